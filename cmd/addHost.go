@@ -4,36 +4,27 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
+var addHostDescription string
+
 // addHostCmd represents the addHost command
 var addHostCmd = &cobra.Command{
-	Use:   "Host",
-	Short: "Add storage host where files are stored",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "host <name>",
+	Aliases: []string{"Host"},
+	Short:   "Add storage host where files are stored",
+	Long: `Add a new host. Names are unique regardless of case.
+
+Example:
+  dupectl add host nas01 --description "Basement NAS"`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("addHost called")
+		hostResource.runAdd(args[0], addHostDescription)
 	},
 }
 
 func init() {
 	addCmd.AddCommand(addHostCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// addHostCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// addHostCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	addHostCmd.Flags().StringVar(&addHostDescription, "description", "", "Description of the host")
 }
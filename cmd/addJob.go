@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addJobSubtree string
+	addJobRehash  []string
+)
+
+// addJobCmd represents the add job command
+var addJobCmd = &cobra.Command{
+	Use:   "job <root-folder-id>",
+	Short: "Queue a scan job for the agents of a root's host",
+	Long: `Queue a scan job on this server. The job is leased by an agent running
+'dupectl agent run' on the host holding the root folder.
+
+By default the whole root folder is scanned. Use --subtree to scan one folder
+and everything under it, or --rehash to hash given files again. Root folder
+IDs are listed by 'dupectl get root'.
+
+Examples:
+  dupectl add job 3
+  dupectl add job 3 --subtree /srv/share/photos
+  dupectl add job 3 --rehash /srv/share/a.iso --rehash /srv/share/b.iso`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAddJob(args[0])
+	},
+}
+
+func init() {
+	addCmd.AddCommand(addJobCmd)
+
+	addJobCmd.Flags().StringVar(&addJobSubtree, "subtree", "", "Scan only this folder of the root")
+	addJobCmd.Flags().StringArrayVar(&addJobRehash, "rehash", nil, "Hash this file of the root again (repeatable)")
+	addJobCmd.MarkFlagsMutuallyExclusive("subtree", "rehash")
+}
+
+func runAddJob(rootArg string) {
+	rootID, err := strconv.ParseInt(rootArg, 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid root folder ID: %s\n", rootArg)
+		os.Exit(1)
+	}
+
+	job := entities.ScanJob{RootFolderID: rootID, Kind: entities.ScanJobRoot}
+	switch {
+	case addJobSubtree != "":
+		job.Kind, job.Path = entities.ScanJobSubtree, addJobSubtree
+	case len(addJobRehash) > 0:
+		job.Kind, job.Paths = entities.ScanJobRehash, addJobRehash
+	}
+
+	_, db := openCatalog()
+	defer db.Close()
+
+	job, err = datastore.InsertScanJob(db, job)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Fprintf(os.Stderr, "Error: Root folder %d not found\n", rootID)
+		os.Exit(1)
+	}
+	if errors.Is(err, datastore.ErrInvalid) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to queue job: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("Queued %s job %d for %s\n", job.Kind, job.ID, jobTarget(&job))
+}
@@ -4,36 +4,27 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
+var addOwnerDescription string
+
 // addOwnerCmd represents the addOwner command
 var addOwnerCmd = &cobra.Command{
-	Use:   "Owner",
-	Short: "Add owner of files/folders",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "owner <name>",
+	Aliases: []string{"Owner"},
+	Short:   "Add owner of files/folders",
+	Long: `Add a new owner. Names are unique regardless of case.
+
+Example:
+  dupectl add owner alice --description "Alice in Finance"`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("addOwner called")
+		ownerResource.runAdd(args[0], addOwnerDescription)
 	},
 }
 
 func init() {
 	addCmd.AddCommand(addOwnerCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// addOwnerCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// addOwnerCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	addOwnerCmd.Flags().StringVar(&addOwnerDescription, "description", "", "Description of the owner")
 }
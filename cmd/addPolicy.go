@@ -4,36 +4,39 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
+var (
+	addPolicyDescription string
+	addPolicyRules       policyRuleFlags
+)
+
 // addPolicyCmd represents the addPolicy command
 var addPolicyCmd = &cobra.Command{
-	Use:   "Policy",
-	Short: "Add Retention Policy",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "policy <name>",
+	Aliases: []string{"Policy"},
+	Short:   "Add retention policy",
+	Long: `Add a new policy. Names are unique regardless of case.
+
+A policy's rules apply to the folders it is assigned to:
+  --priority       keeper selection prefers copies under higher priorities
+  --min-copies     duplicate plans and marks always leave this many copies
+  --max-age-days   copies changed longer ago expire: the policy no longer
+                   retains them
+  --protected      copies may never be marked for deletion
+
+Example:
+  dupectl add policy dr --description "Disaster Recovery" --min-copies 2 --priority 10
+  dupectl add policy archive --description "Long Term Archive" --protected`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("addPolicy called")
+		policyResource.runAdd(args[0], addPolicyDescription, addPolicyRules.edit(cmd))
 	},
 }
 
 func init() {
 	addCmd.AddCommand(addPolicyCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// addPolicyCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// addPolicyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	addPolicyCmd.Flags().StringVar(&addPolicyDescription, "description", "", "Description of the policy")
+	addPolicyRules.register(addPolicyCmd)
 }
@@ -4,36 +4,27 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
+var addPurposeDescription string
+
 // addPurposeCmd represents the addPurpose command
 var addPurposeCmd = &cobra.Command{
-	Use:   "Purpose",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "purpose <name>",
+	Aliases: []string{"Purpose"},
+	Short:   "Add file/folder purpose",
+	Long: `Add a new purpose. Names are unique regardless of case.
+
+Example:
+  dupectl add purpose backup --description "Nightly backup target"`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("addPurpose called")
+		purposeResource.runAdd(args[0], addPurposeDescription)
 	},
 }
 
 func init() {
 	addCmd.AddCommand(addPurposeCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// addPurposeCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// addPurposeCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	addPurposeCmd.Flags().StringVar(&addPurposeDescription, "description", "", "Description of the purpose")
 }
@@ -4,16 +4,22 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var addRootTraverseLinks bool
+var addRootCaseInsensitive bool
 
 // addRootCmd represents the addRoot command
 var addRootCmd = &cobra.Command{
@@ -24,13 +30,29 @@ var addRootCmd = &cobra.Command{
 This operation validates the path exists, checks if it's already registered,
 and adds the root folder record to the database with the specified configuration.
 
+Case sensitivity is detected by probing the filesystem holding the root and
+decides whether paths differing only in case are the same file. Override the
+detection with --case-insensitive=true|false.
+
+In remote mode (--server) the root folder is registered on the server. It
+is a root of this machine, checked and probed here as in local mode, unless
+--host names another host: the path is then sent as given, and the case
+sensitivity is the flag's or else the default.
+
 Example:
   dupectl add root /home/user/documents
-  dupectl add root "C:\Users\user\Documents" --traverse-links`,
+  dupectl add root "C:\Users\user\Documents" --traverse-links
+  dupectl add root /mnt/usb --case-insensitive=true`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		rootPath := args[0]
 
+		// The path of another host can neither be resolved nor checked here
+		if remoteMode() && remoteHost != "" {
+			runRemoteAddRoot(cmd, rootPath)
+			return
+		}
+
 		// Convert relative path to absolute path
 		absPath, err := filepath.Abs(rootPath)
 		if err != nil {
@@ -59,83 +81,110 @@ Example:
 			os.Exit(1)
 		}
 
-		// Open database connection
-		db, err := openDatabaseForAddRoot()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to open database: %v\n", err)
-			os.Exit(1)
+		if remoteMode() {
+			runRemoteAddRoot(cmd, absPath)
+			return
 		}
+
+		_, db := openCatalog()
 		defer db.Close()
 
+		// Root folder paths are unique per host
+		hostID := localHostID(db)
+
 		// Check if root folder already registered
-		var existingID int64
-		err = db.QueryRow("SELECT id FROM root_folders WHERE path = ?", absPath).Scan(&existingID)
+		existing, err := datastore.FindRootFolderByPath(db, hostID, absPath)
 		if err == nil {
-			fmt.Fprintf(os.Stderr, "Error: Root folder already registered: %s\n", absPath)
+			fmt.Fprintf(os.Stderr, "Error: Root folder already registered: %s\n", existing.Path)
 			os.Exit(1)
 		} else if err != sql.ErrNoRows {
 			fmt.Fprintf(os.Stderr, "Error: failed to check for existing root folder: %v\n", err)
 			os.Exit(1)
 		}
 
-		// Insert root folder record
-		result, err := db.Exec(`
-			INSERT INTO root_folders (
-				path, 
-				traverse_links, 
-				folder_count, 
-				file_count, 
-				total_size
-			) VALUES (?, ?, 0, 0, 0)
-		`, absPath, addRootTraverseLinks)
+		// Detect case sensitivity unless explicitly set
+		caseSource := "detected"
+		caseInsensitive := addRootCaseInsensitive
+		if !cmd.Flags().Changed("case-insensitive") {
+			caseInsensitive = detectCaseInsensitive(absPath)
+		} else {
+			caseSource = "set by flag"
+		}
+
+		// The device tells copies on separate disks apart in coverage reports
+		device, err := pathutil.DeviceID(absPath)
+		if err != nil {
+			logger.Warn("Cannot identify the device of %s: %v", absPath, err)
+		}
 
+		// Insert root folder record
+		rootID, err := datastore.InsertRootFolder(db, &datastore.RootFolder{
+			HostID:          hostID,
+			Path:            absPath,
+			TraverseLinks:   addRootTraverseLinks,
+			CaseInsensitive: caseInsensitive,
+			Device:          device,
+		})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: failed to register root folder: %v\n", err)
 			os.Exit(1)
 		}
 
-		rootID, _ := result.LastInsertId()
-
-		// Display confirmation
-		fmt.Printf("Root folder registered: %s\n", absPath)
-		fmt.Println("Configuration:")
-		fmt.Printf("  Traverse Links: %v\n", addRootTraverseLinks)
-		fmt.Println()
-		fmt.Printf("Run 'dupectl scan all %s' to start scanning.\n", absPath)
-
-		if rootID > 0 {
-			fmt.Printf("(Root folder ID: %d)\n", rootID)
-		}
+		printRootRegistered(absPath, caseInsensitive, caseSource, rootID)
 	},
 }
 
-func openDatabaseForAddRoot() (*sql.DB, error) {
-	dbType := viper.GetString("server.database.type")
-	if dbType != "sqlite" {
-		return nil, fmt.Errorf("only SQLite databases are currently supported")
+// runRemoteAddRoot registers the root folder on the server, on the --host
+// host or else on the host of this machine's agent, whose filesystem is
+// probed here for case sensitivity
+func runRemoteAddRoot(cmd *cobra.Command, path string) {
+	req := entities.RootFolderRequest{
+		Host:          remoteHost,
+		Path:          path,
+		TraverseLinks: &addRootTraverseLinks,
 	}
-
-	dbPath := viper.GetString("server.database.sqlite.name")
-	if dbPath == "" {
-		return nil, fmt.Errorf("database path not configured")
+	caseSource := "detected"
+	switch {
+	case cmd.Flags().Changed("case-insensitive"):
+		req.CaseInsensitive = &addRootCaseInsensitive
+		caseSource = "set by flag"
+	case remoteHost == "":
+		caseInsensitive := detectCaseInsensitive(path)
+		req.CaseInsensitive = &caseInsensitive
+	default:
+		caseSource = "default"
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return nil, err
+	root, err := newRemoteClient().CreateRoot(context.Background(), req)
+	if isStatus(err, http.StatusConflict) {
+		fmt.Fprintf(os.Stderr, "Error: Root folder already registered: %s\n", path)
+		os.Exit(1)
 	}
-
-	// Enable foreign keys
-	_, err = db.Exec("PRAGMA foreign_keys = ON")
 	if err != nil {
-		db.Close()
-		return nil, err
+		fmt.Fprintf(os.Stderr, "Error: failed to register root folder: %v\n", err)
+		os.Exit(1)
 	}
+	printRootRegistered(root.Path, root.CaseInsensitive, caseSource, root.ID)
+}
 
-	return db, nil
+// printRootRegistered confirms the registration of a root folder
+func printRootRegistered(path string, caseInsensitive bool, caseSource string, rootID int64) {
+	fmt.Printf("Root folder registered: %s\n", path)
+	fmt.Println("Configuration:")
+	fmt.Printf("  Traverse Links: %v\n", addRootTraverseLinks)
+	fmt.Printf("  Case Insensitive: %v (%s)\n", caseInsensitive, caseSource)
+	fmt.Println()
+	fmt.Printf("Run 'dupectl scan all %s' to start scanning.\n", path)
+
+	if rootID > 0 {
+		fmt.Printf("(Root folder ID: %d)\n", rootID)
+	}
 }
 
 func init() {
 	addCmd.AddCommand(addRootCmd)
 	addRootCmd.Flags().BoolVar(&addRootTraverseLinks, "traverse-links", false, "Follow symbolic links during scans")
+	addRemoteHostFlag(addRootCmd)
+	addRootCmd.Flags().Lookup("host").Usage = "In remote mode, the host of the root folder (default: this machine's host)"
+	addRootCmd.Flags().BoolVar(&addRootCaseInsensitive, "case-insensitive", false, "Treat paths differing only in case as the same file (default: detected)")
 }
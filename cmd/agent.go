@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// agentCmd groups the commands run on scanning agents and the commands
+// managing them on the server
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Run this machine as a scanning agent, or manage agents",
+	Long: `Commands for machines that scan their root folders on behalf of a
+dupectl server, and for managing the agents registered with a server.
+Register the machine first with 'dupectl register'; list agents with
+'dupectl get agent'.`,
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"database/sql"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+// agentApproveCmd represents the agent approve command
+var agentApproveCmd = &cobra.Command{
+	Use:   "approve <id>...",
+	Short: "Approve pending agent registrations",
+	Long: `Approve agents that registered with 'dupectl register' so that their
+credentials are accepted. See 'dupectl get agent' for pending agents.
+
+Example:
+  dupectl agent approve 3`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAgentUpdate(args, "Approved", datastore.ApproveAgent)
+	},
+}
+
+// agentRevokeCmd represents the agent revoke command
+var agentRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>...",
+	Short: "Revoke the credentials of agents",
+	Long: `Revoke the credentials of agents. Their requests are refused at once,
+and the scan jobs they hold are queued again. A revoked agent must register
+and be approved again; the shared API key is left unchanged.
+
+Example:
+  dupectl agent revoke 3`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAgentUpdate(args, "Revoked", datastore.RevokeAgent)
+	},
+}
+
+// agentGrantAdminCmd represents the agent grant-admin command
+var agentGrantAdminCmd = &cobra.Command{
+	Use:   "grant-admin <id>...",
+	Short: "Let approved agents manage the server",
+	Long: `Grant the admin role to approved agents. Remote mode commands run on
+their machine may then manage agents, hosts, root folders and jobs and query
+duplicates through the API. Other agents only push scans and work on the
+jobs they lease.
+
+Example:
+  dupectl agent grant-admin 3`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAgentUpdate(args, "Granted the admin role to", func(db *sql.DB, id int) error {
+			return datastore.SetAgentAdmin(db, id, true)
+		})
+	},
+}
+
+// agentRevokeAdminCmd represents the agent revoke-admin command
+var agentRevokeAdminCmd = &cobra.Command{
+	Use:   "revoke-admin <id>...",
+	Short: "Withdraw the admin role of agents",
+	Long: `Withdraw the admin role of agents. Their admin requests are refused
+at once; they keep pushing scans and working on the jobs they lease.
+
+Example:
+  dupectl agent revoke-admin 3`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAgentUpdate(args, "Withdrew the admin role of", func(db *sql.DB, id int) error {
+			return datastore.SetAgentAdmin(db, id, false)
+		})
+	},
+}
+
+func init() {
+	agentCmd.AddCommand(agentApproveCmd)
+	agentCmd.AddCommand(agentRevokeCmd)
+	agentCmd.AddCommand(agentGrantAdminCmd)
+	agentCmd.AddCommand(agentRevokeAdminCmd)
+}
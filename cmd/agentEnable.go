@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+// agentEnableCmd represents the agent enable command
+var agentEnableCmd = &cobra.Command{
+	Use:   "enable <id>...",
+	Short: "Allow agents to lease scan jobs",
+	Long: `Enable registered agents so that they lease scan jobs again. See
+'dupectl get agent' for their IDs.
+
+Example:
+  dupectl agent enable 3`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAgentUpdate(args, "Enabled", func(db *sql.DB, id int) error {
+			return datastore.SetAgentEnabled(db, id, true)
+		})
+	},
+}
+
+// agentDisableCmd represents the agent disable command
+var agentDisableCmd = &cobra.Command{
+	Use:   "disable <id>...",
+	Short: "Stop agents from leasing scan jobs",
+	Long: `Disable registered agents. They are given no more scan jobs, and the
+jobs they hold are queued again for the other agents of their host. The
+server refuses all their requests but heartbeats, so they abandon the jobs
+they were running and resume once enabled again.
+
+Example:
+  dupectl agent disable 3`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAgentUpdate(args, "Disabled", func(db *sql.DB, id int) error {
+			return datastore.SetAgentEnabled(db, id, false)
+		})
+	},
+}
+
+func init() {
+	agentCmd.AddCommand(agentEnableCmd)
+	agentCmd.AddCommand(agentDisableCmd)
+}
+
+// runAgentUpdate applies update to the agents with the given IDs,
+// reporting each one done with action
+func runAgentUpdate(args []string, action string, update func(db *sql.DB, id int) error) {
+	_, db := openCatalog()
+	defer db.Close()
+
+	failed := false
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err == nil {
+			err = update(db, id)
+		}
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			fmt.Fprintf(os.Stderr, "Error: Agent %s not found\n", arg)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error: Cannot update agent %s: %v\n", arg, err)
+		default:
+			fmt.Printf("%s agent %d\n", action, id)
+			continue
+		}
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
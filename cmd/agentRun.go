@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/internal/config"
+	"github.com/jpconstantineau/dupectl/pkg/apiclient"
+	"github.com/jpconstantineau/dupectl/pkg/checkpoint"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/scanner"
+	"github.com/spf13/cobra"
+)
+
+var (
+	agentRunPoll      time.Duration
+	agentRunLease     time.Duration
+	agentRunHeartbeat time.Duration
+	agentRunOnce      bool
+)
+
+// agentActivity is what the agent reports doing in its heartbeats
+var agentActivity atomic.Value
+
+// agentRunCmd represents the agent run command
+var agentRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Poll the server for scan jobs and run them",
+	Long: `Lease scan jobs for the root folders of this machine's host from the
+server, run them and push the results, polling for more work when the queue
+is empty.
+
+While a job runs, progress is reported regularly to keep its lease. A job
+whose lease expires, e.g. because the agent died, is handed to another agent
+of the host. Interrupting the agent fails its current job so that it is
+queued again.
+
+The agent sends heartbeats with its version, host and current activity; the
+server marks agents that miss them offline. A disabled agent is given no
+jobs and keeps polling until it is enabled again.
+
+Examples:
+  dupectl agent run
+  dupectl agent run --poll 1m --lease 10m
+  dupectl agent run --once`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runAgent()
+	},
+}
+
+func init() {
+	agentCmd.AddCommand(agentRunCmd)
+
+	agentRunCmd.Flags().DurationVar(&agentRunPoll, "poll", 30*time.Second, "Wait between polls when there is no work")
+	agentRunCmd.Flags().DurationVar(&agentRunLease, "lease", 5*time.Minute, "Visibility timeout of leased jobs")
+	agentRunCmd.Flags().DurationVar(&agentRunHeartbeat, "heartbeat", 30*time.Second, "Interval between heartbeats")
+	agentRunCmd.Flags().BoolVar(&agentRunOnce, "once", false, "Exit once the queue is empty")
+}
+
+func runAgent() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to load configuration: %v\n", err)
+		os.Exit(2)
+	}
+	if agentRunLease < 3*time.Second {
+		fmt.Fprintf(os.Stderr, "Error: --lease must be at least 3s\n")
+		os.Exit(1)
+	}
+	if agentRunHeartbeat <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --heartbeat must be positive\n")
+		os.Exit(1)
+	}
+
+	client, err := apiclient.NewClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := checkpoint.SetupSignalHandler(func() {
+		logger.Info("Stopping agent...")
+	})
+	defer cancel()
+
+	agentActivity.Store("")
+	go sendHeartbeats(ctx, client)
+
+	fmt.Println("Agent waiting for scan jobs")
+	refused := "" // Why the server last refused work, logged once
+	for ctx.Err() == nil {
+		job, err := client.LeaseJob(ctx, entities.ScanJobLease{Timeout: int(agentRunLease / time.Second)})
+		var apiErr *apiclient.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden {
+			if apiErr.Message != refused {
+				logger.Warn("Server gives this agent no jobs: %s", apiErr.Message)
+				refused = apiErr.Message
+			}
+			err = nil
+		} else if err != nil && ctx.Err() == nil {
+			logger.Error("Failed to lease a scan job: %v", err)
+		} else {
+			refused = ""
+		}
+		if job != nil {
+			runAgentJob(ctx, client, cfg, job)
+			continue
+		}
+		if err == nil && agentRunOnce {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(agentRunPoll):
+		}
+	}
+}
+
+// runAgentJob runs a leased job and reports how it ended. Reports use
+// their own context so that an interrupted job is still released.
+func runAgentJob(ctx context.Context, client *apiclient.Client, cfg *config.Config, job *entities.ScanJob) {
+	fmt.Printf("Job %d: %s scan of %s\n", job.ID, job.Kind, jobTarget(job))
+	agentActivity.Store(fmt.Sprintf("job %d: %s scan of %s", job.ID, job.Kind, jobTarget(job)))
+	defer agentActivity.Store("")
+
+	report := entities.ScanJobReport{LeaseID: job.LeaseID}
+	var duration string
+	s, err := newJobScanner(client, cfg, job)
+	if err == nil {
+		err = runWithLease(ctx, client, job, s)
+		report.FoldersDone, report.FilesDone, duration = s.GetSummary()
+	}
+
+	reportCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err != nil {
+		fmt.Printf("Job %d failed: %v\n", job.ID, err)
+		report.Error = err.Error()
+		err = client.FailJob(reportCtx, job.ID, report)
+	} else {
+		fmt.Printf("Job %d done in %s: %d folders, %d files\n", job.ID, duration, report.FoldersDone, report.FilesDone)
+		err = client.CompleteJob(reportCtx, job.ID, report)
+	}
+	if err != nil {
+		logger.Error("Failed to report the end of job %d: %v", job.ID, err)
+	}
+}
+
+// sendHeartbeats reports to the server that the agent is alive until ctx is
+// done. Missed heartbeats are only logged: the server marks the agent
+// offline until the next one gets through.
+func sendHeartbeats(ctx context.Context, client *apiclient.Client) {
+	hostname, _ := os.Hostname()
+	enabled := true
+	for {
+		agent, err := client.SendHeartbeat(ctx, entities.AgentHeartbeat{
+			Version:  version,
+			Hostname: hostname,
+			Platform: runtime.GOOS + "/" + runtime.GOARCH,
+			Activity: agentActivity.Load().(string),
+		})
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("Failed to send heartbeat: %v", err)
+		}
+		if err == nil && agent.Enabled != enabled {
+			enabled = agent.Enabled
+			if enabled {
+				logger.Info("Agent %d was enabled on the server", agent.Id)
+			} else {
+				logger.Warn("Agent %d is disabled on the server", agent.Id)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(agentRunHeartbeat):
+		}
+	}
+}
+
+func jobTarget(job *entities.ScanJob) string {
+	switch job.Kind {
+	case entities.ScanJobSubtree:
+		return job.Path
+	case entities.ScanJobRehash:
+		return fmt.Sprintf("%d files under %s", len(job.Paths), job.RootPath)
+	}
+	return job.RootPath
+}
+
+func newJobScanner(client *apiclient.Client, cfg *config.Config, job *entities.ScanJob) (*scanner.Scanner, error) {
+	if _, err := os.Stat(job.RootPath); err != nil {
+		return nil, fmt.Errorf("root folder is not accessible: %w", err)
+	}
+
+	return scanner.NewScanner(nil, &scanner.Config{
+		RootFolderID:    job.RootFolderID,
+		RootPath:        job.RootPath,
+		StartPath:       job.Path,
+		ScanMode:        "all",
+		HashAlgorithm:   cfg.HashAlgorithm,
+		WorkerCount:     cfg.WorkerCount,
+		TraverseLinks:   false, // Default to not following symlinks
+		CaseInsensitive: job.CaseInsensitive,
+		Sink:            scanner.NewRemoteSink(client, job.RootFolderID),
+	})
+}
+
+// runWithLease runs the job's scan while reporting progress often enough to
+// keep the lease. The scan is abandoned if the server withdraws the lease.
+func runWithLease(ctx context.Context, client *apiclient.Client, job *entities.ScanJob, s *scanner.Scanner) error {
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(agentRunLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			folders, files, _ := s.GetSummary()
+			err := client.ReportJobProgress(jobCtx, job.ID,
+				entities.ScanJobReport{LeaseID: job.LeaseID, FoldersDone: folders, FilesDone: files})
+			var apiErr *apiclient.APIError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+				cancel(fmt.Errorf("lease of job %d lost", job.ID))
+				return
+			}
+			if err != nil {
+				logger.Warn("Failed to report progress of job %d: %v", job.ID, err)
+			}
+		}
+	}()
+
+	var err error
+	if job.Kind == entities.ScanJobRehash {
+		err = s.Rehash(jobCtx, job.Paths)
+	} else {
+		err = s.Scan(jobCtx, false)
+	}
+	if cause := context.Cause(jobCtx); err != nil && cause != nil {
+		return cause
+	}
+	return err
+}
@@ -4,36 +4,36 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
+var (
+	applyHostDescription string
+	applyHostRename      string
+)
+
 // applyHostCmd represents the applyHost command
 var applyHostCmd = &cobra.Command{
-	Use:   "Host",
-	Short: "Apply storage host to root folder",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "host <name>",
+	Aliases: []string{"Host"},
+	Short:   "Create or update storage host where files are stored",
+	Long: `Create the host if it does not exist, otherwise update the fields given.
+
+Example:
+  dupectl apply host nas01 --description "Basement NAS"
+  dupectl apply host nas01 --rename nas012`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("applyHost called")
+		var description *string
+		if cmd.Flags().Changed("description") {
+			description = &applyHostDescription
+		}
+		hostResource.runApply(args[0], description, applyHostRename)
 	},
 }
 
 func init() {
 	applyCmd.AddCommand(applyHostCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// applyHostCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// applyHostCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	applyHostCmd.Flags().StringVar(&applyHostDescription, "description", "", "Description of the host")
+	applyHostCmd.Flags().StringVar(&applyHostRename, "rename", "", "New name for the host")
 }
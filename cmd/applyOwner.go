@@ -5,35 +5,64 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	applyOwnerDescription string
+	applyOwnerRename      string
+	applyOwnerFolders     []string
+	applyOwnerUnset       bool
+)
+
 // applyOwnerCmd represents the applyOwner command
 var applyOwnerCmd = &cobra.Command{
-	Use:   "Owner",
-	Short: "Apply owner to files/folders",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	Use:     "owner <name>",
+	Aliases: []string{"Owner"},
+	Short:   "Create or update owner of files/folders, or assign it to folders",
+	Long: `Create the owner if it does not exist, otherwise update the fields given.
+
+With --folder, assign the owner to registered root folders or catalogued
+folders instead. Subfolders inherit the owner of their nearest ancestor
+unless they have their own; --unset removes a folder's own owner.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+Example:
+  dupectl apply owner alice --description "Alice in Finance"
+  dupectl apply owner alice --rename alice2
+  dupectl apply owner alice --folder /data/shared
+  dupectl apply owner --unset --folder /data/shared/archive`,
+	Args: cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("applyOwner called")
+		if applyOwnerUnset {
+			if len(args) != 0 || len(applyOwnerFolders) == 0 {
+				fmt.Fprintf(os.Stderr, "Error: --unset takes no name and requires --folder\n")
+				os.Exit(2)
+			}
+			ownerResource.runAssign("", applyOwnerFolders)
+			return
+		}
+		if len(args) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: owner name is required\n")
+			os.Exit(2)
+		}
+		if len(applyOwnerFolders) > 0 {
+			ownerResource.runAssign(args[0], applyOwnerFolders)
+			return
+		}
+		var description *string
+		if cmd.Flags().Changed("description") {
+			description = &applyOwnerDescription
+		}
+		ownerResource.runApply(args[0], description, applyOwnerRename)
 	},
 }
 
 func init() {
 	applyCmd.AddCommand(applyOwnerCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// applyOwnerCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// applyOwnerCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	applyOwnerCmd.Flags().StringVar(&applyOwnerDescription, "description", "", "Description of the owner")
+	applyOwnerCmd.Flags().StringVar(&applyOwnerRename, "rename", "", "New name for the owner")
+	applyOwnerCmd.Flags().StringArrayVar(&applyOwnerFolders, "folder", nil, "Assign the owner to this root or catalogued folder (repeatable)")
+	applyOwnerCmd.Flags().BoolVar(&applyOwnerUnset, "unset", false, "With --folder, remove the folder's own owner so it is inherited again")
 }
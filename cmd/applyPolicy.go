@@ -5,35 +5,68 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	applyPolicyDescription string
+	applyPolicyRename      string
+	applyPolicyFolders     []string
+	applyPolicyUnset       bool
+	applyPolicyRules       policyRuleFlags
+)
+
 // applyPolicyCmd represents the applyPolicy command
 var applyPolicyCmd = &cobra.Command{
-	Use:   "Policy",
-	Short: "Apply retention policy to files/folders",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	Use:     "policy <name>",
+	Aliases: []string{"Policy"},
+	Short:   "Create or update retention policy, or assign it to folders",
+	Long: `Create the policy if it does not exist, otherwise update the fields
+and rules given (see 'dupectl add policy --help' for the rules).
+
+With --folder, assign the policy to registered root folders or catalogued
+folders instead. Subfolders inherit the policy of their nearest ancestor
+unless they have their own; --unset removes a folder's own policy.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+Example:
+  dupectl apply policy dr --description "Disaster Recovery"
+  dupectl apply policy dr --rename dr2
+  dupectl apply policy dr --min-copies 3 --max-age-days 365
+  dupectl apply policy dr --folder /data/shared
+  dupectl apply policy --unset --folder /data/shared/archive`,
+	Args: cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("applyPolicy called")
+		if applyPolicyUnset {
+			if len(args) != 0 || len(applyPolicyFolders) == 0 {
+				fmt.Fprintf(os.Stderr, "Error: --unset takes no name and requires --folder\n")
+				os.Exit(2)
+			}
+			policyResource.runAssign("", applyPolicyFolders)
+			return
+		}
+		if len(args) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: policy name is required\n")
+			os.Exit(2)
+		}
+		if len(applyPolicyFolders) > 0 {
+			policyResource.runAssign(args[0], applyPolicyFolders)
+			return
+		}
+		var description *string
+		if cmd.Flags().Changed("description") {
+			description = &applyPolicyDescription
+		}
+		policyResource.runApply(args[0], description, applyPolicyRename, applyPolicyRules.edit(cmd))
 	},
 }
 
 func init() {
 	applyCmd.AddCommand(applyPolicyCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// applyPolicyCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// applyPolicyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	applyPolicyCmd.Flags().StringVar(&applyPolicyDescription, "description", "", "Description of the policy")
+	applyPolicyCmd.Flags().StringVar(&applyPolicyRename, "rename", "", "New name for the policy")
+	applyPolicyRules.register(applyPolicyCmd)
+	applyPolicyCmd.Flags().StringArrayVar(&applyPolicyFolders, "folder", nil, "Assign the policy to this root or catalogued folder (repeatable)")
+	applyPolicyCmd.Flags().BoolVar(&applyPolicyUnset, "unset", false, "With --folder, remove the folder's own policy so it is inherited again")
 }
@@ -5,35 +5,64 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	applyPurposeDescription string
+	applyPurposeRename      string
+	applyPurposeFolders     []string
+	applyPurposeUnset       bool
+)
+
 // applyPurposeCmd represents the applyPurpose command
 var applyPurposeCmd = &cobra.Command{
-	Use:   "Purpose",
-	Short: "Apply purpose to files/folders",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	Use:     "purpose <name>",
+	Aliases: []string{"Purpose"},
+	Short:   "Create or update file/folder purpose, or assign it to folders",
+	Long: `Create the purpose if it does not exist, otherwise update the fields given.
+
+With --folder, assign the purpose to registered root folders or catalogued
+folders instead. Subfolders inherit the purpose of their nearest ancestor
+unless they have their own; --unset removes a folder's own purpose.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+Example:
+  dupectl apply purpose backup --description "Nightly backup target"
+  dupectl apply purpose backup --rename backup2
+  dupectl apply purpose backup --folder /data/shared
+  dupectl apply purpose --unset --folder /data/shared/archive`,
+	Args: cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("applyPurpose called")
+		if applyPurposeUnset {
+			if len(args) != 0 || len(applyPurposeFolders) == 0 {
+				fmt.Fprintf(os.Stderr, "Error: --unset takes no name and requires --folder\n")
+				os.Exit(2)
+			}
+			purposeResource.runAssign("", applyPurposeFolders)
+			return
+		}
+		if len(args) != 1 {
+			fmt.Fprintf(os.Stderr, "Error: purpose name is required\n")
+			os.Exit(2)
+		}
+		if len(applyPurposeFolders) > 0 {
+			purposeResource.runAssign(args[0], applyPurposeFolders)
+			return
+		}
+		var description *string
+		if cmd.Flags().Changed("description") {
+			description = &applyPurposeDescription
+		}
+		purposeResource.runApply(args[0], description, applyPurposeRename)
 	},
 }
 
 func init() {
 	applyCmd.AddCommand(applyPurposeCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// applyPurposeCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// applyPurposeCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	applyPurposeCmd.Flags().StringVar(&applyPurposeDescription, "description", "", "Description of the purpose")
+	applyPurposeCmd.Flags().StringVar(&applyPurposeRename, "rename", "", "New name for the purpose")
+	applyPurposeCmd.Flags().StringArrayVar(&applyPurposeFolders, "folder", nil, "Assign the purpose to this root or catalogued folder (repeatable)")
+	applyPurposeCmd.Flags().BoolVar(&applyPurposeUnset, "unset", false, "With --folder, remove the folder's own purpose so it is inherited again")
 }
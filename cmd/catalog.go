@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/jpconstantineau/dupectl/internal/config"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+
+	_ "modernc.org/sqlite"
+)
+
+// openCatalog opens the local catalog database, bringing its schema up to
+// date. Commands without a remote mode refuse to run in remote mode rather
+// than quietly reading a local database.
+func openCatalog() (*config.Config, *sql.DB) {
+	if remoteMode() {
+		fmt.Fprintf(os.Stderr, "Error: This command is not available in remote mode: run it on the server, or without --server\n")
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to load configuration: %v\n", err)
+		os.Exit(2)
+	}
+
+	db, err := sql.Open("sqlite", cfg.DatabasePath+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(ON)")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to open database: %v\n", err)
+		os.Exit(2)
+	}
+
+	if err := datastore.RunMigrations(db); err != nil {
+		db.Close()
+		fmt.Fprintf(os.Stderr, "Error: Failed to run migrations: %v\n", err)
+		os.Exit(2)
+	}
+
+	return cfg, db
+}
+
+// localHostID returns the ID of this machine's host record, which scopes
+// root folder and catalog paths given on the command line
+func localHostID(db *sql.DB) int64 {
+	host, err := datastore.RegisterLocalHost(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to register local host: %v\n", err)
+		os.Exit(2)
+	}
+	return int64(host.Id)
+}
+
+// localRootIDs returns the IDs of the root folders of a host
+func localRootIDs(db *sql.DB, hostID int64) map[int64]bool {
+	roots, err := datastore.GetHostRootFolderIDs(db, hostID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to query root folders: %v\n", err)
+		os.Exit(2)
+	}
+	return roots
+}
+
+// localSet narrows a duplicate set to its copies on the given roots.
+// Remediation only ever acts on, or keeps, copies on this machine's disk.
+func localSet(set *duplicate.DuplicateSet, roots map[int64]bool) *duplicate.DuplicateSet {
+	local := &duplicate.DuplicateSet{Hash: set.Hash, Size: set.Size}
+	for _, file := range set.Files {
+		if roots[file.RootFolderID] {
+			local.Files = append(local.Files, file)
+		}
+	}
+	return local
+}
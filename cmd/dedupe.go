@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jpconstantineau/dupectl/pkg/checkpoint"
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/jpconstantineau/dupectl/pkg/remediate"
+	"github.com/spf13/cobra"
+
+	_ "modernc.org/sqlite"
+)
+
+var (
+	dedupeLink     string
+	dedupeFallback string
+	dedupeSet      string
+	dedupeRules    []string
+	dedupeMinSize  string
+	dedupeDryRun   bool
+	dedupeUndoDry  bool
+)
+
+// dedupeCmd represents the dedupe command
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Replace duplicate copies with links to the kept copy",
+	Long: `Reclaim space by replacing the copies of each duplicate set that the keeper
+rules would remove with links to the kept copy. Every path stays in place.
+Only the copies on this machine's root folders are considered.
+
+Link kinds:
+  hard     hard link to the keeper (same filesystem only)
+  reflink  copy-on-write clone sharing the keeper's extents (btrfs, xfs);
+           refused where unsupported unless --fallback is given
+  symlink  symbolic link to the keeper's absolute path
+
+Each copy is compared byte-for-byte with the keeper first, then a link is
+created next to it and renamed over it, so the path is never missing.
+Every replacement is written to the remediation journal with the copy's
+mode and modification time; 'dupectl dedupe undo <run-id>' turns the links
+back into independent copies.
+
+Examples:
+  dupectl dedupe --link hard --dry-run
+  dupectl dedupe --link reflink --fallback hard --min-size 1M
+  dupectl dedupe --link symlink --set 09e1d4d80f968e45 --rule prefer-root=/data/main`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runDedupe()
+	},
+}
+
+// dedupeUndoCmd represents the dedupe undo command
+var dedupeUndoCmd = &cobra.Command{
+	Use:   "undo <run-id>",
+	Short: "Turn the links of a dedupe run back into independent copies",
+	Long: `Replace each link created by a dedupe run with a copy of the kept file,
+restoring the mode and modification time the replaced copy had.
+
+Links whose content no longer matches the kept file are skipped.
+
+Examples:
+  dupectl dedupe undo 20260101T120000.000000000Z-1a2b3c4d --dry-run
+  dupectl dedupe undo 20260101T120000.000000000Z-1a2b3c4d`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runDedupeUndo(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dedupeCmd)
+	dedupeCmd.AddCommand(dedupeUndoCmd)
+
+	dedupeCmd.Flags().StringVar(&dedupeLink, "link", "", "Link kind: hard, reflink or symlink (required)")
+	dedupeCmd.Flags().StringVar(&dedupeFallback, "fallback", "", "Link kind to use where reflinks are unsupported: hard or symlink")
+	dedupeCmd.Flags().StringVar(&dedupeSet, "set", "", "Only dedupe the set with this hash (or unambiguous hash prefix)")
+	dedupeCmd.Flags().StringArrayVar(&dedupeRules, "rule", nil, "Keeper rule, repeatable and applied in order (overrides duplicates.keeper_rules)")
+	dedupeCmd.Flags().StringVar(&dedupeMinSize, "min-size", "0", "Minimum file size (e.g., 1M, 512K, 1024) - 0 = no minimum")
+	dedupeCmd.Flags().BoolVar(&dedupeDryRun, "dry-run", false, "Compare files and report what would be linked without linking")
+	dedupeCmd.MarkFlagRequired("link")
+
+	dedupeUndoCmd.Flags().BoolVar(&dedupeUndoDry, "dry-run", false, "Report what would be restored without restoring")
+}
+
+func runDedupe() {
+	kind, err := remediate.ParseLinkKind(dedupeLink)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	if dedupeFallback != "" {
+		if kind != remediate.LinkReflink {
+			fmt.Fprintf(os.Stderr, "Error: --fallback only applies to --link %s\n", remediate.LinkReflink)
+			os.Exit(2)
+		}
+		if dedupeFallback != remediate.LinkHard && dedupeFallback != remediate.LinkSymlink {
+			fmt.Fprintf(os.Stderr, "Error: --fallback must be %s or %s\n", remediate.LinkHard, remediate.LinkSymlink)
+			os.Exit(2)
+		}
+	}
+
+	minSize, err := parseSize(dedupeMinSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid --min-size value '%s': %v\n", dedupeMinSize, err)
+		os.Exit(2)
+	}
+
+	cfg, db := openCatalog()
+	defer db.Close()
+
+	planner, err := newKeeperPlanner(cfg, db, dedupeRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Prompt for confirmation unless --yes flag is set
+	if !dedupeDryRun && !rootYes {
+		var response string
+		fmt.Printf("Replace duplicate copies with %s links? (y/n): ", kind)
+		fmt.Scanln(&response)
+
+		if response != "y" && response != "Y" && response != "yes" {
+			fmt.Println("Dedupe cancelled.")
+			return
+		}
+	}
+
+	ctx, cancel := checkpoint.SetupSignalHandler(nil)
+	defer cancel()
+
+	// Links can only be made between copies on this machine's disk
+	hostID := localHostID(db)
+	roots := localRootIDs(db, hostID)
+
+	linker := remediate.NewLinker(db, remediate.LinkOptions{
+		Kind:     kind,
+		Fallback: dedupeFallback,
+		DryRun:   dedupeDryRun,
+	})
+	summary := &remediate.Summary{RunID: linker.RunID()}
+
+	link := func(set *duplicate.DuplicateSet) error {
+		plan, err := planner.Plan(set)
+		if err != nil {
+			return fmt.Errorf("set %s: %w", set.Hash, err)
+		}
+		return linker.LinkSet(ctx, plan, summary, printRemediationResult)
+	}
+
+	detector := duplicate.NewDetector(db)
+	if dedupeSet != "" {
+		set, err := detector.GetSet(dedupeSet)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		set = localSet(set, roots)
+		if len(set.Files) < 2 {
+			fmt.Fprintf(os.Stderr, "Error: Set %s has fewer than two copies on this host\n", set.Hash[:16])
+			os.Exit(1)
+		}
+		err = link(set)
+	} else {
+		_, err = detector.StreamDuplicateSets(duplicate.QueryOptions{MinSize: minSize, HostID: hostID}, link)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Dedupe stopped: %v\n", err)
+	}
+
+	fmt.Println()
+	verb := "Linked"
+	if dedupeDryRun {
+		verb = "Would link"
+	}
+	fmt.Printf("%s %d files (%s reclaimable), %d skipped, %d failed\n",
+		verb, summary.Done, formatBytes(summary.Bytes), summary.Skipped, summary.Failed)
+	if !dedupeDryRun {
+		fmt.Printf("Journal run: %s\n", summary.RunID)
+	}
+
+	if err != nil {
+		os.Exit(2)
+	}
+	if summary.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runDedupeUndo(runID string) {
+	_, db := openCatalog()
+	defer db.Close()
+
+	ctx, cancel := checkpoint.SetupSignalHandler(nil)
+	defer cancel()
+
+	linker := remediate.NewLinker(db, remediate.LinkOptions{DryRun: dedupeUndoDry})
+	summary, err := linker.Undo(ctx, runID, printRemediationResult)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Undo stopped: %v\n", err)
+		if summary == nil {
+			os.Exit(2)
+		}
+	}
+
+	fmt.Println()
+	verb := "Restored"
+	if dedupeUndoDry {
+		verb = "Would restore"
+	}
+	fmt.Printf("%s %d files, %d skipped, %d failed\n", verb, summary.Done, summary.Skipped, summary.Failed)
+	if !dedupeUndoDry && summary.Done+summary.Skipped+summary.Failed > 0 {
+		fmt.Printf("Journal run: %s\n", summary.RunID)
+	}
+
+	if err != nil {
+		os.Exit(2)
+	}
+	if summary.Failed > 0 {
+		os.Exit(1)
+	}
+}
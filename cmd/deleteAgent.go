@@ -4,36 +4,59 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
 
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
 	"github.com/spf13/cobra"
 )
 
 // deleteAgentCmd represents the deleteAgent command
 var deleteAgentCmd = &cobra.Command{
-	Use:   "Agent",
-	Short: "Remove agent from list of scanners",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "agent <id>...",
+	Aliases: []string{"Agent"},
+	Short:   "Remove agent from list of scanners",
+	Long: `Delete registered agents. Scan jobs they hold are queued again for the
+other agents of their host. A deleted agent that is still running is refused
+work until it registers again; use 'dupectl agent disable' to keep it out.
+
+Example:
+  dupectl delete agent 3`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("deleteAgent called")
+		runDeleteAgent(args)
 	},
 }
 
 func init() {
 	deleteCmd.AddCommand(deleteAgentCmd)
+}
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// deleteAgentCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// deleteAgentCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+func runDeleteAgent(args []string) {
+	_, db := openCatalog()
+	defer db.Close()
+
+	failed := false
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err == nil {
+			err = datastore.DeleteAgent(db, id)
+		}
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			fmt.Fprintf(os.Stderr, "Error: Agent %s not found\n", arg)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error: Cannot delete agent %s: %v\n", arg, err)
+		default:
+			fmt.Printf("Deleted agent %d\n", id)
+			continue
+		}
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
 }
@@ -4,36 +4,25 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
 // deleteHostCmd represents the deleteHost command
 var deleteHostCmd = &cobra.Command{
-	Use:   "Host",
-	Short: "Delete Host where files are stored",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "host <name>...",
+	Aliases: []string{"Host"},
+	Short:   "Delete storage host where files are stored",
+	Long: `Delete hosts by name.
+
+Example:
+  dupectl delete host nas01
+  dupectl delete host nas01 --yes`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("deleteHost called")
+		hostResource.runDelete(args)
 	},
 }
 
 func init() {
 	deleteCmd.AddCommand(deleteHostCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// deleteHostCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// deleteHostCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+// deleteJobCmd represents the delete job command
+var deleteJobCmd = &cobra.Command{
+	Use:   "job <id>...",
+	Short: "Delete scan jobs that no agent holds",
+	Long: `Delete scan jobs from this server's queue. Jobs currently leased by an
+agent cannot be deleted until their lease ends.
+
+Example:
+  dupectl delete job 12 13`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runDeleteJob(args)
+	},
+}
+
+func init() {
+	deleteCmd.AddCommand(deleteJobCmd)
+}
+
+func runDeleteJob(args []string) {
+	_, db := openCatalog()
+	defer db.Close()
+
+	failed := false
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err == nil {
+			err = datastore.DeleteScanJob(db, id)
+		}
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			fmt.Fprintf(os.Stderr, "Error: Job %s not found\n", arg)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error: Cannot delete job %s: %v\n", arg, err)
+		default:
+			fmt.Printf("Deleted job %d\n", id)
+			continue
+		}
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
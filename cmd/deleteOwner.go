@@ -4,36 +4,25 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
 // deleteOwnerCmd represents the deleteOwner command
 var deleteOwnerCmd = &cobra.Command{
-	Use:   "Owner",
-	Short: "Delete owner of files/folders",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "owner <name>...",
+	Aliases: []string{"Owner"},
+	Short:   "Delete owner of files/folders",
+	Long: `Delete owners by name.
+
+Example:
+  dupectl delete owner alice
+  dupectl delete owner alice --yes`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("deleteOwner called")
+		ownerResource.runDelete(args)
 	},
 }
 
 func init() {
 	deleteCmd.AddCommand(deleteOwnerCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// deleteOwnerCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// deleteOwnerCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
@@ -4,36 +4,25 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
 // deletePolicyCmd represents the deletePolicy command
 var deletePolicyCmd = &cobra.Command{
-	Use:   "Policy",
-	Short: "Delete Retention Policy",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "policy <name>...",
+	Aliases: []string{"Policy"},
+	Short:   "Delete retention policy",
+	Long: `Delete policies by name.
+
+Example:
+  dupectl delete policy dr
+  dupectl delete policy dr --yes`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("deletePolicy called")
+		policyResource.runDelete(args)
 	},
 }
 
 func init() {
 	deleteCmd.AddCommand(deletePolicyCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// deletePolicyCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// deletePolicyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
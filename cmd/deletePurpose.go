@@ -4,36 +4,25 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
 // deletePurposeCmd represents the deletePurpose command
 var deletePurposeCmd = &cobra.Command{
-	Use:   "Purpose",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "purpose <name>...",
+	Aliases: []string{"Purpose"},
+	Short:   "Delete file/folder purpose",
+	Long: `Delete purposes by name.
+
+Example:
+  dupectl delete purpose backup
+  dupectl delete purpose backup --yes`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("deletePurpose called")
+		purposeResource.runDelete(args)
 	},
 }
 
 func init() {
 	deleteCmd.AddCommand(deletePurposeCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// deletePurposeCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// deletePurposeCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
@@ -5,14 +5,15 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // deleteRootCmd represents the deleteRoot command
@@ -23,6 +24,7 @@ var deleteRootCmd = &cobra.Command{
 
 This operation deletes the root folder record from the database, which CASCADE deletes
 all associated folders, files, and scan state. This action cannot be undone.
+In remote mode (--server) the root folder is deleted on the server.
 
 Example:
   dupectl delete root /path/to/root
@@ -36,22 +38,22 @@ Example:
 			os.Exit(1)
 		}
 
-		// Open database connection
-		db, err := openDatabaseForDeleteRoot()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to open database: %v\n", err)
-			os.Exit(1)
+		if remoteMode() {
+			runRemoteDeleteRoot(absPath)
+			return
 		}
+
+		_, db := openCatalog()
 		defer db.Close()
 
-		// Check if root folder exists and get its statistics
+		// Check if root folder exists on this host and get its statistics
 		var rootID int64
 		var folderCount, fileCount, totalSize int64
 		err = db.QueryRow(`
 			SELECT id, folder_count, file_count, total_size 
 			FROM root_folders 
-			WHERE path = ?
-		`, absPath).Scan(&rootID, &folderCount, &fileCount, &totalSize)
+			WHERE host_id = ? AND path = ?
+		`, localHostID(db), absPath).Scan(&rootID, &folderCount, &fileCount, &totalSize)
 
 		if err == sql.ErrNoRows {
 			fmt.Fprintf(os.Stderr, "Error: Root folder not registered: %s\n", absPath)
@@ -61,63 +63,60 @@ Example:
 			os.Exit(1)
 		}
 
-		// Prompt for confirmation unless --yes flag is set
-		if !rootYes {
-			fmt.Printf("Delete root folder and all scan data? (y/n): ")
-			reader := bufio.NewReader(os.Stdin)
-			response, err := reader.ReadString('\n')
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-				os.Exit(1)
-			}
-
-			response = strings.TrimSpace(strings.ToLower(response))
-			if response != "y" && response != "yes" {
-				fmt.Println("Deletion cancelled.")
-				os.Exit(0)
-			}
-		}
+		confirmDeleteRoot()
 
 		// Delete root folder (CASCADE will delete folders, files, scan_state)
-		_, err = db.Exec("DELETE FROM root_folders WHERE id = ?", rootID)
-		if err != nil {
+		if err := datastore.DeleteRootFolder(db, rootID); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: failed to delete root folder: %v\n", err)
 			os.Exit(1)
 		}
 
-		// Display confirmation
-		fmt.Printf("Root folder deleted: %s\n", absPath)
-		fmt.Printf("Removed: %s folders, %s files, %s of scan data\n",
-			formatNumberForDelete(folderCount),
-			formatNumberForDelete(fileCount),
-			formatBytesForDelete(totalSize))
+		printRootDeleted(absPath, folderCount, fileCount, totalSize)
 	},
 }
 
-func openDatabaseForDeleteRoot() (*sql.DB, error) {
-	dbType := viper.GetString("server.database.type")
-	if dbType != "sqlite" {
-		return nil, fmt.Errorf("only SQLite databases are currently supported")
-	}
+// runRemoteDeleteRoot deletes the root folder and its scan data on the server
+func runRemoteDeleteRoot(absPath string) {
+	ctx := context.Background()
+	client := newRemoteClient()
+	root := findRemoteRoot(ctx, client, absPath)
 
-	dbPath := viper.GetString("server.database.sqlite.name")
-	if dbPath == "" {
-		return nil, fmt.Errorf("database path not configured")
+	confirmDeleteRoot()
+
+	if err := client.DeleteRoot(ctx, root.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to delete root folder: %v\n", err)
+		os.Exit(1)
 	}
+	printRootDeleted(root.Path, root.FolderCount, root.FileCount, root.TotalSizeBytes)
+}
 
-	db, err := sql.Open("sqlite", dbPath)
+// confirmDeleteRoot prompts for confirmation unless --yes is set, exiting
+// when the deletion is declined
+func confirmDeleteRoot() {
+	if rootYes {
+		return
+	}
+	fmt.Printf("Delete root folder and all scan data? (y/n): ")
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
 	if err != nil {
-		return nil, err
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		os.Exit(1)
 	}
 
-	// Enable foreign keys to ensure CASCADE works
-	_, err = db.Exec("PRAGMA foreign_keys = ON")
-	if err != nil {
-		db.Close()
-		return nil, err
+	response = strings.TrimSpace(strings.ToLower(response))
+	if response != "y" && response != "yes" {
+		fmt.Println("Deletion cancelled.")
+		os.Exit(0)
 	}
+}
 
-	return db, nil
+func printRootDeleted(path string, folderCount, fileCount, totalSize int64) {
+	fmt.Printf("Root folder deleted: %s\n", path)
+	fmt.Printf("Removed: %s folders, %s files, %s of scan data\n",
+		formatNumberForDelete(folderCount),
+		formatNumberForDelete(fileCount),
+		formatBytesForDelete(totalSize))
 }
 
 func formatNumberForDelete(n int64) string {
@@ -152,4 +151,5 @@ func formatBytesForDelete(bytes int64) string {
 
 func init() {
 	deleteCmd.AddCommand(deleteRootCmd)
+	addRemoteHostFlag(deleteRootCmd)
 }
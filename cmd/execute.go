@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// executeCmd represents the execute command
+var executeCmd = &cobra.Command{
+	Use:   "execute",
+	Short: "Carry out remediation of marked files",
+	Long: `Carry out remediation actions on files in the deletion workflow.
+
+Every file is re-checked immediately before it is touched and every action
+is recorded in the remediation journal.`,
+}
+
+func init() {
+	rootCmd.AddCommand(executeCmd)
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jpconstantineau/dupectl/pkg/checkpoint"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/remediate"
+	"github.com/spf13/cobra"
+
+	_ "modernc.org/sqlite"
+)
+
+var (
+	executeDeletionsMode     string
+	executeDeletionsDryRun   bool
+	executeDeletionsMaxBytes string
+	executeDeletionsMaxFiles int
+)
+
+// executeDeletionsCmd represents the execute deletions command
+var executeDeletionsCmd = &cobra.Command{
+	Use:   "deletions",
+	Short: "Delete files marked for deletion",
+	Long: `Delete files marked with 'dupectl mark', then remove marked folders left empty.
+
+Before each file is deleted dupectl checks that:
+  - its duplicate set was verified byte-for-byte ('dupectl verify duplicates')
+  - its size and modification time still match the catalog
+  - its content still hashes to the catalogued value
+  - another verified, unchanged copy that is not marked still exists
+
+Files failing a check are skipped and stay marked. Each deleted file moves
+through Ready for Deletion and Deleting to Deleted, and every action is
+written to the remediation journal with the path of the copy that was kept.
+
+With --mode quarantine (or remediation.mode: quarantine in the configuration)
+files are moved to <root>/.dupectl-quarantine/<run>/<relative path> instead
+of being deleted; see 'dupectl quarantine' to restore or expire them.
+
+Examples:
+  dupectl execute deletions --dry-run
+  dupectl execute deletions --mode quarantine
+  dupectl execute deletions --max-bytes 10G
+  dupectl execute deletions --max-files 100 --yes`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runExecuteDeletions()
+	},
+}
+
+func init() {
+	executeCmd.AddCommand(executeDeletionsCmd)
+
+	executeDeletionsCmd.Flags().StringVar(&executeDeletionsMode, "mode", "", "Remediation mode: delete or quarantine (default from remediation.mode)")
+	executeDeletionsCmd.Flags().BoolVar(&executeDeletionsDryRun, "dry-run", false, "Run all checks and report what would be deleted without deleting")
+	executeDeletionsCmd.Flags().StringVar(&executeDeletionsMaxBytes, "max-bytes", "0", "Stop after deleting this much data (e.g., 10G, 512M) - 0 = no limit")
+	executeDeletionsCmd.Flags().IntVar(&executeDeletionsMaxFiles, "max-files", 0, "Stop after deleting this many files - 0 = no limit")
+}
+
+func runExecuteDeletions() {
+	maxBytes, err := parseSize(executeDeletionsMaxBytes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid --max-bytes value '%s': %v\n", executeDeletionsMaxBytes, err)
+		os.Exit(2)
+	}
+
+	cfg, db := openCatalog()
+	defer db.Close()
+
+	modeName := cfg.RemediationMode
+	if executeDeletionsMode != "" {
+		modeName = executeDeletionsMode
+	}
+	mode, err := remediate.ParseMode(modeName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	hostID := localHostID(db)
+	files, err := datastore.GetMarkedFiles(db, hostID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to query marked files: %v\n", err)
+		os.Exit(2)
+	}
+	if len(files) == 0 {
+		fmt.Println("No files marked for deletion.")
+		return
+	}
+
+	// Prompt for confirmation unless --yes flag is set
+	if !executeDeletionsDryRun && !rootYes {
+		var response string
+		if mode == remediate.ModeQuarantine {
+			fmt.Printf("Move up to %d marked files to quarantine? (y/n): ", len(files))
+		} else {
+			fmt.Printf("Delete up to %d marked files from disk? This cannot be undone. (y/n): ", len(files))
+		}
+		fmt.Scanln(&response)
+
+		if response != "y" && response != "Y" && response != "yes" {
+			fmt.Println("Deletion cancelled.")
+			return
+		}
+	}
+
+	ctx, cancel := checkpoint.SetupSignalHandler(nil)
+	defer cancel()
+
+	executor := remediate.NewExecutor(db, remediate.Options{
+		Mode:     mode,
+		DryRun:   executeDeletionsDryRun,
+		MaxBytes: maxBytes,
+		MaxFiles: executeDeletionsMaxFiles,
+		HostID:   hostID,
+	})
+
+	summary, err := executor.ExecuteDeletions(ctx, printRemediationResult)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Deletion run stopped: %v\n", err)
+		if summary == nil {
+			os.Exit(2)
+		}
+	}
+
+	fmt.Println()
+	verb := "Deleted"
+	if mode == remediate.ModeQuarantine {
+		verb = "Quarantined"
+	}
+	if executeDeletionsDryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d entries (%s), %d skipped, %d failed\n",
+		verb, summary.Done, formatBytes(summary.Bytes), summary.Skipped, summary.Failed)
+	if summary.Capped {
+		fmt.Println("Stopped at the --max-bytes/--max-files limit; run again to continue.")
+	}
+	if !executeDeletionsDryRun {
+		fmt.Printf("Journal run: %s\n", summary.RunID)
+	}
+
+	if err != nil {
+		os.Exit(2)
+	}
+	if summary.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// printRemediationResult prints one line per remediated file or folder
+func printRemediationResult(r *remediate.Result) {
+	symbol := "✓"
+	switch r.Result {
+	case datastore.JournalResultSkipped:
+		symbol = "⚠"
+	case datastore.JournalResultFailed:
+		symbol = "✗"
+	}
+
+	fmt.Printf("%s %-14s %s", symbol, r.Action, r.Path)
+	if r.KeeperPath != "" && r.Result == datastore.JournalResultDone {
+		fmt.Printf(" (kept %s)", r.KeeperPath)
+	}
+	if r.Detail != "" && r.Result != datastore.JournalResultDone {
+		fmt.Printf(": %s", r.Detail)
+	}
+	fmt.Println()
+}
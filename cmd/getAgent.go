@@ -4,36 +4,96 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"time"
 
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
 	"github.com/spf13/cobra"
 )
 
+var getAgentJSON bool
+
 // getAgentCmd represents the getAgent command
 var getAgentCmd = &cobra.Command{
-	Use:   "Agent",
-	Short: "List registered agents and show their statuses",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "agent",
+	Aliases: []string{"Agent", "agents"},
+	Short:   "List registered agents and show their statuses",
+	Long: `List the agents registered with this server, newest first, with the
+approval of their registration, their status, whether they may lease scan
+jobs and what their last heartbeat reported. Agents that missed their
+heartbeats for server.agent_timeout are shown as not ready.
+
+Example:
+  dupectl get agent
+  dupectl get agent --json`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("getAgent called")
+		runGetAgent()
 	},
 }
 
 func init() {
 	getCmd.AddCommand(getAgentCmd)
+	getAgentCmd.Flags().BoolVar(&getAgentJSON, "json", false, "Output in JSON format")
+}
+
+func runGetAgent() {
+	_, db := openCatalog()
+	defer db.Close()
+
+	if _, err := datastore.MarkStaleAgentsOffline(db, datastore.AgentHeartbeatTimeout()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to update agent statuses: %v\n", err)
+		os.Exit(2)
+	}
+	agents, err := datastore.GetAgents(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to list agents: %v\n", err)
+		os.Exit(2)
+	}
+
+	if getAgentJSON {
+		data, err := json.MarshalIndent(agents, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to marshal JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
 
-	// Here you will define your flags and configuration settings.
+	if len(agents) == 0 {
+		fmt.Println("No agents registered.")
+		return
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// getAgentCmd.PersistentFlags().String("foo", "", "A help for foo")
+	hosts := map[int]string{}
+	if list, err := datastore.GetHosts(db); err == nil {
+		for _, h := range list {
+			hosts[h.Id] = h.Name
+		}
+	}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// getAgentCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	fmt.Printf("%-4s  %-20s  %-12s  %-8s  %-5s  %-10s  %-7s  %-8s  %-19s  %s\n",
+		"ID", "Name", "Host", "Approval", "Role", "Status", "Enabled", "Version", "Last seen", "Activity")
+	fmt.Println("───────────────────────────────────────────────────────────────────────────────────────────────────────────────────")
+	for _, a := range agents {
+		enabled := "no"
+		if a.Enabled {
+			enabled = "yes"
+		}
+		role := auth.RoleAgent
+		if a.Admin {
+			role = auth.RoleAdmin
+		}
+		activity := a.Activity
+		if activity == "" {
+			activity = "-"
+		}
+		fmt.Printf("%-4d  %-20s  %-12s  %-8s  %-5s  %-10s  %-7s  %-8s  %-19s  %s\n",
+			a.Id, a.Name, hosts[a.HostID], a.Approval, role, a.Status.String(), enabled, a.Version,
+			a.Updated.Format(time.DateTime), activity)
+	}
 }
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jpconstantineau/dupectl/pkg/coverage"
+	"github.com/spf13/cobra"
+
+	_ "modernc.org/sqlite"
+)
+
+var (
+	coverageJSON      bool
+	coverageMinCopies int
+)
+
+// getCoverageCmd represents the get coverage command
+var getCoverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "List files with fewer copies than required",
+	Long: `List catalogued files whose content exists in fewer places than required,
+the opposite of a duplicate report.
+
+A file requires the minimum number of copies of its retention policy
+(see 'dupectl add policy --help'), or --min-copies when that is higher.
+Copies are counted by distinct host and device: two copies on the same
+disk count once. Totals are given per owner, purpose and root folder.
+
+Examples:
+  dupectl get coverage
+  dupectl get coverage --min-copies 2
+  dupectl get coverage --json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runGetCoverage()
+	},
+}
+
+func init() {
+	getCmd.AddCommand(getCoverageCmd)
+
+	getCoverageCmd.Flags().BoolVar(&coverageJSON, "json", false, "Output in JSON format")
+	getCoverageCmd.Flags().IntVar(&coverageMinCopies, "min-copies", 0, "Copies required of every file, in addition to policy minimums")
+}
+
+func runGetCoverage() {
+	if coverageMinCopies < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --min-copies must not be negative\n")
+		os.Exit(2)
+	}
+
+	_, db := openCatalog()
+	defer db.Close()
+
+	report, err := coverage.NewAnalyzer(db).Analyze(coverage.Options{MinCopies: coverageMinCopies})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to analyze coverage: %v\n", err)
+		os.Exit(2)
+	}
+
+	if coverageJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to marshal JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if report.Checked == 0 {
+		fmt.Println("No files require more than one copy. Set --min-copies on a policy, or use --min-copies.")
+		return
+	}
+
+	if len(report.Files) > 0 {
+		var totalSize int64
+		fmt.Printf("%-8s  %-6s  %-10s  %s\n", "Copies", "Paths", "Size", "Path")
+		fmt.Println(strings.Repeat("─", 78))
+		for _, f := range report.Files {
+			fmt.Printf("%-8s  %-6d  %-10s  %s%s\n", fmt.Sprintf("%d/%d", f.Copies, f.Required),
+				f.Paths, formatBytes(f.Size), f.Path, coverageLabel(f))
+			totalSize += f.Size
+		}
+		fmt.Println()
+		printCoverageTotals("owner", report.ByOwner)
+		printCoverageTotals("purpose", report.ByPurpose)
+		printCoverageTotals("root folder", report.ByRoot)
+		fmt.Printf("Total: %d of %d files lack copies (%s)\n", len(report.Files), report.Checked, formatBytes(totalSize))
+	} else {
+		fmt.Printf("All %d files requiring copies have enough.\n", report.Checked)
+	}
+	if report.Unhashed > 0 {
+		fmt.Printf("%d files have not been hashed yet and were not compared; run 'dupectl scan all'.\n", report.Unhashed)
+	}
+}
+
+// coverageLabel describes the metadata of an under-covered file
+func coverageLabel(f coverage.File) string {
+	var parts []string
+	if f.Owner != "" {
+		parts = append(parts, "owner: "+f.Owner)
+	}
+	if f.Purpose != "" {
+		parts = append(parts, "purpose: "+f.Purpose)
+	}
+	if f.Policy != "" {
+		parts = append(parts, "policy: "+f.Policy)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "  (" + strings.Join(parts, ", ") + ")"
+}
+
+func printCoverageTotals(group string, totals []coverage.Total) {
+	fmt.Printf("By %s:\n", group)
+	for _, t := range totals {
+		fmt.Printf("  %-40s  %6d files  %10s\n", t.Name, t.Files, formatBytes(t.Bytes))
+	}
+	fmt.Println()
+}
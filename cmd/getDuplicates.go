@@ -4,22 +4,37 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 
 	"github.com/jpconstantineau/dupectl/internal/config"
+	"github.com/jpconstantineau/dupectl/pkg/apiclient"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
 	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
 	"github.com/spf13/cobra"
-
-	_ "modernc.org/sqlite"
 )
 
+// remoteDuplicatesPage is the number of sets requested per page in remote
+// mode, the most the server returns
+const remoteDuplicatesPage = 1000
+
 var (
 	duplicatesJSON     bool
 	duplicatesDetails  bool
 	duplicatesMinCount int
 	duplicatesMinSize  string
+	duplicatesRoot     string
+	duplicatesPath     string
+	duplicatesSort     string
+	duplicatesLimit    int
+	duplicatesAfter    string
+	duplicatesPlan     bool
+	duplicatesRules    []string
+	duplicatesScript   string
+	duplicatesLink     string
 )
 
 // getDuplicatesCmd represents the getDuplicates command
@@ -30,7 +45,8 @@ var getDuplicatesCmd = &cobra.Command{
 Supports summary and detailed views, with table and JSON output formats.
 
 By default, shows a summary table grouped by root folder.
-Use --details to see individual file paths.
+Use --details to see individual file paths. In remote mode (--server) the
+server's duplicates are listed; --plan is only available locally.
 
 Examples:
   dupectl get duplicates                      # Summary view (default)
@@ -39,7 +55,26 @@ Examples:
   dupectl get duplicates --min-count 3        # Only sets with 3+ files
   dupectl get duplicates --min-size 1M        # 1 megabyte minimum
   dupectl get duplicates --min-size 512K      # 512 kilobytes minimum
-  dupectl get duplicates --min-size 1048576   # bytes also supported`,
+  dupectl get duplicates --min-size 1048576   # bytes also supported
+  dupectl get duplicates --root /data         # Sets with a copy in a root folder
+  dupectl get duplicates --path /data/photos  # Sets with a copy under a path
+  dupectl get duplicates --sort reclaimable   # Most space to reclaim first
+  dupectl get duplicates --details --limit 100             # First page of 100 sets
+  dupectl get duplicates --details --limit 100 --after <c> # Next page
+  dupectl get duplicates --plan                            # Preview which copy is kept
+  dupectl get duplicates --plan --rule prefer-root=/data/master --rule oldest
+  dupectl get duplicates --plan --script bash > remediate.sh
+  dupectl get duplicates --plan --script powershell --link hard > remediate.ps1
+
+With --script the plan is written as a shell script that removes (or, with
+--link, links) each copy that is not kept. Before touching a copy the script
+re-checks its size and hash, and those of the kept copy, and aborts at the
+first mismatch.
+
+Keeper rules are applied in order until a single copy remains; remaining
+ties keep the lexically smallest path. Rules default to the
+duplicates.keeper_rules configuration value:
+` + duplicate.KeeperRuleHelp,
 	Run: func(cmd *cobra.Command, args []string) {
 		runGetDuplicates()
 	},
@@ -47,21 +82,24 @@ Examples:
 
 func init() {
 	getCmd.AddCommand(getDuplicatesCmd)
+	addRemoteHostFlag(getDuplicatesCmd)
 
 	getDuplicatesCmd.Flags().BoolVar(&duplicatesJSON, "json", false, "Output in JSON format")
 	getDuplicatesCmd.Flags().BoolVar(&duplicatesDetails, "details", false, "Show detailed view with individual file paths")
 	getDuplicatesCmd.Flags().IntVar(&duplicatesMinCount, "min-count", 2, "Minimum number of duplicates in a set")
 	getDuplicatesCmd.Flags().StringVar(&duplicatesMinSize, "min-size", "0", "Minimum file size (e.g., 1M, 512K, 1024) - 0 = no minimum")
+	getDuplicatesCmd.Flags().StringVar(&duplicatesRoot, "root", "", "Only sets with a copy in this root folder")
+	getDuplicatesCmd.Flags().StringVar(&duplicatesPath, "path", "", "Only sets with a copy at or beneath this path")
+	getDuplicatesCmd.Flags().StringVar(&duplicatesSort, "sort", duplicate.SortBySize, "Sort order: size or reclaimable")
+	getDuplicatesCmd.Flags().IntVar(&duplicatesLimit, "limit", 0, "Maximum number of duplicate sets to return - 0 = no limit")
+	getDuplicatesCmd.Flags().StringVar(&duplicatesAfter, "after", "", "Return sets after this cursor (printed when more results are available)")
+	getDuplicatesCmd.Flags().BoolVar(&duplicatesPlan, "plan", false, "Preview which copy of each set is kept and which are removed")
+	getDuplicatesCmd.Flags().StringArrayVar(&duplicatesRules, "rule", nil, "Keeper rule, repeatable and applied in order (overrides duplicates.keeper_rules)")
+	getDuplicatesCmd.Flags().StringVar(&duplicatesScript, "script", "", "With --plan, emit a reviewable remediation script: bash or powershell")
+	getDuplicatesCmd.Flags().StringVar(&duplicatesLink, "link", "", "With --script, link copies to the keeper instead of removing them: hard, reflink or symlink")
 }
 
 func runGetDuplicates() {
-	// Load configuration
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to load configuration: %v\n", err)
-		os.Exit(2)
-	}
-
 	// Parse minimum size
 	minSize, err := parseSize(duplicatesMinSize)
 	if err != nil {
@@ -69,43 +107,251 @@ func runGetDuplicates() {
 		os.Exit(2)
 	}
 
-	// Open database
-	db, err := sql.Open("sqlite", cfg.DatabasePath+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(ON)")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to open database: %v\n", err)
+	if duplicatesScript != "" && !duplicatesPlan {
+		fmt.Fprintf(os.Stderr, "Error: --script requires --plan\n")
 		os.Exit(2)
 	}
+	if duplicatesLink != "" && duplicatesScript == "" {
+		fmt.Fprintf(os.Stderr, "Error: --link requires --script\n")
+		os.Exit(2)
+	}
+
+	// Resolve the path filter
+	var pathPrefix string
+	if duplicatesPath != "" {
+		absPath, err := pathutil.ToAbsolute(duplicatesPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid --path value: %v\n", err)
+			os.Exit(2)
+		}
+		pathPrefix = pathutil.NormalizePathForStorage(absPath)
+	}
+	if !duplicate.ValidSort(duplicatesSort) {
+		fmt.Fprintf(os.Stderr, "Error: Invalid --sort value '%s': use size or reclaimable\n", duplicatesSort)
+		os.Exit(2)
+	}
+
+	// Parse pagination cursor
+	var after *duplicate.Cursor
+	if duplicatesAfter != "" {
+		after, err = duplicate.ParseCursor(duplicatesAfter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid --after value: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	if remoteMode() {
+		if duplicatesPlan {
+			fmt.Fprintf(os.Stderr, "Error: --plan is not available in remote mode: run it on the server, or without --server\n")
+			os.Exit(2)
+		}
+		runRemoteDuplicates(minSize, pathPrefix)
+		return
+	}
+
+	cfg, db := openCatalog()
 	defer db.Close()
 
-	// Create detector
+	// Resolve the root filter on this host
+	var rootFolderID int64
+	if duplicatesRoot != "" {
+		absPath, err := pathutil.ToAbsolute(duplicatesRoot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid --root path: %v\n", err)
+			os.Exit(2)
+		}
+		root, err := datastore.FindRootFolderByPath(db, localHostID(db), pathutil.NormalizePathForStorage(absPath))
+		if err == sql.ErrNoRows {
+			fmt.Fprintf(os.Stderr, "Error: Root folder not registered: %s\n", absPath)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to query root folder: %v\n", err)
+			os.Exit(2)
+		}
+		rootFolderID = root.ID
+	}
+
 	detector := duplicate.NewDetector(db)
+	opts := duplicate.QueryOptions{
+		MinCount:     duplicatesMinCount,
+		MinSize:      minSize,
+		RootFolderID: rootFolderID,
+		PathPrefix:   pathPrefix,
+		Sort:         duplicatesSort,
+		Limit:        duplicatesLimit,
+		After:        after,
+	}
 
-	// Find duplicates
-	sets, err := detector.FindDuplicateFiles(duplicatesMinCount, minSize)
+	// Select output writer
+	formatter := duplicate.NewFormatter()
+	var writer duplicate.SetWriter
+	if duplicatesPlan {
+		planner, err := newKeeperPlanner(cfg, db, duplicatesRules)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		if duplicatesScript != "" {
+			writer, err = formatter.NewPlanScriptWriter(os.Stdout, planner, duplicate.ScriptOptions{
+				Shell: duplicatesScript,
+				Link:  duplicatesLink,
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(2)
+			}
+		} else if duplicatesJSON {
+			writer = formatter.NewPlanJSONWriter(os.Stdout, planner)
+		} else {
+			writer = formatter.NewPlanTableWriter(os.Stdout, planner)
+		}
+	} else {
+		// The detailed view is headed by the number of sets
+		total := 0
+		if duplicatesDetails && !duplicatesJSON {
+			if total, err = detector.CountDuplicateSets(opts); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to find duplicates: %v\n", err)
+				os.Exit(2)
+			}
+		}
+		writer = newDuplicatesWriter(formatter, total)
+	}
+
+	// Views listing individual files show their effective owner, purpose and policy
+	if duplicatesScript == "" && (duplicatesPlan || duplicatesJSON || duplicatesDetails) {
+		resolver, err := datastore.NewMetadataResolver(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to load metadata: %v\n", err)
+			os.Exit(2)
+		}
+		writer = formatter.WithMetadata(writer, resolver)
+	}
+
+	// Stream duplicates straight into the writer
+	next, err := detector.StreamDuplicateSets(opts, writer.WriteSet)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: Failed to find duplicates: %v\n", err)
 		os.Exit(2)
 	}
 
-	// Format and display
-	formatter := duplicate.NewFormatter()
+	if err := writer.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to write output: %v\n", err)
+		os.Exit(2)
+	}
 
-	if duplicatesJSON {
-		output, err := formatter.FormatJSON(sets)
+	if next != nil {
+		fmt.Fprintf(os.Stderr, "More results available. Next page: --after %s\n", next.String())
+	}
+}
+
+// runRemoteDuplicates lists the duplicate sets found by the server, page
+// by page, into the same writers as the local catalog. The server resolves
+// the effective metadata of the files.
+func runRemoteDuplicates(minSize int64, pathPrefix string) {
+	ctx := context.Background()
+	client := newRemoteClient()
+
+	query := apiclient.ListDuplicatesParams{
+		MinCount: duplicatesMinCount,
+		MinSize:  minSize,
+		Path:     pathPrefix,
+		Sort:     duplicatesSort,
+		After:    duplicatesAfter,
+	}
+	if duplicatesRoot != "" {
+		absPath, err := pathutil.ToAbsolute(duplicatesRoot)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Failed to format JSON: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: Invalid --root path: %v\n", err)
 			os.Exit(2)
 		}
-		fmt.Println(output)
-	} else if duplicatesDetails {
-		// Detailed view with file paths (original behavior)
-		output := formatter.FormatTable(sets)
-		fmt.Print(output)
-	} else {
-		// Summary view grouped by root folder (default)
-		output := formatter.FormatSummary(sets)
-		fmt.Print(output)
+		query.Root = findRemoteRoot(ctx, client, absPath).ID
+	}
+
+	var writer duplicate.SetWriter
+	remaining := duplicatesLimit
+	var next string
+	for {
+		query.Limit = remoteDuplicatesPage
+		if remaining > 0 {
+			query.Limit = min(remaining, remoteDuplicatesPage)
+		}
+		page, err := client.ListDuplicates(ctx, query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to find duplicates: %v\n", err)
+			os.Exit(2)
+		}
+		if writer == nil {
+			// The first page tells the total the detailed view is headed by
+			total := page.Total
+			if duplicatesLimit > 0 {
+				total = min(total, duplicatesLimit)
+			}
+			writer = newDuplicatesWriter(duplicate.NewFormatter(), total)
+		}
+		for _, set := range page.Sets {
+			if err := writer.WriteSet(set.Set()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: Failed to write output: %v\n", err)
+				os.Exit(2)
+			}
+		}
+
+		next = page.Next
+		if duplicatesLimit > 0 {
+			remaining -= len(page.Sets)
+			if remaining <= 0 {
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		query.After = next
+	}
+
+	if err := writer.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to write output: %v\n", err)
+		os.Exit(2)
+	}
+
+	if next != "" {
+		fmt.Fprintf(os.Stderr, "More results available. Next page: --after %s\n", next)
+	}
+}
+
+// newDuplicatesWriter selects the writer of the listing views; total is the
+// number of sets the detailed view is headed by
+func newDuplicatesWriter(formatter *duplicate.Formatter, total int) duplicate.SetWriter {
+	if duplicatesJSON {
+		return formatter.NewJSONWriter(os.Stdout)
+	}
+	if duplicatesDetails {
+		// Detailed view with file paths
+		return formatter.NewTableWriter(os.Stdout, total)
+	}
+	// Summary view grouped by root folder (default)
+	return formatter.NewSummaryWriter(os.Stdout)
+}
+
+// newKeeperPlanner builds the keeper planner from --rule flags, falling back
+// to the duplicates.keeper_rules configuration value. The planner ranks
+// files by retention policy priority and enforces the policies.
+func newKeeperPlanner(cfg *config.Config, db *sql.DB, ruleFlags []string) (*duplicate.Planner, error) {
+	specs := cfg.KeeperRules
+	if len(ruleFlags) > 0 {
+		specs = ruleFlags
+	}
+
+	resolver, err := datastore.NewMetadataResolver(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+	rules, err := duplicate.ParseRules(specs, duplicate.PolicyPriority(resolver.PolicyFor))
+	if err != nil {
+		return nil, fmt.Errorf("invalid keeper rules: %w", err)
 	}
+	return duplicate.NewPlanner(rules).WithPolicies(resolver.PolicyFor), nil
 }
 
 // parseSize parses human-readable size strings like "10M", "512K", "1G"
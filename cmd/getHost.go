@@ -4,36 +4,27 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
+var getHostJSON bool
+
 // getHostCmd represents the getHost command
 var getHostCmd = &cobra.Command{
-	Use:   "Host",
-	Short: "Get list of storage hosts",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "host [name]...",
+	Aliases: []string{"Host"},
+	Short:   "Get list of hosts",
+	Long: `List all hosts, or only the named ones.
+
+Example:
+  dupectl get host
+  dupectl get host nas01 --json`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("getHost called")
+		hostResource.runGet(args, getHostJSON)
 	},
 }
 
 func init() {
 	getCmd.AddCommand(getHostCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// getHostCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// getHostCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	getHostCmd.Flags().BoolVar(&getHostJSON, "json", false, "Output in JSON format")
 }
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/spf13/cobra"
+)
+
+var (
+	getJobStatus string
+	getJobJSON   bool
+)
+
+// getJobCmd represents the get job command
+var getJobCmd = &cobra.Command{
+	Use:     "job",
+	Aliases: []string{"jobs"},
+	Short:   "List scan jobs queued for agents",
+	Long: `List the scan jobs of this server's queue, oldest first.
+
+Examples:
+  dupectl get job
+  dupectl get job --status failed
+  dupectl get job --json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runGetJob()
+	},
+}
+
+func init() {
+	getCmd.AddCommand(getJobCmd)
+
+	getJobCmd.Flags().StringVar(&getJobStatus, "status", "", "Only list jobs with this status (queued, leased, done, failed)")
+	getJobCmd.Flags().BoolVar(&getJobJSON, "json", false, "Output in JSON format")
+}
+
+func runGetJob() {
+	switch getJobStatus {
+	case "", entities.ScanJobQueued, entities.ScanJobLeased, entities.ScanJobDone, entities.ScanJobFailed:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown status %q\n", getJobStatus)
+		os.Exit(1)
+	}
+
+	_, db := openCatalog()
+	defer db.Close()
+
+	jobs, err := datastore.GetScanJobs(db, getJobStatus)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to list jobs: %v\n", err)
+		os.Exit(2)
+	}
+
+	if getJobJSON {
+		data, err := json.MarshalIndent(jobs, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to marshal JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if len(jobs) == 0 {
+		fmt.Println("No scan jobs.")
+		return
+	}
+
+	fmt.Printf("%-6s  %-8s  %-7s  %-8s  %-18s  %s\n", "ID", "Kind", "Status", "Attempts", "Progress", "Target")
+	fmt.Println("─────────────────────────────────────────────────────────────────────")
+	for _, job := range jobs {
+		progress := fmt.Sprintf("%d/%d", job.FoldersDone, job.FilesDone)
+		fmt.Printf("%-6d  %-8s  %-7s  %-8d  %-18s  %s\n", job.ID, job.Kind, job.Status, job.Attempts, progress, jobTarget(&job))
+		if job.Error != "" {
+			fmt.Printf("        error: %s\n", job.Error)
+		}
+	}
+}
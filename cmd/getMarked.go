@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/spf13/cobra"
+
+	_ "modernc.org/sqlite"
+)
+
+var (
+	markedJSON bool
+)
+
+// getMarkedCmd represents the get marked command
+var getMarkedCmd = &cobra.Command{
+	Use:   "marked",
+	Short: "List files and folders marked for deletion",
+	Long: `List catalogued files and folders in the deletion workflow
+(marked, ready for deletion or being deleted).
+
+Examples:
+  dupectl get marked
+  dupectl get marked --json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runGetMarked()
+	},
+}
+
+func init() {
+	getCmd.AddCommand(getMarkedCmd)
+
+	getMarkedCmd.Flags().BoolVar(&markedJSON, "json", false, "Output in JSON format")
+}
+
+// MarkedFileInfo is the output form of a marked file
+type MarkedFileInfo struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Status     string `json:"status"`
+	RootFolder string `json:"root_folder"`
+}
+
+// MarkedFolderInfo is the output form of a marked folder
+type MarkedFolderInfo struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+func runGetMarked() {
+	_, db := openCatalog()
+	defer db.Close()
+
+	hostID := localHostID(db)
+	files, err := datastore.GetMarkedFiles(db, hostID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to query marked files: %v\n", err)
+		os.Exit(2)
+	}
+	folders, err := datastore.GetMarkedFolders(db, hostID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to query marked folders: %v\n", err)
+		os.Exit(2)
+	}
+
+	fileInfos := make([]MarkedFileInfo, 0, len(files))
+	var totalSize int64
+	for _, f := range files {
+		fileInfos = append(fileInfos, MarkedFileInfo{
+			Path:       f.Path,
+			Size:       f.Size,
+			Status:     f.Status.String(),
+			RootFolder: f.RootFolderPath,
+		})
+		totalSize += f.Size
+	}
+	folderInfos := make([]MarkedFolderInfo, 0, len(folders))
+	for _, f := range folders {
+		folderInfos = append(folderInfos, MarkedFolderInfo{Path: f.Path, Status: f.Status.String()})
+	}
+
+	if markedJSON {
+		output := map[string]interface{}{
+			"files":      fileInfos,
+			"folders":    folderInfos,
+			"total_size": totalSize,
+		}
+		data, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to marshal JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if len(fileInfos) == 0 && len(folderInfos) == 0 {
+		fmt.Println("No files marked for deletion.")
+		return
+	}
+
+	fmt.Printf("%-20s  %-10s  %s\n", "Status", "Size", "Path")
+	fmt.Println("─────────────────────────────────────────────────────────────────────")
+	for _, f := range folderInfos {
+		fmt.Printf("%-20s  %-10s  %s\n", f.Status, "-", f.Path)
+	}
+	for _, f := range fileInfos {
+		fmt.Printf("%-20s  %-10s  %s\n", f.Status, formatBytes(f.Size), f.Path)
+	}
+	fmt.Println()
+	fmt.Printf("Total: %d files (%s), %d folders\n", len(fileInfos), formatBytes(totalSize), len(folderInfos))
+}
@@ -4,36 +4,27 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
+var getOwnerJSON bool
+
 // getOwnerCmd represents the getOwner command
 var getOwnerCmd = &cobra.Command{
-	Use:   "Owner",
-	Short: "Get list of owners",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "owner [name]...",
+	Aliases: []string{"Owner"},
+	Short:   "Get list of owners",
+	Long: `List all owners, or only the named ones.
+
+Example:
+  dupectl get owner
+  dupectl get owner alice --json`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("getOwner called")
+		ownerResource.runGet(args, getOwnerJSON)
 	},
 }
 
 func init() {
 	getCmd.AddCommand(getOwnerCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// getOwnerCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// getOwnerCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	getOwnerCmd.Flags().BoolVar(&getOwnerJSON, "json", false, "Output in JSON format")
 }
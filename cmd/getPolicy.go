@@ -4,36 +4,27 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
+var getPolicyJSON bool
+
 // getPolicyCmd represents the getPolicy command
 var getPolicyCmd = &cobra.Command{
-	Use:   "Policy",
-	Short: "Get list of retention policies",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "policy [name]...",
+	Aliases: []string{"Policy"},
+	Short:   "Get list of policies",
+	Long: `List all policies, or only the named ones.
+
+Example:
+  dupectl get policy
+  dupectl get policy dr --json`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("getPolicy called")
+		policyResource.runGet(args, getPolicyJSON)
 	},
 }
 
 func init() {
 	getCmd.AddCommand(getPolicyCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// getPolicyCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// getPolicyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	getPolicyCmd.Flags().BoolVar(&getPolicyJSON, "json", false, "Output in JSON format")
 }
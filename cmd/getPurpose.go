@@ -4,36 +4,27 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
+var getPurposeJSON bool
+
 // getPurposeCmd represents the getPurpose command
 var getPurposeCmd = &cobra.Command{
-	Use:   "Purpose",
-	Short: "Get list of file/folder purposes",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:     "purpose [name]...",
+	Aliases: []string{"Purpose"},
+	Short:   "Get list of purposes",
+	Long: `List all purposes, or only the named ones.
+
+Example:
+  dupectl get purpose
+  dupectl get purpose backup --json`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("getPurpose called")
+		purposeResource.runGet(args, getPurposeJSON)
 	},
 }
 
 func init() {
 	getCmd.AddCommand(getPurposeCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// getPurposeCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// getPurposeCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	getPurposeCmd.Flags().BoolVar(&getPurposeJSON, "json", false, "Output in JSON format")
 }
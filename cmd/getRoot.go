@@ -4,20 +4,24 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/jpconstantineau/dupectl/pkg/apiclient"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var getRootJSON bool
 
 type RootFolderInfo struct {
+	Host           string  `json:"host"`
 	Path           string  `json:"path"`
 	FolderCount    int64   `json:"folder_count"`
 	FileCount      int64   `json:"file_count"`
@@ -31,63 +35,44 @@ var getRootCmd = &cobra.Command{
 	Short: "Get list of root folders",
 	Long: `List all registered root folders with scan statistics.
 
-Displays path, folder count, file count, total size, and last scan date
-for all registered root folders.
+Displays host, path, folder count, file count, total size, and last scan
+date for all registered root folders. The same path may be registered on
+several hosts. In remote mode (--server) the server's root folders are
+listed.
 
 Example:
   dupectl get root
   dupectl get root --json`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Open database connection
-		db, err := openDatabaseForGetRoot()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to open database: %v\n", err)
-			os.Exit(1)
-		}
-		defer db.Close()
-
-		// Query all root folders
-		rows, err := db.Query(`
-			SELECT path, folder_count, file_count, total_size, last_scan_date
-			FROM root_folders
-			ORDER BY path
-		`)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to query root folders: %v\n", err)
-			os.Exit(1)
-		}
-		defer rows.Close()
-
-		// Collect results
-		var rootFolders []RootFolderInfo
-
-		for rows.Next() {
-			var rf RootFolderInfo
-			var lastScan sql.NullString
-
-			err := rows.Scan(&rf.Path, &rf.FolderCount, &rf.FileCount, &rf.TotalSizeBytes, &lastScan)
+		var roots []entities.RootFolderInfo
+		if remoteMode() {
+			var err error
+			roots, err = newRemoteClient().ListRoots(context.Background(), apiclient.ListRootsParams{})
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: failed to scan row: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Error: failed to query root folders: %v\n", err)
 				os.Exit(1)
 			}
-
-			if lastScan.Valid && lastScan.String != "" {
-				// Parse the timestamp and convert to RFC3339
-				t, err := time.Parse("2006-01-02 15:04:05", lastScan.String)
-				if err == nil {
-					scanTime := t.UTC().Format(time.RFC3339)
-					rf.LastScanDate = &scanTime
-				} else {
-					// Try with timezone
-					t, err = time.Parse("2006-01-02 15:04:05-07:00", lastScan.String)
-					if err == nil {
-						scanTime := t.UTC().Format(time.RFC3339)
-						rf.LastScanDate = &scanTime
-					}
-				}
+		} else {
+			roots = localRoots()
+		}
+		sort.Slice(roots, func(i, j int) bool {
+			if roots[i].Host != roots[j].Host {
+				return roots[i].Host < roots[j].Host
 			}
+			return roots[i].Path < roots[j].Path
+		})
 
-			rootFolders = append(rootFolders, rf)
+		// Collect results
+		var rootFolders []RootFolderInfo
+		for _, root := range roots {
+			rootFolders = append(rootFolders, RootFolderInfo{
+				Host:           root.Host,
+				Path:           root.Path,
+				FolderCount:    root.FolderCount,
+				FileCount:      root.FileCount,
+				TotalSizeBytes: root.TotalSizeBytes,
+				LastScanDate:   root.LastScanDate,
+			})
 		}
 
 		// Output results
@@ -99,23 +84,32 @@ Example:
 	},
 }
 
-func openDatabaseForGetRoot() (*sql.DB, error) {
-	dbType := viper.GetString("server.database.type")
-	if dbType != "sqlite" {
-		return nil, fmt.Errorf("only SQLite databases are currently supported")
-	}
+// localRoots lists the root folders of the local catalog in the form the
+// API returns them
+func localRoots() []entities.RootFolderInfo {
+	_, db := openCatalog()
+	defer db.Close()
 
-	dbPath := viper.GetString("server.database.sqlite.name")
-	if dbPath == "" {
-		return nil, fmt.Errorf("database path not configured")
+	folders, err := datastore.GetAllRootFolders(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to query root folders: %v\n", err)
+		os.Exit(1)
 	}
-
-	db, err := sql.Open("sqlite", dbPath)
+	conv, err := datastore.NewRootFolderConverter(db)
 	if err != nil {
-		return nil, err
+		fmt.Fprintf(os.Stderr, "Error: failed to query root folders: %v\n", err)
+		os.Exit(1)
 	}
-
-	return db, nil
+	roots := make([]entities.RootFolderInfo, 0, len(folders))
+	for _, folder := range folders {
+		root, err := conv.Convert(folder)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to query root folders: %v\n", err)
+			os.Exit(1)
+		}
+		roots = append(roots, root)
+	}
+	return roots
 }
 
 func outputRootTable(rootFolders []RootFolderInfo) {
@@ -127,8 +121,8 @@ func outputRootTable(rootFolders []RootFolderInfo) {
 	fmt.Println("Root Folders")
 	fmt.Println("════════════")
 	fmt.Println()
-	fmt.Printf("%-40s  %-10s  %-10s  %-12s  %s\n", "Path", "Folders", "Files", "Total Size", "Last Scan")
-	fmt.Println(strings.Repeat("─", 120))
+	fmt.Printf("%-16s  %-40s  %-10s  %-10s  %-12s  %s\n", "Host", "Path", "Folders", "Files", "Total Size", "Last Scan")
+	fmt.Println(strings.Repeat("─", 138))
 
 	for _, rf := range rootFolders {
 		path := rf.Path
@@ -148,7 +142,12 @@ func outputRootTable(rootFolders []RootFolderInfo) {
 			}
 		}
 
-		fmt.Printf("%-40s  %-10s  %-10s  %-12s  %s\n", path, folderCountStr, fileCountStr, sizeStr, lastScanStr)
+		host := rf.Host
+		if len(host) > 16 {
+			host = host[:13] + "..."
+		}
+
+		fmt.Printf("%-16s  %-40s  %-10s  %-10s  %-12s  %s\n", host, path, folderCountStr, fileCountStr, sizeStr, lastScanStr)
 	}
 
 	fmt.Println()
@@ -5,41 +5,141 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/tlsutil"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+var (
+	initTLS      bool
+	initTLSDir   string
+	initTLSHosts []string
+	initMTLS     bool
+)
+
 // initCmd represents the init command
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initializes Database",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	Long: `Create the database tables of the server.
+
+With --tls, also create a private CA and a server certificate signed by it
+in --tls-dir, and configure the server to serve over TLS and to issue
+client certificates to agents when they register. An existing CA is kept,
+so that certificates already issued stay valid. Copy ca.pem to the agents
+and set client.tls.ca to it so that they only trust this server.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+With --mtls, the server also requires agents to present their certificate.
+
+Examples:
+  dupectl init
+  dupectl init --tls --tls-host nas01.example.com --tls-host 192.168.1.10
+  dupectl init --tls --mtls`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		dbtype := viper.GetString("server.database.type")
 		fmt.Println("Using Database:", dbtype)
 		fmt.Println("Creating All Tables...")
 		datastore.InitAllTables()
+
+		if initTLS || initMTLS {
+			runInitTLS()
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(initCmd)
 
-	// Here you will define your flags and configuration settings.
+	initCmd.Flags().BoolVar(&initTLS, "tls", false, "Create a CA and server certificate and enable TLS")
+	initCmd.Flags().StringVar(&initTLSDir, "tls-dir", "tls", "Directory of the CA and server certificate")
+	initCmd.Flags().StringSliceVar(&initTLSHosts, "tls-host", nil, "Host name or IP address of the server certificate (default: this host, localhost, 127.0.0.1)")
+	initCmd.Flags().BoolVar(&initMTLS, "mtls", false, "Require agents to present client certificates (implies --tls)")
+}
+
+func runInitTLS() {
+	if err := os.MkdirAll(initTLSDir, 0o700); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	caCert := filepath.Join(initTLSDir, "ca.pem")
+	caKey := filepath.Join(initTLSDir, "ca-key.pem")
+	serverCert := filepath.Join(initTLSDir, "server.pem")
+	serverKey := filepath.Join(initTLSDir, "server-key.pem")
+
+	if _, err := os.Stat(caKey); err == nil {
+		fmt.Println("Using existing CA:", caCert)
+	} else {
+		certPEM, keyPEM, err := tlsutil.GenerateCA("dupectl CA")
+		if err == nil {
+			err = tlsutil.WriteFile(caKey, keyPEM, true)
+		}
+		if err == nil {
+			err = tlsutil.WriteFile(caCert, certPEM, false)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to create CA: %v\n", err)
+			os.Exit(2)
+		}
+		fmt.Println("Created CA:", caCert)
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// initCmd.PersistentFlags().String("foo", "", "A help for foo")
+	hosts := initTLSHosts
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1"}
+		if hostname, err := os.Hostname(); err == nil {
+			hosts = append([]string{hostname}, hosts...)
+		}
+	}
+	ca, err := tlsutil.LoadCA(caCert, caKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to load CA: %v\n", err)
+		os.Exit(2)
+	}
+	certPEM, keyPEM, err := ca.IssueServerCert(hosts)
+	if err == nil {
+		err = tlsutil.WriteFile(serverKey, keyPEM, true)
+	}
+	if err == nil {
+		err = tlsutil.WriteFile(serverCert, certPEM, false)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to create server certificate: %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Printf("Created server certificate for %s: %s\n", strings.Join(hosts, ", "), serverCert)
+
+	for key, path := range map[string]string{
+		"server.tls.cert": serverCert, "server.tls.key": serverKey,
+		"server.tls.ca_cert": caCert, "server.tls.ca_key": caKey,
+	} {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			abs = path
+		}
+		viper.Set(key, abs)
+	}
+	viper.Set("server.tls.require_client_cert", initMTLS)
+	if err := writeConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to save configuration: %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Println("TLS enabled in the server configuration")
+	fmt.Printf("On agents, copy %s and set client.tls.ca to its path, then run 'dupectl register'\n", caCert)
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// initCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// writeConfig saves the configuration to the file in use, or to
+// .dupectl.yaml in the current directory
+func writeConfig() error {
+	if viper.ConfigFileUsed() != "" {
+		return viper.WriteConfig()
+	}
+	viper.SetConfigType("yaml")
+	viper.SetConfigName(".dupectl.yaml")
+	return viper.WriteConfigAs(".dupectl.yaml")
 }
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+	"github.com/spf13/cobra"
+
+	_ "modernc.org/sqlite"
+)
+
+var (
+	markRules []string
+)
+
+// markCmd represents the mark command
+var markCmd = &cobra.Command{
+	Use:   "mark <path|set>...",
+	Short: "Mark files for deletion",
+	Long: `Mark catalogued files or folders for deletion.
+
+Each argument is either a catalogued path or the hash (or unambiguous hash
+prefix) of a duplicate set:
+  file path     marks the file
+  folder path   marks the folder, its sub-folders and every file beneath it
+  set hash      marks every copy except the keeper chosen by the keeper rules
+
+Only files of this machine's root folders can be marked: a set whose keeper
+rules select copies on another host must be marked from that host.
+
+A file is only marked when it has been hashed, another unmarked copy of
+its content remains and the retention policies allow it: copies under a
+protected policy are never marked, and enough copies must remain for the
+minimum of every policy involved. If any file fails these checks nothing
+is marked.
+
+Examples:
+  dupectl mark /data/b/photo.jpg
+  dupectl mark /data/b/old-backup
+  dupectl mark 09e1d4d80f968e45 --rule prefer-root=/data/master`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runMark(args)
+	},
+}
+
+// unmarkCmd represents the unmark command
+var unmarkCmd = &cobra.Command{
+	Use:   "unmark <path|set>...",
+	Short: "Remove deletion marks from files",
+	Long: `Return files or folders marked for deletion to their normal status.
+
+Arguments are resolved like 'dupectl mark'; a set hash unmarks every file
+of the set. Files already being deleted cannot be unmarked.
+
+Examples:
+  dupectl unmark /data/b/photo.jpg
+  dupectl unmark 09e1d4d80f968e45`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runUnmark(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(markCmd)
+	rootCmd.AddCommand(unmarkCmd)
+
+	markCmd.Flags().StringArrayVar(&markRules, "rule", nil, "Keeper rule used for set arguments, repeatable (overrides duplicates.keeper_rules)")
+}
+
+func runMark(args []string) {
+	cfg, db := openCatalog()
+	defer db.Close()
+
+	planner, err := newKeeperPlanner(cfg, db, markRules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	targets, err := resolveMarkTargets(db, args, planner)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	result, err := datastore.MarkForDeletion(db, targets)
+	if err != nil {
+		var refused *datastore.MarkRefusedError
+		if errors.As(err, &refused) {
+			fmt.Fprintf(os.Stderr, "Error: %v; nothing was marked\n", err)
+			for _, r := range refused.Refusals {
+				fmt.Fprintf(os.Stderr, "  - %s: %s\n", r.Path, r.Reason)
+			}
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Error: Failed to mark files: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("Marked %d files (%s) and %d folders for deletion\n",
+		result.Files, formatBytes(result.Bytes), result.Folders)
+}
+
+func runUnmark(args []string) {
+	_, db := openCatalog()
+	defer db.Close()
+
+	targets, err := resolveMarkTargets(db, args, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	result, err := datastore.UnmarkForDeletion(db, targets)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to unmark files: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("Unmarked %d files (%s) and %d folders\n",
+		result.Files, formatBytes(result.Bytes), result.Folders)
+}
+
+// resolveMarkTargets resolves each argument as a catalogued path, then as a
+// duplicate set hash. For sets, the planner selects the files to remove
+// and fails when it selects copies on another host; without a planner
+// every copy of the set on this host is selected.
+func resolveMarkTargets(db *sql.DB, args []string, planner *duplicate.Planner) (*datastore.MarkTargets, error) {
+	detector := duplicate.NewDetector(db)
+	targets := &datastore.MarkTargets{}
+	hostID := localHostID(db)
+	roots := localRootIDs(db, hostID)
+
+	for _, arg := range args {
+		absPath, err := pathutil.ToAbsolute(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path %s: %w", arg, err)
+		}
+
+		found, err := datastore.FindMarkTargets(db, hostID, pathutil.NormalizePathForStorage(absPath))
+		if err == nil {
+			targets.FileIDs = append(targets.FileIDs, found.FileIDs...)
+			targets.FolderIDs = append(targets.FolderIDs, found.FolderIDs...)
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to look up %s: %w", absPath, err)
+		}
+
+		set, err := detector.GetSet(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s is neither a catalogued path nor a duplicate set", arg)
+		}
+
+		files := localSet(set, roots).Files
+		if planner != nil {
+			plan, err := planner.Plan(set)
+			if err != nil {
+				return nil, err
+			}
+			files = plan.Remove
+			for _, violation := range plan.Violations {
+				fmt.Fprintf(os.Stderr, "Warning: set %s: %s\n", set.Hash[:16], violation)
+			}
+			for _, file := range files {
+				if !roots[file.RootFolderID] {
+					return nil, fmt.Errorf("set %s: %s is on another host; mark it from that host", set.Hash[:16], file.Path)
+				}
+			}
+		}
+		for _, file := range files {
+			targets.FileIDs = append(targets.FileIDs, file.ID)
+		}
+	}
+
+	return targets, nil
+}
@@ -0,0 +1,389 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+	"github.com/spf13/cobra"
+)
+
+// metadataResource connects the add/get/apply/delete commands of a named
+// metadata kind (owner, purpose, policy, host) to the datastore
+type metadataResource[T any] struct {
+	kind string
+	// metaKind is the datastore kind used for folder assignment; empty
+	// when the kind cannot be assigned to folders
+	metaKind string
+	plural   string
+	list     func(*sql.DB) ([]T, error)
+	get      func(*sql.DB, string) (T, error)
+	insert   func(*sql.DB, T) (T, error)
+	update   func(*sql.DB, string, T) (T, error)
+	delete   func(*sql.DB, string) error
+	// withInfo returns item with its ID, name and description replaced
+	withInfo func(item T, info MetadataInfo) T
+	info     func(T) MetadataInfo
+	// rules describes kind-specific fields in table output; nil when none
+	rules func(T) string
+}
+
+// MetadataInfo is the common output form of owners, purposes, policies and hosts
+type MetadataInfo struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+var ownerResource = metadataResource[entities.Owner]{
+	kind:     "owner",
+	metaKind: datastore.MetadataOwner,
+	plural:   "owners",
+	list:     datastore.GetOwners,
+	get:      datastore.GetOwner,
+	insert:   datastore.InsertOwner,
+	update:   datastore.UpdateOwner,
+	delete:   datastore.DeleteOwner,
+	withInfo: func(o entities.Owner, i MetadataInfo) entities.Owner {
+		o.Id, o.Name, o.Description = i.ID, i.Name, i.Description
+		return o
+	},
+	info: func(o entities.Owner) MetadataInfo {
+		return MetadataInfo{ID: o.Id, Name: o.Name, Description: o.Description}
+	},
+}
+
+var purposeResource = metadataResource[entities.Purpose]{
+	kind:     "purpose",
+	metaKind: datastore.MetadataPurpose,
+	plural:   "purposes",
+	list:     datastore.GetPurposes,
+	get:      datastore.GetPurpose,
+	insert:   datastore.InsertPurpose,
+	update:   datastore.UpdatePurpose,
+	delete:   datastore.DeletePurpose,
+	withInfo: func(p entities.Purpose, i MetadataInfo) entities.Purpose {
+		p.Id, p.Name, p.Description = i.ID, i.Name, i.Description
+		return p
+	},
+	info: func(p entities.Purpose) MetadataInfo {
+		return MetadataInfo{ID: p.Id, Name: p.Name, Description: p.Description}
+	},
+}
+
+var policyResource = metadataResource[entities.Policy]{
+	kind:     "policy",
+	metaKind: datastore.MetadataPolicy,
+	plural:   "policies",
+	list:     datastore.GetPolicies,
+	get:      datastore.GetPolicy,
+	insert:   datastore.InsertPolicy,
+	update:   datastore.UpdatePolicy,
+	delete:   datastore.DeletePolicy,
+	withInfo: func(p entities.Policy, i MetadataInfo) entities.Policy {
+		p.Id, p.Name, p.Description = i.ID, i.Name, i.Description
+		return p
+	},
+	info: func(p entities.Policy) MetadataInfo {
+		return MetadataInfo{ID: p.Id, Name: p.Name, Description: p.Description}
+	},
+	rules: formatPolicyRules,
+}
+
+var hostResource = metadataResource[entities.Host]{
+	kind:   "host",
+	plural: "hosts",
+	list:   datastore.GetHosts,
+	get:    datastore.GetHost,
+	insert: datastore.InsertHost,
+	update: datastore.UpdateHost,
+	delete: datastore.DeleteHost,
+	withInfo: func(h entities.Host, i MetadataInfo) entities.Host {
+		h.Id, h.Name, h.Description = i.ID, i.Name, i.Description
+		return h
+	},
+	info: func(h entities.Host) MetadataInfo {
+		return MetadataInfo{ID: h.Id, Name: h.Name, Description: h.Description}
+	},
+}
+
+// runAdd creates a new record; the name must not be in use. Edits set
+// kind-specific fields from the command line.
+func (r metadataResource[T]) runAdd(name, description string, edits ...func(*T)) {
+	_, db := openCatalog()
+	defer db.Close()
+
+	var zero T
+	item := r.withInfo(zero, MetadataInfo{Name: name, Description: description})
+	for _, edit := range edits {
+		edit(&item)
+	}
+	item, err := r.insert(db, item)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to add %s: %v\n", r.kind, err)
+		if errors.Is(err, datastore.ErrExists) || errors.Is(err, datastore.ErrInvalid) {
+			os.Exit(1)
+		}
+		os.Exit(2)
+	}
+
+	info := r.info(item)
+	fmt.Printf("%s added: %s (ID: %d)\n", capitalize(r.kind), info.Name, info.ID)
+}
+
+// runApply creates the record or updates the fields given on the command line
+func (r metadataResource[T]) runApply(name string, description *string, rename string, edits ...func(*T)) {
+	_, db := openCatalog()
+	defer db.Close()
+
+	current, err := r.get(db, name)
+	if err == sql.ErrNoRows {
+		info := MetadataInfo{Name: name}
+		if rename != "" {
+			info.Name = rename
+		}
+		if description != nil {
+			info.Description = *description
+		}
+		var zero T
+		item := r.withInfo(zero, info)
+		for _, edit := range edits {
+			edit(&item)
+		}
+		item, err := r.insert(db, item)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to add %s: %v\n", r.kind, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s added: %s (ID: %d)\n", capitalize(r.kind), r.info(item).Name, r.info(item).ID)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to look up %s %s: %v\n", r.kind, name, err)
+		os.Exit(2)
+	}
+
+	info := r.info(current)
+	if rename != "" {
+		info.Name = rename
+	}
+	if description != nil {
+		info.Description = *description
+	}
+	item := r.withInfo(current, info)
+	for _, edit := range edits {
+		edit(&item)
+	}
+	item, err = r.update(db, name, item)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to update %s %s: %v\n", r.kind, name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s updated: %s (ID: %d)\n", capitalize(r.kind), r.info(item).Name, r.info(item).ID)
+}
+
+// runAssign assigns the named record to folders, or clears the assignment
+// when name is empty so the folders inherit from their parent again
+func (r metadataResource[T]) runAssign(name string, folders []string) {
+	_, db := openCatalog()
+	defer db.Close()
+	hostID := localHostID(db)
+
+	var id *int
+	if name != "" {
+		item, err := r.get(db, name)
+		if err == sql.ErrNoRows {
+			fmt.Fprintf(os.Stderr, "Error: %s not found: %s\n", capitalize(r.kind), name)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to query %s %s: %v\n", r.kind, name, err)
+			os.Exit(2)
+		}
+		itemID := r.info(item).ID
+		id = &itemID
+	}
+
+	for _, folder := range folders {
+		absPath, err := pathutil.ToAbsolute(folder)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Invalid path '%s': %v\n", folder, err)
+			os.Exit(2)
+		}
+		absPath = pathutil.NormalizePathForStorage(absPath)
+
+		err = datastore.AssignFolderMetadata(db, hostID, absPath, r.metaKind, id)
+		if err == sql.ErrNoRows {
+			fmt.Fprintf(os.Stderr, "Error: %s is not a registered root or catalogued folder (scan it first)\n", absPath)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to assign %s to %s: %v\n", r.kind, absPath, err)
+			os.Exit(2)
+		}
+
+		if name == "" {
+			fmt.Printf("%s cleared: %s (now inherited)\n", capitalize(r.kind), absPath)
+		} else {
+			fmt.Printf("%s %s assigned: %s\n", capitalize(r.kind), name, absPath)
+		}
+	}
+}
+
+// runGet lists all records, or the named ones
+func (r metadataResource[T]) runGet(names []string, jsonOutput bool) {
+	_, db := openCatalog()
+	defer db.Close()
+
+	var items []T
+	if len(names) == 0 {
+		var err error
+		items, err = r.list(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to query %s: %v\n", r.plural, err)
+			os.Exit(2)
+		}
+	}
+	for _, name := range names {
+		item, err := r.get(db, name)
+		if err == sql.ErrNoRows {
+			fmt.Fprintf(os.Stderr, "Error: %s not found: %s\n", capitalize(r.kind), name)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to query %s %s: %v\n", r.kind, name, err)
+			os.Exit(2)
+		}
+		items = append(items, item)
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to marshal JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if len(items) == 0 {
+		fmt.Printf("No %s defined\n", r.plural)
+		return
+	}
+
+	if r.rules != nil {
+		fmt.Printf("%-6s  %-24s  %-44s  %s\n", "ID", "Name", "Rules", "Description")
+		fmt.Println(strings.Repeat("─", 110))
+	} else {
+		fmt.Printf("%-6s  %-24s  %s\n", "ID", "Name", "Description")
+		fmt.Println(strings.Repeat("─", 78))
+	}
+	for _, item := range items {
+		info := r.info(item)
+		if r.rules != nil {
+			fmt.Printf("%-6d  %-24s  %-44s  %s\n", info.ID, info.Name, r.rules(item), info.Description)
+		} else {
+			fmt.Printf("%-6d  %-24s  %s\n", info.ID, info.Name, info.Description)
+		}
+	}
+	fmt.Println()
+	fmt.Printf("Total: %d %s\n", len(items), r.plural)
+}
+
+// runDelete removes the named records after confirmation
+func (r metadataResource[T]) runDelete(names []string) {
+	_, db := openCatalog()
+	defer db.Close()
+
+	for _, name := range names {
+		if _, err := r.get(db, name); err == sql.ErrNoRows {
+			fmt.Fprintf(os.Stderr, "Error: %s not found: %s\n", capitalize(r.kind), name)
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to query %s %s: %v\n", r.kind, name, err)
+			os.Exit(2)
+		}
+	}
+
+	// Prompt for confirmation unless --yes flag is set
+	if !rootYes {
+		var response string
+		fmt.Printf("Delete %d %s? (y/n): ", len(names), r.plural)
+		fmt.Scanln(&response)
+
+		if response != "y" && response != "Y" && response != "yes" {
+			fmt.Println("Deletion cancelled.")
+			return
+		}
+	}
+
+	for _, name := range names {
+		if err := r.delete(db, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to delete %s %s: %v\n", r.kind, name, err)
+			os.Exit(2)
+		}
+		fmt.Printf("%s deleted: %s\n", capitalize(r.kind), name)
+	}
+}
+
+// policyRuleFlags holds the retention rule flags of add/apply policy
+type policyRuleFlags struct {
+	priority   int
+	minCopies  int
+	maxAgeDays int
+	protected  bool
+}
+
+func (f *policyRuleFlags) register(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&f.priority, "priority", 0, "Keeper priority; copies under higher priorities are kept first")
+	cmd.Flags().IntVar(&f.minCopies, "min-copies", 0, "Minimum number of copies to retain (0 for no minimum)")
+	cmd.Flags().IntVar(&f.maxAgeDays, "max-age-days", 0, "Days after their last change that copies are retained (0 for ever)")
+	cmd.Flags().BoolVar(&f.protected, "protected", false, "Never allow copies under the policy to be marked for deletion")
+}
+
+// edit applies the flags given on the command line to a policy
+func (f *policyRuleFlags) edit(cmd *cobra.Command) func(*entities.Policy) {
+	return func(p *entities.Policy) {
+		flags := cmd.Flags()
+		if flags.Changed("priority") {
+			p.Priority = f.priority
+		}
+		if flags.Changed("min-copies") {
+			p.MinCopies = f.minCopies
+		}
+		if flags.Changed("max-age-days") {
+			p.MaxAgeDays = f.maxAgeDays
+		}
+		if flags.Changed("protected") {
+			p.Protected = f.protected
+		}
+	}
+}
+
+func formatPolicyRules(p entities.Policy) string {
+	rules := []string{fmt.Sprintf("priority=%d", p.Priority)}
+	if p.MinCopies > 0 {
+		rules = append(rules, fmt.Sprintf("min-copies=%d", p.MinCopies))
+	}
+	if p.MaxAgeDays > 0 {
+		rules = append(rules, fmt.Sprintf("max-age=%dd", p.MaxAgeDays))
+	}
+	if p.Protected {
+		rules = append(rules, "protected")
+	}
+	return strings.Join(rules, " ")
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
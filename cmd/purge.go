@@ -4,16 +4,17 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"time"
 
-	"github.com/jpconstantineau/dupectl/internal/config"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
 	"github.com/jpconstantineau/dupectl/pkg/pathutil"
 	"github.com/spf13/cobra"
-
-	_ "modernc.org/sqlite"
 )
 
 var (
@@ -28,6 +29,7 @@ var purgeCmd = &cobra.Command{
 
 This operation permanently deletes file and/or folder records from the database.
 This cannot be undone. Use --before to limit purge to entities removed before a specific date.
+In remote mode (--server) the entities are purged from the server's database.
 
 Examples:
   dupectl purge files /home/user/documents
@@ -43,13 +45,14 @@ Examples:
 
 func init() {
 	rootCmd.AddCommand(purgeCmd)
+	addRemoteHostFlag(purgeCmd)
 
 	purgeCmd.Flags().StringVar(&purgeBefore, "before", "", "Only purge entities removed before date (YYYY-MM-DD)")
 }
 
 func runPurge(entityType, rootPath string) {
 	// Validate entity type
-	if entityType != "files" && entityType != "folders" && entityType != "all" {
+	if entityType != entities.PurgeFiles && entityType != entities.PurgeFolders && entityType != entities.PurgeAll {
 		fmt.Fprintf(os.Stderr, "Error: Invalid entity type '%s'. Must be 'files', 'folders', or 'all'\n", entityType)
 		os.Exit(2)
 	}
@@ -61,32 +64,6 @@ func runPurge(entityType, rootPath string) {
 		os.Exit(2)
 	}
 
-	// Load configuration
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to load configuration: %v\n", err)
-		os.Exit(2)
-	}
-
-	// Open database
-	db, err := sql.Open("sqlite", cfg.DatabasePath+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(ON)")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to open database: %v\n", err)
-		os.Exit(2)
-	}
-	defer db.Close()
-
-	// Check if root folder is registered
-	var rootID int64
-	err = db.QueryRow("SELECT id FROM root_folders WHERE path = ?", absPath).Scan(&rootID)
-	if err == sql.ErrNoRows {
-		fmt.Fprintf(os.Stderr, "Error: Root folder not registered: %s\n", absPath)
-		os.Exit(1)
-	} else if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to query root folder: %v\n", err)
-		os.Exit(2)
-	}
-
 	// Parse --before date if specified
 	var beforeTimestamp int64
 	if purgeBefore != "" {
@@ -98,8 +75,46 @@ func runPurge(entityType, rootPath string) {
 		beforeTimestamp = beforeDate.Unix()
 	}
 
+	var purge func(dryRun bool) (entities.PurgeResult, error)
+	if remoteMode() {
+		ctx := context.Background()
+		client := newRemoteClient()
+		root := findRemoteRoot(ctx, client, absPath)
+		purge = func(dryRun bool) (entities.PurgeResult, error) {
+			return client.PurgeRoot(ctx, root.ID, entities.PurgeRequest{
+				Entities: entityType,
+				Before:   beforeTimestamp,
+				DryRun:   dryRun,
+			})
+		}
+	} else {
+		_, db := openCatalog()
+		defer db.Close()
+
+		// Check if root folder is registered on this host
+		root, err := datastore.FindRootFolderByPath(db, localHostID(db), absPath)
+		if errors.Is(err, sql.ErrNoRows) {
+			fmt.Fprintf(os.Stderr, "Error: Root folder not registered: %s\n", absPath)
+			os.Exit(1)
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Failed to query root folder: %v\n", err)
+			os.Exit(2)
+		}
+		purge = func(dryRun bool) (entities.PurgeResult, error) {
+			if dryRun {
+				return datastore.CountRemoved(db, root.ID, beforeTimestamp)
+			}
+			return datastore.PurgeRemoved(db, root.ID, entityType, beforeTimestamp)
+		}
+	}
+
 	// Count removed entities
-	fileCount, folderCount := countRemovedEntities(db, rootID, beforeTimestamp)
+	counts, err := purge(true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to count removed entities: %v\n", err)
+		os.Exit(2)
+	}
+	fileCount, folderCount := counts.Files, counts.Folders
 
 	if entityType == "files" && fileCount == 0 {
 		fmt.Println("No removed files to purge")
@@ -138,86 +153,18 @@ func runPurge(entityType, rootPath string) {
 	}
 
 	// Perform purge
-	purgedFiles, purgedFolders := performPurge(db, rootID, entityType, beforeTimestamp)
+	purged, err := purge(false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to purge: %v\n", err)
+		os.Exit(2)
+	}
 
 	// Display results
 	if entityType == "files" {
-		fmt.Printf("Purged %d files from database\n", purgedFiles)
+		fmt.Printf("Purged %d files from database\n", purged.Files)
 	} else if entityType == "folders" {
-		fmt.Printf("Purged %d folders from database\n", purgedFolders)
+		fmt.Printf("Purged %d folders from database\n", purged.Folders)
 	} else {
-		fmt.Printf("Purged %d files and %d folders from database\n", purgedFiles, purgedFolders)
+		fmt.Printf("Purged %d files and %d folders from database\n", purged.Files, purged.Folders)
 	}
 }
-
-func countRemovedEntities(db *sql.DB, rootID int64, beforeTimestamp int64) (fileCount, folderCount int) {
-	// Count removed files
-	fileQuery := "SELECT COUNT(*) FROM files WHERE root_folder_id = ? AND removed = 1"
-	fileArgs := []interface{}{rootID}
-	if beforeTimestamp > 0 {
-		fileQuery += " AND last_scanned_at < ?"
-		fileArgs = append(fileArgs, beforeTimestamp)
-	}
-	db.QueryRow(fileQuery, fileArgs...).Scan(&fileCount)
-
-	// Count removed folders
-	folderQuery := "SELECT COUNT(*) FROM folders WHERE root_folder_id = ? AND removed = 1"
-	folderArgs := []interface{}{rootID}
-	if beforeTimestamp > 0 {
-		folderQuery += " AND last_scanned_at < ?"
-		folderArgs = append(folderArgs, beforeTimestamp)
-	}
-	db.QueryRow(folderQuery, folderArgs...).Scan(&folderCount)
-
-	return fileCount, folderCount
-}
-
-func performPurge(db *sql.DB, rootID int64, entityType string, beforeTimestamp int64) (purgedFiles, purgedFolders int64) {
-	// Begin transaction
-	tx, err := db.Begin()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to begin transaction: %v\n", err)
-		os.Exit(2)
-	}
-	defer tx.Rollback()
-
-	// Purge files
-	if entityType == "files" || entityType == "all" {
-		fileQuery := "DELETE FROM files WHERE root_folder_id = ? AND removed = 1"
-		fileArgs := []interface{}{rootID}
-		if beforeTimestamp > 0 {
-			fileQuery += " AND last_scanned_at < ?"
-			fileArgs = append(fileArgs, beforeTimestamp)
-		}
-		result, err := tx.Exec(fileQuery, fileArgs...)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Failed to purge files: %v\n", err)
-			os.Exit(2)
-		}
-		purgedFiles, _ = result.RowsAffected()
-	}
-
-	// Purge folders
-	if entityType == "folders" || entityType == "all" {
-		folderQuery := "DELETE FROM folders WHERE root_folder_id = ? AND removed = 1"
-		folderArgs := []interface{}{rootID}
-		if beforeTimestamp > 0 {
-			folderQuery += " AND last_scanned_at < ?"
-			folderArgs = append(folderArgs, beforeTimestamp)
-		}
-		result, err := tx.Exec(folderQuery, folderArgs...)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Failed to purge folders: %v\n", err)
-			os.Exit(2)
-		}
-		purgedFolders, _ = result.RowsAffected()
-	}
-
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to commit purge: %v\n", err)
-		os.Exit(2)
-	}
-
-	return purgedFiles, purgedFolders
-}
@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/checkpoint"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+	"github.com/jpconstantineau/dupectl/pkg/remediate"
+	"github.com/spf13/cobra"
+
+	_ "modernc.org/sqlite"
+)
+
+var (
+	quarantineListJSON  bool
+	quarantineListAll   bool
+	quarantineOlderThan string
+	quarantineDryRun    bool
+)
+
+// quarantineCmd represents the quarantine command
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "Manage files moved to quarantine",
+	Long: `List, restore or permanently remove files quarantined by
+'dupectl execute deletions --mode quarantine'.
+
+Quarantined files live in <root>/.dupectl-quarantine/<run>/<relative path>.`,
+}
+
+// quarantineListCmd represents the quarantine list command
+var quarantineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List quarantined files",
+	Long: `List files currently held in quarantine.
+
+Examples:
+  dupectl quarantine list
+  dupectl quarantine list --all --json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runQuarantineList()
+	},
+}
+
+// quarantineRestoreCmd represents the quarantine restore command
+var quarantineRestoreCmd = &cobra.Command{
+	Use:   "restore <id|original-path|run-id>...",
+	Short: "Move quarantined files back to their original paths",
+	Long: `Restore quarantined files to their original paths and return them to the catalog.
+
+Each argument is a quarantine entry ID (from 'dupectl quarantine list'), the
+original path of a file, or a run ID to restore every file of that run.
+A file is only restored if it is unchanged since it was quarantined and
+nothing exists at its original path.
+
+Examples:
+  dupectl quarantine restore 12
+  dupectl quarantine restore /data/b/photo.jpg
+  dupectl quarantine restore 20260101T120000.000000000Z-1a2b3c4d`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runQuarantineRestore(args)
+	},
+}
+
+// quarantineExpireCmd represents the quarantine expire command
+var quarantineExpireCmd = &cobra.Command{
+	Use:   "expire",
+	Short: "Permanently remove files quarantined longer than the retention window",
+	Long: `Permanently remove quarantined files older than --older-than.
+
+The retention window accepts days and weeks (30d, 2w) as well as Go
+durations (72h).
+
+Examples:
+  dupectl quarantine expire --older-than 30d --dry-run
+  dupectl quarantine expire --older-than 2w --yes`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runQuarantineExpire()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(quarantineCmd)
+	quarantineCmd.AddCommand(quarantineListCmd)
+	quarantineCmd.AddCommand(quarantineRestoreCmd)
+	quarantineCmd.AddCommand(quarantineExpireCmd)
+
+	quarantineListCmd.Flags().BoolVar(&quarantineListJSON, "json", false, "Output in JSON format")
+	quarantineListCmd.Flags().BoolVar(&quarantineListAll, "all", false, "Include restored and expired entries")
+
+	quarantineExpireCmd.Flags().StringVar(&quarantineOlderThan, "older-than", "", "Retention window, e.g. 30d, 2w, 72h (required)")
+	quarantineExpireCmd.Flags().BoolVar(&quarantineDryRun, "dry-run", false, "Report what would be removed without removing")
+	quarantineExpireCmd.MarkFlagRequired("older-than")
+}
+
+// QuarantineEntryInfo is the output form of a quarantine entry
+type QuarantineEntryInfo struct {
+	ID             int64  `json:"id"`
+	RunID          string `json:"run_id"`
+	OriginalPath   string `json:"original_path"`
+	QuarantinePath string `json:"quarantine_path"`
+	Size           int64  `json:"size"`
+	Hash           string `json:"hash,omitempty"`
+	Status         string `json:"status"`
+	QuarantinedAt  string `json:"quarantined_at"`
+}
+
+func runQuarantineList() {
+	_, db := openCatalog()
+	defer db.Close()
+
+	status := datastore.QuarantineHeld
+	if quarantineListAll {
+		status = ""
+	}
+	entries, err := datastore.GetQuarantineEntries(db, status)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to query quarantine: %v\n", err)
+		os.Exit(2)
+	}
+
+	infos := make([]QuarantineEntryInfo, 0, len(entries))
+	var totalSize int64
+	for _, e := range entries {
+		info := QuarantineEntryInfo{
+			ID:             e.ID,
+			RunID:          e.RunID,
+			OriginalPath:   e.OriginalPath,
+			QuarantinePath: e.QuarantinePath,
+			Size:           e.Size,
+			Status:         e.Status,
+			QuarantinedAt:  time.Unix(e.QuarantinedAt, 0).Format(time.RFC3339),
+		}
+		if e.HashValue != nil {
+			info.Hash = *e.HashValue
+		}
+		infos = append(infos, info)
+		totalSize += e.Size
+	}
+
+	if quarantineListJSON {
+		data, err := json.MarshalIndent(infos, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to marshal JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if len(infos) == 0 {
+		fmt.Println("No files in quarantine.")
+		return
+	}
+
+	fmt.Printf("%-6s  %-12s  %-20s  %-10s  %s\n", "ID", "Status", "Quarantined", "Size", "Original Path")
+	fmt.Println("──────────────────────────────────────────────────────────────────────────────")
+	for i, info := range infos {
+		fmt.Printf("%-6d  %-12s  %-20s  %-10s  %s\n", info.ID, info.Status,
+			time.Unix(entries[i].QuarantinedAt, 0).Format("2006-01-02 15:04:05"),
+			formatBytes(info.Size), info.OriginalPath)
+	}
+	fmt.Println()
+	fmt.Printf("Total: %d files (%s)\n", len(infos), formatBytes(totalSize))
+}
+
+func runQuarantineRestore(args []string) {
+	_, db := openCatalog()
+	defer db.Close()
+
+	ctx, cancel := checkpoint.SetupSignalHandler(nil)
+	defer cancel()
+
+	var entries []*datastore.QuarantineEntry
+	for _, arg := range args {
+		found, err := findQuarantineEntries(db, arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		entries = append(entries, found...)
+	}
+
+	quarantine := remediate.NewQuarantine(db)
+	restored, failed := 0, 0
+	for _, entry := range entries {
+		if err := quarantine.Restore(ctx, entry); err != nil {
+			fmt.Printf("✗ %s: %v\n", entry.OriginalPath, err)
+			failed++
+			continue
+		}
+		fmt.Printf("✓ %s\n", entry.OriginalPath)
+		restored++
+	}
+
+	fmt.Println()
+	fmt.Printf("Restored %d files, %d failed\n", restored, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// findQuarantineEntries resolves an entry ID, original path or run ID
+func findQuarantineEntries(db *sql.DB, arg string) ([]*datastore.QuarantineEntry, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		entry, err := datastore.GetQuarantineEntry(db, id)
+		if err == nil {
+			return []*datastore.QuarantineEntry{entry}, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	absPath, err := pathutil.ToAbsolute(arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path %s: %w", arg, err)
+	}
+	entries, err := datastore.GetHeldQuarantineEntriesBy(db, pathutil.NormalizePathForStorage(absPath), arg)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no quarantined files match %s", arg)
+	}
+	return entries, nil
+}
+
+func runQuarantineExpire() {
+	retention, err := parseRetention(quarantineOlderThan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid --older-than value '%s': %v\n", quarantineOlderThan, err)
+		os.Exit(2)
+	}
+
+	_, db := openCatalog()
+	defer db.Close()
+
+	cutoff := time.Now().Add(-retention)
+	if !quarantineDryRun && !rootYes {
+		var response string
+		fmt.Printf("Permanently remove files quarantined before %s? This cannot be undone. (y/n): ",
+			cutoff.Format("2006-01-02 15:04:05"))
+		fmt.Scanln(&response)
+
+		if response != "y" && response != "Y" && response != "yes" {
+			fmt.Println("Expire cancelled.")
+			return
+		}
+	}
+
+	quarantine := remediate.NewQuarantine(db)
+	count, bytes, err := quarantine.Expire(cutoff, quarantineDryRun, func(e *datastore.QuarantineEntry) {
+		fmt.Printf("  - %s\n", e.QuarantinePath)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Expire stopped: %v\n", err)
+	}
+
+	verb := "Removed"
+	if quarantineDryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d quarantined files (%s)\n", verb, count, formatBytes(bytes))
+	if err != nil {
+		os.Exit(2)
+	}
+}
+
+// parseRetention parses a retention window such as "30d", "2w" or "72h"
+func parseRetention(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("retention must not be empty")
+	}
+
+	var unit time.Duration
+	switch value[len(value)-1] {
+	case 'd':
+		unit = 24 * time.Hour
+	case 'w':
+		unit = 7 * 24 * time.Hour
+	}
+
+	var d time.Duration
+	if unit != 0 {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid number in %q", value)
+		}
+		d = time.Duration(n) * unit
+	} else {
+		var err error
+		d, err = time.ParseDuration(value)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("retention must not be negative")
+	}
+	return d, nil
+}
@@ -1,14 +1,16 @@
 package cmd
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // refreshCmd represents the refresh command
@@ -19,6 +21,7 @@ var refreshCmd = &cobra.Command{
 
 This operation updates folder_count, file_count, total_size, and last_scan_date
 by querying the current database state, without performing a full filesystem scan.
+In remote mode (--server) the statistics are recalculated on the server.
 
 Example:
   dupectl refresh all /path/to/root`,
@@ -36,18 +39,32 @@ Example:
 			os.Exit(1)
 		}
 
-		// Open database connection
-		db, err := openDatabaseForRefresh()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to open database: %v\n", err)
-			os.Exit(1)
+		fmt.Printf("Refreshing statistics for: %s\n", absPath)
+
+		if remoteMode() {
+			ctx := context.Background()
+			client := newRemoteClient()
+			root, err := client.RefreshRoot(ctx, findRemoteRoot(ctx, client, absPath).ID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: failed to refresh statistics: %v\n", err)
+				os.Exit(1)
+			}
+			updated := time.Now()
+			if root.LastScanDate != nil {
+				if t, err := time.Parse(time.RFC3339, *root.LastScanDate); err == nil {
+					updated = t
+				}
+			}
+			printRefreshed(root.FolderCount, root.FileCount, root.TotalSizeBytes, updated)
+			return
 		}
+
+		_, db := openCatalog()
 		defer db.Close()
 
 		// Verify root folder exists
-		var rootID int64
-		err = db.QueryRow("SELECT id FROM rootfolders WHERE path = ?", absPath).Scan(&rootID)
-		if err == sql.ErrNoRows {
+		root, err := datastore.FindRootFolderByPath(db, localHostID(db), absPath)
+		if errors.Is(err, sql.ErrNoRows) {
 			fmt.Fprintf(os.Stderr, "Error: root folder not found in database: %s\n", absPath)
 			fmt.Fprintf(os.Stderr, "Use 'dupectl add root %s' to register it first.\n", absPath)
 			os.Exit(1)
@@ -56,77 +73,21 @@ Example:
 			os.Exit(1)
 		}
 
-		fmt.Printf("Refreshing statistics for: %s\n", absPath)
-
-		// Calculate statistics from database
-		var folderCount, fileCount, totalSize int64
-
-		err = db.QueryRow("SELECT COUNT(*) FROM folders WHERE root_folder_id = ? AND removed = 0", rootID).Scan(&folderCount)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to count folders: %v\n", err)
-			os.Exit(1)
-		}
-
-		err = db.QueryRow("SELECT COUNT(*) FROM files WHERE root_folder_id = ? AND removed = 0", rootID).Scan(&fileCount)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to count files: %v\n", err)
-			os.Exit(1)
-		}
-
-		err = db.QueryRow("SELECT COALESCE(SUM(size), 0) FROM files WHERE root_folder_id = ? AND removed = 0", rootID).Scan(&totalSize)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to calculate total size: %v\n", err)
-			os.Exit(1)
-		}
-
-		// Update root folder statistics
-		now := time.Now().UTC()
-		_, err = db.Exec(`
-			UPDATE rootfolders 
-			SET folder_count = ?, 
-				file_count = ?, 
-				total_size = ?, 
-				last_scan_date = ?
-			WHERE id = ?
-		`, folderCount, fileCount, totalSize, now, rootID)
-
+		folderCount, fileCount, totalSize, err := datastore.RefreshRootFolderStats(db, root.ID)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: failed to update statistics: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-
-		// Display updated statistics
-		fmt.Printf("Folder count: %s\n", formatNumber(folderCount))
-		fmt.Printf("File count: %s\n", formatNumber(fileCount))
-		fmt.Printf("Total size: %s\n", formatBytes(totalSize))
-		fmt.Printf("Last updated: %s\n", now.Format("2006-01-02 15:04:05 MST"))
+		printRefreshed(folderCount, fileCount, totalSize, time.Now())
 	},
 }
 
-func openDatabaseForRefresh() (*sql.DB, error) {
-	dbType := viper.GetString("server.database.type")
-	if dbType != "sqlite" {
-		return nil, fmt.Errorf("only SQLite databases are currently supported")
-	}
-
-	dbPath := viper.GetString("server.database.sqlite.name")
-	if dbPath == "" {
-		return nil, fmt.Errorf("database path not configured")
-	}
-
-	db, err := sql.Open("sqlite", dbPath)
-	if err != nil {
-		return nil, err
-	}
-
-	// Enable foreign keys
-	_, err = db.Exec("PRAGMA foreign_keys = ON")
-	if err != nil {
-		db.Close()
-		return nil, err
-	}
-
-	return db, nil
+// printRefreshed displays the updated statistics of a root folder
+func printRefreshed(folderCount, fileCount, totalSize int64, updated time.Time) {
+	fmt.Printf("Folder count: %s\n", formatNumber(folderCount))
+	fmt.Printf("File count: %s\n", formatNumber(fileCount))
+	fmt.Printf("Total size: %s\n", formatBytes(totalSize))
+	fmt.Printf("Last updated: %s\n", updated.UTC().Format("2006-01-02 15:04:05 MST"))
 }
 
 func formatNumber(n int64) string {
@@ -162,4 +123,5 @@ func formatBytes(bytes int64) string {
 
 func init() {
 	rootCmd.AddCommand(refreshCmd)
+	addRemoteHostFlag(refreshCmd)
 }
@@ -4,6 +4,9 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/jpconstantineau/dupectl/pkg/apiclient"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -13,14 +16,19 @@ import (
 var registerCmd = &cobra.Command{
 	Use:   "register",
 	Short: "Register scan agent with server",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
+	Long: `Ask the server to register this machine as a scanning agent, presenting
+the server's shared API key. The server issues a credential for this agent,
+saved in a credentials file readable only by you (.dupectl-credentials.json
+next to the configuration file, or client.credentials). It becomes usable
+once an admin approves the registration on the server with
+'dupectl agent approve <id>'.
+
+Registering again replaces the credential and needs approval again.
 
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+Example:
+  dupectl register --apikey 1f0e...`,
 	Run: func(cmd *cobra.Command, args []string) {
-		apiclient.RegisterClient()
+		runRegister()
 	},
 }
 
@@ -39,3 +47,16 @@ func init() {
 	// is called directly, e.g.:
 	// registerCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+func runRegister() {
+	registration, err := apiclient.RegisterClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Registration failed: %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Printf("Registered as agent %d, %s\n", registration.AgentID, registration.Approval)
+	if path, err := apiclient.CredentialsPath(); err == nil {
+		fmt.Printf("Credential saved to %s\n", path)
+	}
+	fmt.Printf("Approve it on the server with: dupectl agent approve %d\n", registration.AgentID)
+}
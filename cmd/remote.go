@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jpconstantineau/dupectl/pkg/apiclient"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Modes of the CLI (client.mode)
+const (
+	modeLocal  = "local"  // Commands open the local catalog database
+	modeRemote = "remote" // Commands call the server's API
+)
+
+var serverAddr string
+var remoteHost string
+
+// applyServerFlag switches to remote mode against the server given with
+// --server, as host or host:port
+func applyServerFlag() {
+	if serverAddr == "" {
+		return
+	}
+	host, port, err := net.SplitHostPort(serverAddr)
+	if err != nil {
+		host, port = serverAddr, ""
+	}
+	viper.Set("client.mode", modeRemote)
+	viper.Set("client.apihost", host)
+	if port != "" {
+		viper.Set("client.apiport", port)
+	}
+}
+
+// remoteMode reports whether commands go through the server's API
+func remoteMode() bool {
+	return viper.GetString("client.mode") == modeRemote
+}
+
+// newRemoteClient connects to the configured server with this machine's
+// agent credential. The server only lets agents granted the admin role
+// manage it.
+func newRemoteClient() *apiclient.Client {
+	client, err := apiclient.NewClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	return client
+}
+
+// isStatus reports whether err is an API error with the given status
+func isStatus(err error, status int) bool {
+	var apiErr *apiclient.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// addRemoteHostFlag adds --host, choosing between the hosts registering
+// the same root folder path in remote mode
+func addRemoteHostFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&remoteHost, "host", "", "In remote mode, the host of the root folder (default: the only host registering the path)")
+}
+
+// findRemoteRoot returns the root folder registered on the server with the
+// given path, on the --host host when set
+func findRemoteRoot(ctx context.Context, client *apiclient.Client, path string) entities.RootFolderInfo {
+	roots, err := client.ListRoots(ctx, apiclient.ListRootsParams{Host: remoteHost})
+	if isStatus(err, http.StatusNotFound) {
+		fmt.Fprintf(os.Stderr, "Error: Unknown host: %s\n", remoteHost)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to query root folders: %v\n", err)
+		os.Exit(2)
+	}
+
+	var matches []entities.RootFolderInfo
+	for _, root := range roots {
+		key := pathutil.NormalizePathForComparison(path, root.CaseInsensitive)
+		if pathutil.NormalizePathForComparison(root.Path, root.CaseInsensitive) == key {
+			matches = append(matches, root)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		fmt.Fprintf(os.Stderr, "Error: Root folder not registered: %s\n", path)
+		os.Exit(1)
+	case 1:
+		return matches[0]
+	}
+	hosts := make([]string, len(matches))
+	for i, root := range matches {
+		hosts[i] = root.Host
+	}
+	fmt.Fprintf(os.Stderr, "Error: Root folder %s is registered on several hosts (%s): choose one with --host\n",
+		path, strings.Join(hosts, ", "))
+	os.Exit(2)
+	return entities.RootFolderInfo{}
+}
@@ -33,6 +33,9 @@ import (
 var cfgFile string
 var rootYes bool
 
+// version is set at build time with -ldflags "-X github.com/jpconstantineau/dupectl/cmd.version=..."
+var version = "dev"
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "dupectl",
@@ -51,6 +54,7 @@ var rootCmd = &cobra.Command{
 	
 Enables searching for Duplicate Files and manage their retention.
 Requires configuration file with database connection settings`,
+	Version: version,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -74,6 +78,7 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.dupectl.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&rootYes, "yes", "y", false, "automatic yes to prompts; assume 'yes' as answer to all prompts and run non-interactively")
+	rootCmd.PersistentFlags().StringVar(&serverAddr, "server", "", "run against the server at host[:port] instead of the local database (sets client.mode to remote)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -92,13 +97,19 @@ func setDefaults() {
 	viper.SetDefault("server.apiport", "3000")
 	viper.SetDefault("server.apikey", auth.GenerateAPISeed())
 	viper.SetDefault("server.serverid", auth.GenerateMachineID())
+	viper.SetDefault("server.agent_timeout", "90s")
+	viper.SetDefault("server.timeouts.read_header", "10s")
+	viper.SetDefault("server.timeouts.read", "1m")
+	viper.SetDefault("server.timeouts.write", "5m")
+	viper.SetDefault("server.timeouts.idle", "2m")
 
+	viper.SetDefault("client.mode", modeLocal) // remote to run commands against the server's API
 	viper.SetDefault("client.apihost", "localhost")
 	viper.SetDefault("client.apiport", "3000")
 	viper.SetDefault("client.uniqueid", auth.GenerateAPISeed())
 	viper.SetDefault("client.clientid", auth.GenerateMachineID())
 	viper.SetDefault("client.apikey", "")
-	viper.SetDefault("client.token", "")
+	viper.SetDefault("client.credentials", "") // Path of the credentials file; next to the config file when empty
 
 }
 
@@ -126,4 +137,5 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Fprintln(os.Stderr, "Using config file: ", viper.ConfigFileUsed())
 	}
+	applyServerFlag()
 }
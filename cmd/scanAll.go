@@ -5,14 +5,18 @@ package cmd
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"time"
 
 	"github.com/jpconstantineau/dupectl/internal/config"
+	"github.com/jpconstantineau/dupectl/pkg/apiclient"
 	"github.com/jpconstantineau/dupectl/pkg/checkpoint"
 	"github.com/jpconstantineau/dupectl/pkg/datastore"
 	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
 	"github.com/jpconstantineau/dupectl/pkg/logger"
 	"github.com/jpconstantineau/dupectl/pkg/pathutil"
 	"github.com/jpconstantineau/dupectl/pkg/scanner"
@@ -24,6 +28,7 @@ import (
 var (
 	scanAllProgress bool
 	scanAllRestart  bool
+	scanAllRemote   bool
 )
 
 // scanAllCmd represents the scanAll command
@@ -36,10 +41,16 @@ Calculates cryptographic hashes for duplicate detection.
 Supports checkpoint/resume: if interrupted, the scan will automatically resume
 from where it left off. Use --restart to start fresh.
 
+With --remote, or in remote mode (--server), results are pushed to the
+server configured under client.* (see 'dupectl register') instead of the
+local database. The root folder is registered on the server for this
+machine's host. Remote scans keep no checkpoint.
+
 Examples:
   dupectl scan all /home/user/documents --progress
   dupectl scan all "C:\Users\user\Documents" --restart
-  dupectl scan all ../relative/path`,
+  dupectl scan all ../relative/path
+  dupectl scan all /srv/share --remote`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		runScanAll(args[0])
@@ -51,6 +62,7 @@ func init() {
 
 	scanAllCmd.Flags().BoolVar(&scanAllProgress, "progress", false, "Display real-time progress")
 	scanAllCmd.Flags().BoolVar(&scanAllRestart, "restart", false, "Restart scan from beginning")
+	scanAllCmd.Flags().BoolVar(&scanAllRemote, "remote", false, "Push results to the configured server")
 }
 
 func runScanAll(rootFolderPath string) {
@@ -74,22 +86,17 @@ func runScanAll(rootFolderPath string) {
 		os.Exit(2)
 	}
 
-	// Initialize database
-	db, err := sql.Open("sqlite", cfg.DatabasePath+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(ON)")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to open database: %v\n", err)
-		os.Exit(2)
+	if scanAllRemote || remoteMode() {
+		runRemoteScanAll(absPath, cfg)
+		return
 	}
-	defer db.Close()
 
-	// Run migrations
-	if err := datastore.RunMigrations(db); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: Failed to run migrations: %v\n", err)
-		os.Exit(2)
-	}
+	_, db := openCatalog()
+	defer db.Close()
 
-	// Check if root folder is registered
-	rootFolder, err := getRootFolderByPath(db, absPath)
+	// Check if root folder is registered on this host
+	hostID := localHostID(db)
+	rootFolder, err := getRootFolderByPath(db, hostID, absPath)
 	if err != nil {
 		// Root not registered, prompt user
 		fmt.Printf("Root folder not registered. Register now? (y/n): ")
@@ -102,7 +109,7 @@ func runScanAll(rootFolderPath string) {
 		}
 
 		// Register root folder
-		rootFolder, err = registerRootFolder(db, absPath)
+		rootFolder, err = registerRootFolder(db, hostID, absPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: Failed to register root folder: %v\n", err)
 			os.Exit(2)
@@ -110,6 +117,17 @@ func runScanAll(rootFolderPath string) {
 		fmt.Printf("Root folder registered with ID: %d\n", rootFolder.ID)
 	}
 
+	// Scan under the registered spelling of the path so stored paths stay
+	// consistent on case-insensitive filesystems
+	absPath = rootFolder.Path
+
+	// Device numbers can change between mounts, so refresh the recorded one
+	if device, err := pathutil.DeviceID(absPath); err == nil {
+		if err := datastore.UpdateRootFolderDevice(db, int64(rootFolder.ID), device); err != nil {
+			logger.Warn("Failed to record the device of %s: %v", absPath, err)
+		}
+	}
+
 	// Setup signal handling for graceful shutdown
 	ctx, cancel := checkpoint.SetupSignalHandler(func() {
 		logger.Info("Saving checkpoint before exit...")
@@ -126,6 +144,7 @@ func runScanAll(rootFolderPath string) {
 		ShowProgress:     scanAllProgress,
 		ProgressInterval: time.Duration(cfg.ProgressInterval) * time.Second,
 		TraverseLinks:    false, // Default to not following symlinks
+		CaseInsensitive:  rootFolder.CaseInsensitive,
 	}
 
 	s, err := scanner.NewScanner(db, scannerCfg)
@@ -157,28 +176,104 @@ func runScanAll(rootFolderPath string) {
 	fmt.Printf("Duplicates found: %d files in %d sets\n", dupFiles, dupSets)
 }
 
+// runRemoteScanAll scans a root folder of this machine and pushes the
+// results to the server, which assigns all catalog IDs
+func runRemoteScanAll(absPath string, cfg *config.Config) {
+	client, err := apiclient.NewClient()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	// Setup signal handling for graceful shutdown
+	ctx, cancel := checkpoint.SetupSignalHandler(func() {
+		logger.Info("Stopping remote scan...")
+	})
+	defer cancel()
+
+	start := entities.IngestStart{Path: absPath}
+	if device, err := pathutil.DeviceID(absPath); err == nil {
+		start.Device = device
+	}
+	root, err := client.StartIngest(ctx, start)
+	var apiErr *apiclient.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		// Root not registered on the server, prompt user
+		fmt.Printf("Root folder not registered on the server. Register now? (y/n): ")
+		var response string
+		fmt.Scanln(&response)
+
+		if response != "y" && response != "Y" {
+			fmt.Println("Scan cancelled.")
+			os.Exit(0)
+		}
+
+		start.Register = true
+		start.CaseInsensitive = detectCaseInsensitive(absPath)
+		root, err = client.StartIngest(ctx, start)
+		if err == nil {
+			fmt.Printf("Root folder registered with ID: %d\n", root.ID)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to start remote scan: %v\n", err)
+		os.Exit(2)
+	}
+
+	scannerCfg := &scanner.Config{
+		RootFolderID:     root.ID,
+		RootPath:         root.Path,
+		ScanMode:         "all",
+		HashAlgorithm:    cfg.HashAlgorithm,
+		WorkerCount:      cfg.WorkerCount,
+		ShowProgress:     scanAllProgress,
+		ProgressInterval: time.Duration(cfg.ProgressInterval) * time.Second,
+		TraverseLinks:    false, // Default to not following symlinks
+		CaseInsensitive:  root.CaseInsensitive,
+		Sink:             scanner.NewRemoteSink(client, root.ID),
+	}
+
+	s, err := scanner.NewScanner(nil, scannerCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Failed to create scanner: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("Scanning root folder: %s (pushing to server)\n", root.Path)
+	if err := s.Scan(ctx, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Scan failed: %v\n", err)
+		os.Exit(2)
+	}
+
+	folders, files, duration := s.GetSummary()
+	fmt.Printf("\nScan completed in %s\n", duration)
+	fmt.Printf("Folders scanned: %d\n", folders)
+	fmt.Printf("Files scanned: %d\n", files)
+}
+
 // Temporary helpers - these should be moved to proper datastore functions
 
 type RootFolder struct {
-	ID   int
-	Path string
+	ID              int
+	Path            string
+	CaseInsensitive bool
 }
 
-func getRootFolderByPath(db *sql.DB, path string) (*RootFolder, error) {
-	var rf RootFolder
-	err := db.QueryRow("SELECT id, path FROM root_folders WHERE path = ?", path).Scan(&rf.ID, &rf.Path)
+func getRootFolderByPath(db *sql.DB, hostID int64, path string) (*RootFolder, error) {
+	rf, err := datastore.FindRootFolderByPath(db, hostID, path)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("root folder not registered")
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &rf, nil
+	return &RootFolder{ID: int(rf.ID), Path: rf.Path, CaseInsensitive: rf.CaseInsensitive}, nil
 }
 
-func registerRootFolder(db *sql.DB, path string) (*RootFolder, error) {
-	// Simple registration - in real implementation this would check for agent, host, etc.
-	result, err := db.Exec("INSERT INTO root_folders (path, traverse_links) VALUES (?, 0)", path)
+func registerRootFolder(db *sql.DB, hostID int64, path string) (*RootFolder, error) {
+	// Simple registration - in real implementation this would check for agent, etc.
+	caseInsensitive := detectCaseInsensitive(path)
+	result, err := db.Exec("INSERT INTO root_folders (host_id, path, traverse_links, case_insensitive) VALUES (?, ?, 0, ?)", hostID, path, caseInsensitive)
 	if err != nil {
 		return nil, err
 	}
@@ -188,5 +283,16 @@ func registerRootFolder(db *sql.DB, path string) (*RootFolder, error) {
 		return nil, err
 	}
 
-	return &RootFolder{ID: int(id), Path: path}, nil
+	return &RootFolder{ID: int(id), Path: path, CaseInsensitive: caseInsensitive}, nil
+}
+
+// detectCaseInsensitive probes the filesystem holding path, falling back to
+// the platform default when the probe cannot run (e.g. read-only media)
+func detectCaseInsensitive(path string) bool {
+	caseInsensitive, err := pathutil.ProbeCaseInsensitive(path)
+	if err != nil {
+		caseInsensitive = pathutil.DefaultCaseInsensitive()
+		logger.Warn("Cannot probe case sensitivity of %s (%v), assuming case-insensitive=%v", path, err, caseInsensitive)
+	}
+	return caseInsensitive
 }
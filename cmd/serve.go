@@ -22,6 +22,12 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/jpconstantineau/dupectl/pkg/api"
 	"github.com/spf13/cobra"
 )
@@ -32,9 +38,16 @@ var serveCmd = &cobra.Command{
 	Short: "Launches Duplicate File Manager Web Server and API",
 	Long: `Launches Duplicate File Manager Web Server and API
 	
-	Uses parameters in server section of .dupectl.yaml`,
+	Uses parameters in server section of .dupectl.yaml. On SIGINT or SIGTERM
+	the server stops accepting connections and finishes the requests in
+	flight before exiting.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		api.RunApi()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := api.RunApi(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
 	},
 }
 
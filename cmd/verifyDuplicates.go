@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jpconstantineau/dupectl/pkg/checkpoint"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/spf13/cobra"
+
+	_ "modernc.org/sqlite"
+)
+
+var (
+	verifyDuplicatesSet     string
+	verifyDuplicatesJSON    bool
+	verifyDuplicatesMinSize string
+)
+
+// verifyDuplicatesCmd represents the verify duplicates command
+var verifyDuplicatesCmd = &cobra.Command{
+	Use:   "duplicates",
+	Short: "Compare duplicate files byte-for-byte before remediation",
+	Long: `Re-read the files of each duplicate set and compare them byte-for-byte.
+
+Each file's size and modification time are re-checked against the catalog.
+Sets are recorded as:
+  verified    all files present, unchanged since hashing and identical
+  stale       a file changed or disappeared since it was hashed (re-scan)
+  mismatched  files share a hash but their contents differ
+
+Results are stored so that remediation commands only act on verified sets.
+
+Examples:
+  dupectl verify duplicates
+  dupectl verify duplicates --set 09e1d4d80f968e45
+  dupectl verify duplicates --min-size 1M --json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runVerifyDuplicates()
+	},
+}
+
+func init() {
+	verifyCmd.AddCommand(verifyDuplicatesCmd)
+
+	verifyDuplicatesCmd.Flags().StringVar(&verifyDuplicatesSet, "set", "", "Only verify the set with this hash (or unambiguous hash prefix)")
+	verifyDuplicatesCmd.Flags().BoolVar(&verifyDuplicatesJSON, "json", false, "Output results in JSON format")
+	verifyDuplicatesCmd.Flags().StringVar(&verifyDuplicatesMinSize, "min-size", "0", "Minimum file size (e.g., 1M, 512K, 1024) - 0 = no minimum")
+}
+
+// SetVerificationInfo is the output form of a set verification
+type SetVerificationInfo struct {
+	Hash       string                 `json:"hash"`
+	Size       int64                  `json:"size"`
+	Status     string                 `json:"status"`
+	VerifiedAt int64                  `json:"verified_at"`
+	Files      []FileVerificationInfo `json:"files"`
+}
+
+// FileVerificationInfo is the output form of a file verification
+type FileVerificationInfo struct {
+	Path   string  `json:"path"`
+	Status string  `json:"status"`
+	Detail *string `json:"detail,omitempty"`
+}
+
+func runVerifyDuplicates() {
+	minSize, err := parseSize(verifyDuplicatesMinSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: Invalid --min-size value '%s': %v\n", verifyDuplicatesMinSize, err)
+		os.Exit(2)
+	}
+
+	_, db := openCatalog()
+	defer db.Close()
+
+	ctx, cancel := checkpoint.SetupSignalHandler(nil)
+	defer cancel()
+
+	detector := duplicate.NewDetector(db)
+	verifier := duplicate.NewVerifier(db)
+
+	var results []SetVerificationInfo
+	verify := func(set *duplicate.DuplicateSet) error {
+		v, err := verifier.VerifySet(ctx, set)
+		if err != nil {
+			return fmt.Errorf("set %s: %w", set.Hash, err)
+		}
+		info := newSetVerificationInfo(v)
+		if !verifyDuplicatesJSON {
+			printSetVerification(info)
+		}
+		results = append(results, info)
+		return nil
+	}
+
+	if verifyDuplicatesSet != "" {
+		set, err := detector.GetSet(verifyDuplicatesSet)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		err = verify(set)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Verification failed: %v\n", err)
+			os.Exit(2)
+		}
+	} else {
+		_, err = detector.StreamDuplicateSets(duplicate.QueryOptions{MinSize: minSize}, verify)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: Verification failed: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	counts := map[string]int{
+		datastore.VerificationVerified:   0,
+		datastore.VerificationStale:      0,
+		datastore.VerificationMismatched: 0,
+	}
+	for _, r := range results {
+		counts[r.Status]++
+	}
+
+	if verifyDuplicatesJSON {
+		outputVerifyDuplicatesJSON(results, counts)
+	} else {
+		fmt.Println()
+		fmt.Printf("Summary: %d sets checked, %d verified, %d stale, %d mismatched\n",
+			len(results), counts[datastore.VerificationVerified],
+			counts[datastore.VerificationStale], counts[datastore.VerificationMismatched])
+		if counts[datastore.VerificationStale] > 0 {
+			fmt.Println("Re-scan the affected root folders to refresh stale sets.")
+		}
+	}
+
+	// Exit with error code if any set could not be verified
+	if counts[datastore.VerificationStale] > 0 || counts[datastore.VerificationMismatched] > 0 {
+		os.Exit(1)
+	}
+}
+
+func newSetVerificationInfo(v *datastore.DuplicateVerification) SetVerificationInfo {
+	info := SetVerificationInfo{
+		Hash:       v.HashValue,
+		Size:       v.Size,
+		Status:     v.Status,
+		VerifiedAt: v.VerifiedAt,
+		Files:      make([]FileVerificationInfo, 0, len(v.Files)),
+	}
+	for _, f := range v.Files {
+		info.Files = append(info.Files, FileVerificationInfo{Path: f.Path, Status: f.Status, Detail: f.Detail})
+	}
+	return info
+}
+
+func printSetVerification(info SetVerificationInfo) {
+	symbol := "✓"
+	switch info.Status {
+	case datastore.VerificationStale:
+		symbol = "⚠"
+	case datastore.VerificationMismatched:
+		symbol = "✗"
+	}
+
+	fmt.Printf("%s %-10s  %s...  %d files, %s each\n",
+		symbol, info.Status, info.Hash[:16], len(info.Files), formatBytes(info.Size))
+
+	if info.Status == datastore.VerificationVerified {
+		return
+	}
+	for _, f := range info.Files {
+		if f.Status == datastore.VerificationFileMatch {
+			continue
+		}
+		detail := ""
+		if f.Detail != nil {
+			detail = ": " + *f.Detail
+		}
+		fmt.Printf("  - [%s] %s%s\n", f.Status, f.Path, detail)
+	}
+}
+
+func outputVerifyDuplicatesJSON(results []SetVerificationInfo, counts map[string]int) {
+	if results == nil {
+		results = []SetVerificationInfo{}
+	}
+	output := map[string]interface{}{
+		"sets": results,
+		"summary": map[string]int{
+			"sets_checked": len(results),
+			"verified":     counts[datastore.VerificationVerified],
+			"stale":        counts[datastore.VerificationStale],
+			"mismatched":   counts[datastore.VerificationMismatched],
+		},
+	}
+
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to marshal JSON: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
@@ -12,6 +12,8 @@ type Config struct {
 	WorkerCount      int
 	ProgressInterval int // seconds
 	DatabasePath     string
+	KeeperRules      []string // Ordered keeper selection rules for duplicate sets
+	RemediationMode  string   // "delete" or "quarantine"
 }
 
 // LoadConfig loads configuration from file and environment
@@ -20,6 +22,8 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("scan.concurrent_hashers", 4)
 	viper.SetDefault("scan.progress_interval", "10s")
 	viper.SetDefault("server.database.sqlite.name", "./dupedb.db")
+	viper.SetDefault("duplicates.keeper_rules", []string{"priority", "shortest-path", "oldest"})
+	viper.SetDefault("remediation.mode", "delete")
 
 	// Load from config file
 	viper.SetConfigName(".dupectl")
@@ -43,5 +47,7 @@ func LoadConfig() (*Config, error) {
 		WorkerCount:      viper.GetInt("scan.concurrent_hashers"),
 		ProgressInterval: progressSeconds,
 		DatabasePath:     viper.GetString("server.database.sqlite.name"),
+		KeeperRules:      viper.GetStringSlice("duplicates.keeper_rules"),
+		RemediationMode:  viper.GetString("remediation.mode"),
 	}, nil
 }
@@ -1,62 +1,394 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
 	"github.com/jpconstantineau/dupectl/pkg/auth"
 	"github.com/jpconstantineau/dupectl/pkg/datastore"
 	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/tlsutil"
+	"github.com/spf13/viper"
 )
 
+// HandleAgent lets admins manage registered agents. Agents register
+// through /api/agent/register.
+//
+//	GET    /api/agent           list agents
+//	GET    /api/agent?id=<id>   get one agent
+//	PUT    /api/agent?id=<id>   approve, revoke, enable or disable an agent,
+//	                            or grant or withdraw its admin role
+//	                            (AgentUpdate)
+//	DELETE /api/agent?id=<id>   delete an agent
 func HandleAgent(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		fmt.Fprintf(w, "super secret Create Agents")
+	db, err := datastore.OpenDb()
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer db.Close()
+
+	idText := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idText)
+	if idText != "" && err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, fmt.Sprintf("invalid agent ID %q", idText))
+		return
+	}
+	if idText == "" && (r.Method == http.MethodPut || r.Method == http.MethodDelete) {
+		apiutil.WriteError(w, http.StatusBadRequest, "id query parameter is required")
+		return
 	}
-	if r.Method == http.MethodGet {
-		data, err := datastore.GetAgent()
+
+	switch r.Method {
+	case http.MethodGet:
+		// Statuses are only as fresh as the last sweep
+		if _, err := datastore.MarkStaleAgentsOffline(db, datastore.AgentHeartbeatTimeout()); err != nil {
+			apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if idText == "" {
+			agents, err := datastore.GetAgents(db)
+			if err != nil {
+				apiutil.WriteDatastoreError(w, err)
+				return
+			}
+			apiutil.WriteJSON(w, http.StatusOK, agents)
+			return
+		}
+		agent, err := datastore.GetAgentByID(db, id)
 		if err != nil {
-			fmt.Fprintf(w, err.Error())
-		} else {
-			response, _ := json.Marshal(data)
-			w.Header().Set("content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write(response)
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		apiutil.WriteJSON(w, http.StatusOK, agent)
+
+	case http.MethodPut:
+		var req entities.AgentUpdate
+		if err := apiutil.DecodeJSON(r, &req); err != nil {
+			apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		switch req.Approval {
+		case "":
+		case entities.AgentApproved:
+			err = datastore.ApproveAgent(db, id)
+		case entities.AgentRevoked:
+			err = datastore.RevokeAgent(db, id)
+		default:
+			err = fmt.Errorf("%w: approval must be %s or %s", datastore.ErrInvalid, entities.AgentApproved, entities.AgentRevoked)
+		}
+		if err == nil && req.Enabled != nil {
+			err = datastore.SetAgentEnabled(db, id, *req.Enabled)
+		}
+		if err == nil && req.Admin != nil {
+			err = datastore.SetAgentAdmin(db, id, *req.Admin)
+		}
+		if err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		agent, err := datastore.GetAgentByID(db, id)
+		if err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		apiutil.WriteJSON(w, http.StatusOK, agent)
+
+	case http.MethodDelete:
+		if err := datastore.DeleteAgent(db, id); err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// HandleHeartbeat records the heartbeat of the agent the token was issued
+// to and returns the agent as the server sees it, so that it learns
+// whether it is enabled.
+//
+//	POST /api/agent/heartbeat   (AgentHeartbeat)
+func HandleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	db, err := datastore.OpenDb()
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer db.Close()
+
+	agent, err := apiutil.RequestAgent(db, r)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	var hb entities.AgentHeartbeat
+	if err := apiutil.DecodeJSON(r, &hb); err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	agent, err = datastore.RecordHeartbeat(db, agent.Id, hb)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	apiutil.WriteJSON(w, http.StatusOK, agent)
+}
+
+// MonitorHeartbeats marks agents that missed their heartbeats offline until
+// ctx is done
+func MonitorHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(datastore.AgentHeartbeatTimeout() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			markStaleAgents()
 		}
 	}
-	if r.Method == http.MethodPut {
-		fmt.Fprintf(w, "super secret Update Agents")
+}
+
+func markStaleAgents() {
+	db, err := datastore.OpenDb()
+	if err != nil {
+		logger.Warn("Failed to open database to check agent heartbeats: %v", err)
+		return
 	}
-	if r.Method == http.MethodDelete {
-		fmt.Fprintf(w, "super secret Delete Agents")
+	defer db.Close()
+
+	n, err := datastore.MarkStaleAgentsOffline(db, datastore.AgentHeartbeatTimeout())
+	if err != nil {
+		logger.Warn("Failed to mark stale agents offline: %v", err)
+		return
+	}
+	if n > 0 {
+		logger.Info("Marked %d agents offline after missed heartbeats", n)
 	}
 }
 
+// RegisterAgent records a registration request from a machine presenting
+// the shared API key and returns a new credential for the agent. The
+// registration stays pending until an admin approves it with
+// 'dupectl agent approve'. Registering again issues a new credential and
+// needs approval again, since the shared key and IDs are not secret.
+//
+//	POST /api/agent/register   (Key, Clientid and Uniqueid headers)
 func RegisterAgent(w http.ResponseWriter, r *http.Request) {
-	if r.Header["Clientid"] == nil {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
-	if r.Header["Uniqueid"] == nil {
+	machineID := r.Header.Get("Clientid")
+	uniqueid := r.Header.Get("Uniqueid")
+	if machineID == "" || uniqueid == "" {
+		apiutil.WriteError(w, http.StatusBadRequest, "Clientid and Uniqueid headers are required")
 		return
 	}
-	clientid, err := auth.DecodeMachineID(r.Header["Clientid"][0])
+	clientid, err := auth.DecodeMachineID(machineID)
 	if err != nil {
-		fmt.Println("Invalid ClientID")
+		apiutil.WriteError(w, http.StatusBadRequest, "invalid Clientid header")
+		return
+	}
+	var req entities.AgentRegistrationRequest
+	if r.ContentLength != 0 {
+		if err := apiutil.DecodeJSON(r, &req); err != nil {
+			apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.CSR == "" && viper.GetBool("server.tls.require_client_cert") {
+		apiutil.WriteError(w, http.StatusBadRequest,
+			"server requires client certificates: configure client.tls and register again")
 		return
 	}
-	uniqueid := string(r.Header["Uniqueid"][0])
-	agent := entities.Agent{Name: clientid, Guid: uniqueid, Updated: time.Now(), Status: entities.StatusRegistered}
-	data, err := datastore.PostAgent(agent)
+
+	// The agent's machine becomes a host that its root folders belong to
+	host, err := registerAgentHost(machineID, clientid)
 	if err != nil {
-		fmt.Println(err.Error())
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	/*	response, _ := json.Marshal(data)
-		w.Header().Set("content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(response)
-	*/
-	fmt.Println("registered: ", data.Id, data.Name, data.Guid, data.Status.String())
+
+	db, err := datastore.OpenDb()
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer db.Close()
+
+	// The agent is only recorded once its certificate and credential are
+	// issued, so a rejected certificate request leaves nothing behind
+	tx, err := db.Begin()
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	agent := entities.Agent{Name: clientid, Guid: uniqueid, Enabled: true, Updated: time.Now(), Status: entities.StatusPending, HostID: host.Id}
+	data, err := datastore.PostAgent(tx, agent)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	var certificate []byte
+	if req.CSR != "" {
+		if certificate, err = issueAgentCert(req.CSR, data.Id); err != nil {
+			apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	credential, err := datastore.IssueAgentCredential(tx, data.Id)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.Info("Agent %d (%s) registered, pending approval", data.Id, data.Name)
+	apiutil.WriteJSON(w, http.StatusAccepted, entities.AgentRegistration{
+		AgentID:     data.Id,
+		Approval:    entities.AgentPending,
+		Credential:  credential,
+		Certificate: string(certificate),
+	})
+}
+
+// issueAgentCert signs the certificate request of an agent with the
+// server's CA. Without a CA no certificate is issued, and agents only
+// authenticate with their credential.
+func issueAgentCert(csr string, agentID int) ([]byte, error) {
+	caCert, caKey := viper.GetString("server.tls.ca_cert"), viper.GetString("server.tls.ca_key")
+	if caCert == "" || caKey == "" {
+		if viper.GetBool("server.tls.require_client_cert") {
+			return nil, fmt.Errorf("server requires client certificates but has no CA key to issue them")
+		}
+		return nil, nil
+	}
+	ca, err := tlsutil.LoadCA(caCert, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load CA: %w", err)
+	}
+	return ca.SignAgentCSR([]byte(csr), agentID)
+}
+
+// HandleToken exchanges the credential of an approved agent for a token.
+// Pending agents get 403 until approved; revoked or unknown credentials
+// get 401.
+//
+//	POST /api/agent/token   (Credential header)
+func HandleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	db, err := datastore.OpenDb()
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer db.Close()
+
+	agent, err := datastore.AuthenticateAgent(db, r.Header.Get("Credential"))
+	if errors.Is(err, sql.ErrNoRows) {
+		apiutil.WriteError(w, http.StatusUnauthorized, "invalid or revoked credential: run 'dupectl register'")
+		return
+	}
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if agent.Approval != entities.AgentApproved {
+		apiutil.WriteError(w, http.StatusForbidden,
+			fmt.Sprintf("agent %d is awaiting approval: run 'dupectl agent approve %d' on the server", agent.Id, agent.Id))
+		return
+	}
+	if err := apiutil.CheckClientCert(r, agent.Id); err != nil {
+		apiutil.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	writeToken(w, agent)
+}
+
+// HandleRefresh exchanges a token that has not expired yet for a new one,
+// so that running agents need not present their credential again
+//
+//	POST /api/agent/refresh   (Token header)
+func HandleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	db, err := datastore.OpenDb()
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer db.Close()
+
+	agent, err := apiutil.RequestAgent(db, r)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	writeToken(w, agent)
+}
+
+// writeToken issues a new token to an approved agent, with the admin role
+// when it was granted one
+func writeToken(w http.ResponseWriter, agent entities.Agent) {
+	role := auth.RoleAgent
+	if agent.Admin {
+		role = auth.RoleAdmin
+	}
+	machineID := base64.StdEncoding.EncodeToString([]byte(agent.Name))
+	token, expires, err := auth.CreateJWT(machineID, agent.Guid, agent.Id, role)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	apiutil.WriteJSON(w, http.StatusOK, entities.AgentToken{Token: token, ExpiresAt: expires.Unix()})
+}
+
+// registerAgentHost returns the host of the machine with the given client
+// ID, named after its hostname (the decoded ID without the MAC suffix)
+func registerAgentHost(machineID, decoded string) (entities.Host, error) {
+	db, err := datastore.OpenDb()
+	if err != nil {
+		return entities.Host{}, err
+	}
+	defer db.Close()
+
+	name := decoded
+	if i := strings.LastIndex(decoded, "-"); i > 0 {
+		name = decoded[:i]
+	}
+	return datastore.RegisterHost(db, machineID, name)
 }
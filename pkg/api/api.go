@@ -1,41 +1,87 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 
 	agent "github.com/jpconstantineau/dupectl/pkg/api/agent"
-	host "github.com/jpconstantineau/dupectl/pkg/api/host"
-	owner "github.com/jpconstantineau/dupectl/pkg/api/owner"
-	policy "github.com/jpconstantineau/dupectl/pkg/api/policy"
-	purpose "github.com/jpconstantineau/dupectl/pkg/api/purpose"
-	root "github.com/jpconstantineau/dupectl/pkg/api/rootfolder"
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
 	"github.com/jpconstantineau/dupectl/pkg/auth"
-	"github.com/jpconstantineau/dupectl/pkg/web"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/tlsutil"
 	"github.com/spf13/viper"
 )
 
 func ApiHome(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "super secret area")
+	apiutil.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
-func RunApi() {
+// secured requires a valid token of an approved, enabled agent
+func secured(next func(w http.ResponseWriter, r *http.Request)) http.Handler {
+	return auth.ValidateJWT(apiutil.RequireAgent(next))
+}
+
+// admin requires a valid admin token of an agent granted the admin role
+func admin(next func(w http.ResponseWriter, r *http.Request)) http.Handler {
+	return auth.ValidateJWT(apiutil.RequireAdmin(next))
+}
+
+// RunApi serves the API configured under server.* until ctx is done
+func RunApi(ctx context.Context) error {
 
 	port := viper.GetString("server.apiport")
 
-	http.Handle("/api", auth.ValidateJWT(ApiHome))
-	http.Handle("/api/agent", auth.ValidateJWT(agent.HandleAgent))
-	http.Handle("/api/host", auth.ValidateJWT(host.HandleHost))
-	http.Handle("/api/owner", auth.ValidateJWT(owner.HandleOwner))
-	http.Handle("/api/policy", auth.ValidateJWT(policy.HandlePolicy))
-	http.Handle("/api/purpose", auth.ValidateJWT(purpose.HandlePurpose))
-	http.Handle("/api/root", auth.ValidateJWT(root.HandleRoot))
-
-	http.Handle("/api/agent/register", auth.RegisterJWT(agent.RegisterAgent))
-	//http.HandleFunc("/register", auth.GetJWT)
-	web.SetupStaticWeb()
-	fmt.Println("serving on port " + port)
-	http.ListenAndServe(":"+port, nil)
+	// Handlers expect the current schema
+	datastore.InitAllTables()
+
+	if err := auth.LoadSecret(); err != nil {
+		return err
+	}
+
+	tlsConfig, err := serverTLSConfig()
+	if err != nil {
+		return err
+	}
+	server := NewServer(":"+port, tlsConfig, Timeouts{
+		ReadHeader: viper.GetDuration("server.timeouts.read_header"),
+		Read:       viper.GetDuration("server.timeouts.read"),
+		Write:      viper.GetDuration("server.timeouts.write"),
+		Idle:       viper.GetDuration("server.timeouts.idle"),
+	})
+
+	go agent.MonitorHeartbeats(ctx)
+
+	if tlsConfig != nil {
+		logger.Info("Serving with TLS on port %s", port)
+	} else {
+		logger.Info("Serving on port %s", port)
+	}
+	return server.Run(ctx)
+}
+
+// serverTLSConfig loads the server's certificate when TLS is configured
+func serverTLSConfig() (*tls.Config, error) {
+	certFile := viper.GetString("server.tls.cert")
+	if certFile == "" {
+		return nil, nil
+	}
+
+	// Client certificates are verified against the CA that issues them
+	clientCA := ""
+	if viper.GetBool("server.tls.require_client_cert") {
+		clientCA = viper.GetString("server.tls.ca_cert")
+		if clientCA == "" {
+			return nil, fmt.Errorf("server.tls.require_client_cert needs server.tls.ca_cert")
+		}
+	}
+	tlsConfig, err := tlsutil.ServerConfig(certFile, viper.GetString("server.tls.key"), clientCA)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS certificate: %w", err)
+	}
+	return tlsConfig, nil
 }
 
 // agent
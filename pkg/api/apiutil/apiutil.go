@@ -0,0 +1,252 @@
+package apiutil
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/tlsutil"
+	"github.com/spf13/viper"
+)
+
+// ErrorResponse is the JSON body of every error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// WriteJSON writes v as a JSON response with the given status
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// WriteError writes a JSON error response
+func WriteError(w http.ResponseWriter, status int, message string) {
+	response, _ := json.Marshal(ErrorResponse{Error: message})
+	w.Header().Set("content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// WriteDatastoreError maps a datastore error to its HTTP status
+func WriteDatastoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		WriteError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, datastore.ErrExists):
+		WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, datastore.ErrInvalid):
+		WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// DecodeJSON decodes a JSON request body into v
+func DecodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// AgentHost returns the host of the agent the request's token was issued
+// to, which limits the roots an agent may work on
+func AgentHost(db *sql.DB, r *http.Request) (entities.Host, error) {
+	agent, err := RequestAgent(db, r)
+	if err != nil {
+		return entities.Host{}, err
+	}
+	host, err := datastore.GetHostByID(db, agent.HostID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return host, fmt.Errorf("agent %d has no host: run 'dupectl register'", agent.Id)
+	}
+	return host, err
+}
+
+// RequestAgent returns the agent the request's token was issued to, as
+// long as its credential has not been revoked since
+func RequestAgent(db *sql.DB, r *http.Request) (entities.Agent, error) {
+	id, err := auth.AgentID(r)
+	if err != nil {
+		return entities.Agent{}, err
+	}
+	agent, err := datastore.GetAgentByID(db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return agent, fmt.Errorf("agent %d is not registered: run 'dupectl register'", id)
+	}
+	if err != nil {
+		return agent, err
+	}
+	switch agent.Approval {
+	case entities.AgentPending:
+		return agent, fmt.Errorf("agent %d is awaiting approval", id)
+	case entities.AgentRevoked:
+		return agent, fmt.Errorf("credential of agent %d was revoked: run 'dupectl register'", id)
+	}
+	return agent, nil
+}
+
+// CheckClientCert checks that a request comes with the client certificate
+// issued to the agent when the server requires client certificates
+// (server.tls.require_client_cert). The TLS handshake has verified that
+// the certificate was issued by the server's CA.
+func CheckClientCert(r *http.Request, agentID int) error {
+	if !viper.GetBool("server.tls.require_client_cert") {
+		return nil
+	}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return fmt.Errorf("client certificate required: register again with client.tls configured")
+	}
+	if cn := r.TLS.VerifiedChains[0][0].Subject.CommonName; cn != tlsutil.AgentCommonName(agentID) {
+		return fmt.Errorf("client certificate %s was not issued to agent %d", cn, agentID)
+	}
+	return nil
+}
+
+// RequireAgent lets through requests whose token belongs to an agent that
+// is still approved and enabled, so that revoking a credential or disabling
+// an agent takes effect before the agent's tokens expire, and that present
+// the agent's client certificate when required
+func RequireAgent(next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return requireAgent(next, false, false)
+}
+
+// RequireApprovedAgent is RequireAgent for the few requests a disabled agent
+// still makes, such as heartbeats that tell it when it is enabled again
+func RequireApprovedAgent(next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return requireAgent(next, true, false)
+}
+
+// RequireAdmin is RequireAgent for requests that manage the server, which
+// only agents granted the admin role may make. The token must carry the
+// role too: tokens issued before the role was withdrawn are refused, and
+// tokens issued before it was granted are refused with 401 so that the
+// client gets a new one.
+func RequireAdmin(next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return requireAgent(next, false, true)
+}
+
+func requireAgent(next func(w http.ResponseWriter, r *http.Request), allowDisabled, admin bool) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db, err := datastore.OpenDb()
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		agent, err := RequestAgent(db, r)
+		db.Close()
+		switch {
+		case err != nil:
+		case !agent.Enabled && !allowDisabled:
+			err = fmt.Errorf("agent %d is disabled: run 'dupectl agent enable %d' on the server", agent.Id, agent.Id)
+		case admin && !agent.Admin:
+			err = fmt.Errorf("agent %d is not an admin: run 'dupectl agent grant-admin %d' on the server", agent.Id, agent.Id)
+		default:
+			err = CheckClientCert(r, agent.Id)
+		}
+		if err != nil {
+			WriteError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if role, err := auth.Role(r); admin && (err != nil || role != auth.RoleAdmin) {
+			WriteError(w, http.StatusUnauthorized, "not authorized: token was issued without the admin role")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// NamedResource serves a metadata resource identified by name:
+//
+//	GET    /api/<kind>              list all
+//	GET    /api/<kind>?name=<name>  get one
+//	POST   /api/<kind>              create from the JSON body
+//	PUT    /api/<kind>?name=<name>  replace from the JSON body
+//	DELETE /api/<kind>?name=<name>  delete
+type NamedResource[T any] struct {
+	List   func(db *sql.DB) ([]T, error)
+	Get    func(db *sql.DB, name string) (T, error)
+	Create func(db *sql.DB, item T) (T, error)
+	Update func(db *sql.DB, name string, item T) (T, error)
+	Delete func(db *sql.DB, name string) error
+}
+
+// ServeHTTP dispatches on the request method
+func (res NamedResource[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	db, err := datastore.OpenDb()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer db.Close()
+
+	name := r.URL.Query().Get("name")
+	needsName := r.Method == http.MethodPut || r.Method == http.MethodDelete
+	if needsName && name == "" {
+		WriteError(w, http.StatusBadRequest, "name query parameter is required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			items, err := res.List(db)
+			if err != nil {
+				WriteDatastoreError(w, err)
+				return
+			}
+			WriteJSON(w, http.StatusOK, items)
+			return
+		}
+		item, err := res.Get(db, name)
+		if err != nil {
+			WriteDatastoreError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, item)
+
+	case http.MethodPost, http.MethodPut:
+		var item T
+		if err := DecodeJSON(r, &item); err != nil {
+			WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		status := http.StatusCreated
+		if r.Method == http.MethodPost {
+			item, err = res.Create(db, item)
+		} else {
+			status = http.StatusOK
+			item, err = res.Update(db, name, item)
+		}
+		if err != nil {
+			WriteDatastoreError(w, err)
+			return
+		}
+		WriteJSON(w, status, item)
+
+	case http.MethodDelete:
+		if err := res.Delete(db, name); err != nil {
+			WriteDatastoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
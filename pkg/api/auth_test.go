@@ -0,0 +1,256 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/tlsutil"
+	"github.com/spf13/viper"
+)
+
+func TestAgentTokensCannotManageServer(t *testing.T) {
+	srv := newTestServer(t)
+	worker := testAgent(t, "worker", true, false)
+	token := tokenFor(t, worker, auth.RoleAgent)
+
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodGet, "/api/agent", ""},
+		{http.MethodPut, fmt.Sprintf("/api/agent?id=%d", worker.Id), `{"admin": true}`},
+		{http.MethodPut, fmt.Sprintf("/api/agent?id=%d", worker.Id), `{"approval": "revoked"}`},
+		{http.MethodDelete, fmt.Sprintf("/api/agent?id=%d", worker.Id), ""},
+		{http.MethodGet, "/api/root", ""},
+		{http.MethodDelete, "/api/root/1", ""},
+		{http.MethodGet, "/api/duplicates", ""},
+		{http.MethodGet, "/api/host", ""},
+		{http.MethodGet, "/api/jobs", ""},
+		{http.MethodPost, "/api/jobs", `{"root_folder_id": 1, "kind": "full"}`},
+		{http.MethodGet, "/api/jobs/1", ""},
+		{http.MethodDelete, "/api/jobs/1", ""},
+		{http.MethodGet, "/api/jobs/", ""},
+		{http.MethodPost, "/api/jobs/", `{"root_folder_id": 1, "kind": "full"}`},
+		{http.MethodGet, "/api/jobs/1/", ""},
+		{http.MethodDelete, "/api/jobs/1/", ""},
+		{http.MethodGet, "/api/jobs/1/complete", ""},
+		{http.MethodGet, "/api/jobs/lease", ""},
+	} {
+		if status, body := call(t, srv, req.method, req.path, token, req.body); status != http.StatusForbidden {
+			t.Errorf("%s %s with an agent token: got %d %s, want 403", req.method, req.path, status, body)
+		}
+	}
+
+	// What agents do is still allowed
+	if status, body := call(t, srv, http.MethodPost, "/api/jobs/lease", token, `{"timeout": 60}`); status != http.StatusNoContent {
+		t.Errorf("lease: got %d %s, want 204", status, body)
+	}
+	if status, body := call(t, srv, http.MethodPost, "/api/agent/heartbeat", token, `{"version": "test"}`); status != http.StatusOK {
+		t.Errorf("heartbeat: got %d %s, want 200", status, body)
+	}
+	if status, body := call(t, srv, http.MethodPost, "/api/ingest/1/complete", token, ""); status != http.StatusNotFound {
+		t.Errorf("ingest into an unknown root: got %d %s, want 404", status, body)
+	}
+}
+
+func TestAdminTokensManageServer(t *testing.T) {
+	srv := newTestServer(t)
+	admin := testAgent(t, "console", true, true)
+	worker := testAgent(t, "worker", true, false)
+	token := tokenFor(t, admin, auth.RoleAdmin)
+
+	if status, body := call(t, srv, http.MethodGet, "/api/agent", token, ""); status != http.StatusOK {
+		t.Fatalf("list agents: got %d %s, want 200", status, body)
+	}
+	path := fmt.Sprintf("/api/agent?id=%d", worker.Id)
+	if status, body := call(t, srv, http.MethodPut, path, token, `{"enabled": false}`); status != http.StatusOK {
+		t.Fatalf("disable agent: got %d %s, want 200", status, body)
+	}
+	if status, body := call(t, srv, http.MethodDelete, "/api/jobs/1", token, ""); status != http.StatusNotFound {
+		t.Fatalf("delete unknown job: got %d %s, want 404", status, body)
+	}
+	if status, body := call(t, srv, http.MethodGet, "/api/jobs/1/", token, ""); status != http.StatusNotFound {
+		t.Fatalf("job path with a trailing slash: got %d %s, want 404", status, body)
+	}
+}
+
+func TestAdminRoleMustBeGrantedAndCarried(t *testing.T) {
+	srv := newTestServer(t)
+	admin := testAgent(t, "console", true, true)
+
+	// A token issued before the role was granted is exchanged for a new one
+	status, body := call(t, srv, http.MethodGet, "/api/agent", tokenFor(t, admin, auth.RoleAgent), "")
+	if status != http.StatusUnauthorized {
+		t.Fatalf("agent token of an admin: got %d %s, want 401", status, body)
+	}
+
+	// A token issued before the role was withdrawn is refused
+	token := tokenFor(t, admin, auth.RoleAdmin)
+	db, err := datastore.OpenDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = datastore.SetAgentAdmin(db, admin.Id, false)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := call(t, srv, http.MethodGet, "/api/agent", token, ""); status != http.StatusForbidden {
+		t.Fatalf("admin token after the role was withdrawn: got %d %s, want 403", status, body)
+	}
+}
+
+func TestDisabledAgentOnlySendsHeartbeats(t *testing.T) {
+	srv := newTestServer(t)
+	agent := testAgent(t, "worker", false, false)
+	token := tokenFor(t, agent, auth.RoleAgent)
+
+	if status, body := call(t, srv, http.MethodPost, "/api/jobs/lease", token, `{"timeout": 60}`); status != http.StatusForbidden {
+		t.Errorf("lease: got %d %s, want 403", status, body)
+	}
+	if status, body := call(t, srv, http.MethodPost, "/api/ingest", token, `{"path": "/data"}`); status != http.StatusForbidden {
+		t.Errorf("ingest: got %d %s, want 403", status, body)
+	}
+	if status, body := call(t, srv, http.MethodPost, "/api/agent/heartbeat", token, `{"version": "test"}`); status != http.StatusOK {
+		t.Errorf("heartbeat: got %d %s, want 200", status, body)
+	}
+}
+
+func TestTokensSignedWithAPIKeyAreRejected(t *testing.T) {
+	srv := newTestServer(t)
+	admin := testAgent(t, "console", true, true)
+
+	// Every agent holds the API key, so it must not be able to sign tokens
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"exp":      time.Now().Add(time.Hour).Unix(),
+		"Clientid": base64.StdEncoding.EncodeToString([]byte(admin.Name)),
+		"Uniqueid": admin.Guid,
+		"Agentid":  admin.Id,
+		"Role":     auth.RoleAdmin,
+	})
+	token, err := forged.SignedString([]byte("test-server" + "test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := call(t, srv, http.MethodGet, "/api/agent", token, ""); status != http.StatusUnauthorized {
+		t.Fatalf("token signed with the server ID and API key: got %d %s, want 401", status, body)
+	}
+	if status, body := call(t, srv, http.MethodGet, "/api/agent", tokenFor(t, admin, auth.RoleAdmin), ""); status != http.StatusOK {
+		t.Fatalf("token issued by the server: got %d %s, want 200", status, body)
+	}
+}
+
+func TestSecretIsPrivateAndKept(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	path := filepath.Join(t.TempDir(), "jwt-secret")
+	viper.Set("server.jwt_secret", path)
+
+	if err := auth.LoadSecret(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("secret file mode %o, want 600", perm)
+	}
+	first, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restarting the server keeps the key, so issued tokens stay valid
+	if err := auth.LoadSecret(); err != nil {
+		t.Fatal(err)
+	}
+	if second, _ := os.ReadFile(path); string(second) != string(first) {
+		t.Error("secret regenerated on second load")
+	}
+}
+
+// register sends the registration request of a machine with a JSON body
+func register(t *testing.T, srv *httptest.Server, name, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/agent/register", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Key", "test-key")
+	req.Header.Set("Clientid", base64.StdEncoding.EncodeToString([]byte(name)))
+	req.Header.Set("Uniqueid", name+"-guid")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
+
+func TestRejectedCertificateRequestRecordsNoAgent(t *testing.T) {
+	srv := newTestServer(t)
+	dir := t.TempDir()
+	certPEM, keyPEM, err := tlsutil.GenerateCA("test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, caKey := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	if err := tlsutil.WriteFile(caCert, certPEM, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := tlsutil.WriteFile(caKey, keyPEM, true); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("server.tls.ca_cert", caCert)
+	viper.Set("server.tls.ca_key", caKey)
+
+	if status, body := register(t, srv, "worker", `{"csr": "not a certificate request"}`); status != http.StatusBadRequest {
+		t.Fatalf("register with an invalid CSR: got %d %s, want 400", status, body)
+	}
+	db, err := datastore.OpenDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if agent, err := datastore.FindAgent(db, "worker", "worker-guid"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("agent %d recorded after its registration failed (err %v)", agent.Id, err)
+	}
+}
+
+func TestRegisteringAgainWithdrawsAdminRole(t *testing.T) {
+	srv := newTestServer(t)
+	admin := testAgent(t, "console", true, true)
+
+	if status, body := register(t, srv, "console", ""); status != http.StatusAccepted {
+		t.Fatalf("register again: got %d %s, want 202", status, body)
+	}
+	db, err := datastore.OpenDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	agent, err := datastore.GetAgentByID(db, admin.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent.Admin || agent.Approval != entities.AgentPending {
+		t.Errorf("after registering again: admin %v, approval %s; want a pending agent without the admin role",
+			agent.Admin, agent.Approval)
+	}
+}
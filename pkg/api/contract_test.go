@@ -0,0 +1,564 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+// contract sends requests to the server, checking them and their responses
+// against the OpenAPI document the server serves
+type contract struct {
+	t    *testing.T
+	srv  *httptest.Server
+	spec map[string]any
+	seen map[string]bool // Operation IDs exercised
+}
+
+func newContract(t *testing.T, srv *httptest.Server) *contract {
+	t.Helper()
+	resp, err := srv.Client().Get(srv.URL + "/api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	c := &contract{t: t, srv: srv, seen: map[string]bool{}}
+	if err := json.NewDecoder(resp.Body).Decode(&c.spec); err != nil {
+		t.Fatalf("served OpenAPI document: %v", err)
+	}
+	return c
+}
+
+// request is a request of a contract test; Body is sent as JSON unless nil.
+// Invalid requests break the document on purpose, to test that the server
+// refuses them: only their responses are checked.
+type request struct {
+	Method, Path string
+	Token        string
+	Header       map[string]string
+	Body         any
+	Invalid      bool
+}
+
+// do sends a request, fails the test unless the server answers with the
+// given status, and decodes the response body into out unless nil
+func (c *contract) do(req request, want int, out any) {
+	c.t.Helper()
+	target, err := url.Parse(req.Path)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	where := req.Method + " " + req.Path
+	template, op := c.operation(req.Method, target.Path)
+	if op == nil {
+		c.t.Fatalf("%s: no operation of the document", where)
+	}
+	c.seen[op["operationId"].(string)] = true
+	if !req.Invalid {
+		for _, problem := range c.checkParams(op, template, target, req.Header) {
+			c.t.Errorf("%s: %s", where, problem)
+		}
+	}
+
+	var body io.Reader
+	if req.Body != nil {
+		data, err := json.Marshal(req.Body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if err := c.checkBody(op["requestBody"], data, "request"); err != nil && !req.Invalid {
+			c.t.Errorf("%s: %v", where, err)
+		}
+		body = bytes.NewReader(data)
+	} else if requestBody, ok := op["requestBody"].(map[string]any); ok && requestBody["required"] == true {
+		c.t.Errorf("%s: request without the body the operation needs", where)
+	}
+
+	r, err := http.NewRequest(req.Method, c.srv.URL+req.Path, body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if req.Token != "" {
+		r.Header.Set("Token", req.Token)
+	}
+	for name, value := range req.Header {
+		r.Header.Set(name, value)
+	}
+	if req.Body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.srv.Client().Do(r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if resp.StatusCode != want {
+		c.t.Fatalf("%s: got %d %s, want %d", where, resp.StatusCode, data, want)
+	}
+
+	response, ok := op["responses"].(map[string]any)[strconv.Itoa(resp.StatusCode)].(map[string]any)
+	if !ok {
+		c.t.Fatalf("%s: status %d is not documented", where, resp.StatusCode)
+	}
+	response = c.resolve(response)
+	if err := c.checkBody(response, data, "response"); err != nil {
+		c.t.Errorf("%s: %v", where, err)
+	}
+	if headers, ok := response["headers"].(map[string]any); ok {
+		for name := range headers {
+			if resp.Header.Get(name) == "" {
+				c.t.Errorf("%s: response lacks the %s header", where, name)
+			}
+		}
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			c.t.Fatalf("%s: %v", where, err)
+		}
+	}
+}
+
+// operation finds the operation serving a path, and its path template,
+// preferring the templates with the most literal segments as the server's
+// mux does
+func (c *contract) operation(method, path string) (string, map[string]any) {
+	var best map[string]any
+	var bestTemplate string
+	bestLiterals := -1
+	segments := strings.Split(path, "/")
+	for template, item := range c.spec["paths"].(map[string]any) {
+		op, ok := item.(map[string]any)[strings.ToLower(method)].(map[string]any)
+		if !ok {
+			continue
+		}
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		literals := 0
+		for i, part := range parts {
+			if strings.HasPrefix(part, "{") {
+				continue
+			}
+			if part != segments[i] {
+				literals = -1
+				break
+			}
+			literals++
+		}
+		if literals > bestLiterals {
+			best, bestTemplate, bestLiterals = op, template, literals
+		}
+	}
+	return bestTemplate, best
+}
+
+// checkParams checks the query, path and header parameters of a request
+func (c *contract) checkParams(op map[string]any, template string, target *url.URL, header map[string]string) []string {
+	var problems []string
+	query := target.Query()
+	documented := map[string]bool{}
+	segments := strings.Split(target.Path, "/")
+	params, _ := op["parameters"].([]any)
+	parts := strings.Split(template, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && !slices.ContainsFunc(params, func(p any) bool {
+			return p.(map[string]any)["name"] == strings.Trim(part, "{}")
+		}) {
+			problems = append(problems, fmt.Sprintf("path parameter %s of segment %d is not documented", part, i))
+		}
+	}
+	for _, p := range params {
+		param := p.(map[string]any)
+		name, required := param["name"].(string), param["required"] == true
+		var value string
+		var present bool
+		switch param["in"] {
+		case "query":
+			documented[name] = true
+			value, present = query.Get(name), query.Has(name)
+		case "header":
+			value, present = header[name]
+		case "path":
+			for i, part := range parts {
+				if part == "{"+name+"}" {
+					value, present = segments[i], true
+				}
+			}
+		}
+		if !present {
+			if required {
+				problems = append(problems, fmt.Sprintf("required %s parameter %s is missing", param["in"], name))
+			}
+			continue
+		}
+		var v any = value
+		schema := param["schema"].(map[string]any)
+		if schema["type"] == "integer" {
+			v = json.Number(value)
+		}
+		if err := c.check(schema, v, "parameter "+name); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for name := range query {
+		if !documented[name] {
+			problems = append(problems, fmt.Sprintf("query parameter %s is not documented", name))
+		}
+	}
+	return problems
+}
+
+// checkBody checks a JSON body against the content of a request body or
+// response: without content, the body must be empty
+func (c *contract) checkBody(spec any, data []byte, what string) error {
+	content, _ := spec.(map[string]any)["content"].(map[string]any)
+	media, ok := content["application/json"].(map[string]any)
+	if !ok {
+		if len(bytes.TrimSpace(data)) != 0 {
+			return fmt.Errorf("%s body %s where none is documented", what, data)
+		}
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return fmt.Errorf("%s body %s: %v", what, data, err)
+	}
+	if err := c.check(media["schema"].(map[string]any), v, what); err != nil {
+		return fmt.Errorf("%v in %s", err, data)
+	}
+	return nil
+}
+
+// resolve follows a reference to a component of the document
+func (c *contract) resolve(o map[string]any) map[string]any {
+	ref, ok := o["$ref"].(string)
+	if !ok {
+		return o
+	}
+	var node any = c.spec
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		node = node.(map[string]any)[key]
+	}
+	if node == nil {
+		c.t.Fatalf("dangling reference %s", ref)
+	}
+	return c.resolve(node.(map[string]any))
+}
+
+// check validates a JSON value against a schema. Objects may only have the
+// properties their schema lists, unless it lists none.
+func (c *contract) check(schema map[string]any, v any, at string) error {
+	schema = c.resolve(schema)
+	if v == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s is null", at)
+	}
+	if alternatives, ok := schema["oneOf"].([]any); ok {
+		matched := 0
+		for _, alternative := range alternatives {
+			if c.check(alternative.(map[string]any), v, at) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s matches %d of its schemas, want 1", at, matched)
+		}
+		return nil
+	}
+	if values, ok := schema["enum"].([]any); ok && !slices.Contains(values, v) {
+		return fmt.Errorf("%s is %v, not one of %v", at, v, values)
+	}
+
+	switch schema["type"] {
+	case "object":
+		o, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is not an object", at)
+		}
+		props, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := o[name.(string)]; !ok {
+				return fmt.Errorf("%s lacks %s", at, name)
+			}
+		}
+		names := make([]string, 0, len(o))
+		for name := range o {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := props[name].(map[string]any)
+			if !ok {
+				prop, ok = schema["additionalProperties"].(map[string]any)
+			}
+			if !ok {
+				if props == nil {
+					continue
+				}
+				return fmt.Errorf("%s has undocumented property %s", at, name)
+			}
+			if err := c.check(prop, o[name], at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s is not an array", at)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && len(items) > int(max) {
+			return fmt.Errorf("%s has %d items, more than %v", at, len(items), max)
+		}
+		for i, item := range items {
+			if err := c.check(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s is not a string", at)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Errorf("%s is not a date-time: %v", at, err)
+			}
+		}
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s is not a number", at)
+		}
+		if schema["type"] == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return fmt.Errorf("%s is not an integer", at)
+			}
+		}
+		if min, ok := schema["minimum"].(float64); ok {
+			if f, _ := n.Float64(); f < min {
+				return fmt.Errorf("%s is below %v", at, min)
+			}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s is not a boolean", at)
+		}
+	}
+	return nil
+}
+
+// operations returns the IDs of the document's operations
+func (c *contract) operations() []string {
+	var ids []string
+	for _, item := range c.spec["paths"].(map[string]any) {
+		for _, op := range item.(map[string]any) {
+			ids = append(ids, op.(map[string]any)["operationId"].(string))
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TestAPIFollowsSpec walks an agent and an admin through every operation,
+// checking requests and responses against the served document
+func TestAPIFollowsSpec(t *testing.T) {
+	srv := newTestServer(t)
+	c := newContract(t, srv)
+	admin := tokenFor(t, testAgent(t, "console", true, true), auth.RoleAdmin)
+	get, post, put, del := http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete
+
+	c.do(request{Method: get, Path: "/api/openapi.json"}, 200, nil)
+
+	// An agent registers and gets a token once approved
+	machine := map[string]string{
+		"Key":      "test-key",
+		"Clientid": base64.StdEncoding.EncodeToString([]byte("worker")),
+		"Uniqueid": "worker-guid",
+	}
+	var registration entities.AgentRegistration
+	c.do(request{Method: post, Path: "/api/agent/register", Header: machine}, 202, &registration)
+	machine["Key"] = "wrong"
+	c.do(request{Method: post, Path: "/api/agent/register", Header: machine}, 401, nil)
+	credential := map[string]string{"Credential": registration.Credential}
+	c.do(request{Method: post, Path: "/api/agent/token", Header: credential}, 403, nil)
+	c.do(request{Method: post, Path: "/api/agent/token", Header: map[string]string{"Credential": "wrong"}}, 401, nil)
+
+	agentPath := fmt.Sprintf("/api/agent?id=%d", registration.AgentID)
+	approve := entities.AgentUpdate{Approval: entities.AgentApproved}
+	c.do(request{Method: put, Path: agentPath, Token: admin, Body: approve}, 200, nil)
+	c.do(request{Method: put, Path: "/api/agent?id=999", Token: admin, Body: approve}, 404, nil)
+	var token entities.AgentToken
+	c.do(request{Method: post, Path: "/api/agent/token", Header: credential}, 200, &token)
+	c.do(request{Method: post, Path: "/api/agent/refresh", Token: token.Token}, 200, &token)
+	worker := token.Token
+	heartbeat := entities.AgentHeartbeat{Version: "test", Hostname: "worker", Platform: "linux"}
+	c.do(request{Method: post, Path: "/api/agent/heartbeat", Token: worker, Body: heartbeat}, 200, nil)
+	c.do(request{Method: get, Path: "/api", Token: worker}, 200, nil)
+	c.do(request{Method: get, Path: "/api/agent", Token: worker}, 403, nil)
+	c.do(request{Method: get, Path: "/api/agent", Token: admin}, 200, nil)
+	c.do(request{Method: get, Path: agentPath, Token: admin}, 200, nil)
+	c.do(request{Method: get, Path: "/api/agent?id=999", Token: admin}, 404, nil)
+
+	// Hosts and metadata
+	for _, kind := range []struct {
+		path, name string
+		value      any
+	}{
+		{"/api/host", "nas", entities.Host{Name: "nas"}},
+		{"/api/owner", "alice", entities.Owner{Name: "alice"}},
+		{"/api/purpose", "backup", entities.Purpose{Name: "backup"}},
+		{"/api/policy", "keep", entities.Policy{Name: "keep", MinCopies: 2}},
+	} {
+		named := kind.path + "?name=" + kind.name
+		c.do(request{Method: post, Path: kind.path, Token: admin, Body: kind.value}, 201, nil)
+		c.do(request{Method: post, Path: kind.path, Token: admin, Body: kind.value}, 409, nil)
+		c.do(request{Method: get, Path: kind.path, Token: admin}, 200, nil)
+		c.do(request{Method: get, Path: named, Token: admin}, 200, nil)
+		c.do(request{Method: get, Path: kind.path + "?name=missing", Token: admin}, 404, nil)
+		c.do(request{Method: put, Path: named, Token: admin, Body: kind.value}, 200, nil)
+		c.do(request{Method: del, Path: named, Token: admin}, 204, nil)
+		c.do(request{Method: del, Path: named, Token: admin}, 404, nil)
+	}
+
+	// The agent scans a root folder of its host holding two copies of a file
+	var root entities.IngestRoot
+	c.do(request{Method: post, Path: "/api/ingest", Token: worker,
+		Body: entities.IngestStart{Path: "/data", Register: true}}, 200, &root)
+	c.do(request{Method: post, Path: "/api/ingest", Token: worker,
+		Body: entities.IngestStart{Path: "/unknown"}}, 404, nil)
+	ingest := fmt.Sprintf("/api/ingest/%d", root.ID)
+	parent, hash, algorithm := "/data", "0123456789abcdef", "sha256"
+	c.do(request{Method: post, Path: ingest + "/folders", Token: worker, Body: entities.IngestBatch{
+		Folders: []entities.IngestFolder{{Path: "/data"}, {Path: "/data/copy", ParentPath: &parent}},
+	}}, 200, nil)
+	c.do(request{Method: post, Path: ingest + "/files", Token: worker, Body: entities.IngestBatch{
+		Files: []entities.IngestFile{
+			{Path: "/data/a.txt", FolderPath: "/data", Size: 10, Mtime: 1, HashValue: &hash, HashAlgorithm: &algorithm},
+			{Path: "/data/copy/a.txt", FolderPath: "/data/copy", Size: 10, Mtime: 1, HashValue: &hash, HashAlgorithm: &algorithm},
+		},
+	}}, 200, nil)
+	c.do(request{Method: post, Path: "/api/ingest/999/files", Token: worker,
+		Body: entities.IngestBatch{}}, 404, nil)
+	c.do(request{Method: post, Path: ingest + "/complete", Token: worker}, 200, nil)
+
+	// Root folders
+	rootPath := fmt.Sprintf("/api/root/%d", root.ID)
+	traverse := true
+	c.do(request{Method: get, Path: "/api/root", Token: admin}, 200, nil)
+	c.do(request{Method: get, Path: "/api/root?host=worker", Token: admin}, 200, nil)
+	c.do(request{Method: get, Path: "/api/root?host=missing", Token: admin}, 404, nil)
+	c.do(request{Method: get, Path: rootPath, Token: admin}, 200, nil)
+	c.do(request{Method: get, Path: "/api/root/abc", Token: admin, Invalid: true}, 400, nil)
+	c.do(request{Method: get, Path: "/api/root/999", Token: admin}, 404, nil)
+	c.do(request{Method: put, Path: rootPath, Token: admin,
+		Body: entities.RootFolderRequest{TraverseLinks: &traverse}}, 200, nil)
+	c.do(request{Method: post, Path: rootPath + "/refresh", Token: admin}, 200, nil)
+	c.do(request{Method: post, Path: rootPath + "/purge", Token: admin,
+		Body: entities.PurgeRequest{Entities: entities.PurgeFiles, DryRun: true}}, 200, nil)
+	c.do(request{Method: post, Path: rootPath + "/verify", Token: admin, Body: entities.VerifyRequest{}}, 200, nil)
+
+	var created entities.RootFolderInfo
+	other := entities.RootFolderRequest{Host: "console", Path: "/srv"}
+	c.do(request{Method: post, Path: "/api/root", Token: admin, Body: other}, 201, &created)
+	c.do(request{Method: post, Path: "/api/root", Token: admin, Body: other}, 409, nil)
+	c.do(request{Method: post, Path: "/api/root", Token: admin,
+		Body: entities.RootFolderRequest{Host: "console", Path: "relative"}}, 400, nil)
+	c.do(request{Method: post, Path: "/api/root", Token: admin, Invalid: true,
+		Body: map[string]any{"host": "console", "path": "/data", "filters": []string{"*.tmp"}}}, 400, nil)
+	c.do(request{Method: del, Path: fmt.Sprintf("/api/root/%d", created.ID), Token: admin}, 204, nil)
+	c.do(request{Method: del, Path: fmt.Sprintf("/api/root/%d", created.ID), Token: admin}, 404, nil)
+
+	// Duplicates
+	var page duplicate.JSONPage
+	c.do(request{Method: get, Path: "/api/duplicates?min_size=1&sort=reclaimable", Token: admin}, 200, &page)
+	if len(page.Sets) != 1 {
+		t.Fatalf("got %d duplicate sets, want 1", len(page.Sets))
+	}
+	c.do(request{Method: get, Path: "/api/duplicates?sort=name", Token: admin, Invalid: true}, 400, nil)
+	c.do(request{Method: get, Path: "/api/duplicates/" + hash, Token: admin}, 200, nil)
+	c.do(request{Method: get, Path: "/api/duplicates/ffff", Token: admin}, 404, nil)
+
+	// Scan jobs
+	queue := entities.ScanJobRequest{RootFolderID: root.ID, Kind: entities.ScanJobRoot}
+	lease := entities.ScanJobLease{Timeout: 60}
+	var job entities.ScanJob
+	c.do(request{Method: post, Path: "/api/jobs", Token: admin, Body: queue}, 201, &job)
+	c.do(request{Method: post, Path: "/api/jobs", Token: admin,
+		Body: entities.ScanJobRequest{RootFolderID: root.ID, Kind: "full"}, Invalid: true}, 400, nil)
+	c.do(request{Method: get, Path: "/api/jobs", Token: admin}, 200, nil)
+	c.do(request{Method: get, Path: "/api/jobs?status=bogus", Token: admin, Invalid: true}, 400, nil)
+	c.do(request{Method: get, Path: fmt.Sprintf("/api/jobs/%d", job.ID), Token: admin}, 200, nil)
+	c.do(request{Method: get, Path: "/api/jobs/999", Token: admin}, 404, nil)
+
+	c.do(request{Method: post, Path: "/api/jobs/lease", Token: worker, Body: lease}, 200, &job)
+	jobPath := fmt.Sprintf("/api/jobs/%d", job.ID)
+	report := entities.ScanJobReport{LeaseID: job.LeaseID, FoldersDone: 2, FilesDone: 2}
+	c.do(request{Method: post, Path: jobPath + "/progress", Token: worker, Body: report}, 204, nil)
+	c.do(request{Method: post, Path: jobPath + "/progress", Token: worker,
+		Body: entities.ScanJobReport{LeaseID: "wrong"}}, 409, nil)
+	c.do(request{Method: post, Path: jobPath + "/complete", Token: worker, Body: report}, 204, nil)
+	c.do(request{Method: post, Path: "/api/jobs/lease", Token: worker, Body: lease}, 204, nil)
+
+	c.do(request{Method: post, Path: "/api/jobs", Token: admin, Body: queue}, 201, nil)
+	c.do(request{Method: post, Path: "/api/jobs/lease", Token: worker, Body: lease}, 200, &job)
+	jobPath = fmt.Sprintf("/api/jobs/%d", job.ID)
+	c.do(request{Method: post, Path: jobPath + "/fail", Token: worker,
+		Body: entities.ScanJobReport{LeaseID: job.LeaseID, Error: "disk gone"}}, 204, nil)
+	c.do(request{Method: del, Path: jobPath, Token: admin}, 204, nil)
+	c.do(request{Method: del, Path: jobPath, Token: admin}, 404, nil)
+
+	c.do(request{Method: del, Path: agentPath, Token: admin}, 204, nil)
+	c.do(request{Method: del, Path: agentPath, Token: admin}, 404, nil)
+
+	for _, id := range c.operations() {
+		if !c.seen[id] {
+			t.Errorf("operation %s was not exercised", id)
+		}
+	}
+}
+
+// TestAdminOperationsRefuseAgentTokens checks the role the document gives
+// operations against the server
+func TestAdminOperationsRefuseAgentTokens(t *testing.T) {
+	srv := newTestServer(t)
+	c := newContract(t, srv)
+	token := tokenFor(t, testAgent(t, "worker", true, false), auth.RoleAgent)
+
+	for template, item := range c.spec["paths"].(map[string]any) {
+		path := strings.NewReplacer("{id}", "1", "{hash}", "abc").Replace(template)
+		for method, op := range item.(map[string]any) {
+			if op.(map[string]any)["x-role"] != auth.RoleAdmin {
+				continue
+			}
+			method = strings.ToUpper(method)
+			if status, body := call(t, srv, method, path+"?id=1&name=x", token, ""); status != http.StatusForbidden {
+				t.Errorf("%s %s with an agent token: got %d %s, want 403", method, path, status, body)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+)
+
+// Page sizes of GET /api/duplicates
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// HandleDuplicates serves the duplicate sets found by scans:
+//
+//	GET /api/duplicates          one page of sets, filtered by the query:
+//	                             min_count, min_size (bytes), root (root
+//	                             folder ID), path (prefix), sort (size or
+//	                             reclaimable), limit and after (cursor)
+//	GET /api/duplicates/<hash>   one set by hash or unambiguous hash prefix
+func HandleDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	db, err := datastore.OpenDb()
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer db.Close()
+
+	resolver, err := datastore.NewMetadataResolver(db)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	detector := duplicate.NewDetector(db)
+
+	hash := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/duplicates"), "/")
+	if hash != "" {
+		set, err := detector.GetSet(hash)
+		switch {
+		case errors.Is(err, duplicate.ErrSetNotFound):
+			apiutil.WriteError(w, http.StatusNotFound, err.Error())
+			return
+		case errors.Is(err, duplicate.ErrAmbiguousHash):
+			apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		case err != nil:
+			apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if err := duplicate.ResolveMetadata(set, resolver); err != nil {
+			apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		apiutil.WriteJSON(w, http.StatusOK, duplicate.NewJSONSet(set))
+		return
+	}
+
+	opts, err := parseQuery(r.URL.Query())
+	if err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page := duplicate.JSONPage{Sets: []duplicate.JSONSet{}}
+	all := opts
+	all.Limit = 0
+	if page.Total, err = detector.CountDuplicateSets(all); err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	next, err := detector.StreamDuplicateSets(opts, func(set *duplicate.DuplicateSet) error {
+		if err := duplicate.ResolveMetadata(set, resolver); err != nil {
+			return err
+		}
+		page.Sets = append(page.Sets, duplicate.NewJSONSet(set))
+		return nil
+	})
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if next != nil {
+		page.Next = next.String()
+	}
+	apiutil.WriteJSON(w, http.StatusOK, page)
+}
+
+// parseQuery reads the filters of GET /api/duplicates
+func parseQuery(query url.Values) (duplicate.QueryOptions, error) {
+	opts := duplicate.QueryOptions{
+		MinCount:   2,
+		PathPrefix: query.Get("path"),
+		Sort:       query.Get("sort"),
+		Limit:      defaultLimit,
+	}
+
+	integers := []struct {
+		name   string
+		min    int64
+		target func(int64)
+	}{
+		{"min_count", 2, func(n int64) { opts.MinCount = int(n) }},
+		{"min_size", 0, func(n int64) { opts.MinSize = n }},
+		{"root", 1, func(n int64) { opts.RootFolderID = n }},
+		{"limit", 1, func(n int64) { opts.Limit = int(min(n, maxLimit)) }},
+	}
+	for _, param := range integers {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < param.min {
+			return opts, fmt.Errorf("%s must be an integer of at least %d", param.name, param.min)
+		}
+		param.target(n)
+	}
+
+	if !duplicate.ValidSort(opts.Sort) {
+		return opts, fmt.Errorf("sort must be %s or %s", duplicate.SortBySize, duplicate.SortByReclaimable)
+	}
+	if value := query.Get("after"); value != "" {
+		after, err := duplicate.ParseCursor(value)
+		if err != nil {
+			return opts, err
+		}
+		if (after.Reclaimable > 0) != (opts.Sort == duplicate.SortByReclaimable) {
+			return opts, fmt.Errorf("cursor %s does not belong to this sort order", value)
+		}
+		opts.After = after
+	}
+	return opts, nil
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/spf13/viper"
+)
+
+// newTestServer serves the API over a fresh database
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("server.database.type", "sqlite")
+	viper.Set("server.database.sqlite.name", filepath.Join(t.TempDir(), "dupectl.db"))
+	viper.Set("server.serverid", "test-server")
+	viper.Set("server.apikey", "test-key")
+	viper.Set("server.jwt_secret", filepath.Join(t.TempDir(), "jwt-secret"))
+	datastore.InitAllTables()
+	if err := auth.LoadSecret(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(NewServer("", nil, Timeouts{}).Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testAgent registers an approved agent of a new host, enabled or not, and
+// grants it the admin role when asked
+func testAgent(t *testing.T, name string, enabled, admin bool) entities.Agent {
+	t.Helper()
+	db, err := datastore.OpenDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	host, err := datastore.RegisterHost(db, base64.StdEncoding.EncodeToString([]byte(name)), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent, err := datastore.PostAgent(db, entities.Agent{Name: name, Guid: name + "-guid", Enabled: enabled, HostID: host.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := datastore.IssueAgentCredential(db, agent.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.ApproveAgent(db, agent.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.SetAgentAdmin(db, agent.Id, admin); err != nil {
+		t.Fatal(err)
+	}
+	agent, err = datastore.GetAgentByID(db, agent.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return agent
+}
+
+// tokenFor issues a token with the given role to an agent
+func tokenFor(t *testing.T, agent entities.Agent, role string) string {
+	t.Helper()
+	token, _, err := auth.CreateJWT(base64.StdEncoding.EncodeToString([]byte(agent.Name)), agent.Guid, agent.Id, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// call sends a request with the given token and JSON body, returning the
+// response status and body
+func call(t *testing.T, srv *httptest.Server, method, path, token, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Token", token)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(data)
+}
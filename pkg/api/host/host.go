@@ -1,22 +1,21 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
 )
 
-func HandleHost(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		fmt.Fprintf(w, "super secret Create Hosts")
-	}
-	if r.Method == http.MethodGet {
-		fmt.Fprintf(w, "super secret Read Hosts")
-	}
-	if r.Method == http.MethodPut {
-		fmt.Fprintf(w, "super secret Update Hosts")
-	}
-	if r.Method == http.MethodDelete {
-		fmt.Fprintf(w, "super secret Delete Hosts")
-	}
+var hostResource = apiutil.NamedResource[entities.Host]{
+	List:   datastore.GetHosts,
+	Get:    datastore.GetHost,
+	Create: datastore.InsertHost,
+	Update: datastore.UpdateHost,
+	Delete: datastore.DeleteHost,
+}
 
+func HandleHost(w http.ResponseWriter, r *http.Request) {
+	hostResource.ServeHTTP(w, r)
 }
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+	"github.com/jpconstantineau/dupectl/pkg/scanner"
+)
+
+// MaxBatchSize is the most folders or files accepted per push
+const MaxBatchSize = 5000
+
+// HandleIngest receives scan results pushed by agents. Agents only push to
+// root folders of their own host, and the server assigns all IDs.
+//
+//	POST /api/ingest                 open a scan of a root (IngestStart)
+//	POST /api/ingest/<id>/folders    push folders, parents first
+//	POST /api/ingest/<id>/files      push files of pushed folders
+//	POST /api/ingest/<id>/complete   mark unseen entries removed (IngestComplete)
+//	                                 and refresh the root's statistics
+func HandleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	db, err := datastore.OpenDb()
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer db.Close()
+
+	host, err := apiutil.AgentHost(db, r)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/ingest"), "/")
+	if rest == "" {
+		startScan(w, r, db, host)
+		return
+	}
+
+	idText, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusNotFound, "not found")
+		return
+	}
+	root, err := datastore.GetRootFolder(db, id)
+	if err == nil && root.HostID != int64(host.Id) {
+		err = sql.ErrNoRows // Roots of other hosts are not visible to the agent
+	}
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+
+	switch action {
+	case "folders":
+		ingestFolders(w, r, db, root)
+	case "files":
+		ingestFiles(w, r, db, root)
+	case "complete":
+		completeScan(w, r, db, root)
+	default:
+		apiutil.WriteError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// startScan returns the root a scan pushes to, registering it when asked
+func startScan(w http.ResponseWriter, r *http.Request, db *sql.DB, host entities.Host) {
+	var req entities.IngestStart
+	if err := apiutil.DecodeJSON(r, &req); err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !pathutil.IsAbsoluteOnAnyHost(req.Path) {
+		apiutil.WriteError(w, http.StatusBadRequest, "path must be absolute")
+		return
+	}
+
+	root, err := datastore.FindRootFolderByPath(db, int64(host.Id), req.Path)
+	if errors.Is(err, sql.ErrNoRows) && req.Register {
+		root = &datastore.RootFolder{
+			HostID:          int64(host.Id),
+			Path:            req.Path,
+			CaseInsensitive: req.CaseInsensitive,
+			Device:          req.Device,
+		}
+		root.ID, err = datastore.InsertRootFolder(db, root)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		apiutil.WriteError(w, http.StatusNotFound,
+			fmt.Sprintf("root folder %s is not registered for host %s", req.Path, host.Name))
+		return
+	}
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+
+	// Device numbers can change between mounts, so refresh the recorded one
+	if req.Device != "" && req.Device != root.Device {
+		if err := datastore.UpdateRootFolderDevice(db, root.ID, req.Device); err != nil {
+			apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	apiutil.WriteJSON(w, http.StatusOK, entities.IngestRoot{
+		ID:              root.ID,
+		Path:            root.Path,
+		CaseInsensitive: root.CaseInsensitive,
+	})
+}
+
+// decodeBatch reads a push and checks that every path lies under the root
+func decodeBatch(r *http.Request, root *datastore.RootFolder) (entities.IngestBatch, error) {
+	var batch entities.IngestBatch
+	if err := apiutil.DecodeJSON(r, &batch); err != nil {
+		return batch, err
+	}
+	if len(batch.Folders) > MaxBatchSize || len(batch.Files) > MaxBatchSize {
+		return batch, fmt.Errorf("batches are limited to %d entries", MaxBatchSize)
+	}
+
+	paths := make([]string, 0, len(batch.Folders)+2*len(batch.Files))
+	for _, folder := range batch.Folders {
+		paths = append(paths, folder.Path)
+		if folder.ParentPath != nil {
+			paths = append(paths, *folder.ParentPath)
+		}
+	}
+	for _, file := range batch.Files {
+		paths = append(paths, file.Path, file.FolderPath)
+	}
+	for _, path := range paths {
+		if !pathutil.WithinRoot(root.Path, path, root.CaseInsensitive) {
+			return batch, fmt.Errorf("path %s is not under root folder %s", path, root.Path)
+		}
+	}
+	return batch, nil
+}
+
+// Each batch is written in a single transaction: one commit instead of one
+// per record, and a failed push leaves nothing half-written.
+func ingestFolders(w http.ResponseWriter, r *http.Request, db *sql.DB, root *datastore.RootFolder) {
+	batch, err := decodeBatch(r, root)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	records := make([]entities.IngestRecord, 0, len(batch.Folders))
+	for _, folder := range batch.Folders {
+		id, err := scanner.RegisterFolder(tx, root.ID, folder.Path, folder.ParentPath, folder.ErrorStatus)
+		if err != nil {
+			apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		records = append(records, entities.IngestRecord{Path: folder.Path, ID: id})
+	}
+	if err := tx.Commit(); err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	apiutil.WriteJSON(w, http.StatusOK, records)
+}
+
+func ingestFiles(w http.ResponseWriter, r *http.Request, db *sql.DB, root *datastore.RootFolder) {
+	batch, err := decodeBatch(r, root)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	folderIDs := make(map[string]int64)
+	records := make([]entities.IngestRecord, 0, len(batch.Files))
+	for _, file := range batch.Files {
+		folderID, ok := folderIDs[file.FolderPath]
+		if !ok {
+			folder, err := datastore.GetFolderByPath(tx, root.ID, file.FolderPath)
+			if errors.Is(err, sql.ErrNoRows) {
+				apiutil.WriteError(w, http.StatusBadRequest,
+					fmt.Sprintf("folder %s of file %s has not been pushed", file.FolderPath, file.Path))
+				return
+			}
+			if err != nil {
+				apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			folderID = folder.ID
+			folderIDs[file.FolderPath] = folderID
+		}
+
+		id, err := datastore.InsertFile(tx, &datastore.File{
+			Path:           file.Path,
+			Size:           file.Size,
+			Mtime:          file.Mtime,
+			HashValue:      file.HashValue,
+			HashAlgorithm:  file.HashAlgorithm,
+			ErrorStatus:    file.ErrorStatus,
+			FirstScannedAt: now,
+			LastScannedAt:  now,
+			FolderID:       folderID,
+			RootFolderID:   root.ID,
+		})
+		if err != nil {
+			apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		records = append(records, entities.IngestRecord{Path: file.Path, ID: id})
+	}
+	if err := tx.Commit(); err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	apiutil.WriteJSON(w, http.StatusOK, records)
+}
+
+// completeScan closes a scan. A sweep marks the entries of the swept tree
+// that were not pushed during the scan as removed, as local scans do; the
+// scan's start is taken from the server's clock.
+func completeScan(w http.ResponseWriter, r *http.Request, db *sql.DB, root *datastore.RootFolder) {
+	var req entities.IngestComplete
+	if r.ContentLength != 0 {
+		if err := apiutil.DecodeJSON(r, &req); err != nil {
+			apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var stats entities.IngestStats
+	if req.Sweep != "" {
+		if !pathutil.WithinRoot(root.Path, req.Sweep, root.CaseInsensitive) {
+			apiutil.WriteError(w, http.StatusBadRequest,
+				fmt.Sprintf("path %s is not under root folder %s", req.Sweep, root.Path))
+			return
+		}
+		if req.ElapsedSeconds < 0 {
+			apiutil.WriteError(w, http.StatusBadRequest, "elapsed_seconds must not be negative")
+			return
+		}
+		since := time.Now().Add(-time.Duration(req.ElapsedSeconds)*time.Second).Unix() - 1
+		folders, files, err := datastore.MarkUnseenRemoved(db, root, req.Sweep, since)
+		if err != nil {
+			apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		stats.RemovedFolders, stats.RemovedFiles = folders, files
+	}
+
+	var err error
+	stats.Folders, stats.Files, stats.TotalSize, err = datastore.RefreshRootFolderStats(db, root.ID)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	apiutil.WriteJSON(w, http.StatusOK, stats)
+}
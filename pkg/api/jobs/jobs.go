@@ -0,0 +1,222 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+// HandleJobs serves the scan job queue. Admins queue and inspect jobs;
+// agents lease the jobs of their host's roots and report on the jobs they
+// hold with the lease ID they were given. The routes choose who may call
+// what.
+//
+//	GET    /api/jobs[?status=<status>]  list jobs
+//	POST   /api/jobs                    queue a job (ScanJobRequest)
+//	GET    /api/jobs/<id>               get one job
+//	DELETE /api/jobs/<id>               delete a job no agent holds
+//	POST   /api/jobs/lease              lease the next job (ScanJobLease),
+//	                                    204 when there is none, 403 when the
+//	                                    agent is disabled
+//	POST   /api/jobs/<id>/progress      report progress, extending the lease
+//	POST   /api/jobs/<id>/complete      mark the job done
+//	POST   /api/jobs/<id>/fail          release the job with an error
+func HandleJobs(w http.ResponseWriter, r *http.Request) {
+	db, err := datastore.OpenDb()
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer db.Close()
+
+	// Trailing slashes are not trimmed: they would turn admin paths such
+	// as /api/jobs/<id>/ into paths the routes let agents call
+	rest := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/jobs"), "/")
+	idText, action, nested := strings.Cut(rest, "/")
+	if nested && action == "" {
+		apiutil.WriteError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch {
+	case rest == "":
+		switch r.Method {
+		case http.MethodGet:
+			listJobs(w, r, db)
+		case http.MethodPost:
+			createJob(w, r, db)
+		default:
+			methodNotAllowed(w, "GET, POST")
+		}
+		return
+
+	case rest == "lease":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, "POST")
+			return
+		}
+		leaseJob(w, r, db)
+		return
+	}
+
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if action == "" {
+		switch r.Method {
+		case http.MethodGet:
+			job, err := datastore.GetScanJob(db, id)
+			if err != nil {
+				apiutil.WriteDatastoreError(w, err)
+				return
+			}
+			apiutil.WriteJSON(w, http.StatusOK, job)
+		case http.MethodDelete:
+			if err := datastore.DeleteScanJob(db, id); err != nil {
+				apiutil.WriteDatastoreError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			methodNotAllowed(w, "GET, DELETE")
+		}
+		return
+	}
+
+	report := map[string]func(*sql.DB, int64, entities.ScanJobReport) error{
+		"progress": datastore.ReportScanJobProgress,
+		"complete": datastore.CompleteScanJob,
+		"fail":     datastore.FailScanJob,
+	}[action]
+	if report == nil {
+		apiutil.WriteError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	reportJob(w, r, db, id, report)
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func listJobs(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", entities.ScanJobQueued, entities.ScanJobLeased, entities.ScanJobDone, entities.ScanJobFailed:
+	default:
+		apiutil.WriteError(w, http.StatusBadRequest, fmt.Sprintf("unknown status %q", status))
+		return
+	}
+	jobs, err := datastore.GetScanJobs(db, status)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	apiutil.WriteJSON(w, http.StatusOK, jobs)
+}
+
+func createJob(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req entities.ScanJobRequest
+	if err := apiutil.DecodeJSON(r, &req); err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	job, err := datastore.InsertScanJob(db, entities.ScanJob{
+		RootFolderID: req.RootFolderID,
+		Kind:         req.Kind,
+		Path:         req.Path,
+		Paths:        req.Paths,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		apiutil.WriteError(w, http.StatusBadRequest, fmt.Sprintf("root folder %d not found", req.RootFolderID))
+		return
+	}
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	apiutil.WriteJSON(w, http.StatusCreated, job)
+}
+
+func leaseJob(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	host, err := apiutil.AgentHost(db, r)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	agent, err := apiutil.RequestAgent(db, r)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if !agent.Enabled {
+		apiutil.WriteError(w, http.StatusForbidden, fmt.Sprintf("agent %d is disabled", agent.Id))
+		return
+	}
+	var req entities.ScanJobLease
+	if err := apiutil.DecodeJSON(r, &req); err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Timeout < 0 {
+		apiutil.WriteError(w, http.StatusBadRequest, "timeout must not be negative")
+		return
+	}
+
+	job, err := datastore.LeaseScanJob(db, int64(host.Id), agent.Id, time.Duration(req.Timeout)*time.Second)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	apiutil.WriteJSON(w, http.StatusOK, job)
+}
+
+func reportJob(w http.ResponseWriter, r *http.Request, db *sql.DB, id int64,
+	report func(*sql.DB, int64, entities.ScanJobReport) error) {
+	agent, err := apiutil.RequestAgent(db, r)
+	if err != nil {
+		apiutil.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	var req entities.ScanJobReport
+	if err := apiutil.DecodeJSON(r, &req); err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	job, err := datastore.GetScanJob(db, id)
+	if err == nil && job.AgentID != int64(agent.Id) {
+		err = sql.ErrNoRows // Only the agent holding the lease reports on the job
+	}
+	if err == nil {
+		err = report(db, id, req)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		apiutil.WriteError(w, http.StatusConflict, fmt.Sprintf("lease of scan job %d is not held", id))
+		return
+	}
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+)
+
+// RequestIDHeader carries the ID of a request in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the IDs accepted from clients, which end up in logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// RequestID returns the ID given to a request by the server's middleware
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID keeps the client's request ID, or assigns one, and returns
+// it in the response
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = auth.GenerateAPISeed()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// statusRecorder remembers the status written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(data)
+}
+
+// withLogging logs every request once answered
+func withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		logger.Info("%s %s %d %s [%s]", r.Method, r.URL.Path, recorder.status,
+			time.Since(start).Round(time.Millisecond), RequestID(r.Context()))
+	})
+}
+
+// withRecovery answers a request whose handler panicked with a JSON error,
+// unless the handler already started its response
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder, ok := w.(*statusRecorder)
+		if !ok {
+			recorder = &statusRecorder{ResponseWriter: w}
+		}
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				logger.Error("Panic serving %s %s [%s]: %v\n%s", r.Method, r.URL.Path,
+					RequestID(r.Context()), p, debug.Stack())
+				if recorder.status == 0 {
+					apiutil.WriteError(recorder, http.StatusInternalServerError, "internal server error")
+				}
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+)
+
+// checkJSONError checks that a response is a JSON error with the given
+// status
+func checkJSONError(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		t.Errorf("got status %d, want %d", resp.StatusCode, status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got content type %q, want application/json", ct)
+	}
+	var body apiutil.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+		t.Errorf("got body error %q (%v), want a JSON error message", body.Error, err)
+	}
+}
+
+func TestRecoveryAnswersWithJSONError(t *testing.T) {
+	s := NewServer("", nil, Timeouts{})
+	s.mux.HandleFunc("/test/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	s.mux.HandleFunc("/test/panic-after-write", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("boom")
+	})
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/test/panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get(RequestIDHeader) == "" {
+		t.Error("recovered response carries no request ID")
+	}
+	checkJSONError(t, resp, http.StatusInternalServerError)
+
+	// The status already sent is kept, and the server keeps serving
+	resp, err = http.Get(srv.URL + "/test/panic-after-write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("panic after the header: got status %d, want 202", resp.StatusCode)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	s := NewServer("", nil, Timeouts{})
+	var seen string
+	s.mux.HandleFunc("/test/id", func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	})
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name, sent string
+		kept       bool
+	}{
+		{"none", "", false},
+		{"valid", "client-42.retry_1", true},
+		{"invalid", "bad id with spaces", false},
+		{"too long", strings.Repeat("a", 65), false},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/test/id", nil)
+		if tc.sent != "" {
+			req.Header.Set(RequestIDHeader, tc.sent)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		got := resp.Header.Get(RequestIDHeader)
+		if got == "" || got != seen {
+			t.Errorf("%s: response ID %q, handler saw %q", tc.name, got, seen)
+		}
+		if tc.kept != (got == tc.sent) {
+			t.Errorf("%s: sent %q, got %q", tc.name, tc.sent, got)
+		}
+		if !validRequestID.MatchString(got) {
+			t.Errorf("%s: assigned ID %q is not a valid ID", tc.name, got)
+		}
+	}
+}
+
+func TestErrorsAreJSON(t *testing.T) {
+	srv := newTestServer(t)
+	token := tokenFor(t, testAgent(t, "worker", true, false), auth.RoleAgent)
+
+	for _, tc := range []struct {
+		name, method, path, token, body string
+		status                          int
+	}{
+		{"unknown API path", http.MethodGet, "/api/nothing-here", token, "", http.StatusNotFound},
+		{"no token", http.MethodGet, "/api", "", "", http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/api", "not-a-token", "", http.StatusUnauthorized},
+		{"wrong method", http.MethodGet, "/api/ingest", token, "", http.StatusMethodNotAllowed},
+		{"malformed body", http.MethodPost, "/api/ingest", token, "{", http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/api/jobs/lease", token, `{"wait": 1}`, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+			if tc.token != "" {
+				req.Header.Set("Token", tc.token)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkJSONError(t, resp, tc.status)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Command gen writes the OpenAPI document of the API from the route table
+// in routes.go and the Go types the handlers and the client exchange. Run
+// it with go generate in pkg/api/openapi.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+)
+
+func main() {
+	out := "openapi.json"
+	if len(os.Args) > 1 {
+		out = os.Args[1]
+	}
+	data, err := generate()
+	if err == nil {
+		err = os.WriteFile(out, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// generate returns the OpenAPI document as written to openapi.json
+func generate() ([]byte, error) {
+	comments, err := newComments()
+	if err != nil {
+		return nil, err
+	}
+	s := &schemas{defs: object{}, names: schemaNames, fields: fieldSchemas, comments: comments}
+	a := &api{s: s, paths: object{}}
+	routes(a)
+
+	responses := object{}
+	for _, response := range errorResponses {
+		responses[response.name] = object{
+			"description": response.description,
+			"content":     object{"application/json": object{"schema": s.of(apiutil.ErrorResponse{})}},
+		}
+	}
+
+	doc := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "dupectl API",
+			"version": "1.0.0",
+			"description": "API of the dupectl server. Agents register with the shared API key, exchange their " +
+				"credential for a token once an admin approves them, and send the token in the Token header of " +
+				"every other request. Agent tokens reach the ingest endpoints, heartbeats and the jobs the agent " +
+				"leases; all other endpoints need the token of an agent granted the admin role (x-role).",
+		},
+		"tags":     tags,
+		"security": []object{{"token": []string{}}},
+		"paths":    a.paths,
+		"components": object{
+			"securitySchemes": object{
+				"token":      apiKey("Token", "Token obtained from /api/agent/token"),
+				"apiKey":     apiKey("Key", "Shared API key of the server (server.apikey)"),
+				"credential": apiKey("Credential", "Credential returned at registration"),
+			},
+			"responses": responses,
+			"schemas":   s.defs,
+		},
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var tags = []object{
+	{"name": "server"}, {"name": "auth"}, {"name": "agents"}, {"name": "hosts"}, {"name": "metadata"},
+	{"name": "roots"}, {"name": "duplicates"}, {"name": "ingest"}, {"name": "jobs"},
+}
+
+func apiKey(header, description string) object {
+	return object{"type": "apiKey", "in": "header", "name": header, "description": description}
+}
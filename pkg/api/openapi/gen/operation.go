@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+)
+
+// errorResponses are the shared error responses, by status
+var errorResponses = map[int]struct{ name, description string }{
+	http.StatusBadRequest:   {"BadRequest", "Invalid request"},
+	http.StatusUnauthorized: {"Unauthorized", "Missing or invalid token or key"},
+	http.StatusForbidden: {"Forbidden", "The agent is not approved, is disabled, lacks its client certificate, " +
+		"or lacks the admin role the operation needs"},
+	http.StatusNotFound: {"NotFound", "Not found"},
+	http.StatusConflict: {"Conflict", "Conflicts with the current state"},
+}
+
+// operation is an operation of the API
+type operation struct {
+	s  *schemas
+	op object
+}
+
+// api collects the operations of the API by path
+type api struct {
+	s     *schemas
+	paths object
+}
+
+// add adds an operation. Operations taking a token are given the role they
+// need, and the shared 401 and 403 responses.
+func (a *api) add(method, path, role, tag, id, summary string) *operation {
+	op := object{
+		"tags":        []string{tag},
+		"operationId": id,
+		"summary":     summary,
+		"responses":   object{},
+	}
+	if role != "" {
+		op["x-role"] = role
+		if role == auth.RoleAdmin {
+			op["description"] = "Needs the token of an agent granted the admin role."
+		}
+	}
+	if _, ok := a.paths[path]; !ok {
+		a.paths[path] = object{}
+	}
+	a.paths[path].(object)[strings.ToLower(method)] = op
+
+	o := &operation{s: a.s, op: op}
+	if role != "" {
+		o.fails(http.StatusUnauthorized, http.StatusForbidden)
+	}
+	return o
+}
+
+// agent adds an operation open to the token of any approved agent
+func (a *api) agent(method, path, tag, id, summary string) *operation {
+	return a.add(method, path, auth.RoleAgent, tag, id, summary)
+}
+
+// admin adds an operation that needs an admin token
+func (a *api) admin(method, path, tag, id, summary string) *operation {
+	return a.add(method, path, auth.RoleAdmin, tag, id, summary)
+}
+
+// security replaces the token by other authentication; none for none
+func (o *operation) security(schemes ...string) *operation {
+	requirements := []object{}
+	for _, scheme := range schemes {
+		requirements = append(requirements, object{scheme: []string{}})
+	}
+	o.op["security"] = requirements
+	return o
+}
+
+func (o *operation) param(in, name, description string, schema object, required bool) *operation {
+	params, _ := o.op["parameters"].([]object)
+	param := object{"name": name, "in": in, "required": required, "schema": schema}
+	if description != "" {
+		param["description"] = description
+	}
+	o.op["parameters"] = append(params, param)
+	return o
+}
+
+// query adds an optional query parameter
+func (o *operation) query(name, description string, schema object) *operation {
+	return o.param("query", name, description, schema, false)
+}
+
+// requiredQuery adds a query parameter the operation needs
+func (o *operation) requiredQuery(name, description string, schema object) *operation {
+	return o.param("query", name, description, schema, true)
+}
+
+// pathParam adds a parameter of the path
+func (o *operation) pathParam(name, description string, schema object) *operation {
+	return o.param("path", name, description, schema, true)
+}
+
+// header adds a request header the operation needs
+func (o *operation) header(name, description string) *operation {
+	return o.param("header", name, description, object{"type": "string"}, true)
+}
+
+// accepts sets the JSON request body, required unless optional
+func (o *operation) accepts(v any, optional ...bool) *operation {
+	o.op["requestBody"] = object{
+		"required": len(optional) == 0 || !optional[0],
+		"content":  object{"application/json": object{"schema": o.s.of(v)}},
+	}
+	return o
+}
+
+// returns adds a response, with a JSON body of v's form unless v is nil
+func (o *operation) returns(status int, description string, v any) *operation {
+	response := object{"description": description}
+	if v != nil {
+		response["content"] = object{"application/json": object{"schema": o.s.of(v)}}
+	}
+	o.op["responses"].(object)[strconv.Itoa(status)] = response
+	return o
+}
+
+// withHeader documents a header of the response with the given status
+func (o *operation) withHeader(status int, name, description string) *operation {
+	response := o.op["responses"].(object)[strconv.Itoa(status)].(object)
+	response["headers"] = object{name: object{"description": description, "schema": object{"type": "string"}}}
+	return o
+}
+
+// fails adds shared error responses
+func (o *operation) fails(statuses ...int) *operation {
+	for _, status := range statuses {
+		o.op["responses"].(object)[strconv.Itoa(status)] = ref("responses", errorResponses[status].name)
+	}
+	return o
+}
+
+// oneOf is a schema matching either of the values' forms
+func (a *api) oneOf(values ...any) object {
+	schemas := make([]object, len(values))
+	for i, v := range values {
+		schemas[i] = a.s.of(v)
+	}
+	return object{"oneOf": schemas}
+}
+
+// enum is a string schema limited to the given values
+func enum(values ...string) object {
+	return object{"type": "string", "enum": values}
+}
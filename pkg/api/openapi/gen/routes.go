@@ -0,0 +1,237 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	ingest "github.com/jpconstantineau/dupectl/pkg/api/ingest"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+// schemaNames renames the types whose Go name does not suit the API
+var schemaNames = map[reflect.Type]string{
+	reflect.TypeOf(apiutil.ErrorResponse{}):   "Error",
+	reflect.TypeOf(entities.RootFolderInfo{}): "RootFolder",
+	reflect.TypeOf(duplicate.JSONFile{}):      "DuplicateFile",
+	reflect.TypeOf(duplicate.JSONSet{}):       "DuplicateSet",
+	reflect.TypeOf(duplicate.JSONPage{}):      "DuplicatePage",
+}
+
+var (
+	approvals     = []string{entities.AgentPending, entities.AgentApproved, entities.AgentRevoked}
+	scanJobKinds  = []string{entities.ScanJobRoot, entities.ScanJobSubtree, entities.ScanJobRehash}
+	scanJobStates = []string{entities.ScanJobQueued, entities.ScanJobLeased, entities.ScanJobDone, entities.ScanJobFailed}
+	checkStates   = []string{datastore.CheckPass, datastore.CheckWarning, datastore.CheckError}
+)
+
+// fieldSchemas adds what the Go types do not tell to the schemas of their
+// fields, by "Schema.json_name"
+var fieldSchemas = map[string]object{
+	"Agent.approval":             {"enum": approvals},
+	"AgentUpdate.approval":       {"enum": []string{entities.AgentApproved, entities.AgentRevoked}},
+	"AgentRegistration.approval": {"enum": []string{entities.AgentPending}},
+	"PurgeRequest.entities":      {"enum": []string{entities.PurgeFiles, entities.PurgeFolders, entities.PurgeAll}},
+	"VerifyCheck.status":         {"enum": checkStates},
+	"VerifyIssue.severity":       {"enum": []string{datastore.CheckWarning, datastore.CheckError}},
+	"ScanJob.kind":               {"enum": scanJobKinds},
+	"ScanJob.status":             {"enum": scanJobStates},
+	"ScanJobRequest.kind":        {"enum": scanJobKinds},
+	"IngestBatch.folders":        {"maxItems": ingest.MaxBatchSize},
+	"IngestBatch.files":          {"maxItems": ingest.MaxBatchSize},
+}
+
+// routes describes the operations the server's handlers serve
+func routes(a *api) {
+	const (
+		get  = http.MethodGet
+		post = http.MethodPost
+		put  = http.MethodPut
+		del  = http.MethodDelete
+	)
+	str := object{"type": "string"}
+	integer := object{"type": "integer"}
+	id64 := object{"type": "integer", "format": "int64", "minimum": 1}
+
+	a.agent(get, "/api", "server", "getStatus", "Check that the API is up and the token valid").
+		returns(200, "API is up", object{"type": "object", "properties": object{"status": str}, "required": []string{"status"}})
+	a.add(get, "/api/openapi.json", "", "server", "getOpenAPI", "This document").security().
+		returns(200, "OpenAPI document", object{"type": "object"})
+
+	// Agents
+	a.add(post, "/api/agent/register", "", "auth", "registerAgent", "Register a machine as an agent, pending approval by an admin").
+		security("apiKey").
+		header("Clientid", "Encoded machine ID").
+		header("Uniqueid", "Unique ID of the agent installation").
+		accepts(entities.AgentRegistrationRequest{}, true).
+		returns(202, "Registered, pending approval", entities.AgentRegistration{}).
+		fails(400, 401)
+	a.add(post, "/api/agent/token", "", "auth", "getToken", "Exchange the credential of an approved agent for a token").
+		security("credential").
+		returns(200, "Token", entities.AgentToken{}).
+		fails(401).
+		returns(403, "Registration awaiting approval", apiutil.ErrorResponse{})
+	a.agent(post, "/api/agent/refresh", "auth", "refreshToken", "Exchange a token that has not expired for a new one").
+		returns(200, "Token", entities.AgentToken{})
+	a.agent(post, "/api/agent/heartbeat", "agents", "sendHeartbeat", "Record the heartbeat of the calling agent, even when disabled").
+		accepts(entities.AgentHeartbeat{}).
+		returns(200, "The agent as the server sees it", entities.Agent{}).
+		fails(400)
+	a.admin(get, "/api/agent", "agents", "getAgents", "List agents, or get one by ID").
+		query("id", "Agent ID", integer).
+		returns(200, "All agents, or the agent with the given ID", a.oneOf([]entities.Agent{}, entities.Agent{})).
+		fails(400, 404)
+	a.admin(put, "/api/agent", "agents", "updateAgent", "Approve, revoke, enable or disable an agent, or grant or withdraw its admin role").
+		requiredQuery("id", "Agent ID", integer).
+		accepts(entities.AgentUpdate{}).
+		returns(200, "Updated agent", entities.Agent{}).
+		fails(400, 404)
+	a.admin(del, "/api/agent", "agents", "deleteAgent", "Delete an agent").
+		requiredQuery("id", "Agent ID", integer).
+		returns(204, "Deleted", nil).
+		fails(400, 404)
+
+	// Hosts and metadata
+	for _, kind := range []struct {
+		path, schema, plural, tag string
+		value, list               any
+	}{
+		{"/api/host", "Host", "hosts", "hosts", entities.Host{}, []entities.Host{}},
+		{"/api/owner", "Owner", "owners", "metadata", entities.Owner{}, []entities.Owner{}},
+		{"/api/purpose", "Purpose", "purposes", "metadata", entities.Purpose{}, []entities.Purpose{}},
+		{"/api/policy", "Policy", "policies", "metadata", entities.Policy{}, []entities.Policy{}},
+	} {
+		name := kind.schema + " name"
+		singular := kind.path[len("/api/"):]
+		a.admin(get, kind.path, kind.tag, "get"+kind.schema, "List "+kind.plural+", or get one by name").
+			query("name", name, str).
+			returns(200, "All "+kind.plural+", or the one with the given name", a.oneOf(kind.list, kind.value)).
+			fails(404)
+		a.admin(post, kind.path, kind.tag, "create"+kind.schema, "Create a "+singular).
+			accepts(kind.value).
+			returns(201, "Created", kind.value).
+			fails(400, 409)
+		a.admin(put, kind.path, kind.tag, "update"+kind.schema, "Replace a "+singular).
+			requiredQuery("name", name, str).
+			accepts(kind.value).
+			returns(200, "Updated", kind.value).
+			fails(400, 404, 409)
+		a.admin(del, kind.path, kind.tag, "delete"+kind.schema, "Delete a "+singular).
+			requiredQuery("name", name, str).
+			returns(204, "Deleted", nil).
+			fails(400, 404, 409)
+	}
+
+	// Root folders
+	a.admin(get, "/api/root", "roots", "listRoots", "List root folders").
+		query("host", "Only the roots of this host", str).
+		returns(200, "Root folders", []entities.RootFolderInfo{}).
+		fails(404)
+	a.admin(post, "/api/root", "roots", "createRoot", "Register a root folder").
+		accepts(entities.RootFolderRequest{}).
+		returns(201, "Registered", entities.RootFolderInfo{}).
+		withHeader(201, "Location", "URL of the new root folder").
+		fails(400, 409)
+	a.admin(get, "/api/root/{id}", "roots", "getRoot", "Get a root folder").
+		pathParam("id", "Root folder ID", id64).
+		returns(200, "Root folder", entities.RootFolderInfo{}).
+		fails(400, 404)
+	a.admin(put, "/api/root/{id}", "roots", "updateRoot", "Change the settings of a root folder").
+		pathParam("id", "Root folder ID", id64).
+		accepts(entities.RootFolderRequest{}).
+		returns(200, "Updated", entities.RootFolderInfo{}).
+		fails(400, 404)
+	a.admin(del, "/api/root/{id}", "roots", "deleteRoot", "Delete a root folder with all its scan data").
+		pathParam("id", "Root folder ID", id64).
+		returns(204, "Deleted", nil).
+		fails(400, 404)
+	a.admin(post, "/api/root/{id}/refresh", "roots", "refreshRoot", "Recount the statistics of a root folder from its catalog").
+		pathParam("id", "Root folder ID", id64).
+		returns(200, "Root folder", entities.RootFolderInfo{}).
+		fails(404)
+	a.admin(post, "/api/root/{id}/purge", "roots", "purgeRoot", "Delete the records of removed files or folders, or count them").
+		pathParam("id", "Root folder ID", id64).
+		accepts(entities.PurgeRequest{}).
+		returns(200, "Records purged, or that would be on a dry run", entities.PurgeResult{}).
+		fails(400, 404)
+	a.admin(post, "/api/root/{id}/verify", "roots", "verifyRoot", "Check the consistency of a root folder's catalog").
+		pathParam("id", "Root folder ID", id64).
+		accepts(entities.VerifyRequest{}).
+		returns(200, "Checks run", entities.VerifyResult{}).
+		fails(400, 404)
+
+	// Duplicates
+	a.admin(get, "/api/duplicates", "duplicates", "listDuplicates", "One page of duplicate sets").
+		query("min_count", "Minimum copies per set", object{"type": "integer", "minimum": 2, "default": 2}).
+		query("min_size", "Minimum file size in bytes", object{"type": "integer", "format": "int64", "minimum": 0}).
+		query("root", "Only files under this root folder", id64).
+		query("path", "Only files under this path prefix", str).
+		query("sort", "Order of the sets", object{"type": "string", "enum": []string{"size", "reclaimable"}, "default": "size"}).
+		query("limit", "Sets per page", object{"type": "integer", "minimum": 1, "maximum": 1000, "default": 100}).
+		query("after", "Cursor returned as next by the previous page", str).
+		returns(200, "Duplicate sets", duplicate.JSONPage{}).
+		fails(400)
+	a.admin(get, "/api/duplicates/{hash}", "duplicates", "getDuplicateSet", "Get one duplicate set").
+		pathParam("hash", "Hash or unambiguous hash prefix", str).
+		returns(200, "Duplicate set", duplicate.JSONSet{}).
+		fails(400, 404)
+
+	// Ingestion
+	a.agent(post, "/api/ingest", "ingest", "startIngest", "Open a scan of a root folder of the agent's host").
+		accepts(entities.IngestStart{}).
+		returns(200, "Root folder the scan pushes to", entities.IngestRoot{}).
+		fails(400, 404)
+	a.agent(post, "/api/ingest/{id}/folders", "ingest", "ingestFolders", "Push folders, parents first").
+		pathParam("id", "Root folder ID", id64).
+		accepts(entities.IngestBatch{}).
+		returns(200, "IDs assigned by the server", []entities.IngestRecord{}).
+		fails(400, 404)
+	a.agent(post, "/api/ingest/{id}/files", "ingest", "ingestFiles", "Push files of pushed folders").
+		pathParam("id", "Root folder ID", id64).
+		accepts(entities.IngestBatch{}).
+		returns(200, "IDs assigned by the server", []entities.IngestRecord{}).
+		fails(400, 404)
+	a.agent(post, "/api/ingest/{id}/complete", "ingest", "completeIngest",
+		"Close a scan, mark entries it did not see removed and refresh the root's statistics").
+		pathParam("id", "Root folder ID", id64).
+		accepts(entities.IngestComplete{}, true).
+		returns(200, "Statistics of the root", entities.IngestStats{}).
+		fails(400, 404)
+
+	// Scan jobs
+	a.admin(get, "/api/jobs", "jobs", "listJobs", "List scan jobs, oldest first").
+		query("status", "Only jobs with this status", enum(scanJobStates...)).
+		returns(200, "Scan jobs", []entities.ScanJob{}).
+		fails(400)
+	a.admin(post, "/api/jobs", "jobs", "queueJob", "Queue a scan job").
+		accepts(entities.ScanJobRequest{}).
+		returns(201, "Queued", entities.ScanJob{}).
+		fails(400)
+	a.agent(post, "/api/jobs/lease", "jobs", "leaseJob", "Lease the next job of the agent's host").
+		accepts(entities.ScanJobLease{}).
+		returns(200, "Leased job, with its lease ID", entities.ScanJob{}).
+		returns(204, "No job available", nil).
+		fails(400)
+	a.admin(get, "/api/jobs/{id}", "jobs", "getJob", "Get a scan job").
+		pathParam("id", "Scan job ID", id64).
+		returns(200, "Scan job", entities.ScanJob{}).
+		fails(404)
+	a.admin(del, "/api/jobs/{id}", "jobs", "deleteJob", "Delete a scan job no agent holds").
+		pathParam("id", "Scan job ID", id64).
+		returns(204, "Deleted", nil).
+		fails(400, 404)
+	for _, report := range []struct{ action, id, summary string }{
+		{"progress", "reportJobProgress", "Report progress on a leased job, extending the lease"},
+		{"complete", "completeJob", "Mark a leased job done"},
+		{"fail", "failJob", "Release a leased job with an error"},
+	} {
+		a.agent(post, "/api/jobs/{id}/"+report.action, "jobs", report.id, report.summary).
+			pathParam("id", "Scan job ID", id64).
+			accepts(entities.ScanJobReport{}).
+			returns(204, "Recorded", nil).
+			fails(400).
+			returns(409, "The agent does not hold the lease", apiutil.ErrorResponse{})
+	}
+}
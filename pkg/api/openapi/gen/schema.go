@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// object is a JSON object of the document
+type object = map[string]any
+
+// schemas builds the schemas of Go types, adding the struct types they use
+// to the document's components. Descriptions are the types' and fields'
+// doc comments.
+type schemas struct {
+	defs     object
+	names    map[reflect.Type]string
+	fields   map[string]object // Extra keywords of fields, by "Schema.json_name"
+	comments *comments
+}
+
+// ref refers to a component of the document
+func ref(kind, name string) object {
+	return object{"$ref": "#/components/" + kind + "/" + name}
+}
+
+// of returns the schema of the JSON form of a value
+func (s *schemas) of(v any) object {
+	if schema, ok := v.(object); ok {
+		return schema
+	}
+	return s.typeSchema(reflect.TypeOf(v))
+}
+
+func (s *schemas) typeSchema(t reflect.Type) object {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return object{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Int, reflect.Int32:
+		return object{"type": "integer"}
+	case reflect.Int64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Float64:
+		return object{"type": "number"}
+	case reflect.Slice:
+		return object{"type": "array", "items": s.typeSchema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": s.typeSchema(t.Elem())}
+	case reflect.Struct:
+		name := s.name(t)
+		if _, ok := s.defs[name]; !ok {
+			s.defs[name] = nil // Types may refer to themselves
+			s.defs[name] = s.structSchema(t, name)
+		}
+		return ref("schemas", name)
+	}
+	panic(fmt.Sprintf("no schema for %s", t))
+}
+
+// name returns the schema name of a struct type
+func (s *schemas) name(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+	return t.Name()
+}
+
+func (s *schemas) structSchema(t reflect.Type, name string) object {
+	props := object{}
+	var required []string
+	s.addFields(t, name, props, &required)
+
+	// The client generator in pkg/apiclient/gen decodes into the same type
+	schema := object{"type": "object", "properties": props, "x-go-type": t.PkgPath() + "." + t.Name()}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	if doc := s.comments.get(t.PkgPath(), t.Name()); doc != "" {
+		// "Type is the..." reads "The..." in the document
+		if rest, ok := strings.CutPrefix(doc, t.Name()+" is "); ok {
+			doc = strings.ToUpper(rest[:1]) + rest[1:]
+		}
+		schema["description"] = doc
+	}
+	return schema
+}
+
+func (s *schemas) addFields(t reflect.Type, name string, props object, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		jsonName, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && jsonName == "" {
+			s.addFields(field.Type, name, props, required)
+			continue
+		}
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+		omitempty := strings.Contains(opts, "omitempty")
+
+		schema := s.typeSchema(field.Type)
+		if _, isRef := schema["$ref"]; !isRef {
+			schema = clone(schema)
+			if doc := s.comments.get(t.PkgPath(), t.Name(), field.Name); doc != "" {
+				schema["description"] = doc
+			}
+			if field.Type.Kind() == reflect.Pointer && !omitempty {
+				schema["nullable"] = true
+			}
+			for k, v := range s.fields[name+"."+jsonName] {
+				schema[k] = v
+			}
+		}
+		props[jsonName] = schema
+		if !omitempty {
+			*required = append(*required, jsonName)
+		}
+	}
+}
+
+func clone(o object) object {
+	c := make(object, len(o))
+	for k, v := range o {
+		c[k] = v
+	}
+	return c
+}
+
+// comments holds the doc comments of the types of the module's packages,
+// read from their source
+type comments struct {
+	module, dir string
+	docs        map[string]string // By "pkgpath.Type" and "pkgpath.Type.Field"
+	loaded      map[string]bool
+}
+
+// newComments finds the module holding the working directory
+func newComments() (*comments, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if module, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+					return &comments{module: strings.TrimSpace(module), dir: dir,
+						docs: map[string]string{}, loaded: map[string]bool{}}, nil
+				}
+			}
+			return nil, fmt.Errorf("%s declares no module", filepath.Join(dir, "go.mod"))
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, fmt.Errorf("no go.mod above the working directory")
+		}
+		dir = parent
+	}
+}
+
+// get returns the doc comment of a type, or of one of its fields, on a
+// single line
+func (c *comments) get(pkgPath string, names ...string) string {
+	if !c.loaded[pkgPath] {
+		c.loaded[pkgPath] = true
+		if err := c.load(pkgPath); err != nil {
+			panic(err)
+		}
+	}
+	return c.docs[pkgPath+"."+strings.Join(names, ".")]
+}
+
+func (c *comments) load(pkgPath string) error {
+	rel, ok := strings.CutPrefix(pkgPath, c.module)
+	if !ok {
+		return nil // Outside the module: no comments
+	}
+	dir := filepath.Join(c.dir, filepath.FromSlash(rel))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				doc := ts.Doc
+				if doc == nil && len(gen.Specs) == 1 {
+					doc = gen.Doc
+				}
+				c.set(doc, pkgPath, ts.Name.Name)
+
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				for _, field := range st.Fields.List {
+					doc := field.Doc
+					if doc == nil {
+						doc = field.Comment
+					}
+					for _, name := range field.Names {
+						c.set(doc, pkgPath, ts.Name.Name, name.Name)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *comments) set(doc *ast.CommentGroup, pkgPath string, names ...string) {
+	if doc == nil {
+		return
+	}
+	c.docs[pkgPath+"."+strings.Join(names, ".")] = strings.Join(strings.Fields(doc.Text()), " ")
+}
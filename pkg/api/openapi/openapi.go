@@ -0,0 +1,32 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+)
+
+// spec is the OpenAPI 3 description of the API, generated from the route
+// table in gen/routes.go and the types the handlers and pkg/apiclient
+// exchange. Run go generate after changing either, then in pkg/apiclient
+// to regenerate the client's methods. The server's tests fail when a route
+// of its mux and the operations of the document do not match.
+//
+//go:generate go run ./gen
+//go:embed openapi.json
+var spec []byte
+
+// HandleSpec serves the OpenAPI document, without authentication so that
+// tools can fetch it
+//
+//	GET /api/openapi.json
+func HandleSpec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("content-Type", "application/json")
+	w.Write(spec)
+}
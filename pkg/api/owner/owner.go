@@ -1,22 +1,21 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
 )
 
-func HandleOwner(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		fmt.Fprintf(w, "super secret Create Owner")
-	}
-	if r.Method == http.MethodGet {
-		fmt.Fprintf(w, "super secret Read Owner")
-	}
-	if r.Method == http.MethodPut {
-		fmt.Fprintf(w, "super secret Update Owner")
-	}
-	if r.Method == http.MethodDelete {
-		fmt.Fprintf(w, "super secret Delete Owner")
-	}
+var ownerResource = apiutil.NamedResource[entities.Owner]{
+	List:   datastore.GetOwners,
+	Get:    datastore.GetOwner,
+	Create: datastore.InsertOwner,
+	Update: datastore.UpdateOwner,
+	Delete: datastore.DeleteOwner,
+}
 
+func HandleOwner(w http.ResponseWriter, r *http.Request) {
+	ownerResource.ServeHTTP(w, r)
 }
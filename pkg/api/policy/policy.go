@@ -1,22 +1,21 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
 )
 
-func HandlePolicy(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		fmt.Fprintf(w, "super secret Create Policy")
-	}
-	if r.Method == http.MethodGet {
-		fmt.Fprintf(w, "super secret Read Policy")
-	}
-	if r.Method == http.MethodPut {
-		fmt.Fprintf(w, "super secret Update Policy")
-	}
-	if r.Method == http.MethodDelete {
-		fmt.Fprintf(w, "super secret Delete Policy")
-	}
+var policyResource = apiutil.NamedResource[entities.Policy]{
+	List:   datastore.GetPolicies,
+	Get:    datastore.GetPolicy,
+	Create: datastore.InsertPolicy,
+	Update: datastore.UpdatePolicy,
+	Delete: datastore.DeletePolicy,
+}
 
+func HandlePolicy(w http.ResponseWriter, r *http.Request) {
+	policyResource.ServeHTTP(w, r)
 }
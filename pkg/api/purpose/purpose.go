@@ -1,22 +1,21 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
 )
 
-func HandlePurpose(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		fmt.Fprintf(w, "super secret Create Purpose")
-	}
-	if r.Method == http.MethodGet {
-		fmt.Fprintf(w, "super secret Read Purpose")
-	}
-	if r.Method == http.MethodPut {
-		fmt.Fprintf(w, "super secret Update Purpose")
-	}
-	if r.Method == http.MethodDelete {
-		fmt.Fprintf(w, "super secret Delete Purpose")
-	}
+var purposeResource = apiutil.NamedResource[entities.Purpose]{
+	List:   datastore.GetPurposes,
+	Get:    datastore.GetPurpose,
+	Create: datastore.InsertPurpose,
+	Update: datastore.UpdatePurpose,
+	Delete: datastore.DeletePurpose,
+}
 
+func HandlePurpose(w http.ResponseWriter, r *http.Request) {
+	purposeResource.ServeHTTP(w, r)
 }
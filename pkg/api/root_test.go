@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+func TestRootsDefaultToCallersHost(t *testing.T) {
+	srv := newTestServer(t)
+	laptop := testAgent(t, "laptop", true, true)
+	token := tokenFor(t, laptop, auth.RoleAdmin)
+
+	// The server's disk is never probed for the laptop's path: the case
+	// sensitivity the laptop detected is kept
+	status, body := call(t, srv, http.MethodPost, "/api/root", token, `{"path": "/home/me/docs", "case_insensitive": true}`)
+	if status != http.StatusCreated {
+		t.Fatalf("create root: got %d %s, want 201", status, body)
+	}
+	var root entities.RootFolderInfo
+	if err := json.Unmarshal([]byte(body), &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.Host != "laptop" || !root.CaseInsensitive || root.Device != "" {
+		t.Errorf("root registered as %+v, want it on host laptop, case-insensitive, with no device", root)
+	}
+
+	// Other hosts are named
+	testAgent(t, "fileserver", true, false)
+	status, body = call(t, srv, http.MethodPost, "/api/root", token, `{"host": "fileserver", "path": "/home/me/docs"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("create root of another host: got %d %s, want 201", status, body)
+	}
+	if status, body = call(t, srv, http.MethodPost, "/api/root", token, `{"host": "nowhere", "path": "/srv"}`); status != http.StatusBadRequest {
+		t.Errorf("create root of an unknown host: got %d %s, want 400", status, body)
+	}
+}
@@ -1,22 +1,392 @@
 package api
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
 )
 
+// HandleRoot serves the registered root folders:
+//
+//	GET    /api/root              list all, or ?host=<name> for one host
+//	GET    /api/root/<id>         get one
+//	POST   /api/root              register from the JSON body
+//	PUT    /api/root/<id>         change settings from the JSON body
+//	DELETE /api/root/<id>         delete with all its scan data
+//	POST   /api/root/<id>/refresh recount the root's statistics
+//	POST   /api/root/<id>/purge   delete the records of removed files or
+//	                              folders (PurgeRequest)
+//	POST   /api/root/<id>/verify  check the catalog (VerifyRequest)
+//
+// Roots have no include or exclude filters, as scans catalog every file
+// under a root; a body carrying them is rejected as invalid.
 func HandleRoot(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		fmt.Fprintf(w, "super secret Create Root")
+	db, err := datastore.OpenDb()
+	if err != nil {
+		apiutil.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer db.Close()
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/root"), "/")
+	idText, action, _ := strings.Cut(rest, "/")
+	if idText == "" {
+		switch r.Method {
+		case http.MethodGet:
+			listRoots(w, r, db)
+		case http.MethodPost:
+			createRoot(w, r, db)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil || id <= 0 {
+		apiutil.WriteError(w, http.StatusBadRequest, "invalid root folder id: "+idText)
+		return
+	}
+	if action != "" {
+		rootAction(w, r, db, id, action)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		root, err := datastore.GetRootFolder(db, id)
+		if err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		writeRoot(w, db, http.StatusOK, root)
+	case http.MethodPut:
+		updateRoot(w, r, db, id)
+	case http.MethodDelete:
+		if err := datastore.DeleteRootFolder(db, id); err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// rootAction serves the maintenance actions on a root folder's catalog
+func rootAction(w http.ResponseWriter, r *http.Request, db *sql.DB, id int64, action string) {
+	if action != "refresh" && action != "purge" && action != "verify" {
+		apiutil.WriteError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		apiutil.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	root, err := datastore.GetRootFolder(db, id)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+
+	switch action {
+	case "refresh":
+		if _, _, _, err := datastore.RefreshRootFolderStats(db, id); err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		if root, err = datastore.GetRootFolder(db, id); err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		writeRoot(w, db, http.StatusOK, root)
+
+	case "purge":
+		var req entities.PurgeRequest
+		if err := apiutil.DecodeJSON(r, &req); err != nil {
+			apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var result entities.PurgeResult
+		if req.DryRun {
+			result, err = datastore.CountRemoved(db, id, req.Before)
+		} else {
+			result, err = datastore.PurgeRemoved(db, id, req.Entities, req.Before)
+		}
+		if err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		apiutil.WriteJSON(w, http.StatusOK, result)
+
+	case "verify":
+		var req entities.VerifyRequest
+		if err := apiutil.DecodeJSON(r, &req); err != nil {
+			apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		result, err := datastore.VerifyRootFolder(db, root, req.Repair)
+		if err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		apiutil.WriteJSON(w, http.StatusOK, result)
+	}
+}
+
+func listRoots(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	roots, err := datastore.GetAllRootFolders(db)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+
+	var hostID int64
+	if name := r.URL.Query().Get("host"); name != "" {
+		host, err := datastore.GetHost(db, name)
+		if err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		hostID = int64(host.Id)
+	}
+
+	conv, err := datastore.NewRootFolderConverter(db)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	items := []entities.RootFolderInfo{}
+	for _, root := range roots {
+		if hostID != 0 && root.HostID != hostID {
+			continue
+		}
+		item, err := conv.Convert(root)
+		if err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		items = append(items, item)
+	}
+	apiutil.WriteJSON(w, http.StatusOK, items)
+}
+
+func createRoot(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req entities.RootFolderRequest
+	if err := apiutil.DecodeJSON(r, &req); err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Host == "" {
+		// Without a host, the path is one of the calling agent's machine
+		host, err := apiutil.AgentHost(db, r)
+		if err != nil {
+			apiutil.WriteError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		req.Host = host.Name
+	}
+	root, err := registerRoot(db, req)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/root/%d", root.ID))
+	writeRoot(w, db, http.StatusCreated, root)
+}
+
+// registerRoot validates a POST request and registers the root folder on
+// the request's host
+func registerRoot(db *sql.DB, req entities.RootFolderRequest) (*datastore.RootFolder, error) {
+	if !pathutil.IsAbsoluteOnAnyHost(req.Path) {
+		return nil, fmt.Errorf("%w: path must be absolute", datastore.ErrInvalid)
+	}
+	path := pathutil.NormalizePathForStorage(req.Path)
+
+	local, err := datastore.RegisterLocalHost(db)
+	if err != nil {
+		return nil, err
+	}
+	host, err := datastore.GetHost(db, req.Host)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: unknown host %q", datastore.ErrInvalid, req.Host)
+	}
+	if err != nil {
+		return nil, err
 	}
-	if r.Method == http.MethodGet {
-		fmt.Fprintf(w, "super secret Read Root")
+
+	existing, err := datastore.FindRootFolderByPath(db, int64(host.Id), path)
+	if err == nil {
+		return nil, fmt.Errorf("root folder %s on host %s %w", existing.Path, host.Name, datastore.ErrExists)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	assignments, err := resolveMetadata(db, req)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &datastore.RootFolder{HostID: int64(host.Id), Path: path}
+	if req.TraverseLinks != nil {
+		root.TraverseLinks = *req.TraverseLinks
+	}
+
+	// Only the server's own filesystems can be probed: the roots of other
+	// hosts take the case sensitivity of the request, or the default
+	isLocal := host.Id == local.Id
+	root.CaseInsensitive = pathutil.DefaultCaseInsensitive()
+	if req.CaseInsensitive != nil {
+		root.CaseInsensitive = *req.CaseInsensitive
+	} else if isLocal {
+		if probed, err := pathutil.ProbeCaseInsensitive(path); err == nil {
+			root.CaseInsensitive = probed
+		}
+	}
+	if isLocal {
+		if device, err := pathutil.DeviceID(path); err == nil {
+			root.Device = device
+		}
+	}
+
+	if root.ID, err = datastore.InsertRootFolder(db, root); err != nil {
+		return nil, err
+	}
+	if err := assignMetadata(db, root, assignments); err != nil {
+		return nil, err
+	}
+	return datastore.GetRootFolder(db, root.ID)
+}
+
+func updateRoot(w http.ResponseWriter, r *http.Request, db *sql.DB, id int64) {
+	var req entities.RootFolderRequest
+	if err := apiutil.DecodeJSON(r, &req); err != nil {
+		apiutil.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	root, err := datastore.GetRootFolder(db, id)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	if req.Path != "" && pathutil.NormalizePathForStorage(req.Path) != root.Path {
+		apiutil.WriteError(w, http.StatusBadRequest, "path cannot be changed; register a new root folder instead")
+		return
+	}
+	if req.Host != "" {
+		host, err := datastore.GetHostByID(db, int(root.HostID))
+		if err != nil {
+			apiutil.WriteDatastoreError(w, err)
+			return
+		}
+		if !strings.EqualFold(req.Host, host.Name) {
+			apiutil.WriteError(w, http.StatusBadRequest, "host cannot be changed; register a new root folder instead")
+			return
+		}
 	}
-	if r.Method == http.MethodPut {
-		fmt.Fprintf(w, "super secret Update Root")
+
+	assignments, err := resolveMetadata(db, req)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+
+	if req.TraverseLinks != nil {
+		root.TraverseLinks = *req.TraverseLinks
+	}
+	if req.CaseInsensitive != nil {
+		root.CaseInsensitive = *req.CaseInsensitive
+	}
+	if err := datastore.UpdateRootFolderSettings(db, id, root.TraverseLinks, root.CaseInsensitive); err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	if err := assignMetadata(db, root, assignments); err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	writeRoot(w, db, http.StatusOK, root)
+}
+
+// assignment sets (or, with a nil ID, clears) one kind of metadata
+type assignment struct {
+	kind string
+	id   *int
+}
+
+// resolveMetadata looks up the owner, purpose and policy named in a
+// request, so unknown names are rejected before anything is changed
+func resolveMetadata(db *sql.DB, req entities.RootFolderRequest) ([]assignment, error) {
+	requested := []struct {
+		kind   string
+		name   *string
+		lookup func(name string) (int, error)
+	}{
+		{datastore.MetadataOwner, req.Owner, func(name string) (int, error) {
+			item, err := datastore.GetOwner(db, name)
+			return item.Id, err
+		}},
+		{datastore.MetadataPurpose, req.Purpose, func(name string) (int, error) {
+			item, err := datastore.GetPurpose(db, name)
+			return item.Id, err
+		}},
+		{datastore.MetadataPolicy, req.Policy, func(name string) (int, error) {
+			item, err := datastore.GetPolicy(db, name)
+			return item.Id, err
+		}},
 	}
-	if r.Method == http.MethodDelete {
-		fmt.Fprintf(w, "super secret Delete Root")
+
+	var assignments []assignment
+	for _, m := range requested {
+		if m.name == nil {
+			continue
+		}
+		a := assignment{kind: m.kind}
+		if *m.name != "" {
+			id, err := m.lookup(*m.name)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("%w: unknown %s %q", datastore.ErrInvalid, m.kind, *m.name)
+			}
+			if err != nil {
+				return nil, err
+			}
+			a.id = &id
+		}
+		assignments = append(assignments, a)
 	}
+	return assignments, nil
+}
 
+func assignMetadata(db *sql.DB, root *datastore.RootFolder, assignments []assignment) error {
+	for _, a := range assignments {
+		if err := datastore.AssignFolderMetadata(db, root.HostID, root.Path, a.kind, a.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeRoot(w http.ResponseWriter, db *sql.DB, status int, root *datastore.RootFolder) {
+	conv, err := datastore.NewRootFolderConverter(db)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	item, err := conv.Convert(root)
+	if err != nil {
+		apiutil.WriteDatastoreError(w, err)
+		return
+	}
+	apiutil.WriteJSON(w, status, item)
 }
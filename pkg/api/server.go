@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	agent "github.com/jpconstantineau/dupectl/pkg/api/agent"
+	"github.com/jpconstantineau/dupectl/pkg/api/apiutil"
+	duplicates "github.com/jpconstantineau/dupectl/pkg/api/duplicates"
+	host "github.com/jpconstantineau/dupectl/pkg/api/host"
+	ingest "github.com/jpconstantineau/dupectl/pkg/api/ingest"
+	jobs "github.com/jpconstantineau/dupectl/pkg/api/jobs"
+	openapi "github.com/jpconstantineau/dupectl/pkg/api/openapi"
+	owner "github.com/jpconstantineau/dupectl/pkg/api/owner"
+	policy "github.com/jpconstantineau/dupectl/pkg/api/policy"
+	purpose "github.com/jpconstantineau/dupectl/pkg/api/purpose"
+	root "github.com/jpconstantineau/dupectl/pkg/api/rootfolder"
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/web"
+)
+
+// ShutdownTimeout is how long a stopping server waits for the requests in
+// flight
+const ShutdownTimeout = 30 * time.Second
+
+// Timeouts bound how long a client may take to send a request and to read
+// the response
+type Timeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+// Server serves the API and the web page on its own mux. Every request is
+// given a request ID, logged, and answered with a JSON error should its
+// handler panic.
+type Server struct {
+	mux      *http.ServeMux
+	server   *http.Server
+	patterns []string // Registered on mux, to check them against the spec
+}
+
+// NewServer creates a server listening on addr, over TLS when tlsConfig
+// is set
+func NewServer(addr string, tlsConfig *tls.Config, timeouts Timeouts) *Server {
+	s := &Server{mux: http.NewServeMux()}
+	s.routes()
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: timeouts.ReadHeader,
+		ReadTimeout:       timeouts.Read,
+		WriteTimeout:      timeouts.Write,
+		IdleTimeout:       timeouts.Idle,
+	}
+	return s
+}
+
+// Handler returns the server's mux wrapped in its middleware, e.g. to
+// serve it with httptest
+func (s *Server) Handler() http.Handler {
+	return withRequestID(withLogging(withRecovery(s.mux)))
+}
+
+func (s *Server) routes() {
+	// Agents push scans and work on the jobs they lease
+	s.handle("/api", secured(ApiHome))
+	s.handle("/api/ingest", secured(ingest.HandleIngest))
+	s.handle("/api/ingest/", secured(ingest.HandleIngest))
+	s.handle("POST /api/jobs/lease", secured(jobs.HandleJobs))
+	s.handle("POST /api/jobs/{id}/{action}", secured(jobs.HandleJobs))
+
+	// Admins manage the server
+	s.handle("/api/agent", admin(agent.HandleAgent))
+	s.handle("/api/host", admin(host.HandleHost))
+	s.handle("/api/owner", admin(owner.HandleOwner))
+	s.handle("/api/policy", admin(policy.HandlePolicy))
+	s.handle("/api/purpose", admin(purpose.HandlePurpose))
+	s.handle("/api/root", admin(root.HandleRoot))
+	s.handle("/api/root/", admin(root.HandleRoot))
+	s.handle("/api/duplicates", admin(duplicates.HandleDuplicates))
+	s.handle("/api/duplicates/", admin(duplicates.HandleDuplicates))
+	s.handle("/api/jobs", admin(jobs.HandleJobs))
+	s.handle("/api/jobs/", admin(jobs.HandleJobs))
+
+	// Disabled agents keep sending heartbeats to learn when they are enabled
+	s.handle("/api/agent/heartbeat", auth.ValidateJWT(apiutil.RequireApprovedAgent(agent.HandleHeartbeat)))
+	s.handle("/api/agent/register", auth.RequireKey(agent.RegisterAgent))
+	s.handle("/api/agent/token", http.HandlerFunc(agent.HandleToken))
+	s.handle("/api/agent/refresh", secured(agent.HandleRefresh))
+	s.handle("/api/openapi.json", http.HandlerFunc(openapi.HandleSpec))
+
+	// Unknown API paths get a JSON error rather than the web page
+	s.handle("/api/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiutil.WriteError(w, http.StatusNotFound, "not found")
+	}))
+	s.handle("/", web.Handler())
+}
+
+// handle registers the handler of a route pattern
+func (s *Server) handle(pattern string, handler http.Handler) {
+	s.patterns = append(s.patterns, pattern)
+	s.mux.Handle(pattern, handler)
+}
+
+// Run serves until ctx is done, then stops accepting connections and waits
+// up to ShutdownTimeout for the requests in flight
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve is Run on a listener of the caller's
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	errc := make(chan error, 1)
+	go func() {
+		var err error
+		if s.server.TLSConfig != nil {
+			err = s.server.ServeTLS(ln, "", "")
+		} else {
+			err = s.server.Serve(ln)
+		}
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	logger.Info("Server stopped")
+	return nil
+}
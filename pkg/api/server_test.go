@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer serves s on a local port until the returned cancel is
+// called, returning the server's base URL and what Serve returned
+func startServer(t *testing.T, s *Server) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done, stopped := make(chan error, 1), make(chan struct{})
+	go func() {
+		done <- s.Serve(ctx, ln)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return "http://" + ln.Addr().String(), cancel, done
+}
+
+func TestServerDropsSlowClients(t *testing.T) {
+	s := NewServer("", nil, Timeouts{ReadHeader: 100 * time.Millisecond})
+	url, _, _ := startServer(t, s)
+
+	conn, err := net.Dial("tcp", url[len("http://"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET /api HTTP/1.1\r\nHost: test\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The headers are never finished: the server hangs up
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	data, err := io.ReadAll(conn)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Fatalf("server kept the connection of a client sending no headers for %s", time.Since(start))
+	}
+	if len(data) != 0 {
+		t.Errorf("got response %q to unfinished headers, want none", data)
+	}
+}
+
+func TestServerShutsDownGracefully(t *testing.T) {
+	s := NewServer("", nil, Timeouts{})
+	started, release := make(chan struct{}), make(chan struct{})
+	s.mux.HandleFunc("/test/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	url, cancel, done := startServer(t, s)
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url + "/test/slow")
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		responses <- result{string(data), err}
+	}()
+	<-started
+
+	// Stopping waits for the request in flight
+	cancel()
+	select {
+	case err := <-done:
+		t.Fatalf("server stopped with a request in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// New connections are refused meanwhile
+	if _, err := http.Get(url + "/api"); err == nil {
+		t.Error("stopping server accepted a new request")
+	}
+
+	close(release)
+	if r := <-responses; r.err != nil || r.body != "done" {
+		t.Errorf("request in flight: got %q, %v; want it answered", r.body, r.err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve returned %v after a graceful shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop once the request was answered")
+	}
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	data, err := os.ReadFile("openapi/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer("", nil, Timeouts{})
+
+	// Every operation of the spec reaches a route of its own...
+	fallbacks := map[string]bool{"/api/": true, "/": true}
+	described := map[string]bool{}
+	param := regexp.MustCompile(`\{[^}]+\}`)
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			req := httptest.NewRequest(strings.ToUpper(method), param.ReplaceAllString(path, "1"), nil)
+			_, pattern := s.mux.Handler(req)
+			if pattern == "" || fallbacks[pattern] {
+				t.Errorf("%s %s is in the spec but no route serves it", strings.ToUpper(method), path)
+				continue
+			}
+			described[pattern] = true
+		}
+	}
+
+	// ...and every route serves an operation of the spec
+	for _, pattern := range s.patterns {
+		if !fallbacks[pattern] && !described[pattern] {
+			t.Errorf("route %s serves no operation of the spec", pattern)
+		}
+	}
+}
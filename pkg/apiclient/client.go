@@ -0,0 +1,227 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/tlsutil"
+	"github.com/spf13/viper"
+)
+
+// RefreshMargin is how long before its expiry a token is refreshed
+const RefreshMargin = 5 * time.Minute
+
+// Client calls the dupectl API with tokens obtained for the stored
+// credential. Tokens are refreshed before they expire and saved for the
+// next run; a request refused with 401 is retried once with a new token.
+// A Client is safe for concurrent use. The methods calling each operation
+// are generated in operations.go from the OpenAPI document served at
+// /api/openapi.json; run go generate after changing it.
+//
+//go:generate go run ./gen
+type Client struct {
+	baseURL string
+	http    *http.Client
+
+	mu    sync.Mutex
+	creds Credentials
+}
+
+// APIError is an error response of the server
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// NewClient creates a client for the server configured under client.*
+func NewClient() (*Client, error) {
+	host := viper.GetString("client.apihost")
+	port := viper.GetString("client.apiport")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("no server configured: set client.apihost and client.apiport")
+	}
+	creds, err := LoadCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
+	if creds.Credential == "" {
+		return nil, fmt.Errorf("not registered with %s:%s: run 'dupectl register' first", host, port)
+	}
+	baseURL, httpClient, err := newHTTPClient(creds)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{baseURL: baseURL, http: httpClient, creds: creds}, nil
+}
+
+// TLSEnabled reports whether the server is reached over TLS: when
+// client.tls.enabled is set, or client.tls.ca pins the server's CA
+func TLSEnabled() bool {
+	return viper.GetBool("client.tls.enabled") || viper.GetString("client.tls.ca") != ""
+}
+
+// newHTTPClient returns the server's base URL and a client reaching it,
+// presenting the agent's certificate when it has one
+func newHTTPClient(creds Credentials) (string, *http.Client, error) {
+	host := viper.GetString("client.apihost")
+	port := viper.GetString("client.apiport")
+	if !TLSEnabled() {
+		return "http://" + host + ":" + port, &http.Client{Timeout: 5 * time.Minute}, nil
+	}
+
+	tlsConfig, err := tlsutil.ClientConfig(viper.GetString("client.tls.ca"),
+		[]byte(creds.Certificate), []byte(creds.PrivateKey))
+	if err != nil {
+		return "", nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return "https://" + host + ":" + port, &http.Client{Timeout: 5 * time.Minute, Transport: transport}, nil
+}
+
+// authenticate returns a token valid for a while, refreshing the current
+// one when it nears expiry and otherwise exchanging the credential for a
+// new one. stale is a token the server refused, which is not used again.
+// Fails with an APIError until the agent is approved.
+func (c *Client) authenticate(ctx context.Context, stale string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	expires := time.Unix(c.creds.ExpiresAt, 0)
+	if c.creds.Token != "" && c.creds.Token != stale && now.Add(RefreshMargin).Before(expires) {
+		return c.creds.Token, nil
+	}
+
+	var token entities.AgentToken
+	err := errors.New("no token")
+	if c.creds.Token != "" && c.creds.Token != stale && now.Before(expires) {
+		err = c.tokenRequest(ctx, "/api/agent/refresh", "Token", c.creds.Token, &token)
+		if err != nil {
+			logger.Debug("Token refresh failed, using the credential: %v", err)
+		}
+	}
+	if err != nil {
+		err = c.tokenRequest(ctx, "/api/agent/token", "Credential", c.creds.Credential, &token)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.creds.Token, c.creds.ExpiresAt = token.Token, token.ExpiresAt
+	if err := SaveCredentials(c.creds); err != nil {
+		logger.Warn("Failed to save token: %v", err)
+	}
+	return c.creds.Token, nil
+}
+
+// tokenRequest asks the server for a token, authenticating with the given
+// header
+func (c *Client) tokenRequest(ctx context.Context, path, header, value string, token *entities.AgentToken) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(header, value)
+	return c.send(req, token)
+}
+
+// Do sends in as the JSON body of a request to path and decodes the JSON
+// response into out. Either may be nil.
+func (c *Client) Do(ctx context.Context, method, path string, in, out interface{}) error {
+	var data []byte
+	if in != nil {
+		var err error
+		if data, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	stale := ""
+	for attempt := 0; ; attempt++ {
+		token, err := c.authenticate(ctx, stale)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Token", token)
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		err = c.send(req, out)
+		var apiErr *APIError
+		if attempt == 0 && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+			stale = token // e.g. the server's key changed; get a new token and retry once
+			continue
+		}
+		return err
+	}
+}
+
+// send sends a request and decodes the JSON response into out
+func (c *Client) send(req *http.Request, out interface{}) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(resp.StatusCode, data)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// oneOrMany decodes the responses that are an array of items, or a single
+// item when the request selects one
+type oneOrMany[T any] []T
+
+func (m *oneOrMany[T]) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return json.Unmarshal(trimmed, (*[]T)(m))
+	}
+	var item T
+	if err := json.Unmarshal(data, &item); err != nil {
+		return err
+	}
+	*m = []T{item}
+	return nil
+}
+
+// responseError turns an error response into an APIError. The server
+// answers with {"error": ...}; other bodies, e.g. from a proxy, are kept
+// as they are.
+func responseError(status int, data []byte) error {
+	var e struct {
+		Error string `json:"error"`
+	}
+	message := string(bytes.TrimSpace(data))
+	if json.Unmarshal(data, &e) == nil && e.Error != "" {
+		message = e.Error
+	}
+	return &APIError{StatusCode: status, Message: message}
+}
@@ -0,0 +1,105 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/spf13/viper"
+)
+
+// CredentialsFileName is the name of the credentials file, kept next to
+// the configuration file unless client.credentials names another path
+const CredentialsFileName = ".dupectl-credentials.json"
+
+// Credentials are what an agent keeps to authenticate: the credential
+// issued at registration, its client certificate if the server issued one,
+// and the last token obtained with them. They are kept out of the
+// configuration file, readable by their owner only.
+type Credentials struct {
+	Credential  string `json:"credential"`
+	Certificate string `json:"certificate,omitempty"` // PEM
+	PrivateKey  string `json:"private_key,omitempty"` // PEM key of the certificate
+	Token       string `json:"token,omitempty"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"` // Unix seconds
+}
+
+// CredentialsPath returns where the credentials are stored
+func CredentialsPath() (string, error) {
+	if path := viper.GetString("client.credentials"); path != "" {
+		return path, nil
+	}
+	if config := viper.ConfigFileUsed(); config != "" {
+		return filepath.Join(filepath.Dir(config), CredentialsFileName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, CredentialsFileName), nil
+}
+
+// LoadCredentials reads the stored credentials; they are empty when the
+// machine never registered
+func LoadCredentials() (Credentials, error) {
+	var creds Credentials
+	path, err := CredentialsPath()
+	if err != nil {
+		return creds, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return creds, nil
+	}
+	if err != nil {
+		return creds, err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		logger.Warn("Credentials file %s is accessible by other users; restrict it with: chmod 600 %s", path, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return creds, err
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return creds, fmt.Errorf("invalid credentials file %s: %w", path, err)
+	}
+	return creds, nil
+}
+
+// SaveCredentials replaces the stored credentials. The file is written
+// aside and renamed so that it is never left half written or readable by
+// others.
+func SaveCredentials(creds Credentials) error {
+	path, err := CredentialsPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), CredentialsFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,27 @@
+package apiclient
+
+import (
+	"context"
+
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+)
+
+// EachDuplicateSet calls fn with every duplicate set matching params, one
+// page after the other, stopping at the first error
+func (c *Client) EachDuplicateSet(ctx context.Context, params ListDuplicatesParams, fn func(duplicate.JSONSet) error) error {
+	for {
+		page, err := c.ListDuplicates(ctx, params)
+		if err != nil {
+			return err
+		}
+		for _, set := range page.Sets {
+			if err := fn(set); err != nil {
+				return err
+			}
+		}
+		if page.Next == "" {
+			return nil
+		}
+		params.After = page.Next
+	}
+}
@@ -0,0 +1,406 @@
+// Command gen writes the methods of the API client from the OpenAPI
+// document the server serves, so that the client calls every operation the
+// way the document describes it. Run it with go generate in pkg/apiclient.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// specFile is the OpenAPI document, relative to pkg/apiclient
+const specFile = "../api/openapi/openapi.json"
+
+func main() {
+	out := "operations.go"
+	if len(os.Args) > 1 {
+		out = os.Args[1]
+	}
+	data, err := generate(specFile)
+	if err == nil {
+		err = os.WriteFile(out, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// spec is the part of the OpenAPI document the client is generated from
+type spec struct {
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Schemas map[string]schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string      `json:"operationId"`
+	Summary     string      `json:"summary"`
+	Security    *[]any      `json:"security"` // Set when not the document's token
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Schema      schema `json:"schema"`
+}
+
+type schema struct {
+	Ref    string   `json:"$ref"`
+	Type   string   `json:"type"`
+	Format string   `json:"format"`
+	Items  *schema  `json:"items"`
+	OneOf  []schema `json:"oneOf"`
+	GoType string   `json:"x-go-type"`
+}
+
+// methods are the order operations of a path are written in
+var methods = []string{"get", "post", "put", "delete"}
+
+// generate returns the Go source written to operations.go for the
+// document in file
+func generate(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc spec
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", file, err)
+	}
+
+	g := &generator{doc: &doc, imports: map[string]bool{"context": true, "net/http": true}}
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		for _, method := range methods {
+			if op, ok := doc.Paths[p][method]; ok {
+				if err := g.operation(method, p, op); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), p, err)
+				}
+			}
+		}
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by go run ./gen from " + path.Base(file) + "; DO NOT EDIT.\n\n")
+	src.WriteString("package apiclient\n\nimport (\n")
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	// Standard library first, then the packages of the module
+	for _, module := range []bool{false, true} {
+		if module {
+			src.WriteString("\n")
+		}
+		for _, imp := range imports {
+			if strings.Contains(imp, ".") == module {
+				fmt.Fprintf(&src, "\t%q\n", imp)
+			}
+		}
+	}
+	src.WriteString(")\n")
+	src.Write(g.out.Bytes())
+	return format.Source(src.Bytes())
+}
+
+type generator struct {
+	doc     *spec
+	imports map[string]bool
+	out     bytes.Buffer
+}
+
+// operation writes the method calling an operation. Operations that do not
+// take the token, such as registration, are left to the hand-written code.
+func (g *generator) operation(method, p string, op operation) error {
+	if op.Security != nil {
+		return nil
+	}
+	name := exported(op.OperationID)
+
+	// Path and required query parameters are arguments, optional query
+	// parameters are fields of a <Name>Params struct
+	var args, pathArgs, required, optional []parameter
+	for _, param := range op.Parameters {
+		switch {
+		case param.In == "path":
+			pathArgs = append(pathArgs, param)
+			args = append(args, param)
+		case param.In == "query" && param.Required:
+			required = append(required, param)
+			args = append(args, param)
+		case param.In == "query":
+			optional = append(optional, param)
+		default:
+			return fmt.Errorf("unsupported %s parameter %s", param.In, param.Name)
+		}
+	}
+
+	signature := []string{"ctx context.Context"}
+	for _, param := range args {
+		goType, err := g.goType(param.Schema)
+		if err != nil {
+			return err
+		}
+		signature = append(signature, unexported(param.Name)+" "+goType)
+	}
+	if len(optional) > 0 {
+		if err := g.params(name, optional); err != nil {
+			return err
+		}
+		signature = append(signature, "params "+name+"Params")
+	}
+	body := "nil"
+	if op.RequestBody != nil {
+		goType, err := g.goType(op.RequestBody.Content["application/json"].Schema)
+		if err != nil {
+			return err
+		}
+		signature = append(signature, "body "+goType)
+		body = "body"
+	}
+
+	result, err := g.result(op)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(&g.out, "\n// %s calls %s %s: %s\n", name, strings.ToUpper(method), p, op.Summary)
+	returns := "error"
+	if result.goType != "" {
+		returns = "(" + result.goType + ", error)"
+	}
+	fmt.Fprintf(&g.out, "func (c *Client) %s(%s) %s {\n", name, strings.Join(signature, ", "), returns)
+
+	// Build the path, escaping its parameters
+	format, values := p, []string{}
+	for _, param := range pathArgs {
+		verb, value := "%d", unexported(param.Name)
+		if param.Schema.Type == "string" {
+			g.imports["net/url"] = true
+			verb, value = "%s", "url.PathEscape("+value+")"
+		}
+		format = strings.Replace(format, "{"+param.Name+"}", verb, 1)
+		values = append(values, value)
+	}
+	if len(values) > 0 {
+		g.imports["fmt"] = true
+		fmt.Fprintf(&g.out, "\tpath := fmt.Sprintf(%q, %s)\n", format, strings.Join(values, ", "))
+	} else {
+		fmt.Fprintf(&g.out, "\tpath := %q\n", p)
+	}
+	if len(required)+len(optional) > 0 {
+		g.imports["net/url"] = true
+		if len(optional) > 0 {
+			g.out.WriteString("\tquery := params.values()\n")
+		} else {
+			g.out.WriteString("\tquery := url.Values{}\n")
+		}
+		for _, param := range required {
+			fmt.Fprintf(&g.out, "\tquery.Set(%q, %s)\n", param.Name, g.formatValue(param.Schema, unexported(param.Name)))
+		}
+		if len(required) > 0 {
+			g.out.WriteString("\tpath += \"?\" + query.Encode()\n")
+		} else {
+			g.out.WriteString("\tif len(query) > 0 {\n\t\tpath += \"?\" + query.Encode()\n\t}\n")
+		}
+	}
+
+	httpMethod := "http.Method" + exported(method)
+	switch {
+	case result.goType == "":
+		fmt.Fprintf(&g.out, "\treturn c.Do(ctx, %s, path, %s, nil)\n", httpMethod, body)
+	case result.decode != "":
+		fmt.Fprintf(&g.out, "\tvar out %s\n", result.decode)
+		fmt.Fprintf(&g.out, "\terr := c.Do(ctx, %s, path, %s, &out)\n", httpMethod, body)
+		fmt.Fprintf(&g.out, "\treturn %s(out), err\n", result.goType)
+	default:
+		fmt.Fprintf(&g.out, "\tvar out %s\n", result.goType)
+		fmt.Fprintf(&g.out, "\terr := c.Do(ctx, %s, path, %s, &out)\n", httpMethod, body)
+		g.out.WriteString("\treturn out, err\n")
+	}
+	g.out.WriteString("}\n")
+	return nil
+}
+
+// result is what a method returns, and the type its response decodes into
+// when that differs
+type result struct {
+	goType string
+	decode string
+}
+
+// result returns what the method of an operation returns: nothing when no
+// success response has content, a pointer that is nil on responses without
+// content when some do, and every item when the response is an array of
+// items or a single item
+func (g *generator) result(op operation) (result, error) {
+	var content *schema
+	empty := false
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		body, ok := op.Responses[code].Content["application/json"]
+		switch {
+		case !ok:
+			empty = true
+		case content == nil:
+			content = &body.Schema
+		}
+	}
+	if content == nil {
+		return result{}, nil
+	}
+
+	if one := content.OneOf; len(one) == 2 && one[0].Items != nil && one[1].Ref != "" && one[0].Items.Ref == one[1].Ref {
+		item, err := g.goType(content.OneOf[1])
+		if err != nil {
+			return result{}, err
+		}
+		return result{goType: "[]" + item, decode: "oneOrMany[" + item + "]"}, nil
+	}
+	goType, err := g.goType(*content)
+	if err != nil {
+		return result{}, err
+	}
+	if empty {
+		return result{goType: "*" + goType}, nil
+	}
+	return result{goType: goType}, nil
+}
+
+// params writes the struct of the optional query parameters of an
+// operation and its values method
+func (g *generator) params(name string, params []parameter) error {
+	g.imports["net/url"] = true
+	fmt.Fprintf(&g.out, "\n// %sParams are the optional parameters of %s.\n// Zero fields are left to the server's defaults.\n", name, name)
+	fmt.Fprintf(&g.out, "type %sParams struct {\n", name)
+	for _, param := range params {
+		goType, err := g.goType(param.Schema)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&g.out, "\t%s %s // %s\n", exported(param.Name), goType, param.Description)
+	}
+	g.out.WriteString("}\n")
+
+	fmt.Fprintf(&g.out, "\nfunc (p %sParams) values() url.Values {\n\tvalues := url.Values{}\n", name)
+	for _, param := range params {
+		field := "p." + exported(param.Name)
+		zero := "0"
+		if param.Schema.Type == "string" {
+			zero = `""`
+		}
+		fmt.Fprintf(&g.out, "\tif %s != %s {\n\t\tvalues.Set(%q, %s)\n\t}\n", field, zero, param.Name, g.formatValue(param.Schema, field))
+	}
+	g.out.WriteString("\treturn values\n}\n")
+	return nil
+}
+
+// formatValue returns the expression formatting a parameter value
+func (g *generator) formatValue(s schema, value string) string {
+	if s.Type == "string" {
+		return value
+	}
+	g.imports["strconv"] = true
+	if s.Format == "int64" {
+		return "strconv.FormatInt(" + value + ", 10)"
+	}
+	return "strconv.Itoa(" + value + ")"
+}
+
+// goType returns the Go type of a schema, importing its package
+func (g *generator) goType(s schema) (string, error) {
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		component, ok := g.doc.Components.Schemas[name]
+		if !ok || component.GoType == "" {
+			return "", fmt.Errorf("schema %s has no x-go-type", name)
+		}
+		i := strings.LastIndex(component.GoType, ".")
+		pkg := component.GoType[:i]
+		g.imports[pkg] = true
+		return path.Base(pkg) + component.GoType[i:], nil
+	}
+	switch s.Type {
+	case "array":
+		item, err := g.goType(*s.Items)
+		return "[]" + item, err
+	case "object":
+		return "map[string]any", nil
+	case "string":
+		return "string", nil
+	case "boolean":
+		return "bool", nil
+	case "number":
+		return "float64", nil
+	case "integer":
+		if s.Format == "int64" {
+			return "int64", nil
+		}
+		return "int", nil
+	}
+	return "", fmt.Errorf("no Go type for schema %+v", s)
+}
+
+// initialisms are written in capitals in Go names
+var initialisms = []string{"id", "url", "api"}
+
+// exported turns an operation or parameter name such as "listJobs" or
+// "min_count" into an exported Go name
+func exported(name string) string {
+	var sb strings.Builder
+	for _, word := range strings.Split(name, "_") {
+		if slices.Contains(initialisms, word) {
+			sb.WriteString(strings.ToUpper(word))
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		sb.WriteString(string(runes))
+	}
+	return sb.String()
+}
+
+// unexported turns a parameter name into a Go argument name
+func unexported(name string) string {
+	runes := []rune(exported(name))
+	if s := string(runes); slices.Contains(initialisms, strings.ToLower(s)) {
+		return strings.ToLower(s)
+	}
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestClientIsUpToDate(t *testing.T) {
+	want, err := generate("../" + specFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("../operations.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("operations.go is not what openapi.json describes: run 'go generate ./pkg/apiclient'")
+	}
+}
@@ -0,0 +1,544 @@
+// Code generated by go run ./gen from openapi.json; DO NOT EDIT.
+
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+// GetStatus calls GET /api: Check that the API is up and the token valid
+func (c *Client) GetStatus(ctx context.Context) (map[string]any, error) {
+	path := "/api"
+	var out map[string]any
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// GetAgentsParams are the optional parameters of GetAgents.
+// Zero fields are left to the server's defaults.
+type GetAgentsParams struct {
+	ID int // Agent ID
+}
+
+func (p GetAgentsParams) values() url.Values {
+	values := url.Values{}
+	if p.ID != 0 {
+		values.Set("id", strconv.Itoa(p.ID))
+	}
+	return values
+}
+
+// GetAgents calls GET /api/agent: List agents, or get one by ID
+func (c *Client) GetAgents(ctx context.Context, params GetAgentsParams) ([]entities.Agent, error) {
+	path := "/api/agent"
+	query := params.values()
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var out oneOrMany[entities.Agent]
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return []entities.Agent(out), err
+}
+
+// UpdateAgent calls PUT /api/agent: Approve, revoke, enable or disable an agent, or grant or withdraw its admin role
+func (c *Client) UpdateAgent(ctx context.Context, id int, body entities.AgentUpdate) (entities.Agent, error) {
+	path := "/api/agent"
+	query := url.Values{}
+	query.Set("id", strconv.Itoa(id))
+	path += "?" + query.Encode()
+	var out entities.Agent
+	err := c.Do(ctx, http.MethodPut, path, body, &out)
+	return out, err
+}
+
+// DeleteAgent calls DELETE /api/agent: Delete an agent
+func (c *Client) DeleteAgent(ctx context.Context, id int) error {
+	path := "/api/agent"
+	query := url.Values{}
+	query.Set("id", strconv.Itoa(id))
+	path += "?" + query.Encode()
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// SendHeartbeat calls POST /api/agent/heartbeat: Record the heartbeat of the calling agent, even when disabled
+func (c *Client) SendHeartbeat(ctx context.Context, body entities.AgentHeartbeat) (entities.Agent, error) {
+	path := "/api/agent/heartbeat"
+	var out entities.Agent
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// RefreshToken calls POST /api/agent/refresh: Exchange a token that has not expired for a new one
+func (c *Client) RefreshToken(ctx context.Context) (entities.AgentToken, error) {
+	path := "/api/agent/refresh"
+	var out entities.AgentToken
+	err := c.Do(ctx, http.MethodPost, path, nil, &out)
+	return out, err
+}
+
+// ListDuplicatesParams are the optional parameters of ListDuplicates.
+// Zero fields are left to the server's defaults.
+type ListDuplicatesParams struct {
+	MinCount int    // Minimum copies per set
+	MinSize  int64  // Minimum file size in bytes
+	Root     int64  // Only files under this root folder
+	Path     string // Only files under this path prefix
+	Sort     string // Order of the sets
+	Limit    int    // Sets per page
+	After    string // Cursor returned as next by the previous page
+}
+
+func (p ListDuplicatesParams) values() url.Values {
+	values := url.Values{}
+	if p.MinCount != 0 {
+		values.Set("min_count", strconv.Itoa(p.MinCount))
+	}
+	if p.MinSize != 0 {
+		values.Set("min_size", strconv.FormatInt(p.MinSize, 10))
+	}
+	if p.Root != 0 {
+		values.Set("root", strconv.FormatInt(p.Root, 10))
+	}
+	if p.Path != "" {
+		values.Set("path", p.Path)
+	}
+	if p.Sort != "" {
+		values.Set("sort", p.Sort)
+	}
+	if p.Limit != 0 {
+		values.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.After != "" {
+		values.Set("after", p.After)
+	}
+	return values
+}
+
+// ListDuplicates calls GET /api/duplicates: One page of duplicate sets
+func (c *Client) ListDuplicates(ctx context.Context, params ListDuplicatesParams) (duplicate.JSONPage, error) {
+	path := "/api/duplicates"
+	query := params.values()
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var out duplicate.JSONPage
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// GetDuplicateSet calls GET /api/duplicates/{hash}: Get one duplicate set
+func (c *Client) GetDuplicateSet(ctx context.Context, hash string) (duplicate.JSONSet, error) {
+	path := fmt.Sprintf("/api/duplicates/%s", url.PathEscape(hash))
+	var out duplicate.JSONSet
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// GetHostParams are the optional parameters of GetHost.
+// Zero fields are left to the server's defaults.
+type GetHostParams struct {
+	Name string // Host name
+}
+
+func (p GetHostParams) values() url.Values {
+	values := url.Values{}
+	if p.Name != "" {
+		values.Set("name", p.Name)
+	}
+	return values
+}
+
+// GetHost calls GET /api/host: List hosts, or get one by name
+func (c *Client) GetHost(ctx context.Context, params GetHostParams) ([]entities.Host, error) {
+	path := "/api/host"
+	query := params.values()
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var out oneOrMany[entities.Host]
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return []entities.Host(out), err
+}
+
+// CreateHost calls POST /api/host: Create a host
+func (c *Client) CreateHost(ctx context.Context, body entities.Host) (entities.Host, error) {
+	path := "/api/host"
+	var out entities.Host
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// UpdateHost calls PUT /api/host: Replace a host
+func (c *Client) UpdateHost(ctx context.Context, name string, body entities.Host) (entities.Host, error) {
+	path := "/api/host"
+	query := url.Values{}
+	query.Set("name", name)
+	path += "?" + query.Encode()
+	var out entities.Host
+	err := c.Do(ctx, http.MethodPut, path, body, &out)
+	return out, err
+}
+
+// DeleteHost calls DELETE /api/host: Delete a host
+func (c *Client) DeleteHost(ctx context.Context, name string) error {
+	path := "/api/host"
+	query := url.Values{}
+	query.Set("name", name)
+	path += "?" + query.Encode()
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// StartIngest calls POST /api/ingest: Open a scan of a root folder of the agent's host
+func (c *Client) StartIngest(ctx context.Context, body entities.IngestStart) (entities.IngestRoot, error) {
+	path := "/api/ingest"
+	var out entities.IngestRoot
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// CompleteIngest calls POST /api/ingest/{id}/complete: Close a scan, mark entries it did not see removed and refresh the root's statistics
+func (c *Client) CompleteIngest(ctx context.Context, id int64, body entities.IngestComplete) (entities.IngestStats, error) {
+	path := fmt.Sprintf("/api/ingest/%d/complete", id)
+	var out entities.IngestStats
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// IngestFiles calls POST /api/ingest/{id}/files: Push files of pushed folders
+func (c *Client) IngestFiles(ctx context.Context, id int64, body entities.IngestBatch) ([]entities.IngestRecord, error) {
+	path := fmt.Sprintf("/api/ingest/%d/files", id)
+	var out []entities.IngestRecord
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// IngestFolders calls POST /api/ingest/{id}/folders: Push folders, parents first
+func (c *Client) IngestFolders(ctx context.Context, id int64, body entities.IngestBatch) ([]entities.IngestRecord, error) {
+	path := fmt.Sprintf("/api/ingest/%d/folders", id)
+	var out []entities.IngestRecord
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// ListJobsParams are the optional parameters of ListJobs.
+// Zero fields are left to the server's defaults.
+type ListJobsParams struct {
+	Status string // Only jobs with this status
+}
+
+func (p ListJobsParams) values() url.Values {
+	values := url.Values{}
+	if p.Status != "" {
+		values.Set("status", p.Status)
+	}
+	return values
+}
+
+// ListJobs calls GET /api/jobs: List scan jobs, oldest first
+func (c *Client) ListJobs(ctx context.Context, params ListJobsParams) ([]entities.ScanJob, error) {
+	path := "/api/jobs"
+	query := params.values()
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var out []entities.ScanJob
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// QueueJob calls POST /api/jobs: Queue a scan job
+func (c *Client) QueueJob(ctx context.Context, body entities.ScanJobRequest) (entities.ScanJob, error) {
+	path := "/api/jobs"
+	var out entities.ScanJob
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// LeaseJob calls POST /api/jobs/lease: Lease the next job of the agent's host
+func (c *Client) LeaseJob(ctx context.Context, body entities.ScanJobLease) (*entities.ScanJob, error) {
+	path := "/api/jobs/lease"
+	var out *entities.ScanJob
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// GetJob calls GET /api/jobs/{id}: Get a scan job
+func (c *Client) GetJob(ctx context.Context, id int64) (entities.ScanJob, error) {
+	path := fmt.Sprintf("/api/jobs/%d", id)
+	var out entities.ScanJob
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// DeleteJob calls DELETE /api/jobs/{id}: Delete a scan job no agent holds
+func (c *Client) DeleteJob(ctx context.Context, id int64) error {
+	path := fmt.Sprintf("/api/jobs/%d", id)
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// CompleteJob calls POST /api/jobs/{id}/complete: Mark a leased job done
+func (c *Client) CompleteJob(ctx context.Context, id int64, body entities.ScanJobReport) error {
+	path := fmt.Sprintf("/api/jobs/%d/complete", id)
+	return c.Do(ctx, http.MethodPost, path, body, nil)
+}
+
+// FailJob calls POST /api/jobs/{id}/fail: Release a leased job with an error
+func (c *Client) FailJob(ctx context.Context, id int64, body entities.ScanJobReport) error {
+	path := fmt.Sprintf("/api/jobs/%d/fail", id)
+	return c.Do(ctx, http.MethodPost, path, body, nil)
+}
+
+// ReportJobProgress calls POST /api/jobs/{id}/progress: Report progress on a leased job, extending the lease
+func (c *Client) ReportJobProgress(ctx context.Context, id int64, body entities.ScanJobReport) error {
+	path := fmt.Sprintf("/api/jobs/%d/progress", id)
+	return c.Do(ctx, http.MethodPost, path, body, nil)
+}
+
+// GetOwnerParams are the optional parameters of GetOwner.
+// Zero fields are left to the server's defaults.
+type GetOwnerParams struct {
+	Name string // Owner name
+}
+
+func (p GetOwnerParams) values() url.Values {
+	values := url.Values{}
+	if p.Name != "" {
+		values.Set("name", p.Name)
+	}
+	return values
+}
+
+// GetOwner calls GET /api/owner: List owners, or get one by name
+func (c *Client) GetOwner(ctx context.Context, params GetOwnerParams) ([]entities.Owner, error) {
+	path := "/api/owner"
+	query := params.values()
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var out oneOrMany[entities.Owner]
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return []entities.Owner(out), err
+}
+
+// CreateOwner calls POST /api/owner: Create a owner
+func (c *Client) CreateOwner(ctx context.Context, body entities.Owner) (entities.Owner, error) {
+	path := "/api/owner"
+	var out entities.Owner
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// UpdateOwner calls PUT /api/owner: Replace a owner
+func (c *Client) UpdateOwner(ctx context.Context, name string, body entities.Owner) (entities.Owner, error) {
+	path := "/api/owner"
+	query := url.Values{}
+	query.Set("name", name)
+	path += "?" + query.Encode()
+	var out entities.Owner
+	err := c.Do(ctx, http.MethodPut, path, body, &out)
+	return out, err
+}
+
+// DeleteOwner calls DELETE /api/owner: Delete a owner
+func (c *Client) DeleteOwner(ctx context.Context, name string) error {
+	path := "/api/owner"
+	query := url.Values{}
+	query.Set("name", name)
+	path += "?" + query.Encode()
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// GetPolicyParams are the optional parameters of GetPolicy.
+// Zero fields are left to the server's defaults.
+type GetPolicyParams struct {
+	Name string // Policy name
+}
+
+func (p GetPolicyParams) values() url.Values {
+	values := url.Values{}
+	if p.Name != "" {
+		values.Set("name", p.Name)
+	}
+	return values
+}
+
+// GetPolicy calls GET /api/policy: List policies, or get one by name
+func (c *Client) GetPolicy(ctx context.Context, params GetPolicyParams) ([]entities.Policy, error) {
+	path := "/api/policy"
+	query := params.values()
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var out oneOrMany[entities.Policy]
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return []entities.Policy(out), err
+}
+
+// CreatePolicy calls POST /api/policy: Create a policy
+func (c *Client) CreatePolicy(ctx context.Context, body entities.Policy) (entities.Policy, error) {
+	path := "/api/policy"
+	var out entities.Policy
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// UpdatePolicy calls PUT /api/policy: Replace a policy
+func (c *Client) UpdatePolicy(ctx context.Context, name string, body entities.Policy) (entities.Policy, error) {
+	path := "/api/policy"
+	query := url.Values{}
+	query.Set("name", name)
+	path += "?" + query.Encode()
+	var out entities.Policy
+	err := c.Do(ctx, http.MethodPut, path, body, &out)
+	return out, err
+}
+
+// DeletePolicy calls DELETE /api/policy: Delete a policy
+func (c *Client) DeletePolicy(ctx context.Context, name string) error {
+	path := "/api/policy"
+	query := url.Values{}
+	query.Set("name", name)
+	path += "?" + query.Encode()
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// GetPurposeParams are the optional parameters of GetPurpose.
+// Zero fields are left to the server's defaults.
+type GetPurposeParams struct {
+	Name string // Purpose name
+}
+
+func (p GetPurposeParams) values() url.Values {
+	values := url.Values{}
+	if p.Name != "" {
+		values.Set("name", p.Name)
+	}
+	return values
+}
+
+// GetPurpose calls GET /api/purpose: List purposes, or get one by name
+func (c *Client) GetPurpose(ctx context.Context, params GetPurposeParams) ([]entities.Purpose, error) {
+	path := "/api/purpose"
+	query := params.values()
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var out oneOrMany[entities.Purpose]
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return []entities.Purpose(out), err
+}
+
+// CreatePurpose calls POST /api/purpose: Create a purpose
+func (c *Client) CreatePurpose(ctx context.Context, body entities.Purpose) (entities.Purpose, error) {
+	path := "/api/purpose"
+	var out entities.Purpose
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// UpdatePurpose calls PUT /api/purpose: Replace a purpose
+func (c *Client) UpdatePurpose(ctx context.Context, name string, body entities.Purpose) (entities.Purpose, error) {
+	path := "/api/purpose"
+	query := url.Values{}
+	query.Set("name", name)
+	path += "?" + query.Encode()
+	var out entities.Purpose
+	err := c.Do(ctx, http.MethodPut, path, body, &out)
+	return out, err
+}
+
+// DeletePurpose calls DELETE /api/purpose: Delete a purpose
+func (c *Client) DeletePurpose(ctx context.Context, name string) error {
+	path := "/api/purpose"
+	query := url.Values{}
+	query.Set("name", name)
+	path += "?" + query.Encode()
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// ListRootsParams are the optional parameters of ListRoots.
+// Zero fields are left to the server's defaults.
+type ListRootsParams struct {
+	Host string // Only the roots of this host
+}
+
+func (p ListRootsParams) values() url.Values {
+	values := url.Values{}
+	if p.Host != "" {
+		values.Set("host", p.Host)
+	}
+	return values
+}
+
+// ListRoots calls GET /api/root: List root folders
+func (c *Client) ListRoots(ctx context.Context, params ListRootsParams) ([]entities.RootFolderInfo, error) {
+	path := "/api/root"
+	query := params.values()
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var out []entities.RootFolderInfo
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// CreateRoot calls POST /api/root: Register a root folder
+func (c *Client) CreateRoot(ctx context.Context, body entities.RootFolderRequest) (entities.RootFolderInfo, error) {
+	path := "/api/root"
+	var out entities.RootFolderInfo
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// GetRoot calls GET /api/root/{id}: Get a root folder
+func (c *Client) GetRoot(ctx context.Context, id int64) (entities.RootFolderInfo, error) {
+	path := fmt.Sprintf("/api/root/%d", id)
+	var out entities.RootFolderInfo
+	err := c.Do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// UpdateRoot calls PUT /api/root/{id}: Change the settings of a root folder
+func (c *Client) UpdateRoot(ctx context.Context, id int64, body entities.RootFolderRequest) (entities.RootFolderInfo, error) {
+	path := fmt.Sprintf("/api/root/%d", id)
+	var out entities.RootFolderInfo
+	err := c.Do(ctx, http.MethodPut, path, body, &out)
+	return out, err
+}
+
+// DeleteRoot calls DELETE /api/root/{id}: Delete a root folder with all its scan data
+func (c *Client) DeleteRoot(ctx context.Context, id int64) error {
+	path := fmt.Sprintf("/api/root/%d", id)
+	return c.Do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// PurgeRoot calls POST /api/root/{id}/purge: Delete the records of removed files or folders, or count them
+func (c *Client) PurgeRoot(ctx context.Context, id int64, body entities.PurgeRequest) (entities.PurgeResult, error) {
+	path := fmt.Sprintf("/api/root/%d/purge", id)
+	var out entities.PurgeResult
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
+
+// RefreshRoot calls POST /api/root/{id}/refresh: Recount the statistics of a root folder from its catalog
+func (c *Client) RefreshRoot(ctx context.Context, id int64) (entities.RootFolderInfo, error) {
+	path := fmt.Sprintf("/api/root/%d/refresh", id)
+	var out entities.RootFolderInfo
+	err := c.Do(ctx, http.MethodPost, path, nil, &out)
+	return out, err
+}
+
+// VerifyRoot calls POST /api/root/{id}/verify: Check the consistency of a root folder's catalog
+func (c *Client) VerifyRoot(ctx context.Context, id int64, body entities.VerifyRequest) (entities.VerifyResult, error) {
+	path := fmt.Sprintf("/api/root/%d/verify", id)
+	var out entities.VerifyResult
+	err := c.Do(ctx, http.MethodPost, path, body, &out)
+	return out, err
+}
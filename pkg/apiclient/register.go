@@ -1,56 +1,82 @@
 package apiclient
 
 import (
-	"io/ioutil"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/tlsutil"
 	"github.com/spf13/viper"
 )
 
-func saveToken(token string) {
-	viper.Set("client.token", token)
-	viper.SetConfigType("yaml")
-	viper.SetConfigName(".dupectl.yaml")
-	viper.WriteConfigAs(".dupectl.yaml")
-}
+// RegisterClient asks the server to register this machine as an agent,
+// presenting the shared API key, and saves the agent's credential to the
+// credentials file. Over TLS it also asks for a client certificate. The
+// credential is usable once an admin approves the registration.
+func RegisterClient() (entities.AgentRegistration, error) {
+	var registration entities.AgentRegistration
 
-func RegisterClient() error {
 	// get keys
-	host := viper.GetString("client.apihost")
-	port := viper.GetString("client.apiport")
 	key := viper.GetString("client.apikey")
 	clientid := viper.GetString("client.clientid")
 	uniqueid := viper.GetString("client.uniqueid")
-	protocol := "http://"
-	url := protocol + host + ":" + port + "/api/agent/register"
+	baseURL, client, err := newHTTPClient(Credentials{})
+	if err != nil {
+		return registration, err
+	}
 
 	// form request
-	client := &http.Client{
-		Transport: &http.Transport{},
+	var request entities.AgentRegistrationRequest
+	var privateKey []byte
+	if TLSEnabled() {
+		var csr []byte
+		if csr, privateKey, err = tlsutil.NewAgentCSR(); err != nil {
+			return registration, err
+		}
+		request.CSR = string(csr)
 	}
-	req, err := http.NewRequest("GET", url, nil)
+	body, err := json.Marshal(request)
 	if err != nil {
-		return err
+		return registration, err
+	}
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/api/agent/register", bytes.NewReader(body))
+	if err != nil {
+		return registration, err
 	}
 	req.Header.Add("Key", key)
 	req.Header.Add("Uniqueid", uniqueid)
 	req.Header.Add("Clientid", clientid)
+	req.Header.Set("Content-Type", "application/json")
 
 	// make request
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return registration, err
 	}
 	defer resp.Body.Close()
 
 	// Process Response
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-
+	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return registration, err
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return registration, responseError(resp.StatusCode, bodyBytes)
+	}
+	if err := json.Unmarshal(bodyBytes, &registration); err != nil {
+		return registration, fmt.Errorf("invalid registration response: %w", err)
+	}
+
+	// save credential, dropping the token of any previous registration
+	creds := Credentials{Credential: registration.Credential}
+	if registration.Certificate != "" {
+		creds.Certificate, creds.PrivateKey = registration.Certificate, string(privateKey)
+	}
+	if err := SaveCredentials(creds); err != nil {
+		return registration, fmt.Errorf("failed to save credential: %w", err)
 	}
-	// save token
-	bodyString := string(bodyBytes)
-	saveToken(bodyString)
-	return nil
+	return registration, nil
 }
@@ -2,12 +2,20 @@ package auth
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,10 +23,92 @@ import (
 	"github.com/spf13/viper"
 )
 
-func getSecret() []byte {
-	data := viper.GetString("server.serverid") + viper.GetString("server.apikey")
-	SECRET := []byte(data)
-	return SECRET
+// SecretFileName is the name of the file holding the key tokens are
+// signed with, kept next to the configuration file unless server.jwt_secret
+// names another path
+const SecretFileName = ".dupectl-jwt-secret"
+
+var (
+	secretMu sync.RWMutex
+	secret   []byte
+)
+
+// SecretPath returns where the token signing key is stored
+func SecretPath() (string, error) {
+	if path := viper.GetString("server.jwt_secret"); path != "" {
+		return path, nil
+	}
+	if config := viper.ConfigFileUsed(); config != "" {
+		return filepath.Join(filepath.Dir(config), SecretFileName), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, SecretFileName), nil
+}
+
+// LoadSecret reads the key tokens are signed with, generating it on first
+// use. The key is random and known to the server only: unlike the API key,
+// agents never hold it, so they cannot forge tokens.
+func LoadSecret() error {
+	path, err := SecretPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = createSecret(path)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot load token signing key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) < 32 {
+		return fmt.Errorf("invalid token signing key in %s", path)
+	}
+
+	secretMu.Lock()
+	secret = key
+	secretMu.Unlock()
+	return nil
+}
+
+// createSecret writes a new random key readable by its owner only, unless
+// another server process created one first
+func createSecret(path string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	data := []byte(hex.EncodeToString(key) + "\n")
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, fs.ErrExist) {
+		return os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return data, nil
+}
+
+func getSecret() ([]byte, error) {
+	secretMu.RLock()
+	defer secretMu.RUnlock()
+	if secret == nil {
+		return nil, fmt.Errorf("token signing key not loaded")
+	}
+	return secret, nil
 }
 
 func getApiKey() string {
@@ -87,106 +177,146 @@ func GenerateAPISeed() string {
 	return uuid
 }
 
-func CreateJWT(h http.Header) (string, error) {
+// TokenLifetime is how long tokens issued to agents are valid
+const TokenLifetime = time.Hour
+
+// Roles carried by tokens
+const (
+	RoleAgent = "agent" // Pushes scans and works on the jobs it leases
+	RoleAdmin = "admin" // Also manages the server
+)
+
+// CreateJWT issues a token with the given role to the approved agent
+// agentID of the machine clientID, returning the token and when it expires
+func CreateJWT(clientID, uniqueID string, agentID int, role string) (string, time.Time, error) {
+	expires := time.Now().Add(TokenLifetime)
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
-	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["exp"] = expires.Unix()
+	claims["Clientid"] = clientID
+	claims["Uniqueid"] = uniqueID
+	claims["Agentid"] = agentID
+	claims["Role"] = role
 
-	if h["Clientid"] != nil {
-		claims["Clientid"] = h["Clientid"][0]
-	}
-
-	if h["Uniqueid"] != nil {
-		claims["Uniqueid"] = h["Uniqueid"][0]
+	key, err := getSecret()
+	if err != nil {
+		return "", time.Time{}, err
 	}
-
-	tokenstr, err := token.SignedString(getSecret())
+	tokenstr, err := token.SignedString(key)
 	if err != nil {
-		fmt.Println(err.Error())
-		return "", err
-
+		return "", time.Time{}, err
 	}
-	return tokenstr, nil
+	return tokenstr, expires, nil
 }
 
-func GetJWT(w http.ResponseWriter, r *http.Request) {
-	if r.Header["Key"] != nil {
-		if r.Header["Key"][0] == getApiKey() {
-			token, err := CreateJWT(r.Header)
-			if err != nil {
+// RequireKey lets through requests presenting the shared API key. The key
+// only allows machines to ask for registration; tokens are issued per agent.
+func RequireKey(next func(w http.ResponseWriter, r *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Key")
+		if key == "" {
+			writeUnauthorized(w, "not authorized: no key")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(getApiKey())) != 1 {
+			writeUnauthorized(w, "not authorized: invalid key")
+			return
+		}
+		next(w, r)
+	})
+}
 
+// ValidateJWT lets through requests carrying a valid token issued to an
+// agent
+func ValidateJWT(next func(w http.ResponseWriter, r *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Token") == "" {
+			writeUnauthorized(w, "not authorized: no token")
+			return
+		}
+		claims, err := requestClaims(r)
+		if err != nil {
+			writeUnauthorized(w, "not authorized: "+err.Error())
+			return
+		}
+		for _, name := range []string{"Clientid", "Uniqueid", "Agentid"} {
+			if claims[name] == nil {
+				writeUnauthorized(w, "not authorized: token carries no "+name+" claim")
 				return
-			} else {
-				fmt.Fprint(w, token)
 			}
-
-		} else {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("Not Authorized - Invalid key"))
 		}
-	} else {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("Not Authorized - No key"))
-	}
+		next(w, r)
+	})
 }
 
-func RegisterJWT(next func(w http.ResponseWriter, r *http.Request)) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header["Key"] != nil {
-			if r.Header["Key"][0] == getApiKey() {
-				token, err := CreateJWT(r.Header)
-				if err != nil {
-					return
-				} else {
-					fmt.Fprint(w, token)
-					next(w, r)
-				}
+// writeUnauthorized answers 401 with the JSON error body of the API
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	response, _ := json.Marshal(map[string]string{"error": message})
+	w.Header().Set("content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write(response)
+}
 
-			} else {
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte("Not Authorized - Invalid key"))
-			}
-		} else {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("Not Authorized - No key"))
-		}
+// ClientID returns the machine ID carried by the token of a request that
+// ValidateJWT has let through
+func ClientID(r *http.Request) (string, error) {
+	return claim(r, "Clientid")
+}
 
-	})
+// UniqueID returns the unique ID of the agent installation carried by the
+// token of a request that ValidateJWT has let through
+func UniqueID(r *http.Request) (string, error) {
+	return claim(r, "Uniqueid")
 }
 
-func ValidateJWT(next func(w http.ResponseWriter, r *http.Request)) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header["Token"] != nil {
-			token, err := jwt.Parse(r.Header["Token"][0], func(t *jwt.Token) (interface{}, error) {
-				_, ok := t.Method.(*jwt.SigningMethodHMAC)
-				if !ok {
-					w.WriteHeader(http.StatusUnauthorized)
-					w.Write([]byte(" Not Authorized "))
-				}
-				return getSecret(), nil
-			})
+// AgentID returns the ID of the agent the token of a request that
+// ValidateJWT has let through was issued to
+func AgentID(r *http.Request) (int, error) {
+	claims, err := requestClaims(r)
+	if err != nil {
+		return 0, err
+	}
+	id, ok := claims["Agentid"].(float64) // JSON numbers decode as float64
+	if !ok || id <= 0 {
+		return 0, fmt.Errorf("token carries no Agentid claim")
+	}
+	return int(id), nil
+}
 
-			if err != nil {
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte(" Not Authorized " + err.Error()))
-			}
-			if token.Valid {
-				if token.Claims.(jwt.MapClaims)["Clientid"] == nil {
-					w.WriteHeader(http.StatusUnauthorized)
-					w.Write([]byte(" Clientid Missing "))
-					return
-				}
-				if token.Claims.(jwt.MapClaims)["Uniqueid"] == nil {
-					w.WriteHeader(http.StatusUnauthorized)
-					w.Write([]byte(" Uniqueid Missing "))
-					return
-				}
-				next(w, r)
-			}
-		} else {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(" Not Authorized "))
-		}
+// Role returns the role carried by the token of a request that ValidateJWT
+// has let through. Tokens issued before roles existed are agent tokens.
+func Role(r *http.Request) (string, error) {
+	claims, err := requestClaims(r)
+	if err != nil {
+		return "", err
+	}
+	if role, ok := claims["Role"].(string); ok {
+		return role, nil
+	}
+	return RoleAgent, nil
+}
+
+func claim(r *http.Request, name string) (string, error) {
+	claims, err := requestClaims(r)
+	if err != nil {
+		return "", err
+	}
+	value, ok := claims[name].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("token carries no %s claim", name)
+	}
+	return value, nil
+}
 
+func requestClaims(r *http.Request) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(r.Header.Get("Token"), func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return getSecret()
 	})
+	if err != nil {
+		return nil, err
+	}
+	return token.Claims.(jwt.MapClaims), nil
 }
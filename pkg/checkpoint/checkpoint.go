@@ -8,7 +8,8 @@ import (
 	"github.com/jpconstantineau/dupectl/pkg/logger"
 )
 
-// Manager handles scan checkpoint operations
+// Manager handles scan checkpoint operations. A nil Manager keeps no
+// checkpoints, as for scans pushed to a server.
 type Manager struct {
 	db           *sql.DB
 	rootFolderID int64
@@ -27,6 +28,9 @@ func NewManager(db *sql.DB, rootFolderID int64, scanMode string) *Manager {
 
 // Start creates a new scan checkpoint
 func (m *Manager) Start() error {
+	if m == nil {
+		return nil
+	}
 	now := time.Now().Unix()
 	state := &datastore.ScanState{
 		RootFolderID: m.rootFolderID,
@@ -48,7 +52,7 @@ func (m *Manager) Start() error {
 
 // Save updates checkpoint with current progress
 func (m *Manager) Save(currentFolder, lastFile *string) error {
-	if m.stateID == nil {
+	if m == nil || m.stateID == nil {
 		return nil // No checkpoint active
 	}
 
@@ -72,7 +76,7 @@ func (m *Manager) Save(currentFolder, lastFile *string) error {
 
 // Complete marks the scan as completed
 func (m *Manager) Complete() error {
-	if m.stateID == nil {
+	if m == nil || m.stateID == nil {
 		return nil
 	}
 
@@ -88,6 +92,9 @@ func (m *Manager) Complete() error {
 
 // Resume retrieves existing checkpoint
 func (m *Manager) Resume() (*datastore.ScanState, error) {
+	if m == nil {
+		return nil, nil
+	}
 	state, err := datastore.GetActiveScanState(m.db, m.rootFolderID)
 	if err == sql.ErrNoRows {
 		return nil, nil // No active checkpoint
@@ -103,6 +110,9 @@ func (m *Manager) Resume() (*datastore.ScanState, error) {
 
 // Clear removes checkpoint (for restart)
 func (m *Manager) Clear() error {
+	if m == nil {
+		return nil
+	}
 	if m.stateID != nil {
 		err := datastore.DeleteScanState(m.db, *m.stateID)
 		if err != nil {
@@ -0,0 +1,208 @@
+package coverage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+// Unassigned names the group of files without an owner or purpose
+const Unassigned = "(none)"
+
+// Options selects the copies each file requires
+type Options struct {
+	// MinCopies is required of every file, on top of the minimum of its
+	// retention policy; 0 checks the policies only
+	MinCopies int
+}
+
+// File is a file whose content exists in fewer places than required
+type File struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Root     string `json:"root"`
+	Owner    string `json:"owner,omitempty"`
+	Purpose  string `json:"purpose,omitempty"`
+	Policy   string `json:"policy,omitempty"`
+	Required int    `json:"required"`
+	Copies   int    `json:"copies"` // Distinct hosts and devices holding the content
+	Paths    int    `json:"paths"`  // Catalogued paths holding the content
+}
+
+// Total sums the under-covered files of one owner, purpose or root
+type Total struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Report lists the files lacking copies, with totals per group
+type Report struct {
+	Checked   int     `json:"checked"`  // Files that require more than one copy
+	Unhashed  int     `json:"unhashed"` // Checked files not hashed yet, so not compared
+	Files     []File  `json:"files"`
+	ByOwner   []Total `json:"by_owner"`
+	ByPurpose []Total `json:"by_purpose"`
+	ByRoot    []Total `json:"by_root"`
+}
+
+// Analyzer finds files with fewer copies than their policies require
+type Analyzer struct {
+	db *sql.DB
+}
+
+// NewAnalyzer creates a coverage analyzer
+func NewAnalyzer(db *sql.DB) *Analyzer {
+	return &Analyzer{db: db}
+}
+
+// copyCount is the number of places holding one content
+type copyCount struct {
+	locations int
+	paths     int
+}
+
+// Analyze checks every synced file of the catalog. Copies are counted by
+// distinct host and device, so two copies on one disk count once.
+func (a *Analyzer) Analyze(opts Options) (*Report, error) {
+	resolver, err := datastore.NewMetadataResolver(a.db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := a.db.Query(`
+	SELECT f.id, f.path, f.size, f.mtime, f.hash_value, f.folder_id, f.root_folder_id, rf.path
+	FROM files f
+	JOIN root_folders rf ON f.root_folder_id = rf.id
+	WHERE f.removed = 0 AND f.error_status IS NULL AND f.status = ?
+	ORDER BY f.path
+	`, entities.StatusSynced)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &Report{Files: []File{}}
+	counts := make(map[string]copyCount)
+	owners := make(map[string]*Total)
+	purposes := make(map[string]*Total)
+	roots := make(map[string]*Total)
+	now := time.Now()
+
+	for rows.Next() {
+		file := &datastore.File{}
+		if err := rows.Scan(&file.ID, &file.Path, &file.Size, &file.Mtime, &file.HashValue,
+			&file.FolderID, &file.RootFolderID, &file.RootFolderPath); err != nil {
+			return nil, err
+		}
+
+		metadata, err := resolver.ForFile(file)
+		if err != nil {
+			return nil, err
+		}
+		required := opts.MinCopies
+		if p := metadata.Policy; p != nil && !p.Expired(file.Mtime, now) && p.MinCopies > required {
+			required = p.MinCopies
+		}
+		if required < 2 {
+			continue
+		}
+		report.Checked++
+		if file.HashValue == nil {
+			report.Unhashed++
+			continue
+		}
+
+		key := fmt.Sprintf("%s:%d", *file.HashValue, file.Size)
+		count, ok := counts[key]
+		if !ok {
+			count, err = a.countCopies(*file.HashValue, file.Size)
+			if err != nil {
+				return nil, err
+			}
+			counts[key] = count
+		}
+		if count.locations >= required {
+			continue
+		}
+
+		entry := File{
+			Path:     file.Path,
+			Size:     file.Size,
+			Root:     file.RootFolderPath,
+			Required: required,
+			Copies:   count.locations,
+			Paths:    count.paths,
+		}
+		if metadata.Owner != nil {
+			entry.Owner = metadata.Owner.Name
+		}
+		if metadata.Purpose != nil {
+			entry.Purpose = metadata.Purpose.Name
+		}
+		if metadata.Policy != nil {
+			entry.Policy = metadata.Policy.Name
+		}
+		report.Files = append(report.Files, entry)
+
+		add(owners, entry.Owner, entry.Size)
+		add(purposes, entry.Purpose, entry.Size)
+		add(roots, entry.Root, entry.Size)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report.ByOwner = sorted(owners)
+	report.ByPurpose = sorted(purposes)
+	report.ByRoot = sorted(roots)
+	return report, nil
+}
+
+// countCopies counts the distinct locations of a content. Roots whose
+// device is unknown count as a device of their own.
+func (a *Analyzer) countCopies(hash string, size int64) (copyCount, error) {
+	var count copyCount
+	err := a.db.QueryRow(`
+	SELECT COUNT(DISTINCT rf.host_id || ':' ||
+	                      CASE WHEN rf.device = '' THEN 'root-' || rf.id ELSE rf.device END),
+	       COUNT(*)
+	FROM files f
+	JOIN root_folders rf ON f.root_folder_id = rf.id
+	WHERE f.hash_value = ? AND f.size = ?
+	  AND f.removed = 0 AND f.error_status IS NULL AND f.status = ?
+	`, hash, size, entities.StatusSynced).Scan(&count.locations, &count.paths)
+	return count, err
+}
+
+func add(totals map[string]*Total, name string, size int64) {
+	if name == "" {
+		name = Unassigned
+	}
+	total, ok := totals[name]
+	if !ok {
+		total = &Total{Name: name}
+		totals[name] = total
+	}
+	total.Files++
+	total.Bytes += size
+}
+
+// sorted orders totals by bytes, largest first
+func sorted(totals map[string]*Total) []Total {
+	list := make([]Total, 0, len(totals))
+	for _, total := range totals {
+		list = append(list, *total)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Bytes != list[j].Bytes {
+			return list[i].Bytes > list[j].Bytes
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
@@ -1,10 +1,16 @@
 package datastore
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jpconstantineau/dupectl/pkg/auth"
 	"github.com/jpconstantineau/dupectl/pkg/entities"
 	"github.com/spf13/viper"
 
@@ -35,125 +41,254 @@ func initAgentTable() error {
 	return nil
 }
 
-func PostAgent(data entities.Agent) (entities.Agent, error) {
-	db, err := startDb()
+// PostAgent records the registration of an agent, or updates the agent
+// registered before with the same name and unique ID. Registering again
+// keeps the agent enabled or disabled.
+func PostAgent(q Querier, data entities.Agent) (entities.Agent, error) {
+	updated := time.Now().Unix()
+	hostID := sql.NullInt64{Int64: int64(data.HostID), Valid: data.HostID != 0}
+
+	result, err := q.Exec(`UPDATE agents SET updated = ?, status = ?, host_id = ? WHERE name = ? AND guid = ?`,
+		updated, data.Status, hostID, data.Name, data.Guid)
 	if err != nil {
 		return entities.Agent{}, err
 	}
-	defer db.Close()
-
-	name := data.Name
-	guid := data.Guid
-	enabled := data.Enabled
-	updated := time.Now().Unix()
-	status := data.Status
-	found := false
-
-	// check if Agent Already exists
-	selDB, err := db.Query("SELECT id, name, guid FROM agents WHERE name=? AND guid =?", name, guid)
+	n, err := result.RowsAffected()
 	if err != nil {
 		return entities.Agent{}, err
 	}
-
-	for selDB.Next() {
-		var qid int
-		var qname, qguid string
-		err = selDB.Scan(&qid, &qname, &qguid)
-		if err != nil {
+	if n == 0 {
+		if _, err := q.Exec(`INSERT INTO agents(name, guid, enabled, updated, status, host_id) VALUES(?,?,?,?,?,?)`,
+			data.Name, data.Guid, data.Enabled, updated, data.Status, hostID); err != nil {
 			return entities.Agent{}, err
 		}
-		//fmt.Println("FOUND: Agent: " + qname + " | guid: " + qguid)
-		found = true
-	}
-	selDB.Close()
-	if found { // update if it does exist
-		upForm, err := db.Prepare("UPDATE agents SET enabled=?, updated=?, status=? WHERE name=? AND guid=?")
-		if err != nil {
-			return entities.Agent{}, err
-		}
-		upForm.Exec(enabled, updated, status, name, guid)
-		//fmt.Println("UPDATE: Agent: " + name + " | guid: " + guid)
-		upForm.Close()
-	} else { // insert if it doesn't exist
-		insForm, err := db.Prepare("INSERT INTO agents(name, guid, enabled, updated, status ) VALUES(?,?,?,?,?)")
-		if err != nil {
-			return entities.Agent{}, err
-		}
-		insForm.Exec(name, guid, enabled, updated, status)
-		//fmt.Println("INSERT: Agent: " + name + " | guid: " + guid)
-		insForm.Close()
 	}
+	return FindAgent(q, data.Name, data.Guid)
+}
 
-	resDB, err := db.Query("SELECT id, name, guid, enabled, updated, status FROM agents WHERE name=? AND guid =?", name, guid)
+func GetAgent() ([]entities.Agent, error) {
+	db, err := startDb()
 	if err != nil {
-		return entities.Agent{}, err
+		return []entities.Agent{}, err
 	}
+	defer db.Close()
 
-	var response entities.Agent
-	for resDB.Next() {
-		var qid int
-		var qname, qguid string
-		var qenabled bool
-		var updatedstr string
-		var qstatus entities.StatusName
+	return GetAgents(db)
+}
 
-		err = resDB.Scan(&qid, &qname, &qguid, &qenabled, &updatedstr, &qstatus)
-		if err != nil {
-			return entities.Agent{}, err
-		}
+// agentColumns is the column list scanned by scanAgent
+const agentColumns = `id, name, guid, COALESCE(enabled, 0), approval, COALESCE(updated, 0),
+	COALESCE(status, 0), COALESCE(host_id, 0), COALESCE(version, ''), COALESCE(hostname, ''),
+	COALESCE(platform, ''), COALESCE(activity, ''), admin`
 
-		i, err := strconv.ParseInt(updatedstr, 10, 64)
+func scanAgent(row rowScanner) (entities.Agent, error) {
+	var a entities.Agent
+	var updated int64
+	err := row.Scan(&a.Id, &a.Name, &a.Guid, &a.Enabled, &a.Approval, &updated,
+		&a.Status, &a.HostID, &a.Version, &a.Hostname, &a.Platform, &a.Activity, &a.Admin)
+	a.Updated = time.Unix(updated, 0)
+	return a, err
+}
+
+// GetAgents lists all registered agents, newest first
+func GetAgents(db *sql.DB) ([]entities.Agent, error) {
+	rows, err := db.Query(`SELECT ` + agentColumns + ` FROM agents ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	agents := []entities.Agent{}
+	for rows.Next() {
+		a, err := scanAgent(rows)
 		if err != nil {
-			return entities.Agent{}, err
+			return nil, err
 		}
-		updatedT := time.Unix(i, 0)
+		agents = append(agents, a)
+	}
+	return agents, rows.Err()
+}
 
-		response = entities.Agent{Id: qid, Name: qname, Guid: qguid, Enabled: qenabled, Updated: updatedT, Status: qstatus}
+// GetAgentByID retrieves an agent by ID
+func GetAgentByID(db *sql.DB, id int) (entities.Agent, error) {
+	return scanAgent(db.QueryRow(`SELECT `+agentColumns+` FROM agents WHERE id = ?`, id))
+}
+
+// FindAgent retrieves the agent registered under a machine name and unique ID
+func FindAgent(q Querier, name, guid string) (entities.Agent, error) {
+	return scanAgent(q.QueryRow(`SELECT `+agentColumns+` FROM agents WHERE name = ? AND guid = ?`, name, guid))
+}
 
+// SetAgentEnabled enables or disables an agent. A disabled agent is given
+// no more scan jobs and loses the ones it holds.
+func SetAgentEnabled(db *sql.DB, id int, enabled bool) error {
+	result, err := db.Exec(`UPDATE agents SET enabled = ? WHERE id = ?`, enabled, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
 	}
-	resDB.Close()
+	if !enabled {
+		return releaseAgentScanJobs(db, id)
+	}
+	return nil
+}
 
-	return response, nil
+// SetAgentAdmin grants or withdraws the admin role of an agent. Only
+// approved agents may be granted it.
+func SetAgentAdmin(db *sql.DB, id int, admin bool) error {
+	agent, err := GetAgentByID(db, id)
+	if err != nil {
+		return err
+	}
+	if admin && agent.Approval != entities.AgentApproved {
+		return fmt.Errorf("%w: agent %d is %s; approve it first", ErrInvalid, id, agent.Approval)
+	}
+	_, err = db.Exec(`UPDATE agents SET admin = ? WHERE id = ?`, admin, id)
+	return err
 }
 
-func GetAgent() ([]entities.Agent, error) {
-	db, err := startDb()
+// DeleteAgent removes an agent, queueing again the scan jobs it holds
+func DeleteAgent(db *sql.DB, id int) error {
+	if err := releaseAgentScanJobs(db, id); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE scan_jobs SET agent_id = NULL WHERE agent_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := db.Exec(`DELETE FROM agents WHERE id = ?`, id)
 	if err != nil {
-		return []entities.Agent{}, err
+		return err
 	}
-	defer db.Close()
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+	return nil
+}
 
-	selDB, err := db.Query("SELECT id, name, guid, status, enabled, updated FROM agents ORDER BY id DESC")
+// RecordHeartbeat stores what a running agent reports about itself and
+// marks it ready, or scanning while it reports an activity
+func RecordHeartbeat(db *sql.DB, id int, hb entities.AgentHeartbeat) (entities.Agent, error) {
+	status := entities.StatusReady
+	if hb.Activity != "" {
+		status = entities.StatusScanning
+	}
+	_, err := db.Exec(`UPDATE agents
+		SET updated = ?, status = ?, version = ?, hostname = ?, platform = ?, activity = ?
+		WHERE id = ?`,
+		time.Now().Unix(), status, hb.Version, hb.Hostname, hb.Platform, hb.Activity, id)
 	if err != nil {
-		return []entities.Agent{}, err
+		return entities.Agent{}, err
 	}
+	return GetAgentByID(db, id)
+}
 
-	items := []entities.Agent{}
-	for selDB.Next() {
-		var id int
-		var name, guid, updatedstr string
-		var enabled bool
-		var status entities.StatusName
+// DefaultAgentHeartbeatTimeout applies when server.agent_timeout is not set
+const DefaultAgentHeartbeatTimeout = 90 * time.Second
 
-		var updated time.Time
+// AgentHeartbeatTimeout is how long an agent may go without a heartbeat
+// before it is marked offline
+func AgentHeartbeatTimeout() time.Duration {
+	timeout := viper.GetDuration("server.agent_timeout")
+	if timeout <= 0 {
+		timeout = DefaultAgentHeartbeatTimeout
+	}
+	return timeout
+}
 
-		err = selDB.Scan(&id, &name, &guid, &status, &enabled, &updatedstr)
-		if err != nil {
-			return []entities.Agent{}, err
-		}
+// MarkStaleAgentsOffline marks running agents whose last heartbeat is older
+// than timeout as not ready, returning how many were marked
+func MarkStaleAgentsOffline(db *sql.DB, timeout time.Duration) (int64, error) {
+	result, err := db.Exec(`UPDATE agents SET status = ?, activity = NULL
+		WHERE status IN (?, ?) AND updated < ?`,
+		entities.StatusNotReady, entities.StatusReady, entities.StatusScanning,
+		time.Now().Add(-timeout).Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
 
-		i, err := strconv.ParseInt(updatedstr, 10, 64)
-		if err != nil {
-			return []entities.Agent{}, err
+// IssueAgentCredential gives an agent a new credential, replacing any
+// previous one, and makes its registration pending until an admin approves
+// it and grants it the admin role again. Only a hash of the credential is
+// stored.
+func IssueAgentCredential(q Querier, id int) (string, error) {
+	credential := fmt.Sprintf("%d.%s%s", id, auth.GenerateAPISeed(), auth.GenerateAPISeed())
+	result, err := q.Exec(`UPDATE agents SET approval = ?, credential_hash = ?, status = ?, admin = 0 WHERE id = ?`,
+		entities.AgentPending, hashCredential(credential), entities.StatusPending, id)
+	if err != nil {
+		return "", err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
 		}
-		updated = time.Unix(i, 0)
-		if err != nil {
-			return []entities.Agent{}, err
+		return "", err
+	}
+	return credential, nil
+}
+
+// AuthenticateAgent returns the agent a credential was issued to, whatever
+// its approval. Returns sql.ErrNoRows when the credential is not valid.
+func AuthenticateAgent(db *sql.DB, credential string) (entities.Agent, error) {
+	idText, _, ok := strings.Cut(credential, ".")
+	id, err := strconv.Atoi(idText)
+	if !ok || err != nil {
+		return entities.Agent{}, sql.ErrNoRows
+	}
+	var stored sql.NullString
+	if err := db.QueryRow(`SELECT credential_hash FROM agents WHERE id = ?`, id).Scan(&stored); err != nil {
+		return entities.Agent{}, err
+	}
+	if !stored.Valid || subtle.ConstantTimeCompare([]byte(stored.String), []byte(hashCredential(credential))) != 1 {
+		return entities.Agent{}, sql.ErrNoRows
+	}
+	return GetAgentByID(db, id)
+}
+
+// ApproveAgent approves a pending registration
+func ApproveAgent(db *sql.DB, id int) error {
+	agent, err := GetAgentByID(db, id)
+	if err != nil {
+		return err
+	}
+	switch agent.Approval {
+	case entities.AgentApproved:
+		return nil
+	case entities.AgentRevoked:
+		return fmt.Errorf("%w: the credential of agent %d was revoked; the agent must register again", ErrInvalid, id)
+	}
+	_, err = db.Exec(`UPDATE agents SET approval = ?, status = ? WHERE id = ?`,
+		entities.AgentApproved, entities.StatusRegistered, id)
+	return err
+}
+
+// RevokeAgent withdraws an agent's credential and queues again the scan
+// jobs it holds. The agent must register and be approved again.
+func RevokeAgent(db *sql.DB, id int) error {
+	result, err := db.Exec(`UPDATE agents SET approval = ?, credential_hash = NULL, status = ?, activity = NULL,
+		admin = 0 WHERE id = ?`, entities.AgentRevoked, entities.StatusNotReady, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
 		}
-		var item = entities.Agent{Id: id, Name: name, Guid: guid, Enabled: enabled, Updated: updated, Status: status}
-		items = append(items, item)
-		fmt.Println(item.Id, item.Name, item.Guid, item.Enabled, item.Updated)
+		return err
 	}
-	selDB.Close()
-	return items, nil
+	return releaseAgentScanJobs(db, id)
+}
+
+func hashCredential(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:])
 }
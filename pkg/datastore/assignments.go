@@ -0,0 +1,234 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+// Metadata kinds that can be assigned to root folders and folders
+const (
+	MetadataOwner   = "owner"
+	MetadataPurpose = "purpose"
+	MetadataPolicy  = "policy"
+)
+
+// metadataColumn returns the root_folders/folders column holding a kind
+func metadataColumn(kind string) (string, error) {
+	switch kind {
+	case MetadataOwner:
+		return "owner_id", nil
+	case MetadataPurpose:
+		return "purpose_id", nil
+	case MetadataPolicy:
+		return "policy_id", nil
+	default:
+		return "", fmt.Errorf("unknown metadata kind %q", kind)
+	}
+}
+
+// AssignFolderMetadata sets the owner, purpose or policy of a root folder or
+// catalogued folder on a host, matching paths under case-insensitive roots
+// in any case; a nil id clears the assignment so the value is inherited
+// again. Returns sql.ErrNoRows when path is neither.
+func AssignFolderMetadata(db *sql.DB, hostID int64, path, kind string, id *int) error {
+	column, err := metadataColumn(kind)
+	if err != nil {
+		return err
+	}
+
+	root, err := FindRootFolderByPath(db, hostID, path)
+	if err == nil {
+		_, err = db.Exec(`UPDATE root_folders SET `+column+` = ? WHERE id = ?`, id, root.ID)
+		return err
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	if path, err = catalogPath(db, hostID, path); err != nil {
+		return err
+	}
+	res, err := db.Exec(`UPDATE folders SET `+column+` = ? WHERE path = ? AND removed = 0 AND `+hostRoots, id, path, hostID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// EffectiveMetadata is the owner, purpose and policy that apply to a
+// folder: assigned to it directly or inherited from the nearest ancestor,
+// ending at the root folder. Nil means none applies.
+type EffectiveMetadata struct {
+	Owner   *entities.Owner
+	Purpose *entities.Purpose
+	Policy  *entities.Policy
+}
+
+// metadataIDs holds the assigned (or inherited) IDs, nil when unset
+type metadataIDs struct {
+	owner, purpose, policy *int
+}
+
+// inherit fills unset IDs from the parent's
+func (m metadataIDs) inherit(parent metadataIDs) metadataIDs {
+	if m.owner == nil {
+		m.owner = parent.owner
+	}
+	if m.purpose == nil {
+		m.purpose = parent.purpose
+	}
+	if m.policy == nil {
+		m.policy = parent.policy
+	}
+	return m
+}
+
+// MetadataResolver computes effective metadata for folders and files,
+// caching every folder it resolves along the way
+type MetadataResolver struct {
+	db       *sql.DB
+	folders  map[int64]metadataIDs
+	roots    map[int64]metadataIDs
+	owners   map[int]*entities.Owner
+	purposes map[int]*entities.Purpose
+	policies map[int]*entities.Policy
+}
+
+// NewMetadataResolver loads the owners, purposes and policies
+func NewMetadataResolver(db *sql.DB) (*MetadataResolver, error) {
+	r := &MetadataResolver{
+		db:       db,
+		folders:  make(map[int64]metadataIDs),
+		roots:    make(map[int64]metadataIDs),
+		owners:   make(map[int]*entities.Owner),
+		purposes: make(map[int]*entities.Purpose),
+		policies: make(map[int]*entities.Policy),
+	}
+
+	owners, err := GetOwners(db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range owners {
+		r.owners[owners[i].Id] = &owners[i]
+	}
+	purposes, err := GetPurposes(db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range purposes {
+		r.purposes[purposes[i].Id] = &purposes[i]
+	}
+	policies, err := GetPolicies(db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range policies {
+		r.policies[policies[i].Id] = &policies[i]
+	}
+	return r, nil
+}
+
+// ForFolder returns the metadata in effect for a folder
+func (r *MetadataResolver) ForFolder(folderID int64) (*EffectiveMetadata, error) {
+	ids, err := r.folderIDs(folderID)
+	if err != nil {
+		return nil, err
+	}
+	return r.effective(ids), nil
+}
+
+// ForRoot returns the metadata assigned to a root folder
+func (r *MetadataResolver) ForRoot(rootFolderID int64) (*EffectiveMetadata, error) {
+	ids, err := r.rootIDs(rootFolderID)
+	if err != nil {
+		return nil, err
+	}
+	return r.effective(ids), nil
+}
+
+// ForFile returns the metadata in effect for a file's folder
+func (r *MetadataResolver) ForFile(file *File) (*EffectiveMetadata, error) {
+	if file.FolderID == 0 {
+		return r.ForRoot(file.RootFolderID)
+	}
+	return r.ForFolder(file.FolderID)
+}
+
+// PolicyFor returns the retention policy in effect for a file, or nil
+func (r *MetadataResolver) PolicyFor(file *File) (*entities.Policy, error) {
+	m, err := r.ForFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return m.Policy, nil
+}
+
+func (r *MetadataResolver) effective(ids metadataIDs) *EffectiveMetadata {
+	m := &EffectiveMetadata{}
+	if ids.owner != nil {
+		m.Owner = r.owners[*ids.owner]
+	}
+	if ids.purpose != nil {
+		m.Purpose = r.purposes[*ids.purpose]
+	}
+	if ids.policy != nil {
+		m.Policy = r.policies[*ids.policy]
+	}
+	return m
+}
+
+func (r *MetadataResolver) folderIDs(folderID int64) (metadataIDs, error) {
+	if ids, ok := r.folders[folderID]; ok {
+		return ids, nil
+	}
+
+	var ids metadataIDs
+	var parentID *int64
+	var rootID int64
+	err := r.db.QueryRow(`
+	SELECT parent_folder_id, root_folder_id, owner_id, purpose_id, policy_id
+	FROM folders WHERE id = ?
+	`, folderID).Scan(&parentID, &rootID, &ids.owner, &ids.purpose, &ids.policy)
+	if err != nil {
+		return metadataIDs{}, err
+	}
+
+	var parent metadataIDs
+	if parentID != nil {
+		parent, err = r.folderIDs(*parentID)
+	} else {
+		parent, err = r.rootIDs(rootID)
+	}
+	if err != nil {
+		return metadataIDs{}, err
+	}
+
+	ids = ids.inherit(parent)
+	r.folders[folderID] = ids
+	return ids, nil
+}
+
+func (r *MetadataResolver) rootIDs(rootFolderID int64) (metadataIDs, error) {
+	if ids, ok := r.roots[rootFolderID]; ok {
+		return ids, nil
+	}
+
+	var ids metadataIDs
+	err := r.db.QueryRow(`SELECT owner_id, purpose_id, policy_id FROM root_folders WHERE id = ?`, rootFolderID).
+		Scan(&ids.owner, &ids.purpose, &ids.policy)
+	if err != nil {
+		return metadataIDs{}, err
+	}
+	r.roots[rootFolderID] = ids
+	return ids, nil
+}
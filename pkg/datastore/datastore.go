@@ -9,6 +9,14 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// Querier is satisfied by *sql.DB and *sql.Tx, so that catalog writes can
+// be grouped in a transaction by the caller
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 func startDb() (*sql.DB, error) {
 	dbtype := viper.GetString("server.database.type")
 	if dbtype == "sqlite" {
@@ -25,6 +33,11 @@ func startDb() (*sql.DB, error) {
 	return nil, fmt.Errorf("startDB: Not Implemented")
 }
 
+// OpenDb opens the database configured in the server section
+func OpenDb() (*sql.DB, error) {
+	return startDb()
+}
+
 func connectSqliteDB(dbPath string) (*sql.DB, error) {
 	// Note: the busy_timeout pragma must be first because
 	// the connection needs to be set to block on busy before WAL mode
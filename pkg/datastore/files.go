@@ -2,8 +2,10 @@ package datastore
 
 import (
 	"database/sql"
-	"path/filepath"
-	"strings"
+	"fmt"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
 )
 
 const CreateFilesTableSQL = `
@@ -33,6 +35,13 @@ CREATE INDEX IF NOT EXISTS idx_files_removed ON files(removed);
 CREATE INDEX IF NOT EXISTS idx_files_path ON files(path);
 `
 
+// Link kinds recorded for files dupectl replaced with a link to a keeper
+const (
+	FileLinkHard    = "hard"    // Hard link sharing the keeper's inode
+	FileLinkReflink = "reflink" // Independent clone sharing the keeper's extents
+	FileLinkSymlink = "symlink" // Symbolic link holding no content of its own
+)
+
 // File represents a file record in the database
 type File struct {
 	ID             int64
@@ -47,16 +56,41 @@ type File struct {
 	Removed        bool
 	FolderID       int64
 	RootFolderID   int64
-	RootFolderPath string // For display purposes
+	Status         entities.StatusName // Deletion workflow status
+	RootFolderPath string              // For display purposes
+	// RootCaseInsensitive reports whether the root's filesystem ignores case,
+	// and therefore whether paths differing only in case are the same file
+	RootCaseInsensitive bool
+	// Metadata is the owner, purpose and policy in effect for the file,
+	// resolved on demand for display
+	Metadata *EffectiveMetadata
+	// LinkKind and LinkTarget are set when dupectl replaced the file with a
+	// link ("hard", "reflink" or "symlink") to the keeper at LinkTarget
+	LinkKind   *string
+	LinkTarget *string
+}
+
+// foldPath returns the case-folded spelling of a path, under which paths of
+// case-insensitive roots are looked up (folded_path columns)
+func foldPath(path string) string {
+	return pathutil.NormalizePathForComparison(path, true)
 }
 
 // InsertFile inserts a new file record
-func InsertFile(db *sql.DB, file *File) (int64, error) {
-	query := `
-	INSERT INTO files (path, size, mtime, hash_value, hash_algorithm, error_status, 
+// A file that changed or reappeared since it was last seen drops out of
+// the deletion workflow, since any earlier mark no longer applies to it.
+func InsertFile(db Querier, file *File) (int64, error) {
+	query := fmt.Sprintf(`
+	INSERT INTO files (path, folded_path, size, mtime, hash_value, hash_algorithm, error_status,
 	                   first_scanned_at, last_scanned_at, removed, folder_id, root_folder_id)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	ON CONFLICT(path) DO UPDATE SET
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(root_folder_id, path) DO UPDATE SET
+		status = CASE WHEN files.size != excluded.size OR files.mtime != excluded.mtime OR files.removed = 1
+		              THEN %d ELSE files.status END,
+		link_kind = CASE WHEN files.size != excluded.size OR files.mtime != excluded.mtime OR files.removed = 1
+		                 THEN NULL ELSE files.link_kind END,
+		link_target = CASE WHEN files.size != excluded.size OR files.mtime != excluded.mtime OR files.removed = 1
+		                   THEN NULL ELSE files.link_target END,
 		size = excluded.size,
 		mtime = excluded.mtime,
 		hash_value = excluded.hash_value,
@@ -67,7 +101,7 @@ func InsertFile(db *sql.DB, file *File) (int64, error) {
 		folder_id = excluded.folder_id,
 		root_folder_id = excluded.root_folder_id
 	RETURNING id
-	`
+	`, entities.StatusSynced)
 
 	removed := 0
 	if file.Removed {
@@ -75,7 +109,7 @@ func InsertFile(db *sql.DB, file *File) (int64, error) {
 	}
 
 	var id int64
-	err := db.QueryRow(query, file.Path, file.Size, file.Mtime, file.HashValue,
+	err := db.QueryRow(query, file.Path, foldPath(file.Path), file.Size, file.Mtime, file.HashValue,
 		file.HashAlgorithm, file.ErrorStatus, file.FirstScannedAt, file.LastScannedAt,
 		removed, file.FolderID, file.RootFolderID).Scan(&id)
 	if err != nil {
@@ -92,14 +126,30 @@ func UpdateFileHash(db *sql.DB, fileID int64, hashValue, hashAlgorithm string) e
 	return err
 }
 
-// SetFileRemoved marks a file as removed
-func SetFileRemoved(db *sql.DB, path string, removed bool) error {
+// SetFileError records why a file could not be hashed
+func SetFileError(db *sql.DB, fileID int64, errorStatus string) error {
+	_, err := db.Exec(`UPDATE files SET error_status = ?, last_scanned_at = strftime('%s', 'now') WHERE id = ?`,
+		errorStatus, fileID)
+	return err
+}
+
+// SetFileLink records that dupectl replaced a file with a link of the
+// given kind to target, and the modification time the path now shows.
+// An empty kind records that the file is an independent copy again.
+func SetFileLink(db *sql.DB, fileID int64, kind, target string, mtime int64) error {
+	_, err := db.Exec(`UPDATE files SET link_kind = NULLIF(?, ''), link_target = NULLIF(?, ''), mtime = ? WHERE id = ?`,
+		kind, target, mtime, fileID)
+	return err
+}
+
+// SetFileRemoved marks a file of a root folder as removed
+func SetFileRemoved(db *sql.DB, rootFolderID int64, path string, removed bool) error {
 	removedInt := 0
 	if removed {
 		removedInt = 1
 	}
-	query := `UPDATE files SET removed = ?, last_scanned_at = strftime('%s', 'now') WHERE path = ?`
-	_, err := db.Exec(query, removedInt, path)
+	query := `UPDATE files SET removed = ?, last_scanned_at = strftime('%s', 'now') WHERE root_folder_id = ? AND path = ?`
+	_, err := db.Exec(query, removedInt, rootFolderID, path)
 	return err
 }
 
@@ -107,8 +157,9 @@ func SetFileRemoved(db *sql.DB, path string, removed bool) error {
 func GetFilesByHash(db *sql.DB, hashValue string, size int64) ([]*File, error) {
 	query := `
 	SELECT f.id, f.path, f.size, f.mtime, f.hash_value, f.hash_algorithm, f.error_status,
-	       f.first_scanned_at, f.last_scanned_at, f.removed, f.folder_id, f.root_folder_id,
-	       COALESCE(rf.path, '') as root_folder_path
+	       f.first_scanned_at, f.last_scanned_at, f.removed, f.folder_id, f.root_folder_id, f.status,
+	       COALESCE(rf.path, '') as root_folder_path, COALESCE(rf.case_insensitive, 0),
+	       f.link_kind, f.link_target
 	FROM files f
 	LEFT JOIN root_folders rf ON f.root_folder_id = rf.id
 	WHERE f.hash_value = ? AND f.size = ? AND f.removed = 0 AND f.error_status IS NULL
@@ -126,17 +177,19 @@ func GetFilesByHash(db *sql.DB, hashValue string, size int64) ([]*File, error) {
 
 	for rows.Next() {
 		file := &File{}
-		var removed int
+		var removed, caseInsensitive int
 		err := rows.Scan(&file.ID, &file.Path, &file.Size, &file.Mtime, &file.HashValue,
 			&file.HashAlgorithm, &file.ErrorStatus, &file.FirstScannedAt, &file.LastScannedAt,
-			&removed, &file.FolderID, &file.RootFolderID, &file.RootFolderPath)
+			&removed, &file.FolderID, &file.RootFolderID, &file.Status, &file.RootFolderPath, &caseInsensitive,
+			&file.LinkKind, &file.LinkTarget)
 		if err != nil {
 			return nil, err
 		}
 		file.Removed = removed != 0
+		file.RootCaseInsensitive = caseInsensitive != 0
 
-		// Normalize path for comparison (case-insensitive on Windows)
-		normalizedPath := normalizePathForComparison(file.Path)
+		// Normalize path for comparison (case-folded only on case-insensitive roots)
+		normalizedPath := pathutil.NormalizePathForComparison(file.Path, file.RootCaseInsensitive)
 
 		// Skip if we've already seen this path (case-insensitive duplicate)
 		if seenPaths[normalizedPath] {
@@ -149,10 +202,3 @@ func GetFilesByHash(db *sql.DB, hashValue string, size int64) ([]*File, error) {
 
 	return files, rows.Err()
 }
-
-// normalizePathForComparison normalizes paths for case-insensitive comparison
-func normalizePathForComparison(path string) string {
-	// On Windows, convert to lowercase for comparison
-	// On Unix, paths are case-sensitive so return as-is
-	return strings.ToLower(filepath.Clean(path))
-}
@@ -2,6 +2,8 @@ package datastore
 
 import (
 	"database/sql"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
 )
 
 const CreateFoldersTableSQL = `
@@ -35,15 +37,16 @@ type Folder struct {
 	FirstScannedAt int64
 	LastScannedAt  int64
 	Removed        bool
+	Status         entities.StatusName // Deletion workflow status
 }
 
 // InsertFolder inserts a new folder record
-func InsertFolder(db *sql.DB, folder *Folder) (int64, error) {
+func InsertFolder(db Querier, folder *Folder) (int64, error) {
 	query := `
-	INSERT INTO folders (path, parent_folder_id, root_folder_id, error_status, 
+	INSERT INTO folders (path, folded_path, parent_folder_id, root_folder_id, error_status,
 	                     first_scanned_at, last_scanned_at, removed)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
-	ON CONFLICT(path) DO UPDATE SET
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(root_folder_id, path) DO UPDATE SET
 		parent_folder_id = excluded.parent_folder_id,
 		error_status = excluded.error_status,
 		last_scanned_at = excluded.last_scanned_at,
@@ -57,7 +60,7 @@ func InsertFolder(db *sql.DB, folder *Folder) (int64, error) {
 	}
 
 	var id int64
-	err := db.QueryRow(query, folder.Path, folder.ParentFolderID, folder.RootFolderID,
+	err := db.QueryRow(query, folder.Path, foldPath(folder.Path), folder.ParentFolderID, folder.RootFolderID,
 		folder.ErrorStatus, folder.FirstScannedAt, folder.LastScannedAt, removed).Scan(&id)
 	if err != nil {
 		return 0, err
@@ -66,18 +69,18 @@ func InsertFolder(db *sql.DB, folder *Folder) (int64, error) {
 	return id, nil
 }
 
-// GetFolderByPath retrieves a folder by path
-func GetFolderByPath(db *sql.DB, path string) (*Folder, error) {
+// GetFolderByPath retrieves a folder of a root folder by path
+func GetFolderByPath(db Querier, rootFolderID int64, path string) (*Folder, error) {
 	query := `
 	SELECT id, path, parent_folder_id, root_folder_id, error_status,
 	       first_scanned_at, last_scanned_at, removed
 	FROM folders
-	WHERE path = ?
+	WHERE root_folder_id = ? AND path = ?
 	`
 
 	folder := &Folder{}
 	var removed int
-	err := db.QueryRow(query, path).Scan(&folder.ID, &folder.Path, &folder.ParentFolderID,
+	err := db.QueryRow(query, rootFolderID, path).Scan(&folder.ID, &folder.Path, &folder.ParentFolderID,
 		&folder.RootFolderID, &folder.ErrorStatus, &folder.FirstScannedAt,
 		&folder.LastScannedAt, &removed)
 	if err != nil {
@@ -87,14 +90,14 @@ func GetFolderByPath(db *sql.DB, path string) (*Folder, error) {
 	return folder, nil
 }
 
-// SetFolderRemoved marks a folder as removed
-func SetFolderRemoved(db *sql.DB, path string, removed bool) error {
+// SetFolderRemoved marks a folder of a root folder as removed
+func SetFolderRemoved(db *sql.DB, rootFolderID int64, path string, removed bool) error {
 	removedInt := 0
 	if removed {
 		removedInt = 1
 	}
-	query := `UPDATE folders SET removed = ?, last_scanned_at = strftime('%s', 'now') WHERE path = ?`
-	_, err := db.Exec(query, removedInt, path)
+	query := `UPDATE folders SET removed = ?, last_scanned_at = strftime('%s', 'now') WHERE root_folder_id = ? AND path = ?`
+	_, err := db.Exec(query, removedInt, rootFolderID, path)
 	return err
 }
 
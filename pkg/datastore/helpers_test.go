@@ -0,0 +1,71 @@
+package datastore
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+
+	_ "modernc.org/sqlite"
+)
+
+// openTestDB opens a migrated catalog in a temporary directory
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(10000)&_pragma=foreign_keys(ON)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := RunMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// addTestHost registers a host by name
+func addTestHost(t *testing.T, db *sql.DB, name string) int64 {
+	t.Helper()
+	host, err := InsertHost(db, entities.Host{Name: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(host.Id)
+}
+
+// addTestRoot registers a root folder of a host
+func addTestRoot(t *testing.T, db *sql.DB, hostID int64, path string, caseInsensitive bool) *RootFolder {
+	t.Helper()
+	root := &RootFolder{HostID: hostID, Path: path, CaseInsensitive: caseInsensitive}
+	id, err := InsertRootFolder(db, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.ID = id
+	return root
+}
+
+// addTestFolder catalogues a folder of a root
+func addTestFolder(t *testing.T, db *sql.DB, root *RootFolder, path string, parentID *int64) int64 {
+	t.Helper()
+	id, err := InsertFolder(db, &Folder{Path: path, ParentFolderID: parentID, RootFolderID: root.ID,
+		FirstScannedAt: 1, LastScannedAt: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// addTestFile catalogues a hashed file of a root
+func addTestFile(t *testing.T, db *sql.DB, root *RootFolder, folderID int64, path, hash string, size int64) int64 {
+	t.Helper()
+	algorithm := "sha512"
+	id, err := InsertFile(db, &File{Path: path, Size: size, Mtime: 1, HashValue: &hash, HashAlgorithm: &algorithm,
+		FirstScannedAt: 1, LastScannedAt: 1, FolderID: folderID, RootFolderID: root.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
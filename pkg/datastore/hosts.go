@@ -0,0 +1,143 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/spf13/viper"
+)
+
+// Hosts share the named table layout and add the machine ID of the
+// registered machine, which is never changed by edits
+const hostColumns = `id, name, description, COALESCE(machine_id, '')`
+
+func scanHost(row rowScanner) (entities.Host, error) {
+	var h entities.Host
+	err := row.Scan(&h.Id, &h.Name, &h.Description, &h.MachineID)
+	return h, err
+}
+
+// GetHosts lists all storage hosts by name
+func GetHosts(db *sql.DB) ([]entities.Host, error) {
+	rows, err := db.Query(`SELECT ` + hostColumns + ` FROM ` + HostsTable + ` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hosts := []entities.Host{}
+	for rows.Next() {
+		h, err := scanHost(rows)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, rows.Err()
+}
+
+// GetHost retrieves a storage host by name
+func GetHost(db *sql.DB, name string) (entities.Host, error) {
+	return scanHost(db.QueryRow(`SELECT `+hostColumns+` FROM `+HostsTable+` WHERE name = ?`, name))
+}
+
+// GetHostByID retrieves a storage host by ID
+func GetHostByID(db *sql.DB, id int) (entities.Host, error) {
+	return scanHost(db.QueryRow(`SELECT `+hostColumns+` FROM `+HostsTable+` WHERE id = ?`, id))
+}
+
+// GetHostByMachineID retrieves the host a machine registered as
+func GetHostByMachineID(db *sql.DB, machineID string) (entities.Host, error) {
+	return scanHost(db.QueryRow(`SELECT `+hostColumns+` FROM `+HostsTable+` WHERE machine_id = ?`, machineID))
+}
+
+// InsertHost creates a storage host; the machine ID is left for the
+// machine to claim when it registers
+func InsertHost(db *sql.DB, item entities.Host) (entities.Host, error) {
+	r, err := insertNamedRecord(db, HostsTable, namedRecord{Name: item.Name, Description: item.Description})
+	return entities.Host{Id: r.Id, Name: r.Name, Description: r.Description}, err
+}
+
+// UpdateHost replaces the name and description of the host called name
+func UpdateHost(db *sql.DB, name string, item entities.Host) (entities.Host, error) {
+	r, err := updateNamedRecord(db, HostsTable, name, namedRecord{Name: item.Name, Description: item.Description})
+	if err != nil {
+		return entities.Host{}, err
+	}
+	return GetHostByID(db, r.Id)
+}
+
+// DeleteHost removes a storage host by name. A host that still has root
+// folders cannot be deleted.
+func DeleteHost(db *sql.DB, name string) error {
+	host, err := GetHost(db, name)
+	if err != nil {
+		return err
+	}
+	var roots int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM root_folders WHERE host_id = ?`, host.Id).Scan(&roots); err != nil {
+		return err
+	}
+	if roots > 0 {
+		return fmt.Errorf("%w: host %q still has %d root folder(s)", ErrInvalid, host.Name, roots)
+	}
+	return deleteNamedRecord(db, HostsTable, name)
+}
+
+// RegisterHost returns the host of a machine, creating it on first
+// registration. A host created by hand under the machine's name is
+// adopted; if the name belongs to another machine, the decoded machine ID
+// is used as the name instead.
+func RegisterHost(db *sql.DB, machineID, name string) (entities.Host, error) {
+	host, err := GetHostByMachineID(db, machineID)
+	if err != sql.ErrNoRows {
+		return host, err
+	}
+
+	host, err = GetHost(db, name)
+	if err == nil && host.MachineID == "" {
+		_, err = db.Exec(`UPDATE `+HostsTable+` SET machine_id = ?, updated_at = strftime('%s', 'now') WHERE id = ?`,
+			machineID, host.Id)
+		host.MachineID = machineID
+		return host, err
+	}
+	if err == nil {
+		if name, err = auth.DecodeMachineID(machineID); err != nil {
+			return entities.Host{}, err
+		}
+	} else if err != sql.ErrNoRows {
+		return entities.Host{}, err
+	}
+	if err := validateName(name); err != nil {
+		return entities.Host{}, err
+	}
+	if err := checkNameFree(db, HostsTable, name, 0); err != nil {
+		return entities.Host{}, err
+	}
+
+	host = entities.Host{Name: name, MachineID: machineID}
+	err = db.QueryRow(`INSERT INTO `+HostsTable+` (name, machine_id) VALUES (?, ?) RETURNING id`,
+		name, machineID).Scan(&host.Id)
+	return host, err
+}
+
+// LocalMachineID returns the client ID this machine registers under
+func LocalMachineID() string {
+	if id := viper.GetString("client.clientid"); id != "" {
+		return id
+	}
+	return auth.GenerateMachineID()
+}
+
+// RegisterLocalHost returns the host of this machine, registering it under
+// its hostname on first use
+func RegisterLocalHost(db *sql.DB) (entities.Host, error) {
+	name, err := os.Hostname()
+	if err != nil {
+		return entities.Host{}, err
+	}
+	return RegisterHost(db, LocalMachineID(), name)
+}
@@ -0,0 +1,121 @@
+package datastore
+
+import (
+	"database/sql"
+)
+
+const CreateRemediationJournalTableSQL = `
+CREATE TABLE IF NOT EXISTS remediation_journal (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id TEXT NOT NULL,
+    file_id INTEGER,
+    path TEXT NOT NULL,
+    action TEXT NOT NULL,
+    result TEXT NOT NULL,
+    size INTEGER NOT NULL DEFAULT 0,
+    hash_value TEXT,
+    keeper_path TEXT,
+    detail TEXT,
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE SET NULL
+);`
+
+// Remediation journal actions
+const (
+	JournalActionDelete       = "delete"
+	JournalActionDeleteFolder = "delete-folder"
+	JournalActionQuarantine   = "quarantine"
+	JournalActionRestore      = "restore"
+	JournalActionExpire       = "expire"
+	JournalActionLinkHard     = "link-hard"
+	JournalActionLinkReflink  = "link-reflink"
+	JournalActionLinkSymlink  = "link-symlink"
+	JournalActionUnlink       = "unlink" // Reverses a link-* entry
+)
+
+// Remediation journal results
+const (
+	JournalResultDone    = "done"    // The action was carried out
+	JournalResultSkipped = "skipped" // A safety check failed; nothing was changed
+	JournalResultFailed  = "failed"  // The action was attempted and failed
+)
+
+// JournalEntry records one remediation action. KeeperPath names the copy
+// that was kept, so removed content can be restored from it. FileMode and
+// FileMtime hold the replaced file's attributes so links can be reversed.
+type JournalEntry struct {
+	ID         int64
+	RunID      string
+	FileID     *int64
+	Path       string
+	Action     string
+	Result     string
+	Size       int64
+	HashValue  *string
+	KeeperPath *string
+	Detail     *string
+	FileMode   *int64
+	FileMtime  *int64
+	UndoOf     *int64 // ID of the entry this entry reverses
+	CreatedAt  int64
+}
+
+// InsertJournalEntry appends an entry to the remediation journal
+func InsertJournalEntry(db *sql.DB, e *JournalEntry) (int64, error) {
+	var id int64
+	err := db.QueryRow(`
+	INSERT INTO remediation_journal (run_id, file_id, path, action, result, size,
+	                                 hash_value, keeper_path, detail, file_mode, file_mtime,
+	                                 undo_of, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id
+	`, e.RunID, e.FileID, e.Path, e.Action, e.Result, e.Size,
+		e.HashValue, e.KeeperPath, e.Detail, e.FileMode, e.FileMtime, e.UndoOf, e.CreatedAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	e.ID = id
+	return id, nil
+}
+
+// GetJournalEntries returns the journal entries of a run, or of all runs
+// when runID is empty, oldest first
+func GetJournalEntries(db *sql.DB, runID string) ([]*JournalEntry, error) {
+	rows, err := db.Query(`
+	SELECT id, run_id, file_id, path, action, result, size, hash_value, keeper_path, detail,
+	       file_mode, file_mtime, undo_of, created_at
+	FROM remediation_journal
+	WHERE ? = '' OR run_id = ?
+	ORDER BY id
+	`, runID, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*JournalEntry
+	for rows.Next() {
+		e := &JournalEntry{}
+		err := rows.Scan(&e.ID, &e.RunID, &e.FileID, &e.Path, &e.Action, &e.Result, &e.Size,
+			&e.HashValue, &e.KeeperPath, &e.Detail, &e.FileMode, &e.FileMtime, &e.UndoOf, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// IsJournalEntryUndone reports whether a successful entry reverses the given entry
+func IsJournalEntryUndone(db *sql.DB, id int64) (bool, error) {
+	var exists int
+	err := db.QueryRow(`
+	SELECT EXISTS (SELECT 1 FROM remediation_journal WHERE undo_of = ? AND result = ?)
+	`, id, JournalResultDone).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists != 0, nil
+}
@@ -0,0 +1,552 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+)
+
+// MarkRefusal explains why a file could not be marked for deletion
+type MarkRefusal struct {
+	Path   string
+	Reason string
+}
+
+// MarkRefusedError is returned when files of a mark request fail the
+// deletion guards. Nothing is marked when this error is returned.
+type MarkRefusedError struct {
+	Refusals []MarkRefusal
+}
+
+func (e *MarkRefusedError) Error() string {
+	return fmt.Sprintf("%d file(s) cannot be marked for deletion", len(e.Refusals))
+}
+
+// MarkResult counts the entries whose status changed
+type MarkResult struct {
+	Files   int
+	Folders int
+	Bytes   int64
+}
+
+// MarkTargets holds the catalog entries selected by a path
+type MarkTargets struct {
+	FileIDs   []int64
+	FolderIDs []int64
+}
+
+// hostRoots restricts a files or folders query to the roots of a host
+const hostRoots = `root_folder_id IN (SELECT id FROM root_folders WHERE host_id = ?)`
+
+// hostFoldedRoots restricts a query to the case-insensitive root folders of
+// a host, whose paths match by their folded spelling
+const hostFoldedRoots = `root_folder_id IN (SELECT id FROM root_folders WHERE host_id = ? AND case_insensitive = 1)`
+
+// FindMarkTargets resolves a catalogued file or folder path on a host. A
+// folder selects itself, its sub-folders and every file beneath it.
+// Returns sql.ErrNoRows if the path is not in the catalog.
+func FindMarkTargets(db *sql.DB, hostID int64, path string) (*MarkTargets, error) {
+	targets := &MarkTargets{}
+
+	path, err := catalogPath(db, hostID, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileID int64
+	err = db.QueryRow(`SELECT id FROM files WHERE path = ? AND removed = 0 AND `+hostRoots, path, hostID).Scan(&fileID)
+	if err == nil {
+		targets.FileIDs = append(targets.FileIDs, fileID)
+		return targets, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var folderID int64
+	err = db.QueryRow(`SELECT id FROM folders WHERE path = ? AND removed = 0 AND `+hostRoots, path, hostID).Scan(&folderID)
+	if err != nil {
+		return nil, err
+	}
+	targets.FolderIDs = append(targets.FolderIDs, folderID)
+
+	// Descendants share the folder path followed by a separator
+	prefix := strings.TrimSuffix(path, string(filepath.Separator)) + string(filepath.Separator)
+
+	folderIDs, err := queryIDs(db, `
+	SELECT id FROM folders
+	WHERE removed = 0 AND substr(path, 1, length(?)) = ? AND `+hostRoots+`
+	ORDER BY path
+	`, prefix, prefix, hostID)
+	if err != nil {
+		return nil, err
+	}
+	targets.FolderIDs = append(targets.FolderIDs, folderIDs...)
+
+	targets.FileIDs, err = queryIDs(db, `
+	SELECT id FROM files
+	WHERE removed = 0 AND substr(path, 1, length(?)) = ? AND `+hostRoots+`
+	ORDER BY path
+	`, prefix, prefix, hostID)
+	if err != nil {
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+// catalogPath returns the spelling under which a file or folder path is
+// catalogued on a host. Paths under case-insensitive roots match in any
+// case. Returns sql.ErrNoRows when the path is not in the catalog.
+func catalogPath(db *sql.DB, hostID int64, path string) (string, error) {
+	var exists int
+	err := db.QueryRow(`
+	SELECT EXISTS (SELECT 1 FROM files WHERE path = ? AND removed = 0 AND `+hostRoots+`)
+	    OR EXISTS (SELECT 1 FROM folders WHERE path = ? AND removed = 0 AND `+hostRoots+`)
+	`, path, hostID, path, hostID).Scan(&exists)
+	if err != nil {
+		return "", err
+	}
+	if exists != 0 {
+		return path, nil
+	}
+
+	var stored string
+	err = db.QueryRow(`
+	SELECT path FROM files WHERE folded_path = ? AND removed = 0 AND `+hostFoldedRoots+`
+	UNION ALL
+	SELECT path FROM folders WHERE folded_path = ? AND removed = 0 AND `+hostFoldedRoots+`
+	LIMIT 1
+	`, foldPath(path), hostID, foldPath(path), hostID).Scan(&stored)
+	return stored, err
+}
+
+// MarkForDeletion moves files and folders to MarkForDeletion in a single
+// transaction. Each file must be hashed, must not be the last remaining
+// copy of its content and must be allowed by the retention policies of its
+// copies; entries already in the deletion workflow are skipped.
+func MarkForDeletion(db *sql.DB, targets *MarkTargets) (*MarkResult, error) {
+	resolver, err := NewMetadataResolver(db)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &MarkResult{}
+	var refusals []MarkRefusal
+
+	for _, id := range targets.FileIDs {
+		file, err := getFileForUpdate(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if file.Status != entities.StatusSynced {
+			if isDeletionStatus(file.Status) {
+				continue
+			}
+			refusals = append(refusals, MarkRefusal{Path: file.Path, Reason: "status is " + file.Status.String()})
+			continue
+		}
+		if file.HashValue == nil {
+			refusals = append(refusals, MarkRefusal{Path: file.Path, Reason: "file has not been hashed"})
+			continue
+		}
+
+		// Marks made earlier in this transaction are visible to the guard,
+		// so marking every copy of a set refuses the last one
+		others, err := otherCopies(tx, file)
+		if err != nil {
+			return nil, err
+		}
+		if len(others) == 0 {
+			refusals = append(refusals, MarkRefusal{Path: file.Path, Reason: "last remaining copy of its content"})
+			continue
+		}
+		reason, err := policyRefusal(resolver, file, others, now)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			refusals = append(refusals, MarkRefusal{Path: file.Path, Reason: reason})
+			continue
+		}
+
+		if err := setFileStatusTx(tx, file.ID, file.Status, entities.StatusMarkForDeletion); err != nil {
+			return nil, err
+		}
+		result.Files++
+		result.Bytes += file.Size
+	}
+
+	if len(refusals) > 0 {
+		return nil, &MarkRefusedError{Refusals: refusals}
+	}
+
+	for _, id := range targets.FolderIDs {
+		var status entities.StatusName
+		if err := tx.QueryRow(`SELECT status FROM folders WHERE id = ?`, id).Scan(&status); err != nil {
+			return nil, err
+		}
+		if !entities.CanTransitionFolder(status, entities.StatusMarkForDeletion) {
+			continue
+		}
+		if err := setFolderStatusTx(tx, id, status, entities.StatusMarkForDeletion); err != nil {
+			return nil, err
+		}
+		result.Folders++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UnmarkForDeletion returns marked files and folders to Synced.
+// Entries already being deleted cannot be unmarked and are skipped.
+func UnmarkForDeletion(db *sql.DB, targets *MarkTargets) (*MarkResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &MarkResult{}
+	for _, id := range targets.FileIDs {
+		file, err := getFileForUpdate(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !entities.CanTransitionFile(file.Status, entities.StatusSynced) {
+			continue
+		}
+		if err := setFileStatusTx(tx, file.ID, file.Status, entities.StatusSynced); err != nil {
+			return nil, err
+		}
+		result.Files++
+		result.Bytes += file.Size
+	}
+
+	for _, id := range targets.FolderIDs {
+		var status entities.StatusName
+		if err := tx.QueryRow(`SELECT status FROM folders WHERE id = ?`, id).Scan(&status); err != nil {
+			return nil, err
+		}
+		if !entities.CanTransitionFolder(status, entities.StatusSynced) {
+			continue
+		}
+		if err := setFolderStatusTx(tx, id, status, entities.StatusSynced); err != nil {
+			return nil, err
+		}
+		result.Folders++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetFileStatus moves a file to a new status, enforcing the allowed
+// transitions. Fails if the file's status changed concurrently.
+func SetFileStatus(db *sql.DB, fileID int64, to entities.StatusName) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	file, err := getFileForUpdate(tx, fileID)
+	if err != nil {
+		return err
+	}
+	if err := setFileStatusTx(tx, fileID, file.Status, to); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetFolderStatus moves a folder to a new status, enforcing the allowed
+// transitions. Fails if the folder's status changed concurrently.
+func SetFolderStatus(db *sql.DB, folderID int64, to entities.StatusName) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status entities.StatusName
+	if err := tx.QueryRow(`SELECT status FROM folders WHERE id = ?`, folderID).Scan(&status); err != nil {
+		return fmt.Errorf("folder %d: %w", folderID, err)
+	}
+	if err := setFolderStatusTx(tx, folderID, status, to); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FolderHasChildren reports whether a folder still contains catalogued
+// files or folders that have not been removed
+func FolderHasChildren(db *sql.DB, folderID int64) (bool, error) {
+	var exists int
+	err := db.QueryRow(`
+	SELECT EXISTS (SELECT 1 FROM files WHERE folder_id = ? AND removed = 0)
+	    OR EXISTS (SELECT 1 FROM folders WHERE parent_folder_id = ? AND removed = 0)
+	`, folderID, folderID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists != 0, nil
+}
+
+// GetMarkedFiles returns the files of a host's roots currently in the
+// deletion workflow
+func GetMarkedFiles(db *sql.DB, hostID int64) ([]*File, error) {
+	rows, err := db.Query(`
+	SELECT f.id, f.path, f.size, f.mtime, f.hash_value, f.hash_algorithm, f.status,
+	       f.folder_id, f.root_folder_id, COALESCE(rf.path, '') as root_folder_path,
+	       COALESCE(rf.case_insensitive, 0), f.link_kind, f.link_target
+	FROM files f
+	LEFT JOIN root_folders rf ON f.root_folder_id = rf.id
+	WHERE f.removed = 0 AND f.status IN (?, ?, ?) AND f.`+hostRoots+`
+	ORDER BY f.path
+	`, entities.StatusMarkForDeletion, entities.StatusReadyForDeletion, entities.StatusDeleting, hostID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*File
+	for rows.Next() {
+		file := &File{}
+		var caseInsensitive int
+		err := rows.Scan(&file.ID, &file.Path, &file.Size, &file.Mtime, &file.HashValue,
+			&file.HashAlgorithm, &file.Status, &file.FolderID, &file.RootFolderID, &file.RootFolderPath,
+			&caseInsensitive, &file.LinkKind, &file.LinkTarget)
+		if err != nil {
+			return nil, err
+		}
+		file.RootCaseInsensitive = caseInsensitive != 0
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// GetMarkedFolders returns the folders of a host's roots currently in the
+// deletion workflow
+func GetMarkedFolders(db *sql.DB, hostID int64) ([]*Folder, error) {
+	rows, err := db.Query(`
+	SELECT id, path, parent_folder_id, root_folder_id, status
+	FROM folders
+	WHERE removed = 0 AND status IN (?, ?, ?) AND `+hostRoots+`
+	ORDER BY path
+	`, entities.StatusMarkForDeletion, entities.StatusReadyForDeletion, entities.StatusDeleting, hostID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folders []*Folder
+	for rows.Next() {
+		folder := &Folder{}
+		err := rows.Scan(&folder.ID, &folder.Path, &folder.ParentFolderID, &folder.RootFolderID, &folder.Status)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+
+	return folders, rows.Err()
+}
+
+// isDeletionStatus reports whether a status belongs to the deletion workflow
+func isDeletionStatus(status entities.StatusName) bool {
+	switch status {
+	case entities.StatusMarkForDeletion, entities.StatusReadyForDeletion,
+		entities.StatusDeleting, entities.StatusDeleted:
+		return true
+	}
+	return false
+}
+
+// getFileForUpdate reads the fields needed by the deletion guards
+func getFileForUpdate(tx *sql.Tx, fileID int64) (*File, error) {
+	file := &File{}
+	var caseInsensitive int
+	err := tx.QueryRow(`
+	SELECT f.id, f.path, f.size, f.mtime, f.hash_value, f.status, f.folder_id, f.root_folder_id,
+	       COALESCE(rf.case_insensitive, 0)
+	FROM files f
+	LEFT JOIN root_folders rf ON f.root_folder_id = rf.id
+	WHERE f.id = ?
+	`, fileID).Scan(&file.ID, &file.Path, &file.Size, &file.Mtime, &file.HashValue, &file.Status,
+		&file.FolderID, &file.RootFolderID, &caseInsensitive)
+	if err != nil {
+		return nil, fmt.Errorf("file %d: %w", fileID, err)
+	}
+	file.RootCaseInsensitive = caseInsensitive != 0
+	return file, nil
+}
+
+// otherCopies returns the other unmarked copies of the file's content in
+// the catalog. Rows naming the same entry on a case-insensitive root
+// (e.g. F1.txt and f1.txt) are not counted as separate copies, nor are
+// symbolic links, which hold no content of their own, or hard links to
+// the file's own inode, which go with it.
+func otherCopies(tx *sql.Tx, file *File) ([]*File, error) {
+	rows, err := tx.Query(`
+	SELECT f.id, f.path, f.mtime, f.folder_id, f.root_folder_id, f.link_kind, f.link_target,
+	       COALESCE(rf.host_id = (SELECT host_id FROM root_folders WHERE id = ?), 0)
+	FROM files f
+	LEFT JOIN root_folders rf ON f.root_folder_id = rf.id
+	WHERE f.hash_value = ? AND f.size = ? AND f.id != ?
+	  AND f.removed = 0 AND f.error_status IS NULL AND f.status = ?
+	`, file.RootFolderID, *file.HashValue, file.Size, file.ID, entities.StatusSynced)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	self := pathutil.NormalizePathForComparison(file.Path, file.RootCaseInsensitive)
+	// The file's own entry on disk, when it is reachable from here
+	selfInfo, selfErr := os.Lstat(file.Path)
+	var others []*File
+	for rows.Next() {
+		other := &File{}
+		var sameHost bool
+		if err := rows.Scan(&other.ID, &other.Path, &other.Mtime, &other.FolderID, &other.RootFolderID,
+			&other.LinkKind, &other.LinkTarget, &sameHost); err != nil {
+			return nil, err
+		}
+		if pathutil.NormalizePathForComparison(other.Path, file.RootCaseInsensitive) == self {
+			continue
+		}
+		if other.LinkKind != nil && *other.LinkKind == FileLinkSymlink {
+			continue
+		}
+		if other.LinkKind != nil && *other.LinkKind == FileLinkHard && other.LinkTarget != nil &&
+			pathutil.NormalizePathForComparison(*other.LinkTarget, file.RootCaseInsensitive) == self {
+			continue
+		}
+		if sameHost && selfErr == nil {
+			if info, err := os.Lstat(other.Path); err == nil &&
+				(info.Mode()&os.ModeSymlink != 0 || os.SameFile(selfInfo, info)) {
+				continue
+			}
+		}
+		others = append(others, other)
+	}
+	return others, rows.Err()
+}
+
+// policyRefusal explains why the retention policies of a file or of its
+// remaining copies forbid marking it, or returns "" when they allow it.
+// Copies past their policy's maximum age are no longer retained by it.
+func policyRefusal(resolver *MetadataResolver, file *File, others []*File, now time.Time) (string, error) {
+	policy, err := resolver.PolicyFor(file)
+	if err != nil {
+		return "", err
+	}
+	if policy != nil && policy.Protected && !policy.Expired(file.Mtime, now) {
+		return "policy " + policy.Name + " is protected", nil
+	}
+
+	for _, c := range append([]*File{file}, others...) {
+		policy, err := resolver.PolicyFor(c)
+		if err != nil {
+			return "", err
+		}
+		if policy != nil && !policy.Expired(c.Mtime, now) && len(others) < policy.MinCopies {
+			return fmt.Sprintf("policy %s requires %d copies", policy.Name, policy.MinCopies), nil
+		}
+	}
+	return "", nil
+}
+
+func setFileStatusTx(tx *sql.Tx, fileID int64, from, to entities.StatusName) error {
+	if !entities.CanTransitionFile(from, to) {
+		return fmt.Errorf("file %d: cannot change status from %s to %s", fileID, from, to)
+	}
+	res, err := tx.Exec(`
+	UPDATE files SET status = ?, status_updated_at = strftime('%s', 'now')
+	WHERE id = ? AND status = ?
+	`, to, fileID, from)
+	if err != nil {
+		return err
+	}
+	return checkStatusUpdated(res, "file", fileID)
+}
+
+func setFolderStatusTx(tx *sql.Tx, folderID int64, from, to entities.StatusName) error {
+	if !entities.CanTransitionFolder(from, to) {
+		return fmt.Errorf("folder %d: cannot change status from %s to %s", folderID, from, to)
+	}
+	res, err := tx.Exec(`
+	UPDATE folders SET status = ?, status_updated_at = strftime('%s', 'now')
+	WHERE id = ? AND status = ?
+	`, to, folderID, from)
+	if err != nil {
+		return err
+	}
+	return checkStatusUpdated(res, "folder", folderID)
+}
+
+func checkStatusUpdated(res sql.Result, kind string, id int64) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %d: status changed concurrently", kind, id)
+	}
+	return nil
+}
+
+func queryIDs(db *sql.DB, query string, args ...interface{}) ([]int64, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func queryStrings(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
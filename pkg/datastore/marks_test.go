@@ -0,0 +1,122 @@
+package datastore
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestFindMarkTargetsCaseInsensitiveRoot(t *testing.T) {
+	db := openTestDB(t)
+	hostID := addTestHost(t, db, "laptop")
+	root := addTestRoot(t, db, hostID, "/data/Photos", true)
+	folderID := addTestFolder(t, db, root, "/data/Photos/Trip", nil)
+	fileID := addTestFile(t, db, root, folderID, "/data/Photos/Trip/IMG_1.jpg", "h1", 10)
+
+	targets, err := FindMarkTargets(db, hostID, "/data/photos/trip/img_1.JPG")
+	if err != nil {
+		t.Fatalf("file typed in another case: %v", err)
+	}
+	if len(targets.FileIDs) != 1 || targets.FileIDs[0] != fileID {
+		t.Fatalf("got files %v, want [%d]", targets.FileIDs, fileID)
+	}
+
+	targets, err = FindMarkTargets(db, hostID, "/DATA/PHOTOS/TRIP")
+	if err != nil {
+		t.Fatalf("folder typed in another case: %v", err)
+	}
+	if len(targets.FolderIDs) != 1 || targets.FolderIDs[0] != folderID || len(targets.FileIDs) != 1 {
+		t.Fatalf("got folders %v files %v, want the folder and its file", targets.FolderIDs, targets.FileIDs)
+	}
+}
+
+func TestFindMarkTargetsFoldsNonASCII(t *testing.T) {
+	db := openTestDB(t)
+	hostID := addTestHost(t, db, "laptop")
+	root := addTestRoot(t, db, hostID, "/data", true)
+	folderID := addTestFolder(t, db, root, "/data/Études", nil)
+	fileID := addTestFile(t, db, root, folderID, "/data/Études/Ärger.txt", "h1", 10)
+
+	targets, err := FindMarkTargets(db, hostID, "/data/études/ärger.TXT")
+	if err != nil {
+		t.Fatalf("file typed in another case: %v", err)
+	}
+	if len(targets.FileIDs) != 1 || targets.FileIDs[0] != fileID {
+		t.Fatalf("got files %v, want [%d]", targets.FileIDs, fileID)
+	}
+}
+
+func TestMigrationV18FoldsExistingPaths(t *testing.T) {
+	db := openTestDB(t)
+	hostID := addTestHost(t, db, "laptop")
+	root := addTestRoot(t, db, hostID, "/data", true)
+	folderID := addTestFolder(t, db, root, "/data/Trip", nil)
+	fileID := addTestFile(t, db, root, folderID, "/data/Trip/IMG_1.jpg", "h1", 10)
+
+	// Catalogs written before V18 have no folded paths
+	if err := migrationV18Down(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrationV18Up(db); err != nil {
+		t.Fatal(err)
+	}
+
+	targets, err := FindMarkTargets(db, hostID, "/DATA/trip/img_1.jpg")
+	if err != nil {
+		t.Fatalf("file catalogued before the migration: %v", err)
+	}
+	if len(targets.FileIDs) != 1 || targets.FileIDs[0] != fileID {
+		t.Fatalf("got files %v, want [%d]", targets.FileIDs, fileID)
+	}
+}
+
+func TestFindMarkTargetsCaseSensitiveRoot(t *testing.T) {
+	db := openTestDB(t)
+	hostID := addTestHost(t, db, "server")
+	root := addTestRoot(t, db, hostID, "/srv/share", false)
+	folderID := addTestFolder(t, db, root, "/srv/share", nil)
+	addTestFile(t, db, root, folderID, "/srv/share/Report.txt", "h1", 10)
+
+	if _, err := FindMarkTargets(db, hostID, "/srv/share/report.txt"); err != sql.ErrNoRows {
+		t.Fatalf("got %v, want sql.ErrNoRows for another case on a case-sensitive root", err)
+	}
+	if _, err := FindMarkTargets(db, hostID, "/srv/share/Report.txt"); err != nil {
+		t.Fatalf("exact path: %v", err)
+	}
+}
+
+func TestFindMarkTargetsOtherHost(t *testing.T) {
+	db := openTestDB(t)
+	local := addTestHost(t, db, "laptop")
+	other := addTestHost(t, db, "server")
+	root := addTestRoot(t, db, other, "/srv/share", true)
+	folderID := addTestFolder(t, db, root, "/srv/share", nil)
+	addTestFile(t, db, root, folderID, "/srv/share/a.txt", "h1", 10)
+
+	if _, err := FindMarkTargets(db, local, "/srv/share/A.TXT"); err != sql.ErrNoRows {
+		t.Fatalf("got %v, want sql.ErrNoRows for a path of another host", err)
+	}
+}
+
+func TestGetMarkedFilesOtherHost(t *testing.T) {
+	db := openTestDB(t)
+	local := addTestHost(t, db, "laptop")
+	other := addTestHost(t, db, "server")
+	var marked []int64
+	for _, hostID := range []int64{local, other} {
+		root := addTestRoot(t, db, hostID, "/data", false)
+		folderID := addTestFolder(t, db, root, "/data", nil)
+		addTestFile(t, db, root, folderID, "/data/a.txt", "h1", 10)
+		marked = append(marked, addTestFile(t, db, root, folderID, "/data/b.txt", "h1", 10))
+	}
+	if _, err := MarkForDeletion(db, &MarkTargets{FileIDs: marked}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := GetMarkedFiles(db, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].ID != marked[0] {
+		t.Fatalf("got %d marked files, want only file %d of the local host", len(files), marked[0])
+	}
+}
@@ -0,0 +1,206 @@
+package datastore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+// Owners, purposes, policies and hosts are named metadata records that
+// share one table layout. Names are unique regardless of case.
+const createNamedTableSQL = `
+CREATE TABLE IF NOT EXISTS %s (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    description TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL DEFAULT (strftime('%%s', 'now')),
+    updated_at INTEGER NOT NULL DEFAULT (strftime('%%s', 'now'))
+);`
+
+// Metadata tables
+const (
+	OwnersTable   = "owners"
+	PurposesTable = "purposes"
+	PoliciesTable = "policies"
+	HostsTable    = "hosts"
+)
+
+var (
+	// ErrExists is returned when a record with the same name already exists
+	ErrExists = errors.New("already exists")
+	// ErrInvalid is returned when a record fails validation
+	ErrInvalid = errors.New("invalid")
+)
+
+// namedRecord is the common layout of the metadata entities
+type namedRecord struct {
+	Id          int
+	Name        string
+	Description string
+}
+
+func validateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%w: name must not be empty", ErrInvalid)
+	}
+	return nil
+}
+
+func getNamedRecords(db *sql.DB, table string) ([]namedRecord, error) {
+	rows, err := db.Query(`SELECT id, name, description FROM ` + table + ` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []namedRecord{}
+	for rows.Next() {
+		var r namedRecord
+		if err := rows.Scan(&r.Id, &r.Name, &r.Description); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// getNamedRecord returns sql.ErrNoRows when no record has the name
+func getNamedRecord(db *sql.DB, table, name string) (namedRecord, error) {
+	var r namedRecord
+	err := db.QueryRow(`SELECT id, name, description FROM `+table+` WHERE name = ?`, name).
+		Scan(&r.Id, &r.Name, &r.Description)
+	return r, err
+}
+
+// checkNameFree returns ErrExists when a record other than selfID has the name
+func checkNameFree(db *sql.DB, table, name string, selfID int) error {
+	existing, err := getNamedRecord(db, table, name)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Id != selfID {
+		return fmt.Errorf("%q %w", existing.Name, ErrExists)
+	}
+	return nil
+}
+
+func insertNamedRecord(db *sql.DB, table string, r namedRecord) (namedRecord, error) {
+	if err := validateName(r.Name); err != nil {
+		return namedRecord{}, err
+	}
+	if err := checkNameFree(db, table, r.Name, 0); err != nil {
+		return namedRecord{}, err
+	}
+
+	err := db.QueryRow(`INSERT INTO `+table+` (name, description) VALUES (?, ?) RETURNING id`,
+		r.Name, r.Description).Scan(&r.Id)
+	return r, err
+}
+
+// updateNamedRecord renames and redescribes the record called name;
+// returns sql.ErrNoRows when it does not exist
+func updateNamedRecord(db *sql.DB, table, name string, r namedRecord) (namedRecord, error) {
+	if err := validateName(r.Name); err != nil {
+		return namedRecord{}, err
+	}
+	current, err := getNamedRecord(db, table, name)
+	if err != nil {
+		return namedRecord{}, err
+	}
+	if err := checkNameFree(db, table, r.Name, current.Id); err != nil {
+		return namedRecord{}, err
+	}
+
+	_, err = db.Exec(`UPDATE `+table+` SET name = ?, description = ?, updated_at = strftime('%s', 'now') WHERE id = ?`,
+		r.Name, r.Description, current.Id)
+	r.Id = current.Id
+	return r, err
+}
+
+// deleteNamedRecord returns sql.ErrNoRows when no record has the name
+func deleteNamedRecord(db *sql.DB, table, name string) error {
+	res, err := db.Exec(`DELETE FROM `+table+` WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetOwners lists all owners by name
+func GetOwners(db *sql.DB) ([]entities.Owner, error) {
+	records, err := getNamedRecords(db, OwnersTable)
+	items := make([]entities.Owner, len(records))
+	for i, r := range records {
+		items[i] = entities.Owner(r)
+	}
+	return items, err
+}
+
+// GetOwner retrieves an owner by name
+func GetOwner(db *sql.DB, name string) (entities.Owner, error) {
+	r, err := getNamedRecord(db, OwnersTable, name)
+	return entities.Owner(r), err
+}
+
+// InsertOwner creates an owner
+func InsertOwner(db *sql.DB, item entities.Owner) (entities.Owner, error) {
+	r, err := insertNamedRecord(db, OwnersTable, namedRecord(item))
+	return entities.Owner(r), err
+}
+
+// UpdateOwner replaces the name and description of the owner called name
+func UpdateOwner(db *sql.DB, name string, item entities.Owner) (entities.Owner, error) {
+	r, err := updateNamedRecord(db, OwnersTable, name, namedRecord(item))
+	return entities.Owner(r), err
+}
+
+// DeleteOwner removes an owner by name
+func DeleteOwner(db *sql.DB, name string) error {
+	return deleteNamedRecord(db, OwnersTable, name)
+}
+
+// GetPurposes lists all purposes by name
+func GetPurposes(db *sql.DB) ([]entities.Purpose, error) {
+	records, err := getNamedRecords(db, PurposesTable)
+	items := make([]entities.Purpose, len(records))
+	for i, r := range records {
+		items[i] = entities.Purpose(r)
+	}
+	return items, err
+}
+
+// GetPurpose retrieves a purpose by name
+func GetPurpose(db *sql.DB, name string) (entities.Purpose, error) {
+	r, err := getNamedRecord(db, PurposesTable, name)
+	return entities.Purpose(r), err
+}
+
+// InsertPurpose creates a purpose
+func InsertPurpose(db *sql.DB, item entities.Purpose) (entities.Purpose, error) {
+	r, err := insertNamedRecord(db, PurposesTable, namedRecord(item))
+	return entities.Purpose(r), err
+}
+
+// UpdatePurpose replaces the name and description of the purpose called name
+func UpdatePurpose(db *sql.DB, name string, item entities.Purpose) (entities.Purpose, error) {
+	r, err := updateNamedRecord(db, PurposesTable, name, namedRecord(item))
+	return entities.Purpose(r), err
+}
+
+// DeletePurpose removes a purpose by name
+func DeletePurpose(db *sql.DB, name string) error {
+	return deleteNamedRecord(db, PurposesTable, name)
+}
@@ -1,10 +1,15 @@
 package datastore
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/jpconstantineau/dupectl/pkg/entities"
 	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
 )
 
 // Migration represents a database schema version
@@ -22,6 +27,108 @@ var migrations = []Migration{
 		Up:          migrationV1Up,
 		Down:        migrationV1Down,
 	},
+	{
+		Version:     2,
+		Description: "Add per-root case sensitivity (root_folders.case_insensitive)",
+		Up:          migrationV2Up,
+		Down:        migrationV2Down,
+	},
+	{
+		Version:     3,
+		Description: "Create duplicate verification tables (duplicate_verifications, verification_files)",
+		Up:          migrationV3Up,
+		Down:        migrationV3Down,
+	},
+	{
+		Version:     4,
+		Description: "Add deletion workflow status to files and folders",
+		Up:          migrationV4Up,
+		Down:        migrationV4Down,
+	},
+	{
+		Version:     5,
+		Description: "Create remediation journal table (remediation_journal)",
+		Up:          migrationV5Up,
+		Down:        migrationV5Down,
+	},
+	{
+		Version:     6,
+		Description: "Create quarantine table (quarantine)",
+		Up:          migrationV6Up,
+		Down:        migrationV6Down,
+	},
+	{
+		Version:     7,
+		Description: "Record replaced file attributes in the remediation journal for link reversal",
+		Up:          migrationV7Up,
+		Down:        migrationV7Down,
+	},
+	{
+		Version:     8,
+		Description: "Create metadata tables (owners, purposes, policies, hosts)",
+		Up:          migrationV8Up,
+		Down:        migrationV8Down,
+	},
+	{
+		Version:     9,
+		Description: "Assign owner, purpose and policy to root folders and folders",
+		Up:          migrationV9Up,
+		Down:        migrationV9Down,
+	},
+	{
+		Version:     10,
+		Description: "Add retention rules to policies",
+		Up:          migrationV10Up,
+		Down:        migrationV10Down,
+	},
+	{
+		Version:     11,
+		Description: "Record the filesystem device of root folders (root_folders.device)",
+		Up:          migrationV11Up,
+		Down:        migrationV11Down,
+	},
+	{
+		Version:     12,
+		Description: "Link root folders and agents to hosts; key root folders by (host, path)",
+		Up:          migrationV12Up,
+		Down:        migrationV12Down,
+	},
+	{
+		Version:     13,
+		Description: "Create scan job queue table (scan_jobs)",
+		Up:          migrationV13Up,
+		Down:        migrationV13Down,
+	},
+	{
+		Version:     14,
+		Description: "Record agent heartbeats (agents.version, hostname, platform, activity) and job agents",
+		Up:          migrationV14Up,
+		Down:        migrationV14Down,
+	},
+	{
+		Version:     15,
+		Description: "Add agent approval and per-agent credentials (agents.approval, credential_hash)",
+		Up:          migrationV15Up,
+		Down:        migrationV15Down,
+	},
+	{
+		Version:     16,
+		Description: "Record files replaced by links (files.link_kind, link_target)",
+		Up:          migrationV16Up,
+		Down:        migrationV16Down,
+	},
+	{
+		Version:     17,
+		Description: "Grant the admin role to agents (agents.admin)",
+		Up:          migrationV17Up,
+		Down:        migrationV17Down,
+	},
+	{
+		Version:     18,
+		Description: "Index case-folded paths (files.folded_path, folders.folded_path, quarantine.folded_original_path)",
+		Up:          migrationV18Up,
+		Down:        migrationV18Down,
+	},
 }
 
 // RunMigrations runs all pending migrations
@@ -158,3 +265,798 @@ func migrationV1Down(db *sql.DB) error {
 	}
 	return nil
 }
+
+// Migration V2: Per-root case sensitivity
+func migrationV2Up(db *sql.DB) error {
+	_, err := db.Exec("ALTER TABLE root_folders ADD COLUMN case_insensitive INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return fmt.Errorf("failed to add case_insensitive column: %w", err)
+	}
+
+	// Roots registered before detection existed get the platform default
+	if pathutil.DefaultCaseInsensitive() {
+		_, err = db.Exec("UPDATE root_folders SET case_insensitive = 1")
+		if err != nil {
+			return fmt.Errorf("failed to set case_insensitive default: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV2Down(db *sql.DB) error {
+	_, err := db.Exec("ALTER TABLE root_folders DROP COLUMN case_insensitive")
+	return err
+}
+
+// Migration V3: Byte-for-byte duplicate verification results
+func migrationV3Up(db *sql.DB) error {
+	tables := []string{
+		CreateDuplicateVerificationsTableSQL,
+		CreateVerificationFilesTableSQL,
+	}
+	for _, query := range tables {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_verification_files_verification ON verification_files(verification_id)",
+		"CREATE INDEX IF NOT EXISTS idx_verification_files_file ON verification_files(file_id)",
+	}
+	for _, query := range indexes {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV3Down(db *sql.DB) error {
+	queries := []string{
+		"DROP TABLE IF EXISTS verification_files",
+		"DROP TABLE IF EXISTS duplicate_verifications",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migration V4: Deletion workflow status on files and folders
+func migrationV4Up(db *sql.DB) error {
+	queries := []string{
+		fmt.Sprintf("ALTER TABLE files ADD COLUMN status INTEGER NOT NULL DEFAULT %d", entities.StatusSynced),
+		"ALTER TABLE files ADD COLUMN status_updated_at INTEGER",
+		fmt.Sprintf("ALTER TABLE folders ADD COLUMN status INTEGER NOT NULL DEFAULT %d", entities.StatusSynced),
+		"ALTER TABLE folders ADD COLUMN status_updated_at INTEGER",
+		"CREATE INDEX IF NOT EXISTS idx_files_status ON files(status)",
+		"CREATE INDEX IF NOT EXISTS idx_folders_status ON folders(status)",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add status columns: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV4Down(db *sql.DB) error {
+	queries := []string{
+		"DROP INDEX IF EXISTS idx_folders_status",
+		"DROP INDEX IF EXISTS idx_files_status",
+		"ALTER TABLE folders DROP COLUMN status_updated_at",
+		"ALTER TABLE folders DROP COLUMN status",
+		"ALTER TABLE files DROP COLUMN status_updated_at",
+		"ALTER TABLE files DROP COLUMN status",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migration V5: Remediation journal
+func migrationV5Up(db *sql.DB) error {
+	if _, err := db.Exec(CreateRemediationJournalTableSQL); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_remediation_journal_run ON remediation_journal(run_id)",
+		"CREATE INDEX IF NOT EXISTS idx_remediation_journal_file ON remediation_journal(file_id)",
+	}
+	for _, query := range indexes {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV5Down(db *sql.DB) error {
+	_, err := db.Exec("DROP TABLE IF EXISTS remediation_journal")
+	return err
+}
+
+// Migration V6: Quarantined files
+func migrationV6Up(db *sql.DB) error {
+	if _, err := db.Exec(CreateQuarantineTableSQL); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_quarantine_status ON quarantine(status, quarantined_at)",
+		"CREATE INDEX IF NOT EXISTS idx_quarantine_original ON quarantine(original_path)",
+		"CREATE INDEX IF NOT EXISTS idx_quarantine_run ON quarantine(run_id)",
+	}
+	for _, query := range indexes {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV6Down(db *sql.DB) error {
+	_, err := db.Exec("DROP TABLE IF EXISTS quarantine")
+	return err
+}
+
+// Migration V7: Reversible link remediation
+func migrationV7Up(db *sql.DB) error {
+	queries := []string{
+		"ALTER TABLE remediation_journal ADD COLUMN file_mode INTEGER",
+		"ALTER TABLE remediation_journal ADD COLUMN file_mtime INTEGER",
+		"ALTER TABLE remediation_journal ADD COLUMN undo_of INTEGER REFERENCES remediation_journal(id)",
+		"CREATE INDEX IF NOT EXISTS idx_remediation_journal_undo ON remediation_journal(undo_of)",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to extend remediation_journal: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV7Down(db *sql.DB) error {
+	queries := []string{
+		"DROP INDEX IF EXISTS idx_remediation_journal_undo",
+		"ALTER TABLE remediation_journal DROP COLUMN undo_of",
+		"ALTER TABLE remediation_journal DROP COLUMN file_mtime",
+		"ALTER TABLE remediation_journal DROP COLUMN file_mode",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migration V8: Owner, purpose, policy and host metadata
+func migrationV8Up(db *sql.DB) error {
+	for _, table := range []string{OwnersTable, PurposesTable, PoliciesTable, HostsTable} {
+		if _, err := db.Exec(fmt.Sprintf(createNamedTableSQL, table)); err != nil {
+			return fmt.Errorf("failed to create table %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func migrationV8Down(db *sql.DB) error {
+	for _, table := range []string{HostsTable, PoliciesTable, PurposesTable, OwnersTable} {
+		if _, err := db.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migration V9: Metadata assignment with inheritance down the folder tree
+func migrationV9Up(db *sql.DB) error {
+	columns := []string{
+		"owner_id INTEGER REFERENCES owners(id) ON DELETE SET NULL",
+		"purpose_id INTEGER REFERENCES purposes(id) ON DELETE SET NULL",
+		"policy_id INTEGER REFERENCES policies(id) ON DELETE SET NULL",
+	}
+	for _, table := range []string{"root_folders", "folders"} {
+		for _, column := range columns {
+			if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column); err != nil {
+				return fmt.Errorf("failed to extend %s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+func migrationV9Down(db *sql.DB) error {
+	for _, table := range []string{"folders", "root_folders"} {
+		for _, column := range []string{"policy_id", "purpose_id", "owner_id"} {
+			if _, err := db.Exec("ALTER TABLE " + table + " DROP COLUMN " + column); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func migrationV10Up(db *sql.DB) error {
+	columns := []string{
+		"priority INTEGER NOT NULL DEFAULT 0",
+		"min_copies INTEGER NOT NULL DEFAULT 0",
+		"max_age_days INTEGER NOT NULL DEFAULT 0",
+		"protected INTEGER NOT NULL DEFAULT 0",
+	}
+	for _, column := range columns {
+		if _, err := db.Exec("ALTER TABLE policies ADD COLUMN " + column); err != nil {
+			return fmt.Errorf("failed to extend policies: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV10Down(db *sql.DB) error {
+	for _, column := range []string{"protected", "max_age_days", "min_copies", "priority"} {
+		if _, err := db.Exec("ALTER TABLE policies DROP COLUMN " + column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrationV11Up(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE root_folders ADD COLUMN device TEXT NOT NULL DEFAULT ''"); err != nil {
+		return fmt.Errorf("failed to add device column: %w", err)
+	}
+
+	// Record the device of roots that are reachable now; the others are
+	// filled in by their next scan
+	rows, err := db.Query("SELECT id, path FROM root_folders")
+	if err != nil {
+		return err
+	}
+	devices := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			rows.Close()
+			return err
+		}
+		if device, err := pathutil.DeviceID(path); err == nil {
+			devices[id] = device
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, device := range devices {
+		if _, err := db.Exec("UPDATE root_folders SET device = ? WHERE id = ?", device, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrationV11Down(db *sql.DB) error {
+	_, err := db.Exec("ALTER TABLE root_folders DROP COLUMN device")
+	return err
+}
+
+// Migration V12: Hosts own root folders and agents. Paths are only unique
+// per host, so root_folders, folders and files are rebuilt to replace their
+// global UNIQUE(path) with a per-host (or per-root) key.
+func migrationV12Up(db *sql.DB) error {
+	queries := []string{
+		"ALTER TABLE hosts ADD COLUMN machine_id TEXT",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_hosts_machine_id ON hosts(machine_id) WHERE machine_id IS NOT NULL",
+		// The agents table used to be created outside the migrations
+		`CREATE TABLE IF NOT EXISTS agents (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			guid TEXT NOT NULL,
+			enabled INTEGER,
+			updated INTEGER,
+			status INTEGER
+			)`,
+		"ALTER TABLE agents ADD COLUMN host_id INTEGER REFERENCES hosts(id) ON DELETE SET NULL",
+		"ALTER TABLE root_folders ADD COLUMN host_id INTEGER REFERENCES hosts(id)",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add host columns: %w", err)
+		}
+	}
+
+	// Existing root folders were registered on this machine
+	hostID, err := migrationLocalHost(db)
+	if err != nil {
+		return fmt.Errorf("failed to register local host: %w", err)
+	}
+	if _, err := db.Exec("UPDATE root_folders SET host_id = ?", hostID); err != nil {
+		return err
+	}
+
+	err = rebuildTables(db, func(ctx context.Context, conn *sql.Conn) error {
+		if err := rebuildTable(ctx, conn, "root_folders", func(ddl string) (string, error) {
+			return editDDL(ddl,
+				replaceDDL("path TEXT NOT NULL UNIQUE", "path TEXT NOT NULL"),
+				replaceDDL("host_id INTEGER REFERENCES hosts(id)", "host_id INTEGER NOT NULL REFERENCES hosts(id)"),
+				appendDDL("UNIQUE (host_id, path)"))
+		}); err != nil {
+			return err
+		}
+		for _, table := range []string{"folders", "files"} {
+			if err := rebuildTable(ctx, conn, table, func(ddl string) (string, error) {
+				return editDDL(ddl,
+					replaceDDL("path TEXT NOT NULL UNIQUE", "path TEXT NOT NULL"),
+					appendDDL("UNIQUE (root_folder_id, path)"))
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE INDEX IF NOT EXISTS idx_root_folders_host ON root_folders(host_id)")
+	return err
+}
+
+func migrationV12Down(db *sql.DB) error {
+	if _, err := db.Exec("DROP INDEX IF EXISTS idx_root_folders_host"); err != nil {
+		return err
+	}
+	err := rebuildTables(db, func(ctx context.Context, conn *sql.Conn) error {
+		for _, table := range []string{"files", "folders"} {
+			if err := rebuildTable(ctx, conn, table, func(ddl string) (string, error) {
+				return editDDL(ddl,
+					removeDDL(",\n    UNIQUE (root_folder_id, path)"),
+					replaceDDL("path TEXT NOT NULL,", "path TEXT NOT NULL UNIQUE,"))
+			}); err != nil {
+				return err
+			}
+		}
+		if err := rebuildTable(ctx, conn, "root_folders", func(ddl string) (string, error) {
+			return editDDL(ddl,
+				removeDDL(",\n    UNIQUE (host_id, path)"),
+				removeDDL(", host_id INTEGER NOT NULL REFERENCES hosts(id)"),
+				replaceDDL("path TEXT NOT NULL,", "path TEXT NOT NULL UNIQUE,"))
+		}); err != nil {
+			return err
+		}
+		return rebuildTable(ctx, conn, "agents", func(ddl string) (string, error) {
+			return editDDL(ddl, removeDDL(", host_id INTEGER REFERENCES hosts(id) ON DELETE SET NULL"))
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	queries := []string{
+		"DROP INDEX IF EXISTS idx_hosts_machine_id",
+		"ALTER TABLE hosts DROP COLUMN machine_id",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrationLocalHost returns the host record of this machine, adopting a
+// host of the same name created by hand before hosts were registered
+func migrationLocalHost(db *sql.DB) (int64, error) {
+	machineID := LocalMachineID()
+	name, err := os.Hostname()
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = db.QueryRow("SELECT id FROM hosts WHERE name = ?", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = db.QueryRow("INSERT INTO hosts (name) VALUES (?) RETURNING id", name).Scan(&id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	_, err = db.Exec("UPDATE hosts SET machine_id = ? WHERE id = ?", machineID, id)
+	return id, err
+}
+
+// rebuildTables runs table rebuilds in one transaction on a connection with
+// foreign key enforcement off, as SQLite requires when a table is replaced,
+// and checks the references are intact before committing
+func rebuildTables(db *sql.DB, rebuild func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	if err := rebuild(ctx, conn); err != nil {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+	broken := rows.Next()
+	rows.Close()
+	if broken {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return fmt.Errorf("foreign key check failed after rebuilding tables")
+	}
+
+	_, err = conn.ExecContext(ctx, "COMMIT")
+	return err
+}
+
+// rebuildTable recreates a table from its stored definition as changed by
+// edit, for schema changes ALTER TABLE cannot make such as a new unique key.
+// Columns dropped by the edit are not copied; indexes are recreated.
+func rebuildTable(ctx context.Context, conn *sql.Conn, table string, edit func(ddl string) (string, error)) error {
+	var ddl string
+	err := conn.QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&ddl)
+	if err != nil {
+		return fmt.Errorf("failed to read definition of %s: %w", table, err)
+	}
+
+	var indexes []string
+	rows, err := conn.QueryContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var index string
+		if err := rows.Scan(&index); err != nil {
+			rows.Close()
+			return err
+		}
+		indexes = append(indexes, index)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ddl, err = edit(ddl)
+	if err != nil {
+		return fmt.Errorf("failed to edit definition of %s: %w", table, err)
+	}
+	// A table renamed by an earlier rebuild has its name stored quoted
+	body, ok := strings.CutPrefix(ddl, "CREATE TABLE "+table+" (")
+	if !ok {
+		body, ok = strings.CutPrefix(ddl, `CREATE TABLE "`+table+`" (`)
+	}
+	if !ok {
+		return fmt.Errorf("unexpected definition of %s", table)
+	}
+	temp := table + "_new"
+	if _, err := conn.ExecContext(ctx, "CREATE TABLE "+temp+" ("+body); err != nil {
+		return fmt.Errorf("failed to create %s: %w", temp, err)
+	}
+
+	var columns []string
+	rows, err = conn.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", temp)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return err
+		}
+		columns = append(columns, column)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	list := strings.Join(columns, ", ")
+	queries := []string{
+		"INSERT INTO " + temp + " (" + list + ") SELECT " + list + " FROM " + table,
+		"DROP TABLE " + table,
+		"ALTER TABLE " + temp + " RENAME TO " + table,
+	}
+	for _, query := range append(queries, indexes...) {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to rebuild %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// ddlEdit changes a stored table definition
+type ddlEdit func(ddl string) (string, error)
+
+// editDDL applies edits in order
+func editDDL(ddl string, edits ...ddlEdit) (string, error) {
+	for _, edit := range edits {
+		var err error
+		if ddl, err = edit(ddl); err != nil {
+			return "", err
+		}
+	}
+	return ddl, nil
+}
+
+// replaceDDL replaces the first occurrence of old, which must be present
+func replaceDDL(old, new string) ddlEdit {
+	return func(ddl string) (string, error) {
+		if !strings.Contains(ddl, old) {
+			return "", fmt.Errorf("%q not found", old)
+		}
+		return strings.Replace(ddl, old, new, 1), nil
+	}
+}
+
+// removeDDL removes the first occurrence of text, which must be present
+func removeDDL(text string) ddlEdit {
+	return replaceDDL(text, "")
+}
+
+// appendDDL adds a table constraint after the last column or constraint
+func appendDDL(constraint string) ddlEdit {
+	return func(ddl string) (string, error) {
+		end := strings.LastIndex(ddl, ")")
+		if end < 0 {
+			return "", fmt.Errorf("malformed definition")
+		}
+		return strings.TrimRight(ddl[:end], " \n") + ",\n    " + constraint + "\n)" + ddl[end+1:], nil
+	}
+}
+
+// Migration V13: Scan jobs leased by agents
+func migrationV13Up(db *sql.DB) error {
+	if _, err := db.Exec(CreateScanJobsTableSQL); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	indexes := []string{
+		"CREATE INDEX IF NOT EXISTS idx_scan_jobs_status ON scan_jobs(status, id)",
+		"CREATE INDEX IF NOT EXISTS idx_scan_jobs_root ON scan_jobs(root_folder_id)",
+	}
+	for _, query := range indexes {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV13Down(db *sql.DB) error {
+	_, err := db.Exec("DROP TABLE IF EXISTS scan_jobs")
+	return err
+}
+
+// Migration V14: Agent heartbeats. Registration used to store agents as
+// disabled although nothing checked it, so all agents start enabled.
+func migrationV14Up(db *sql.DB) error {
+	queries := []string{
+		"ALTER TABLE agents ADD COLUMN version TEXT",
+		"ALTER TABLE agents ADD COLUMN hostname TEXT",
+		"ALTER TABLE agents ADD COLUMN platform TEXT",
+		"ALTER TABLE agents ADD COLUMN activity TEXT",
+		"UPDATE agents SET enabled = 1",
+		"ALTER TABLE scan_jobs ADD COLUMN agent_id INTEGER",
+		"CREATE INDEX IF NOT EXISTS idx_scan_jobs_agent ON scan_jobs(agent_id)",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add heartbeat columns: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV14Down(db *sql.DB) error {
+	queries := []string{
+		"DROP INDEX IF EXISTS idx_scan_jobs_agent",
+		"ALTER TABLE scan_jobs DROP COLUMN agent_id",
+		"ALTER TABLE agents DROP COLUMN activity",
+		"ALTER TABLE agents DROP COLUMN platform",
+		"ALTER TABLE agents DROP COLUMN hostname",
+		"ALTER TABLE agents DROP COLUMN version",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migration V15: Agents were accepted by anyone holding the shared API key,
+// so existing agents hold no credential and must register again
+func migrationV15Up(db *sql.DB) error {
+	queries := []string{
+		"ALTER TABLE agents ADD COLUMN approval TEXT NOT NULL DEFAULT 'pending'",
+		"ALTER TABLE agents ADD COLUMN credential_hash TEXT",
+		fmt.Sprintf("UPDATE agents SET status = %d", entities.StatusPending),
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add agent approval columns: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV15Down(db *sql.DB) error {
+	queries := []string{
+		"ALTER TABLE agents DROP COLUMN credential_hash",
+		"ALTER TABLE agents DROP COLUMN approval",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migration V16: Files replaced by links kept looking like independent
+// copies, so the links already made are recovered from the journal
+func migrationV16Up(db *sql.DB) error {
+	queries := []string{
+		"ALTER TABLE files ADD COLUMN link_kind TEXT",
+		"ALTER TABLE files ADD COLUMN link_target TEXT",
+		fmt.Sprintf(`UPDATE files SET
+			link_kind = SUBSTR(j.action, 6),
+			link_target = j.keeper_path
+		FROM (
+			SELECT file_id, action, keeper_path, MAX(id) AS id FROM remediation_journal
+			WHERE action IN ('%s', '%s', '%s') AND result = '%s'
+			GROUP BY file_id
+		) AS j
+		WHERE files.id = j.file_id
+		  AND NOT EXISTS (SELECT 1 FROM remediation_journal u WHERE u.undo_of = j.id AND u.result = '%s')`,
+			JournalActionLinkHard, JournalActionLinkReflink, JournalActionLinkSymlink, JournalResultDone,
+			JournalResultDone),
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add file link columns: %w", err)
+		}
+	}
+	return nil
+}
+
+func migrationV16Down(db *sql.DB) error {
+	queries := []string{
+		"ALTER TABLE files DROP COLUMN link_target",
+		"ALTER TABLE files DROP COLUMN link_kind",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migration V17: Every approved agent could administer the server; the
+// admin role is now granted per agent, to none of the existing ones
+func migrationV17Up(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE agents ADD COLUMN admin INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return fmt.Errorf("failed to add agent admin column: %w", err)
+	}
+	return nil
+}
+
+func migrationV17Down(db *sql.DB) error {
+	_, err := db.Exec("ALTER TABLE agents DROP COLUMN admin")
+	return err
+}
+
+// Migration V18: Paths under case-insensitive roots were matched by loading
+// every path of the root. The case-folded spelling of each path is now
+// stored and indexed.
+func migrationV18Up(db *sql.DB) error {
+	for _, table := range []struct{ name, column, source string }{
+		{"files", "folded_path", "path"},
+		{"folders", "folded_path", "path"},
+		{"quarantine", "folded_original_path", "original_path"},
+	} {
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s TEXT", table.name, table.column)); err != nil {
+			return fmt.Errorf("failed to add %s.%s column: %w", table.name, table.column, err)
+		}
+		if err := foldColumn(db, table.name, table.column, table.source); err != nil {
+			return fmt.Errorf("failed to fill %s.%s: %w", table.name, table.column, err)
+		}
+	}
+
+	queries := []string{
+		"CREATE INDEX idx_files_folded_path ON files(root_folder_id, folded_path)",
+		"CREATE INDEX idx_folders_folded_path ON folders(root_folder_id, folded_path)",
+		"CREATE INDEX idx_quarantine_folded_original_path ON quarantine(folded_original_path)",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// foldColumn fills a case-folded column from its source, a batch of rows
+// at a time
+func foldColumn(db *sql.DB, table, column, source string) error {
+	const batch = 1000
+	update := fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, column)
+	for lastID := int64(0); ; {
+		rows, err := db.Query(fmt.Sprintf("SELECT id, %s FROM %s WHERE id > ? ORDER BY id LIMIT ?", source, table), lastID, batch)
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id   int64
+			path string
+		}
+		var read []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.path); err != nil {
+				rows.Close()
+				return err
+			}
+			read = append(read, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, r := range read {
+			if _, err := db.Exec(update, foldPath(r.path), r.id); err != nil {
+				return err
+			}
+			lastID = r.id
+		}
+		if len(read) < batch {
+			return nil
+		}
+	}
+}
+
+func migrationV18Down(db *sql.DB) error {
+	queries := []string{
+		"DROP INDEX IF EXISTS idx_files_folded_path",
+		"DROP INDEX IF EXISTS idx_folders_folded_path",
+		"DROP INDEX IF EXISTS idx_quarantine_folded_original_path",
+		"ALTER TABLE files DROP COLUMN folded_path",
+		"ALTER TABLE folders DROP COLUMN folded_path",
+		"ALTER TABLE quarantine DROP COLUMN folded_original_path",
+	}
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
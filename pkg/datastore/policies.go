@@ -0,0 +1,98 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+// Policies share the named table layout and add their retention rules
+const policyColumns = `id, name, description, priority, min_copies, max_age_days, protected`
+
+func scanPolicy(row rowScanner) (entities.Policy, error) {
+	var p entities.Policy
+	err := row.Scan(&p.Id, &p.Name, &p.Description, &p.Priority, &p.MinCopies, &p.MaxAgeDays, &p.Protected)
+	return p, err
+}
+
+func validatePolicy(p entities.Policy) error {
+	if err := validateName(p.Name); err != nil {
+		return err
+	}
+	if p.MinCopies < 0 {
+		return fmt.Errorf("%w: min_copies must not be negative", ErrInvalid)
+	}
+	if p.MaxAgeDays < 0 {
+		return fmt.Errorf("%w: max_age_days must not be negative", ErrInvalid)
+	}
+	return nil
+}
+
+// GetPolicies lists all retention policies by name
+func GetPolicies(db *sql.DB) ([]entities.Policy, error) {
+	rows, err := db.Query(`SELECT ` + policyColumns + ` FROM ` + PoliciesTable + ` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []entities.Policy{}
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// GetPolicy retrieves a retention policy by name
+func GetPolicy(db *sql.DB, name string) (entities.Policy, error) {
+	return scanPolicy(db.QueryRow(`SELECT `+policyColumns+` FROM `+PoliciesTable+` WHERE name = ?`, name))
+}
+
+// InsertPolicy creates a retention policy
+func InsertPolicy(db *sql.DB, item entities.Policy) (entities.Policy, error) {
+	if err := validatePolicy(item); err != nil {
+		return entities.Policy{}, err
+	}
+	if err := checkNameFree(db, PoliciesTable, item.Name, 0); err != nil {
+		return entities.Policy{}, err
+	}
+
+	err := db.QueryRow(`
+	INSERT INTO `+PoliciesTable+` (name, description, priority, min_copies, max_age_days, protected)
+	VALUES (?, ?, ?, ?, ?, ?) RETURNING id
+	`, item.Name, item.Description, item.Priority, item.MinCopies, item.MaxAgeDays, item.Protected).Scan(&item.Id)
+	return item, err
+}
+
+// UpdatePolicy replaces the name, description and rules of the policy called name
+func UpdatePolicy(db *sql.DB, name string, item entities.Policy) (entities.Policy, error) {
+	if err := validatePolicy(item); err != nil {
+		return entities.Policy{}, err
+	}
+	current, err := GetPolicy(db, name)
+	if err != nil {
+		return entities.Policy{}, err
+	}
+	if err := checkNameFree(db, PoliciesTable, item.Name, current.Id); err != nil {
+		return entities.Policy{}, err
+	}
+
+	_, err = db.Exec(`
+	UPDATE `+PoliciesTable+`
+	SET name = ?, description = ?, priority = ?, min_copies = ?, max_age_days = ?, protected = ?,
+	    updated_at = strftime('%s', 'now')
+	WHERE id = ?
+	`, item.Name, item.Description, item.Priority, item.MinCopies, item.MaxAgeDays, item.Protected, current.Id)
+	item.Id = current.Id
+	return item, err
+}
+
+// DeletePolicy removes a retention policy by name
+func DeletePolicy(db *sql.DB, name string) error {
+	return deleteNamedRecord(db, PoliciesTable, name)
+}
@@ -0,0 +1,148 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+)
+
+// removedFilter selects the removed records of a root, only those last
+// seen before the given Unix time when it is set
+func removedFilter(rootID, before int64) (string, []interface{}) {
+	where := ` WHERE root_folder_id = ? AND removed = 1`
+	args := []interface{}{rootID}
+	if before > 0 {
+		where += ` AND last_scanned_at < ?`
+		args = append(args, before)
+	}
+	return where, args
+}
+
+// CountRemoved counts the file and folder records of a root folder that
+// scans no longer found, as purged by PurgeRemoved
+func CountRemoved(db *sql.DB, rootID, before int64) (entities.PurgeResult, error) {
+	var result entities.PurgeResult
+	where, args := removedFilter(rootID, before)
+	if err := db.QueryRow(`SELECT COUNT(*) FROM files`+where, args...).Scan(&result.Files); err != nil {
+		return result, fmt.Errorf("failed to count removed files: %w", err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM folders`+where, args...).Scan(&result.Folders); err != nil {
+		return result, fmt.Errorf("failed to count removed folders: %w", err)
+	}
+	return result, nil
+}
+
+// PurgeRemoved permanently deletes the removed file records, folder
+// records or both (entities.PurgeFiles, PurgeFolders or PurgeAll) of a root
+// folder, only those last seen before the given Unix time when it is set
+func PurgeRemoved(db *sql.DB, rootID int64, kind string, before int64) (entities.PurgeResult, error) {
+	var result entities.PurgeResult
+	if kind != entities.PurgeFiles && kind != entities.PurgeFolders && kind != entities.PurgeAll {
+		return result, fmt.Errorf("%w: entities must be %s, %s or %s", ErrInvalid,
+			entities.PurgeFiles, entities.PurgeFolders, entities.PurgeAll)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	where, args := removedFilter(rootID, before)
+	purges := []struct {
+		kind  string
+		table string
+		count *int64
+	}{
+		{entities.PurgeFiles, "files", &result.Files},
+		{entities.PurgeFolders, "folders", &result.Folders},
+	}
+	for _, purge := range purges {
+		if kind != purge.kind && kind != entities.PurgeAll {
+			continue
+		}
+		res, err := tx.Exec(`DELETE FROM `+purge.table+where, args...)
+		if err != nil {
+			return result, fmt.Errorf("failed to purge %s: %w", purge.table, err)
+		}
+		if *purge.count, err = res.RowsAffected(); err != nil {
+			return result, err
+		}
+	}
+	return result, tx.Commit()
+}
+
+// MarkUnseenRemoved marks as removed the files and folders of a root at or
+// beneath path that a completed scan of that tree did not see, i.e. last
+// seen before since (Unix time). Entries beneath folders the scan could
+// not read are left alone. Returns the number of folders and files marked.
+func MarkUnseenRemoved(db *sql.DB, root *RootFolder, path string, since int64) (folders, files int64, err error) {
+	unreadable, err := queryStrings(db, `
+	SELECT path FROM folders
+	WHERE root_folder_id = ? AND removed = 0 AND error_status IS NOT NULL AND last_scanned_at >= ?
+	`, root.ID, since)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// unseen selects the entries of a table that the scan should have seen
+	unseen := func(table string) ([]int64, error) {
+		rows, err := db.Query(`SELECT id, path FROM `+table+`
+		WHERE root_folder_id = ? AND removed = 0 AND last_scanned_at < ?`, root.ID, since)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var ids []int64
+	next:
+		for rows.Next() {
+			var id int64
+			var entryPath string
+			if err := rows.Scan(&id, &entryPath); err != nil {
+				return nil, err
+			}
+			if !pathutil.WithinRoot(path, entryPath, root.CaseInsensitive) {
+				continue
+			}
+			for _, folder := range unreadable {
+				if pathutil.WithinRoot(folder, entryPath, root.CaseInsensitive) {
+					continue next
+				}
+			}
+			ids = append(ids, id)
+		}
+		return ids, rows.Err()
+	}
+
+	folderIDs, err := unseen("folders")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to find unseen folders: %w", err)
+	}
+	fileIDs, err := unseen("files")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to find unseen files: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+	for _, id := range folderIDs {
+		if _, err := tx.Exec(`UPDATE folders SET removed = 1 WHERE id = ?`, id); err != nil {
+			return 0, 0, err
+		}
+	}
+	for _, id := range fileIDs {
+		if _, err := tx.Exec(`UPDATE files SET removed = 1 WHERE id = ?`, id); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return int64(len(folderIDs)), int64(len(fileIDs)), nil
+}
@@ -0,0 +1,63 @@
+package datastore
+
+import "testing"
+
+func TestMarkUnseenRemoved(t *testing.T) {
+	db := openTestDB(t)
+	hostID := addTestHost(t, db, "laptop")
+	root := addTestRoot(t, db, hostID, "/data", false)
+	top := addTestFolder(t, db, root, "/data", nil)
+	gone := addTestFolder(t, db, root, "/data/gone", &top)
+	unreadable := addTestFolder(t, db, root, "/data/locked", &top)
+	other := addTestFolder(t, db, root, "/data2", nil)
+	seenFile := addTestFile(t, db, root, top, "/data/a.txt", "h1", 10)
+	goneFile := addTestFile(t, db, root, gone, "/data/gone/b.txt", "h2", 10)
+	lockedFile := addTestFile(t, db, root, unreadable, "/data/locked/c.txt", "h3", 10)
+	otherFile := addTestFile(t, db, root, other, "/data2/d.txt", "h4", 10)
+
+	// The scan started at 100 and saw the top folder, a.txt and the
+	// unreadable folder
+	if _, err := db.Exec(`UPDATE folders SET last_scanned_at = 100 WHERE id IN (?, ?)`, top, unreadable); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE folders SET error_status = 'permission denied' WHERE id = ?`, unreadable); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE files SET last_scanned_at = 100 WHERE id = ?`, seenFile); err != nil {
+		t.Fatal(err)
+	}
+
+	folders, files, err := MarkUnseenRemoved(db, root, "/data", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if folders != 1 || files != 1 {
+		t.Fatalf("marked %d folders and %d files, want 1 and 1", folders, files)
+	}
+
+	removed := func(table string, id int64) bool {
+		var removed bool
+		if err := db.QueryRow(`SELECT removed FROM `+table+` WHERE id = ?`, id).Scan(&removed); err != nil {
+			t.Fatal(err)
+		}
+		return removed
+	}
+	for _, tt := range []struct {
+		table string
+		id    int64
+		want  bool
+	}{
+		{"folders", top, false},
+		{"folders", gone, true},
+		{"folders", unreadable, false},
+		{"folders", other, false},
+		{"files", seenFile, false},
+		{"files", goneFile, true},
+		{"files", lockedFile, false},
+		{"files", otherFile, false},
+	} {
+		if got := removed(tt.table, tt.id); got != tt.want {
+			t.Errorf("%s %d removed = %v, want %v", tt.table, tt.id, got, tt.want)
+		}
+	}
+}
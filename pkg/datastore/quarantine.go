@@ -0,0 +1,195 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+const CreateQuarantineTableSQL = `
+CREATE TABLE IF NOT EXISTS quarantine (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id TEXT NOT NULL,
+    file_id INTEGER,
+    root_folder_id INTEGER,
+    original_path TEXT NOT NULL,
+    quarantine_path TEXT NOT NULL UNIQUE,
+    size INTEGER NOT NULL,
+    mtime INTEGER NOT NULL,
+    hash_value TEXT,
+    hash_algorithm TEXT,
+    status TEXT NOT NULL,
+    quarantined_at INTEGER NOT NULL,
+    resolved_at INTEGER,
+    FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE SET NULL,
+    FOREIGN KEY (root_folder_id) REFERENCES root_folders(id) ON DELETE SET NULL
+);`
+
+// Quarantine entry statuses
+const (
+	QuarantineHeld     = "quarantined" // The file sits in the quarantine directory
+	QuarantineRestored = "restored"    // The file was moved back to its original path
+	QuarantineExpired  = "expired"     // The file was permanently removed after retention
+)
+
+// QuarantineEntry records a file moved into a root's quarantine directory
+type QuarantineEntry struct {
+	ID             int64
+	RunID          string
+	FileID         *int64
+	RootFolderID   *int64
+	OriginalPath   string
+	QuarantinePath string
+	Size           int64
+	Mtime          int64
+	HashValue      *string
+	HashAlgorithm  *string
+	Status         string
+	QuarantinedAt  int64
+	ResolvedAt     *int64 // When the entry was restored or expired
+}
+
+const quarantineColumns = `id, run_id, file_id, root_folder_id, original_path, quarantine_path, size, mtime,
+	       hash_value, hash_algorithm, status, quarantined_at, resolved_at`
+
+func scanQuarantineEntry(row rowScanner) (*QuarantineEntry, error) {
+	e := &QuarantineEntry{}
+	err := row.Scan(&e.ID, &e.RunID, &e.FileID, &e.RootFolderID, &e.OriginalPath, &e.QuarantinePath,
+		&e.Size, &e.Mtime, &e.HashValue, &e.HashAlgorithm, &e.Status, &e.QuarantinedAt, &e.ResolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// InsertQuarantineEntry records a quarantined file
+func InsertQuarantineEntry(db *sql.DB, e *QuarantineEntry) (int64, error) {
+	var id int64
+	err := db.QueryRow(`
+	INSERT INTO quarantine (run_id, file_id, root_folder_id, original_path, folded_original_path,
+	                        quarantine_path, size, mtime, hash_value, hash_algorithm, status, quarantined_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id
+	`, e.RunID, e.FileID, e.RootFolderID, e.OriginalPath, foldPath(e.OriginalPath), e.QuarantinePath, e.Size, e.Mtime,
+		e.HashValue, e.HashAlgorithm, e.Status, e.QuarantinedAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	e.ID = id
+	return id, nil
+}
+
+// GetQuarantineEntry retrieves a quarantine entry by ID
+func GetQuarantineEntry(db *sql.DB, id int64) (*QuarantineEntry, error) {
+	query := `SELECT ` + quarantineColumns + ` FROM quarantine WHERE id = ?`
+	return scanQuarantineEntry(db.QueryRow(query, id))
+}
+
+// GetQuarantineEntries returns quarantine entries with the given status,
+// or all entries when status is empty, oldest first
+func GetQuarantineEntries(db *sql.DB, status string) ([]*QuarantineEntry, error) {
+	query := `SELECT ` + quarantineColumns + ` FROM quarantine WHERE ? = '' OR status = ? ORDER BY id`
+	return queryQuarantineEntries(db, query, status, status)
+}
+
+// GetHeldQuarantineEntriesBy returns entries still in quarantine that were
+// quarantined from originalPath or during the run runID. Original paths
+// under case-insensitive roots match in any case.
+func GetHeldQuarantineEntriesBy(db *sql.DB, originalPath, runID string) ([]*QuarantineEntry, error) {
+	query := `SELECT ` + quarantineColumns + ` FROM quarantine
+	WHERE status = ? AND (run_id = ? OR original_path = ?
+	   OR (folded_original_path = ? AND root_folder_id IN (SELECT id FROM root_folders WHERE case_insensitive = 1)))
+	ORDER BY id`
+	return queryQuarantineEntries(db, query, QuarantineHeld, runID, originalPath, foldPath(originalPath))
+}
+
+// GetHeldQuarantineEntriesBefore returns entries still held that were
+// quarantined no later than the cutoff Unix time
+func GetHeldQuarantineEntriesBefore(db *sql.DB, cutoff int64) ([]*QuarantineEntry, error) {
+	query := `SELECT ` + quarantineColumns + ` FROM quarantine
+	WHERE status = ? AND quarantined_at <= ? ORDER BY id`
+	return queryQuarantineEntries(db, query, QuarantineHeld, cutoff)
+}
+
+func queryQuarantineEntries(db *sql.DB, query string, args ...interface{}) ([]*QuarantineEntry, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*QuarantineEntry
+	for rows.Next() {
+		e, err := scanQuarantineEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// SetQuarantineStatus resolves a held quarantine entry as restored or expired
+func SetQuarantineStatus(db *sql.DB, id int64, status string) error {
+	res, err := db.Exec(`
+	UPDATE quarantine SET status = ?, resolved_at = strftime('%s', 'now')
+	WHERE id = ? AND status = ?
+	`, status, id, QuarantineHeld)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("quarantine entry %d is no longer held", id)
+	}
+	return nil
+}
+
+// DeleteQuarantineEntry removes the record of a quarantine that did not happen
+func DeleteQuarantineEntry(db *sql.DB, id int64) error {
+	_, err := db.Exec(`DELETE FROM quarantine WHERE id = ?`, id)
+	return err
+}
+
+// RestoreFileRecord returns a deleted file, and the folders containing it,
+// to the catalog after the file was moved back to its original path
+func RestoreFileRecord(db *sql.DB, fileID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	file, err := getFileForUpdate(tx, fileID)
+	if err != nil {
+		return err
+	}
+	if err := setFileStatusTx(tx, fileID, file.Status, entities.StatusSynced); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE files SET removed = 0 WHERE id = ?`, fileID); err != nil {
+		return err
+	}
+
+	// Folders emptied by the deletion run were removed too
+	_, err = tx.Exec(`
+	WITH RECURSIVE chain(id) AS (
+		SELECT folder_id FROM files WHERE id = ?
+		UNION
+		SELECT f.parent_folder_id FROM folders f JOIN chain c ON f.id = c.id
+		WHERE f.parent_folder_id IS NOT NULL
+	)
+	UPDATE folders SET removed = 0, status = ?, status_updated_at = strftime('%s', 'now')
+	WHERE id IN (SELECT id FROM chain) AND (removed = 1 OR status = ?)
+	`, fileID, entities.StatusSynced, entities.StatusDeleted)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,46 @@
+package datastore
+
+import "testing"
+
+func TestGetHeldQuarantineEntriesByCase(t *testing.T) {
+	db := openTestDB(t)
+	hostID := addTestHost(t, db, "laptop")
+	insensitive := addTestRoot(t, db, hostID, "/data/Docs", true)
+	sensitive := addTestRoot(t, db, hostID, "/srv/share", false)
+
+	for _, e := range []*QuarantineEntry{
+		{RunID: "run-1", RootFolderID: &insensitive.ID, OriginalPath: "/data/Docs/Report.txt",
+			QuarantinePath: "/data/Docs/.dupectl-quarantine/run-1/Report.txt"},
+		{RunID: "run-2", RootFolderID: &sensitive.ID, OriginalPath: "/srv/share/Report.txt",
+			QuarantinePath: "/srv/share/.dupectl-quarantine/run-2/Report.txt"},
+	} {
+		e.Status = QuarantineHeld
+		if _, err := InsertQuarantineEntry(db, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := GetHeldQuarantineEntriesBy(db, "/data/docs/REPORT.txt", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].RunID != "run-1" {
+		t.Fatalf("case-insensitive root: got %d entries, want the run-1 entry", len(entries))
+	}
+
+	entries, err = GetHeldQuarantineEntriesBy(db, "/srv/share/report.txt", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("case-sensitive root: got %d entries, want none", len(entries))
+	}
+
+	entries, err = GetHeldQuarantineEntriesBy(db, "", "run-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].OriginalPath != "/srv/share/Report.txt" {
+		t.Fatalf("run ID: got %d entries, want the run-2 entry", len(entries))
+	}
+}
@@ -3,6 +3,10 @@ package datastore
 import (
 	"database/sql"
 	"fmt"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
 )
 
 // CreateRootFoldersTableSQL creates the root_folders table
@@ -26,6 +30,7 @@ CREATE INDEX IF NOT EXISTS idx_root_folders_agent ON root_folders(agent_id);
 // RootFolder represents a root folder entity
 type RootFolder struct {
 	ID            int64
+	HostID        int64 // Machine holding the root; paths are unique per host
 	Path          string
 	AgentID       *int64
 	TraverseLinks bool
@@ -33,17 +38,55 @@ type RootFolder struct {
 	FolderCount   int64
 	FileCount     int64
 	TotalSize     int64
+	// CaseInsensitive records whether the root's filesystem ignores case,
+	// detected when the root is registered
+	CaseInsensitive bool
+	// Device identifies the filesystem device holding the root, recorded
+	// at registration and refreshed by each scan; empty when unknown
+	Device string
+}
+
+// rootFolderColumns is the column list scanned by scanRootFolder. The
+// scanner stamps last_scan_date with CURRENT_TIMESTAMP text, so it is
+// converted to Unix seconds here.
+const rootFolderColumns = `id, host_id, path, agent_id, traverse_links,
+	       CASE typeof(last_scan_date) WHEN 'text' THEN CAST(strftime('%s', last_scan_date) AS INTEGER)
+	            ELSE last_scan_date END,
+	       folder_count, file_count, total_size, case_insensitive, device`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRootFolder reads a root folder selected with rootFolderColumns
+func scanRootFolder(row rowScanner) (*RootFolder, error) {
+	var folder RootFolder
+	var traverseLinks, caseInsensitive int
+	err := row.Scan(
+		&folder.ID, &folder.HostID, &folder.Path, &folder.AgentID, &traverseLinks,
+		&folder.LastScanDate, &folder.FolderCount, &folder.FileCount, &folder.TotalSize,
+		&caseInsensitive, &folder.Device,
+	)
+	if err != nil {
+		return nil, err
+	}
+	folder.TraverseLinks = traverseLinks == 1
+	folder.CaseInsensitive = caseInsensitive == 1
+	return &folder, nil
 }
 
-// InsertRootFolder registers a new root folder
+// InsertRootFolder registers a new root folder on its host
 func InsertRootFolder(db *sql.DB, folder *RootFolder) (int64, error) {
 	query := `
-	INSERT INTO root_folders (path, agent_id, traverse_links, last_scan_date, 
-	                          folder_count, file_count, total_size)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
-	ON CONFLICT(path) DO UPDATE SET
+	INSERT INTO root_folders (host_id, path, agent_id, traverse_links, last_scan_date, 
+	                          folder_count, file_count, total_size, case_insensitive, device)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(host_id, path) DO UPDATE SET
 		agent_id = excluded.agent_id,
-		traverse_links = excluded.traverse_links
+		traverse_links = excluded.traverse_links,
+		case_insensitive = excluded.case_insensitive,
+		device = excluded.device
 	RETURNING id
 	`
 
@@ -51,10 +94,15 @@ func InsertRootFolder(db *sql.DB, folder *RootFolder) (int64, error) {
 	if folder.TraverseLinks {
 		traverseLinks = 1
 	}
+	caseInsensitive := 0
+	if folder.CaseInsensitive {
+		caseInsensitive = 1
+	}
 
 	var id int64
-	err := db.QueryRow(query, folder.Path, folder.AgentID, traverseLinks,
-		folder.LastScanDate, folder.FolderCount, folder.FileCount, folder.TotalSize).Scan(&id)
+	err := db.QueryRow(query, folder.HostID, folder.Path, folder.AgentID, traverseLinks,
+		folder.LastScanDate, folder.FolderCount, folder.FileCount, folder.TotalSize,
+		caseInsensitive, folder.Device).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
@@ -62,27 +110,49 @@ func InsertRootFolder(db *sql.DB, folder *RootFolder) (int64, error) {
 	return id, nil
 }
 
-// GetRootFolderByPath retrieves a root folder by its path
-func GetRootFolderByPath(db *sql.DB, path string) (*RootFolder, error) {
-	query := `
-	SELECT id, path, agent_id, traverse_links, last_scan_date, 
-	       folder_count, file_count, total_size
-	FROM root_folders
-	WHERE path = ?
-	`
+// GetRootFolder retrieves a root folder by ID
+func GetRootFolder(db *sql.DB, id int64) (*RootFolder, error) {
+	query := `SELECT ` + rootFolderColumns + ` FROM root_folders WHERE id = ?`
+	return scanRootFolder(db.QueryRow(query, id))
+}
 
-	var folder RootFolder
-	var traverseLinks int
-	err := db.QueryRow(query, path).Scan(
-		&folder.ID, &folder.Path, &folder.AgentID, &traverseLinks,
-		&folder.LastScanDate, &folder.FolderCount, &folder.FileCount, &folder.TotalSize,
-	)
+// GetRootFolderByPath retrieves a root folder by its host and path
+func GetRootFolderByPath(db *sql.DB, hostID int64, path string) (*RootFolder, error) {
+	query := `SELECT ` + rootFolderColumns + ` FROM root_folders WHERE host_id = ? AND path = ?`
+	return scanRootFolder(db.QueryRow(query, hostID, path))
+}
+
+// FindRootFolderByPath retrieves the root folder registered for path on a host.
+// An exact match is preferred; otherwise roots on case-insensitive
+// filesystems match regardless of the case the path was typed in.
+// Returns sql.ErrNoRows when no root matches.
+func FindRootFolderByPath(db *sql.DB, hostID int64, path string) (*RootFolder, error) {
+	folder, err := GetRootFolderByPath(db, hostID, path)
+	if err != sql.ErrNoRows {
+		return folder, err
+	}
+
+	query := `SELECT ` + rootFolderColumns + ` FROM root_folders WHERE host_id = ? AND case_insensitive = 1`
+	rows, err := db.Query(query, hostID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	folder.TraverseLinks = traverseLinks == 1
-	return &folder, nil
+	key := pathutil.NormalizePathForComparison(path, true)
+	for rows.Next() {
+		folder, err := scanRootFolder(rows)
+		if err != nil {
+			return nil, err
+		}
+		if pathutil.NormalizePathForComparison(folder.Path, true) == key {
+			return folder, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return nil, sql.ErrNoRows
 }
 
 // UpdateRootFolderStats updates the scan statistics for a root folder
@@ -100,14 +170,51 @@ func UpdateRootFolderStats(db *sql.DB, id int64, folderCount, fileCount, totalSi
 	return err
 }
 
+// RefreshRootFolderStats recounts the folders, files and bytes present
+// under a root folder and records them as its latest scan
+func RefreshRootFolderStats(db *sql.DB, id int64) (folderCount, fileCount, totalSize int64, err error) {
+	err = db.QueryRow(`SELECT COUNT(*) FROM folders WHERE root_folder_id = ? AND removed = 0`, id).Scan(&folderCount)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to count folders: %w", err)
+	}
+	err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(size), 0) FROM files WHERE root_folder_id = ? AND removed = 0`,
+		id).Scan(&fileCount, &totalSize)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to count files: %w", err)
+	}
+	if err := UpdateRootFolderStats(db, id, folderCount, fileCount, totalSize, time.Now().Unix()); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to update statistics: %w", err)
+	}
+	return folderCount, fileCount, totalSize, nil
+}
+
+// UpdateRootFolderSettings changes how a root folder is scanned and how
+// its paths are compared
+func UpdateRootFolderSettings(db *sql.DB, id int64, traverseLinks, caseInsensitive bool) error {
+	res, err := db.Exec(`UPDATE root_folders SET traverse_links = ?, case_insensitive = ? WHERE id = ?`,
+		traverseLinks, caseInsensitive, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateRootFolderDevice records the filesystem device holding a root folder
+func UpdateRootFolderDevice(db *sql.DB, id int64, device string) error {
+	_, err := db.Exec(`UPDATE root_folders SET device = ? WHERE id = ?`, device, id)
+	return err
+}
+
 // GetAllRootFolders retrieves all root folders
 func GetAllRootFolders(db *sql.DB) ([]*RootFolder, error) {
-	query := `
-	SELECT id, path, agent_id, traverse_links, last_scan_date,
-	       folder_count, file_count, total_size
-	FROM root_folders
-	ORDER BY path
-	`
+	query := `SELECT ` + rootFolderColumns + ` FROM root_folders ORDER BY path`
 
 	rows, err := db.Query(query)
 	if err != nil {
@@ -117,23 +224,31 @@ func GetAllRootFolders(db *sql.DB) ([]*RootFolder, error) {
 
 	var folders []*RootFolder
 	for rows.Next() {
-		var folder RootFolder
-		var traverseLinks int
-		err := rows.Scan(
-			&folder.ID, &folder.Path, &folder.AgentID, &traverseLinks,
-			&folder.LastScanDate, &folder.FolderCount, &folder.FileCount, &folder.TotalSize,
-		)
+		folder, err := scanRootFolder(rows)
 		if err != nil {
 			return nil, err
 		}
-		folder.TraverseLinks = traverseLinks == 1
-		folders = append(folders, &folder)
+		folders = append(folders, folder)
 	}
 
 	return folders, rows.Err()
 }
 
-// DeleteRootFolder removes a root folder and all associated scan data (CASCADE)
+// GetHostRootFolderIDs returns the set of IDs of a host's root folders
+func GetHostRootFolderIDs(db *sql.DB, hostID int64) (map[int64]bool, error) {
+	ids, err := queryIDs(db, `SELECT id FROM root_folders WHERE host_id = ?`, hostID)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set, nil
+}
+
+// DeleteRootFolder removes a root folder and all associated scan data (CASCADE).
+// Returns sql.ErrNoRows when no root folder has the ID.
 func DeleteRootFolder(db *sql.DB, id int64) error {
 	query := `DELETE FROM root_folders WHERE id = ?`
 	result, err := db.Exec(query, id)
@@ -147,8 +262,69 @@ func DeleteRootFolder(db *sql.DB, id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("root folder not found")
+		return sql.ErrNoRows
 	}
 
 	return nil
 }
+
+// RootFolderConverter builds the API form of root folders with their host
+// names and effective metadata, caching host names
+type RootFolderConverter struct {
+	db       *sql.DB
+	resolver *MetadataResolver
+	hosts    map[int64]string
+}
+
+// NewRootFolderConverter loads the metadata root folders may be assigned
+func NewRootFolderConverter(db *sql.DB) (*RootFolderConverter, error) {
+	resolver, err := NewMetadataResolver(db)
+	if err != nil {
+		return nil, err
+	}
+	return &RootFolderConverter{db: db, resolver: resolver, hosts: make(map[int64]string)}, nil
+}
+
+// Convert returns the API form of a root folder
+func (c *RootFolderConverter) Convert(root *RootFolder) (entities.RootFolderInfo, error) {
+	hostName, ok := c.hosts[root.HostID]
+	if !ok {
+		host, err := GetHostByID(c.db, int(root.HostID))
+		if err != nil {
+			return entities.RootFolderInfo{}, err
+		}
+		hostName = host.Name
+		c.hosts[root.HostID] = hostName
+	}
+
+	item := entities.RootFolderInfo{
+		ID:              root.ID,
+		Host:            hostName,
+		Path:            root.Path,
+		TraverseLinks:   root.TraverseLinks,
+		CaseInsensitive: root.CaseInsensitive,
+		Device:          root.Device,
+		FolderCount:     root.FolderCount,
+		FileCount:       root.FileCount,
+		TotalSizeBytes:  root.TotalSize,
+	}
+	if root.LastScanDate != nil {
+		scanTime := time.Unix(*root.LastScanDate, 0).UTC().Format(time.RFC3339)
+		item.LastScanDate = &scanTime
+	}
+
+	metadata, err := c.resolver.ForRoot(root.ID)
+	if err != nil {
+		return entities.RootFolderInfo{}, err
+	}
+	if metadata.Owner != nil {
+		item.Owner = metadata.Owner.Name
+	}
+	if metadata.Purpose != nil {
+		item.Purpose = metadata.Purpose.Name
+	}
+	if metadata.Policy != nil {
+		item.Policy = metadata.Policy.Name
+	}
+	return item, nil
+}
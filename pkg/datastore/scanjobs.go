@@ -0,0 +1,246 @@
+package datastore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/auth"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+)
+
+const CreateScanJobsTableSQL = `
+CREATE TABLE IF NOT EXISTS scan_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    root_folder_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    path TEXT,
+    paths TEXT,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    lease_id TEXT,
+    lease_timeout INTEGER NOT NULL DEFAULT 0,
+    lease_expires INTEGER,
+    folders_done INTEGER NOT NULL DEFAULT 0,
+    files_done INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    FOREIGN KEY (root_folder_id) REFERENCES root_folders(id) ON DELETE CASCADE
+);`
+
+// Leases of scan jobs
+const (
+	DefaultLeaseTimeout = 5 * time.Minute
+	MaxLeaseTimeout     = time.Hour
+	// MaxScanJobAttempts is how often a job is leased before it fails for
+	// good, whether its agents failed it or let the lease expire
+	MaxScanJobAttempts = 3
+)
+
+// scanJobColumns is the column list scanned by scanScanJob. Lease IDs are
+// never read back: only the leasing agent learns its own.
+const scanJobColumns = `j.id, j.root_folder_id, rf.path, rf.case_insensitive, j.kind,
+	COALESCE(j.path, ''), COALESCE(j.paths, ''), j.status, j.attempts,
+	COALESCE(j.agent_id, 0), COALESCE(j.lease_expires, 0),
+	j.folders_done, j.files_done, COALESCE(j.error, ''), j.created_at, j.updated_at`
+
+const scanJobFrom = ` FROM scan_jobs j JOIN root_folders rf ON rf.id = j.root_folder_id`
+
+func scanScanJob(row rowScanner) (entities.ScanJob, error) {
+	var job entities.ScanJob
+	var paths string
+	err := row.Scan(&job.ID, &job.RootFolderID, &job.RootPath, &job.CaseInsensitive, &job.Kind,
+		&job.Path, &paths, &job.Status, &job.Attempts, &job.AgentID, &job.LeaseExpires,
+		&job.FoldersDone, &job.FilesDone, &job.Error, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return job, err
+	}
+	if paths != "" {
+		if err := json.Unmarshal([]byte(paths), &job.Paths); err != nil {
+			return job, fmt.Errorf("scan job %d has invalid paths: %w", job.ID, err)
+		}
+	}
+	return job, nil
+}
+
+// InsertScanJob queues a job. Subtree and rehash paths must lie under the
+// job's root folder.
+func InsertScanJob(db *sql.DB, job entities.ScanJob) (entities.ScanJob, error) {
+	root, err := GetRootFolder(db, job.RootFolderID)
+	if err != nil {
+		return entities.ScanJob{}, err
+	}
+
+	var path, paths *string
+	switch job.Kind {
+	case entities.ScanJobRoot:
+	case entities.ScanJobSubtree:
+		if !pathutil.WithinRoot(root.Path, job.Path, root.CaseInsensitive) {
+			return entities.ScanJob{}, fmt.Errorf("%w: %s is not under root folder %s", ErrInvalid, job.Path, root.Path)
+		}
+		path = &job.Path
+	case entities.ScanJobRehash:
+		if len(job.Paths) == 0 {
+			return entities.ScanJob{}, fmt.Errorf("%w: a rehash job needs the paths of the files to hash", ErrInvalid)
+		}
+		for _, p := range job.Paths {
+			if !pathutil.WithinRoot(root.Path, p, root.CaseInsensitive) {
+				return entities.ScanJob{}, fmt.Errorf("%w: %s is not under root folder %s", ErrInvalid, p, root.Path)
+			}
+		}
+		data, err := json.Marshal(job.Paths)
+		if err != nil {
+			return entities.ScanJob{}, err
+		}
+		encoded := string(data)
+		paths = &encoded
+	default:
+		return entities.ScanJob{}, fmt.Errorf("%w: unknown job kind %q (want %s, %s or %s)", ErrInvalid,
+			job.Kind, entities.ScanJobRoot, entities.ScanJobSubtree, entities.ScanJobRehash)
+	}
+
+	now := time.Now().Unix()
+	var id int64
+	err = db.QueryRow(`INSERT INTO scan_jobs (root_folder_id, kind, path, paths, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		root.ID, job.Kind, path, paths, entities.ScanJobQueued, now, now).Scan(&id)
+	if err != nil {
+		return entities.ScanJob{}, err
+	}
+	return GetScanJob(db, id)
+}
+
+// GetScanJob retrieves a scan job by ID
+func GetScanJob(db *sql.DB, id int64) (entities.ScanJob, error) {
+	return scanScanJob(db.QueryRow(`SELECT `+scanJobColumns+scanJobFrom+` WHERE j.id = ?`, id))
+}
+
+// GetScanJobs lists scan jobs, oldest first, optionally only those with
+// the given status
+func GetScanJobs(db *sql.DB, status string) ([]entities.ScanJob, error) {
+	rows, err := db.Query(`SELECT `+scanJobColumns+scanJobFrom+` WHERE ? = '' OR j.status = ? ORDER BY j.id`,
+		status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []entities.ScanJob{}
+	for rows.Next() {
+		job, err := scanScanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// DeleteScanJob removes a job that no agent currently holds
+func DeleteScanJob(db *sql.DB, id int64) error {
+	job, err := GetScanJob(db, id)
+	if err != nil {
+		return err
+	}
+	if job.Status == entities.ScanJobLeased && job.LeaseExpires >= time.Now().Unix() {
+		return fmt.Errorf("%w: scan job %d is leased by an agent", ErrInvalid, id)
+	}
+	_, err = db.Exec(`DELETE FROM scan_jobs WHERE id = ?`, id)
+	return err
+}
+
+// LeaseScanJob hands the oldest available job of a host's roots to one of
+// its agents until the lease expires after timeout. Jobs whose lease
+// expired are available again unless they ran out of attempts, in which
+// case they fail. Returns sql.ErrNoRows when there is no work.
+func LeaseScanJob(db *sql.DB, hostID int64, agentID int, timeout time.Duration) (entities.ScanJob, error) {
+	if timeout <= 0 {
+		timeout = DefaultLeaseTimeout
+	}
+	timeout = min(timeout, MaxLeaseTimeout)
+	now := time.Now().Unix()
+
+	_, err := db.Exec(`UPDATE scan_jobs
+		SET status = ?, lease_id = NULL, error = 'lease expired', updated_at = ?
+		WHERE status = ? AND lease_expires < ? AND attempts >= ?`,
+		entities.ScanJobFailed, now, entities.ScanJobLeased, now, MaxScanJobAttempts)
+	if err != nil {
+		return entities.ScanJob{}, err
+	}
+
+	leaseID := auth.GenerateAPISeed()
+	seconds := int64(timeout / time.Second)
+	var id int64
+	err = db.QueryRow(`UPDATE scan_jobs
+		SET status = ?, attempts = attempts + 1, agent_id = ?, lease_id = ?, lease_timeout = ?,
+		    lease_expires = ?, folders_done = 0, files_done = 0, updated_at = ?
+		WHERE id = (
+			SELECT j.id FROM scan_jobs j JOIN root_folders rf ON rf.id = j.root_folder_id
+			WHERE rf.host_id = ? AND (j.status = ? OR (j.status = ? AND j.lease_expires < ?))
+			ORDER BY j.id LIMIT 1)
+		RETURNING id`,
+		entities.ScanJobLeased, agentID, leaseID, seconds, now+seconds, now,
+		hostID, entities.ScanJobQueued, entities.ScanJobLeased, now).Scan(&id)
+	if err != nil {
+		return entities.ScanJob{}, err
+	}
+
+	job, err := GetScanJob(db, id)
+	job.LeaseID = leaseID
+	return job, err
+}
+
+// ReportScanJobProgress records the progress of a leased job and extends
+// its lease by its timeout. Returns sql.ErrNoRows when the lease was lost.
+func ReportScanJobProgress(db *sql.DB, id int64, report entities.ScanJobReport) error {
+	now := time.Now().Unix()
+	return updateLeasedScanJob(db, id, report.LeaseID, `folders_done = ?, files_done = ?,
+		lease_expires = ? + lease_timeout, updated_at = ?`,
+		report.FoldersDone, report.FilesDone, now, now)
+}
+
+// CompleteScanJob marks a leased job done
+func CompleteScanJob(db *sql.DB, id int64, report entities.ScanJobReport) error {
+	return updateLeasedScanJob(db, id, report.LeaseID, `status = ?, lease_id = NULL, error = NULL,
+		folders_done = ?, files_done = ?, updated_at = ?`,
+		entities.ScanJobDone, report.FoldersDone, report.FilesDone, time.Now().Unix())
+}
+
+// FailScanJob releases a leased job with the agent's error. The job is
+// queued again until it runs out of attempts.
+func FailScanJob(db *sql.DB, id int64, report entities.ScanJobReport) error {
+	return updateLeasedScanJob(db, id, report.LeaseID, `
+		status = CASE WHEN attempts >= ? THEN ? ELSE ? END,
+		lease_id = NULL, lease_expires = NULL, error = ?, updated_at = ?`,
+		MaxScanJobAttempts, entities.ScanJobFailed, entities.ScanJobQueued, report.Error, time.Now().Unix())
+}
+
+// releaseAgentScanJobs queues again the jobs an agent holds, without
+// counting the withdrawn lease as an attempt
+func releaseAgentScanJobs(db *sql.DB, agentID int) error {
+	_, err := db.Exec(`UPDATE scan_jobs
+		SET status = ?, attempts = MAX(attempts - 1, 0), lease_id = NULL, lease_expires = NULL, updated_at = ?
+		WHERE agent_id = ? AND status = ?`,
+		entities.ScanJobQueued, time.Now().Unix(), agentID, entities.ScanJobLeased)
+	return err
+}
+
+// updateLeasedScanJob applies set to a job still held under leaseID
+func updateLeasedScanJob(db *sql.DB, id int64, leaseID, set string, args ...interface{}) error {
+	args = append(args, id, leaseID, entities.ScanJobLeased)
+	result, err := db.Exec(`UPDATE scan_jobs SET `+set+` WHERE id = ? AND lease_id = ? AND status = ?`, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
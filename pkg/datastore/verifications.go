@@ -0,0 +1,174 @@
+package datastore
+
+import (
+	"database/sql"
+)
+
+const CreateDuplicateVerificationsTableSQL = `
+CREATE TABLE IF NOT EXISTS duplicate_verifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    hash_value TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    file_count INTEGER NOT NULL DEFAULT 0,
+    verified_at INTEGER NOT NULL,
+    UNIQUE(hash_value, size)
+);`
+
+const CreateVerificationFilesTableSQL = `
+CREATE TABLE IF NOT EXISTS verification_files (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    verification_id INTEGER NOT NULL,
+    file_id INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    mtime INTEGER NOT NULL,
+    detail TEXT,
+    FOREIGN KEY (verification_id) REFERENCES duplicate_verifications(id) ON DELETE CASCADE,
+    FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE
+);`
+
+// Duplicate set verification statuses
+const (
+	VerificationVerified   = "verified"   // All files present, unchanged and byte-identical
+	VerificationStale      = "stale"      // A file changed or disappeared since it was hashed
+	VerificationMismatched = "mismatched" // Files share a hash but their contents differ
+)
+
+// Per-file verification statuses
+const (
+	VerificationFileMatch    = "match"
+	VerificationFileStale    = "stale"
+	VerificationFileMissing  = "missing"
+	VerificationFileMismatch = "mismatch"
+)
+
+// DuplicateVerification records the outcome of a byte-for-byte comparison
+// of a duplicate set
+type DuplicateVerification struct {
+	ID         int64
+	HashValue  string
+	Size       int64
+	Status     string
+	FileCount  int
+	VerifiedAt int64
+	Files      []*VerificationFile
+}
+
+// VerificationFile records the outcome for one file of a verified set
+// Size and Mtime are the values observed on disk at verification time
+type VerificationFile struct {
+	ID             int64
+	VerificationID int64
+	FileID         int64
+	Path           string // For display purposes
+	Status         string
+	Size           int64
+	Mtime          int64
+	Detail         *string
+}
+
+// SaveVerification stores the result of a set verification, replacing any
+// previous result for the same hash and size
+func SaveVerification(db *sql.DB, v *DuplicateVerification) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`
+	INSERT INTO duplicate_verifications (hash_value, size, status, file_count, verified_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(hash_value, size) DO UPDATE SET
+		status = excluded.status,
+		file_count = excluded.file_count,
+		verified_at = excluded.verified_at
+	RETURNING id
+	`, v.HashValue, v.Size, v.Status, len(v.Files), v.VerifiedAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM verification_files WHERE verification_id = ?`, id); err != nil {
+		return 0, err
+	}
+
+	for _, file := range v.Files {
+		_, err := tx.Exec(`
+		INSERT INTO verification_files (verification_id, file_id, status, size, mtime, detail)
+		VALUES (?, ?, ?, ?, ?, ?)
+		`, id, file.FileID, file.Status, file.Size, file.Mtime, file.Detail)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	v.ID = id
+	return id, nil
+}
+
+// GetVerification retrieves the latest verification of a duplicate set
+func GetVerification(db *sql.DB, hashValue string, size int64) (*DuplicateVerification, error) {
+	v := &DuplicateVerification{}
+	err := db.QueryRow(`
+	SELECT id, hash_value, size, status, file_count, verified_at
+	FROM duplicate_verifications
+	WHERE hash_value = ? AND size = ?
+	`, hashValue, size).Scan(&v.ID, &v.HashValue, &v.Size, &v.Status, &v.FileCount, &v.VerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+	SELECT vf.id, vf.verification_id, vf.file_id, COALESCE(f.path, ''), vf.status, vf.size, vf.mtime, vf.detail
+	FROM verification_files vf
+	LEFT JOIN files f ON vf.file_id = f.id
+	WHERE vf.verification_id = ?
+	ORDER BY f.path
+	`, v.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		file := &VerificationFile{}
+		err := rows.Scan(&file.ID, &file.VerificationID, &file.FileID, &file.Path, &file.Status,
+			&file.Size, &file.Mtime, &file.Detail)
+		if err != nil {
+			return nil, err
+		}
+		v.Files = append(v.Files, file)
+	}
+
+	return v, rows.Err()
+}
+
+// IsFileVerified reports whether a file belongs to a verified duplicate set
+// and its catalogued size and mtime still match what was verified.
+// Remediation uses this to refuse acting on unverified or changed files.
+func IsFileVerified(db *sql.DB, fileID int64) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+	SELECT COUNT(*)
+	FROM verification_files vf
+	JOIN duplicate_verifications dv ON vf.verification_id = dv.id
+	JOIN files f ON vf.file_id = f.id
+	WHERE vf.file_id = ?
+	  AND vf.status = ?
+	  AND dv.status = ?
+	  AND f.hash_value = dv.hash_value
+	  AND f.size = vf.size
+	  AND f.mtime = vf.mtime
+	`, fileID, VerificationFileMatch, VerificationVerified).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,283 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+// Statuses and severities of consistency checks
+const (
+	CheckPass    = "pass"
+	CheckWarning = "warning"
+	CheckError   = "error"
+)
+
+// maxListedIssues is how many inconsistencies a check describes one by one
+const maxListedIssues = 3
+
+// VerifyRootFolder checks the consistency of a root folder's catalog:
+// references between records, scan timestamps, removed flags, the root's
+// statistics and hash algorithms. With repair, the issues that can be fixed
+// safely are fixed.
+func VerifyRootFolder(db *sql.DB, root *RootFolder, repair bool) (entities.VerifyResult, error) {
+	checks := []func(*sql.DB, int64, bool) (entities.VerifyCheck, error){
+		checkForeignKeyIntegrity,
+		checkTimestampValidity,
+		checkRemovedFlagCascade,
+		checkStatisticsAccuracy,
+		checkHashAlgorithmConsistency,
+	}
+
+	result := entities.VerifyResult{
+		RootPath:      root.Path,
+		ChecksRun:     len(checks),
+		Checks:        make([]entities.VerifyCheck, 0, len(checks)),
+		ScanTimestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, run := range checks {
+		check, err := run(db, root.ID, repair)
+		if err != nil {
+			return result, fmt.Errorf("failed to run check %s: %w", check.Name, err)
+		}
+		result.Checks = append(result.Checks, check)
+		result.IssuesFound += len(check.Issues)
+		result.IssuesFixed += check.Fixed
+	}
+	return result, nil
+}
+
+func newCheck(name string) entities.VerifyCheck {
+	return entities.VerifyCheck{Name: name, Status: CheckPass, Issues: make([]entities.VerifyIssue, 0)}
+}
+
+// addIssue records an issue, raising the check's status to its severity
+func addIssue(check *entities.VerifyCheck, severity, description string) {
+	if check.Status != CheckError {
+		check.Status = severity
+	}
+	check.Issues = append(check.Issues, entities.VerifyIssue{Description: description, Severity: severity})
+}
+
+// repairRows runs a fix and adds the rows it changed to the check
+func repairRows(db *sql.DB, check *entities.VerifyCheck, query string, args ...interface{}) error {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	check.Fixed += int(rows)
+	return nil
+}
+
+func checkForeignKeyIntegrity(db *sql.DB, rootID int64, repair bool) (entities.VerifyCheck, error) {
+	check := newCheck("foreign_key_integrity")
+
+	var orphanedFiles int
+	err := db.QueryRow(`SELECT COUNT(*) FROM files f LEFT JOIN folders fo ON f.folder_id = fo.id
+		WHERE f.root_folder_id = ? AND fo.id IS NULL`, rootID).Scan(&orphanedFiles)
+	if err != nil {
+		return check, err
+	}
+	if orphanedFiles > 0 {
+		addIssue(&check, CheckError, fmt.Sprintf("%d files reference non-existent folders", orphanedFiles))
+		if repair {
+			err := repairRows(db, &check, `DELETE FROM files
+				WHERE root_folder_id = ? AND folder_id NOT IN (SELECT id FROM folders)`, rootID)
+			if err != nil {
+				return check, err
+			}
+		}
+	}
+
+	var orphanedFolders int
+	err = db.QueryRow(`SELECT COUNT(*) FROM folders f LEFT JOIN folders p ON f.parent_folder_id = p.id
+		WHERE f.root_folder_id = ? AND f.parent_folder_id IS NOT NULL AND p.id IS NULL`, rootID).Scan(&orphanedFolders)
+	if err != nil {
+		return check, err
+	}
+	if orphanedFolders > 0 {
+		addIssue(&check, CheckError, fmt.Sprintf("%d folders reference non-existent parent folders", orphanedFolders))
+		if repair {
+			err := repairRows(db, &check, `UPDATE folders SET parent_folder_id = NULL
+				WHERE root_folder_id = ? AND parent_folder_id IS NOT NULL
+				AND parent_folder_id NOT IN (SELECT id FROM folders)`, rootID)
+			if err != nil {
+				return check, err
+			}
+		}
+	}
+	return check, nil
+}
+
+func checkTimestampValidity(db *sql.DB, rootID int64, repair bool) (entities.VerifyCheck, error) {
+	check := newCheck("timestamp_validity")
+	now := time.Now().Unix()
+
+	for _, table := range []string{"files", "folders"} {
+		var future int
+		err := db.QueryRow(`SELECT COUNT(*) FROM `+table+`
+			WHERE root_folder_id = ? AND (first_scanned_at > ? OR last_scanned_at > ?)`,
+			rootID, now, now).Scan(&future)
+		if err != nil {
+			return check, err
+		}
+		if future > 0 {
+			addIssue(&check, CheckWarning, fmt.Sprintf("%d %s have future scan timestamps", future, table))
+			if repair {
+				err := repairRows(db, &check, `UPDATE `+table+`
+					SET first_scanned_at = MIN(first_scanned_at, ?), last_scanned_at = MIN(last_scanned_at, ?)
+					WHERE root_folder_id = ? AND (first_scanned_at > ? OR last_scanned_at > ?)`,
+					now, now, rootID, now, now)
+				if err != nil {
+					return check, err
+				}
+			}
+		}
+
+		var inverted int
+		err = db.QueryRow(`SELECT COUNT(*) FROM `+table+`
+			WHERE root_folder_id = ? AND first_scanned_at > last_scanned_at`, rootID).Scan(&inverted)
+		if err != nil {
+			return check, err
+		}
+		if inverted > 0 {
+			addIssue(&check, CheckWarning, fmt.Sprintf("%d %s were first scanned after they were last scanned", inverted, table))
+			if repair {
+				err := repairRows(db, &check, `UPDATE `+table+` SET last_scanned_at = first_scanned_at
+					WHERE root_folder_id = ? AND first_scanned_at > last_scanned_at`, rootID)
+				if err != nil {
+					return check, err
+				}
+			}
+		}
+	}
+	return check, nil
+}
+
+func checkRemovedFlagCascade(db *sql.DB, rootID int64, repair bool) (entities.VerifyCheck, error) {
+	check := newCheck("removed_flag_cascade")
+
+	rows, err := db.Query(`SELECT f.path, fo.path FROM files f JOIN folders fo ON f.folder_id = fo.id
+		WHERE f.root_folder_id = ? AND fo.removed = 1 AND f.removed = 0`, rootID)
+	if err != nil {
+		return check, err
+	}
+	count := 0
+	for rows.Next() {
+		var filePath, folderPath string
+		if err := rows.Scan(&filePath, &folderPath); err != nil {
+			rows.Close()
+			return check, err
+		}
+		count++
+		if count <= maxListedIssues {
+			addIssue(&check, CheckError,
+				fmt.Sprintf("Folder %s removed but child file %s not marked removed", folderPath, filePath))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return check, err
+	}
+
+	if count > maxListedIssues {
+		addIssue(&check, CheckError, fmt.Sprintf("...and %d more inconsistencies", count-maxListedIssues))
+	}
+	if count > 0 && repair {
+		err := repairRows(db, &check, `UPDATE files SET removed = 1
+			WHERE root_folder_id = ? AND removed = 0
+			AND folder_id IN (SELECT id FROM folders WHERE removed = 1)`, rootID)
+		if err != nil {
+			return check, err
+		}
+	}
+	return check, nil
+}
+
+func checkStatisticsAccuracy(db *sql.DB, rootID int64, repair bool) (entities.VerifyCheck, error) {
+	check := newCheck("statistics_accuracy")
+
+	var storedFolders, storedFiles int64
+	err := db.QueryRow(`SELECT folder_count, file_count FROM root_folders WHERE id = ?`,
+		rootID).Scan(&storedFolders, &storedFiles)
+	if err != nil {
+		return check, err
+	}
+
+	// Statistics count what the latest scans found, as RefreshRootFolderStats
+	var actualFolders, actualFiles int64
+	err = db.QueryRow(`SELECT COUNT(*) FROM folders WHERE root_folder_id = ? AND removed = 0`,
+		rootID).Scan(&actualFolders)
+	if err != nil {
+		return check, err
+	}
+	err = db.QueryRow(`SELECT COUNT(*) FROM files WHERE root_folder_id = ? AND removed = 0`,
+		rootID).Scan(&actualFiles)
+	if err != nil {
+		return check, err
+	}
+
+	if storedFolders != actualFolders || storedFiles != actualFiles {
+		addIssue(&check, CheckWarning, fmt.Sprintf(
+			"Statistics mismatch - Expected: %d folders, %d files; Actual: %d folders, %d files",
+			storedFolders, storedFiles, actualFolders, actualFiles))
+		if repair {
+			_, err := db.Exec(`UPDATE root_folders
+				SET folder_count = (SELECT COUNT(*) FROM folders WHERE root_folder_id = ? AND removed = 0),
+				    file_count = (SELECT COUNT(*) FROM files WHERE root_folder_id = ? AND removed = 0),
+				    total_size = (SELECT COALESCE(SUM(size), 0) FROM files WHERE root_folder_id = ? AND removed = 0)
+				WHERE id = ?`, rootID, rootID, rootID, rootID)
+			if err != nil {
+				return check, err
+			}
+			check.Fixed = 1
+		}
+	}
+	return check, nil
+}
+
+func checkHashAlgorithmConsistency(db *sql.DB, rootID int64, repair bool) (entities.VerifyCheck, error) {
+	check := newCheck("hash_algorithm_consistency")
+
+	rows, err := db.Query(`SELECT hash_algorithm, COUNT(*) FROM files
+		WHERE root_folder_id = ? AND hash_algorithm IS NOT NULL
+		GROUP BY hash_algorithm`, rootID)
+	if err != nil {
+		return check, err
+	}
+	defer rows.Close()
+
+	algorithms := make(map[string]int)
+	var names []string
+	for rows.Next() {
+		var algorithm string
+		var count int
+		if err := rows.Scan(&algorithm, &count); err != nil {
+			return check, err
+		}
+		algorithms[algorithm] = count
+		names = append(names, algorithm)
+	}
+	if err := rows.Err(); err != nil {
+		return check, err
+	}
+
+	// Files hashed with another algorithm cannot be compared; only a new
+	// scan can fix that
+	if len(algorithms) > 1 {
+		sort.Strings(names)
+		description := "Multiple hash algorithms detected:"
+		for _, name := range names {
+			description += fmt.Sprintf(" %s (%d files)", name, algorithms[name])
+		}
+		addIssue(&check, CheckWarning, description)
+	}
+	return check, nil
+}
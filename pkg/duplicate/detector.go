@@ -2,10 +2,14 @@ package duplicate
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/jpconstantineau/dupectl/pkg/datastore"
-	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
 )
 
 // DuplicateSet represents a group of duplicate files
@@ -15,6 +19,78 @@ type DuplicateSet struct {
 	Files []*datastore.File
 }
 
+var (
+	// ErrSetNotFound is returned when no duplicate set matches a hash
+	ErrSetNotFound = errors.New("no duplicate set found")
+	// ErrAmbiguousHash is returned when a hash prefix matches several sets
+	ErrAmbiguousHash = errors.New("hash prefix matches more than one duplicate set")
+)
+
+// Sort orders of duplicate set queries
+const (
+	SortBySize        = "size"        // Largest files first
+	SortByReclaimable = "reclaimable" // Most bytes freed by removing extra copies first
+)
+
+// Cursor identifies the position of a duplicate set in the result ordering
+// Sets are ordered by size descending, then hash ascending; when sorting by
+// reclaimable bytes, those come first.
+type Cursor struct {
+	Reclaimable int64 // Set only for SortByReclaimable
+	Size        int64
+	Hash        string
+}
+
+// String encodes the cursor for use with --after
+func (c *Cursor) String() string {
+	if c.Reclaimable > 0 {
+		return fmt.Sprintf("%d:%d:%s", c.Reclaimable, c.Size, c.Hash)
+	}
+	return fmt.Sprintf("%d:%s", c.Size, c.Hash)
+}
+
+// ParseCursor decodes a cursor produced by Cursor.String
+func ParseCursor(value string) (*Cursor, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[len(parts)-1] == "" {
+		return nil, fmt.Errorf("invalid cursor %q: expected [<reclaimable>:]<size>:<hash>", value)
+	}
+	numbers := make([]int64, len(parts)-1)
+	for i := range numbers {
+		n, err := strconv.ParseInt(parts[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %q: %w", value, err)
+		}
+		numbers[i] = n
+	}
+
+	c := &Cursor{Hash: parts[len(parts)-1], Size: numbers[len(numbers)-1]}
+	if len(numbers) == 2 {
+		c.Reclaimable = numbers[0]
+	}
+	return c, nil
+}
+
+// QueryOptions filters and pages a duplicate set query
+type QueryOptions struct {
+	MinCount int
+	MinSize  int64
+	// RootFolderID, when set, selects sets with a copy in that root folder
+	RootFolderID int64
+	// PathPrefix, when set, selects sets with a copy at or beneath that path
+	PathPrefix string
+	// HostID, when set, ignores the copies on other hosts' roots
+	HostID int64
+	Sort   string  // SortBySize (default) or SortByReclaimable
+	Limit  int     // Maximum number of sets to return, 0 = no limit
+	After  *Cursor // Only return sets ordered after this cursor
+}
+
+// ValidSort reports whether sort names a supported sort order ("" is the default)
+func ValidSort(sort string) bool {
+	return sort == "" || sort == SortBySize || sort == SortByReclaimable
+}
+
 // Detector finds duplicate files
 type Detector struct {
 	db *sql.DB
@@ -27,51 +103,251 @@ func NewDetector(db *sql.DB) *Detector {
 
 // FindDuplicateFiles finds all duplicate file sets
 func (d *Detector) FindDuplicateFiles(minCount int, minSize int64) ([]*DuplicateSet, error) {
-	// Query for hashes that appear more than once
-	query := `
-	SELECT hash_value, size, COUNT(*) as count
-	FROM files
-	WHERE hash_value IS NOT NULL 
-	  AND removed = 0 
-	  AND error_status IS NULL
-	  AND size > 0
-	  AND size >= ?
-	GROUP BY hash_value, size
-	HAVING count >= ?
-	ORDER BY size DESC, hash_value
-	`
+	var duplicateSets []*DuplicateSet
+	_, err := d.StreamDuplicateSets(QueryOptions{MinCount: minCount, MinSize: minSize}, func(set *DuplicateSet) error {
+		duplicateSets = append(duplicateSets, set)
+		return nil
+	})
+	return duplicateSets, err
+}
+
+// StreamDuplicateSets reads duplicate sets with a single ordered query and
+// hands each set to fn as soon as all of its files have been read.
+// Returns the cursor of the next page, or nil when no sets remain.
+func (d *Detector) StreamDuplicateSets(opts QueryOptions, fn func(*DuplicateSet) error) (*Cursor, error) {
+	keys, args, err := setKeys(opts)
+	if err != nil {
+		return nil, err
+	}
+	minCount := max(opts.MinCount, 2)
+	byReclaimable := opts.Sort == SortByReclaimable
+
+	order := "size DESC, hash_value"
+	if byReclaimable {
+		order = "reclaimable DESC, " + order
+	}
+
+	// The sets CTE selects one page of (hash, size) keys; fetching one extra
+	// key tells us whether another page exists without a second query.
+	limitClause := ""
+	if opts.Limit > 0 {
+		limitClause = "LIMIT ?"
+		args = append(args, opts.Limit+1)
+	}
 
-	rows, err := d.db.Query(query, minSize, minCount)
+	hostClause := ""
+	if opts.HostID != 0 {
+		hostClause = " AND f.root_folder_id IN (SELECT id FROM root_folders WHERE host_id = ?)"
+		args = append(args, opts.HostID)
+	}
+
+	query := fmt.Sprintf(`
+	WITH sets AS (
+		%s
+		ORDER BY %s
+		%s
+	)
+	SELECT f.id, f.path, f.size, f.mtime, f.hash_value, f.hash_algorithm, f.error_status,
+	       f.first_scanned_at, f.last_scanned_at, f.removed, f.folder_id, f.root_folder_id, f.status,
+	       COALESCE(rf.path, '') as root_folder_path, COALESCE(rf.case_insensitive, 0), s.reclaimable
+	FROM sets s
+	JOIN files f ON f.hash_value = s.hash_value AND f.size = s.size
+	LEFT JOIN root_folders rf ON f.root_folder_id = rf.id
+	WHERE f.removed = 0 AND f.error_status IS NULL%s
+	ORDER BY %s, f.path
+	`, keys, order, limitClause, hostClause, "s."+strings.ReplaceAll(order, ", ", ", s."))
+
+	rows, err := d.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
 	defer rows.Close()
 
-	var duplicateSets []*DuplicateSet
-	for rows.Next() {
-		var hash string
-		var size int64
-		var count int
+	var current *DuplicateSet
+	var currentReclaimable int64
+	var seenPaths map[string]bool
+	setsRead := 0
 
-		if err := rows.Scan(&hash, &size, &count); err != nil {
-			return nil, err
+	// emit hands the completed set to fn, skipping sets that collapsed below
+	// minCount once equivalent paths were merged
+	emit := func() error {
+		if current == nil || len(current.Files) < minCount {
+			return nil
 		}
+		return fn(current)
+	}
 
-		// Get all files with this hash
-		files, err := datastore.GetFilesByHash(d.db, hash, size)
+	for rows.Next() {
+		file := &datastore.File{}
+		var removed, caseInsensitive int
+		var reclaimable int64
+		err := rows.Scan(&file.ID, &file.Path, &file.Size, &file.Mtime, &file.HashValue,
+			&file.HashAlgorithm, &file.ErrorStatus, &file.FirstScannedAt, &file.LastScannedAt,
+			&removed, &file.FolderID, &file.RootFolderID, &file.Status, &file.RootFolderPath, &caseInsensitive,
+			&reclaimable)
 		if err != nil {
-			logger.Warn("Failed to get files for hash %s: %v", hash, err)
+			return nil, err
+		}
+		file.Removed = removed != 0
+		file.RootCaseInsensitive = caseInsensitive != 0
+
+		if current == nil || current.Hash != *file.HashValue || current.Size != file.Size {
+			if err := emit(); err != nil {
+				return nil, err
+			}
+			if opts.Limit > 0 && setsRead == opts.Limit {
+				// The extra key fetched by the CTE: another page exists
+				next := &Cursor{Size: current.Size, Hash: current.Hash}
+				if byReclaimable {
+					next.Reclaimable = currentReclaimable
+				}
+				return next, nil
+			}
+			currentReclaimable = reclaimable
+			current = &DuplicateSet{Hash: *file.HashValue, Size: file.Size}
+			seenPaths = make(map[string]bool)
+			setsRead++
+		}
+
+		// Skip if we've already seen this path (case-insensitive duplicate)
+		normalizedPath := pathutil.NormalizePathForComparison(file.Path, file.RootCaseInsensitive)
+		if seenPaths[normalizedPath] {
 			continue
 		}
+		seenPaths[normalizedPath] = true
+		current.Files = append(current.Files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, emit()
+}
+
+// CountDuplicateSets returns the number of sets StreamDuplicateSets hands
+// over for the same options, on this page when a limit is set. Sets that
+// fall below MinCount once equivalent paths of case-insensitive roots are
+// merged are still counted.
+func (d *Detector) CountDuplicateSets(opts QueryOptions) (int, error) {
+	keys, args, err := setKeys(opts)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	if err := d.db.QueryRow("SELECT COUNT(*) FROM ("+keys+")", args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("query failed: %w", err)
+	}
+	if opts.Limit > 0 {
+		count = min(count, opts.Limit)
+	}
+	return count, nil
+}
+
+// setKeys returns the query selecting the (hash, size, reclaimable) keys of
+// the duplicate sets matching the options, unordered, with its arguments.
+// Root and path filters keep the sets with at least one matching copy.
+func setKeys(opts QueryOptions) (string, []interface{}, error) {
+	if !ValidSort(opts.Sort) {
+		return "", nil, fmt.Errorf("unknown sort order %q (use %s or %s)", opts.Sort, SortBySize, SortByReclaimable)
+	}
+	byReclaimable := opts.Sort == SortByReclaimable
+	if opts.After != nil && (opts.After.Reclaimable > 0) != byReclaimable {
+		return "", nil, fmt.Errorf("cursor %s does not belong to this sort order", opts.After)
+	}
+
+	var having []string
+	hostClause := ""
+	args := []interface{}{opts.MinSize}
+	if opts.HostID != 0 {
+		hostClause = " AND root_folder_id IN (SELECT id FROM root_folders WHERE host_id = ?)"
+		args = append(args, opts.HostID)
+	}
+	args = append(args, max(opts.MinCount, 2))
+	if opts.RootFolderID != 0 {
+		having = append(having, "SUM(root_folder_id = ?) > 0")
+		args = append(args, opts.RootFolderID)
+	}
+	if opts.PathPrefix != "" {
+		prefix := strings.TrimSuffix(opts.PathPrefix, string(filepath.Separator)) + string(filepath.Separator)
+		having = append(having, "SUM(path = ? OR substr(path, 1, length(?)) = ?) > 0")
+		args = append(args, strings.TrimSuffix(prefix, string(filepath.Separator)), prefix, prefix)
+	}
+	if opts.After != nil {
+		after := "(size < ? OR (size = ? AND hash_value > ?))"
+		afterArgs := []interface{}{opts.After.Size, opts.After.Size, opts.After.Hash}
+		if byReclaimable {
+			after = "(size * (COUNT(*) - 1) < ? OR (size * (COUNT(*) - 1) = ? AND " + after + "))"
+			afterArgs = append([]interface{}{opts.After.Reclaimable, opts.After.Reclaimable}, afterArgs...)
+		}
+		having = append(having, after)
+		args = append(args, afterArgs...)
+	}
+	havingClause := ""
+	for _, condition := range having {
+		havingClause += " AND " + condition
+	}
+
+	return fmt.Sprintf(`
+		SELECT hash_value, size, size * (COUNT(*) - 1) AS reclaimable
+		FROM files
+		WHERE hash_value IS NOT NULL
+		  AND removed = 0
+		  AND error_status IS NULL
+		  AND size > 0
+		  AND size >= ?%s
+		GROUP BY hash_value, size
+		HAVING COUNT(*) >= ?%s`, hostClause, havingClause), args, nil
+}
+
+// GetSet retrieves a single duplicate set by its hash or an unambiguous
+// hash prefix (as shown in the detailed table view)
+func (d *Detector) GetSet(hashPrefix string) (*DuplicateSet, error) {
+	if hashPrefix == "" {
+		return nil, fmt.Errorf("hash must not be empty")
+	}
+
+	rows, err := d.db.Query(`
+	SELECT hash_value, size
+	FROM files
+	WHERE hash_value LIKE ? || '%'
+	  AND removed = 0
+	  AND error_status IS NULL
+	  AND size > 0
+	GROUP BY hash_value, size
+	HAVING COUNT(*) >= 2
+	LIMIT 2
+	`, hashPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	var keys []Cursor
+	for rows.Next() {
+		var key Cursor
+		if err := rows.Scan(&key.Hash, &key.Size); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		duplicateSets = append(duplicateSets, &DuplicateSet{
-			Hash:  hash,
-			Size:  size,
-			Files: files,
-		})
+	switch len(keys) {
+	case 0:
+		return nil, fmt.Errorf("%w for hash %s", ErrSetNotFound, hashPrefix)
+	case 1:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrAmbiguousHash, hashPrefix)
 	}
 
-	return duplicateSets, rows.Err()
+	files, err := datastore.GetFilesByHash(d.db, keys[0].Hash, keys[0].Size)
+	if err != nil {
+		return nil, err
+	}
+	return &DuplicateSet{Hash: keys[0].Hash, Size: keys[0].Size, Files: files}, nil
 }
 
 // CountDuplicates returns total duplicate count statistics
@@ -0,0 +1,120 @@
+package duplicate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// stream returns the hashes of the sets of one page, and its next cursor
+func stream(t *testing.T, c *testCatalog, opts QueryOptions) ([]string, *Cursor) {
+	t.Helper()
+	var hashes []string
+	next, err := NewDetector(c.db).StreamDuplicateSets(opts, func(set *DuplicateSet) error {
+		hashes = append(hashes, set.Hash)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hashes, next
+}
+
+func TestStreamDuplicateSetsPages(t *testing.T) {
+	c := newTestCatalog(t)
+	// Sets are ordered by size, largest first, then by hash: "b" and "c"
+	// share a size, and "c" also has a copy of another size
+	for _, set := range []struct {
+		hash   string
+		size   int64
+		copies int
+	}{
+		{"a", 300, 2}, {"c", 200, 3}, {"b", 200, 2}, {"d", 100, 2},
+	} {
+		for i := 0; i < set.copies; i++ {
+			c.catalog(fmt.Sprintf("%s%d", set.hash, i), set.size, set.hash)
+		}
+	}
+	c.catalog("c-single", 50, "c")
+
+	for _, tc := range []struct {
+		name  string
+		opts  QueryOptions
+		want  string
+		after string // Cursor of the next page
+	}{
+		{"all", QueryOptions{}, "a b c d", ""},
+		{"first page", QueryOptions{Limit: 2}, "a b", "200:b"},
+		{"page ending at a size", QueryOptions{Limit: 1, After: &Cursor{Size: 300, Hash: "a"}}, "b", "200:b"},
+		{"same size, next hash", QueryOptions{Limit: 2, After: &Cursor{Size: 200, Hash: "b"}}, "c d", ""},
+		{"exact last page", QueryOptions{Limit: 4}, "a b c d", ""},
+		{"after the last set", QueryOptions{Limit: 2, After: &Cursor{Size: 100, Hash: "d"}}, "", ""},
+		{"min count", QueryOptions{MinCount: 3}, "c", ""},
+		{"by reclaimable", QueryOptions{Sort: SortByReclaimable, Limit: 2}, "c a", "300:300:a"},
+		{"by reclaimable, next page", QueryOptions{Sort: SortByReclaimable,
+			After: &Cursor{Reclaimable: 300, Size: 300, Hash: "a"}}, "b d", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hashes, next := stream(t, c, tc.opts)
+			if got := strings.Join(hashes, " "); got != tc.want {
+				t.Errorf("got sets %q, want %q", got, tc.want)
+			}
+			after := ""
+			if next != nil {
+				after = next.String()
+			}
+			if after != tc.after {
+				t.Errorf("got next cursor %q, want %q", after, tc.after)
+			}
+
+			count, err := NewDetector(c.db).CountDuplicateSets(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(hashes) {
+				t.Errorf("counted %d sets, streamed %d", count, len(hashes))
+			}
+		})
+	}
+}
+
+func TestStreamDuplicateSetsFollowsCursor(t *testing.T) {
+	c := newTestCatalog(t)
+	for i := 0; i < 7; i++ {
+		hash := fmt.Sprintf("h%d", i)
+		c.catalog(hash+"-1", int64(100+i%3), hash)
+		c.catalog(hash+"-2", int64(100+i%3), hash)
+	}
+
+	all, _ := stream(t, c, QueryOptions{})
+	var paged []string
+	var after *Cursor
+	for pages := 0; ; pages++ {
+		if pages > len(all) {
+			t.Fatal("paging does not end")
+		}
+		hashes, next := stream(t, c, QueryOptions{Limit: 3, After: after})
+		paged = append(paged, hashes...)
+		if next == nil {
+			break
+		}
+		// The cursor survives being printed for --after
+		if after, _ = ParseCursor(next.String()); after == nil {
+			t.Fatalf("cursor %s does not parse", next)
+		}
+	}
+	if strings.Join(paged, " ") != strings.Join(all, " ") {
+		t.Errorf("pages gave %v, want %v", paged, all)
+	}
+}
+
+func TestTableHeaderCountsSets(t *testing.T) {
+	set := &DuplicateSet{Hash: strings.Repeat("a", 64), Size: 10}
+	got := NewFormatter().FormatTable([]*DuplicateSet{set, set})
+	if !strings.HasPrefix(got, "Found 2 duplicate sets:\n\nSet 1: ") {
+		t.Errorf("table starts with %q, want the header first", got)
+	}
+	if got := NewFormatter().FormatTable(nil); got != "No duplicates found.\n" {
+		t.Errorf("empty table: got %q", got)
+	}
+}
@@ -3,7 +3,12 @@ package duplicate
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
 	"strings"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
 )
 
 // Formatter formats duplicate results for display
@@ -14,76 +19,197 @@ func NewFormatter() *Formatter {
 	return &Formatter{}
 }
 
-// FormatTable formats duplicates as a table
-func (f *Formatter) FormatTable(sets []*DuplicateSet) string {
-	if len(sets) == 0 {
-		return "No duplicates found.\n"
-	}
+// SetWriter renders duplicate sets incrementally as they are streamed
+// from the detector, so output starts before the query completes
+type SetWriter interface {
+	WriteSet(set *DuplicateSet) error
+	Close() error
+}
 
-	var sb strings.Builder
+// metadataWriter resolves the effective owner, purpose and policy of every
+// file before handing the set to the next writer
+type metadataWriter struct {
+	SetWriter
+	resolver *datastore.MetadataResolver
+}
 
-	sb.WriteString(fmt.Sprintf("Found %d duplicate sets:\n\n", len(sets)))
+// WithMetadata wraps a writer so files carry their effective metadata
+func (f *Formatter) WithMetadata(w SetWriter, resolver *datastore.MetadataResolver) SetWriter {
+	return &metadataWriter{SetWriter: w, resolver: resolver}
+}
 
-	for i, set := range sets {
-		sb.WriteString(fmt.Sprintf("Set %d: %d files, %s each (hash: %s...)\n",
-			i+1, len(set.Files), formatSize(set.Size), set.Hash[:16]))
+func (m *metadataWriter) WriteSet(set *DuplicateSet) error {
+	if err := ResolveMetadata(set, m.resolver); err != nil {
+		return err
+	}
+	return m.SetWriter.WriteSet(set)
+}
 
-		for _, file := range set.Files {
-			sb.WriteString(fmt.Sprintf("  - %s\n", file.Path))
+// ResolveMetadata sets the effective metadata of every file in a set
+func ResolveMetadata(set *DuplicateSet, resolver *datastore.MetadataResolver) error {
+	for _, file := range set.Files {
+		metadata, err := resolver.ForFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to resolve metadata of %s: %w", file.Path, err)
 		}
-		sb.WriteString("\n")
+		file.Metadata = metadata
 	}
+	return nil
+}
 
-	return sb.String()
+// metadataLabel describes a file's effective metadata for table views,
+// or returns "" when none is known
+func metadataLabel(file *datastore.File) string {
+	if file.Metadata == nil {
+		return ""
+	}
+	var parts []string
+	if file.Metadata.Owner != nil {
+		parts = append(parts, "owner: "+file.Metadata.Owner.Name)
+	}
+	if file.Metadata.Purpose != nil {
+		parts = append(parts, "purpose: "+file.Metadata.Purpose.Name)
+	}
+	if file.Metadata.Policy != nil {
+		parts = append(parts, "policy: "+file.Metadata.Policy.Name)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "  (" + strings.Join(parts, ", ") + ")"
+}
+
+// FormatTable formats duplicates as a table
+func (f *Formatter) FormatTable(sets []*DuplicateSet) string {
+	return formatAll(func(w io.Writer) SetWriter { return f.NewTableWriter(w, len(sets)) }, sets)
 }
 
 // FormatSummary formats duplicates as a summary table grouped by root folder
 func (f *Formatter) FormatSummary(sets []*DuplicateSet) string {
-	if len(sets) == 0 {
-		return "No duplicates found.\n"
+	return formatAll(f.NewSummaryWriter, sets)
+}
+
+// FormatJSON formats duplicates as JSON
+func (f *Formatter) FormatJSON(sets []*DuplicateSet) (string, error) {
+	var sb strings.Builder
+	writer := f.NewJSONWriter(&sb)
+	for _, set := range sets {
+		if err := writer.WriteSet(set); err != nil {
+			return "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
 	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
 
-	// Group duplicates by root folder
-	type RootSummary struct {
-		Path           string
-		DuplicateSets  int
-		DuplicateFiles int
-		TotalSize      int64
+// formatAll renders a complete slice of sets through a streaming writer
+func formatAll(newWriter func(io.Writer) SetWriter, sets []*DuplicateSet) string {
+	var sb strings.Builder
+	writer := newWriter(&sb)
+	for _, set := range sets {
+		writer.WriteSet(set)
 	}
+	writer.Close()
+	return sb.String()
+}
 
-	rootMap := make(map[string]*RootSummary)
+// tableWriter prints each set with its file paths
+type tableWriter struct {
+	w     io.Writer
+	total int
+	sets  int
+}
 
-	for _, set := range sets {
-		for _, file := range set.Files {
-			root := file.RootFolderPath
-			if root == "" {
-				root = "(unknown)"
-			}
+// NewTableWriter creates a writer for the detailed table view, headed by
+// the total number of sets it will be given
+func (f *Formatter) NewTableWriter(w io.Writer, total int) SetWriter {
+	return &tableWriter{w: w, total: total}
+}
 
-			if _, exists := rootMap[root]; !exists {
-				rootMap[root] = &RootSummary{
-					Path: root,
-				}
-			}
+func (t *tableWriter) WriteSet(set *DuplicateSet) error {
+	var sb strings.Builder
+	if t.sets == 0 {
+		sb.WriteString(fmt.Sprintf("Found %d duplicate sets:\n\n", t.total))
+	}
+	t.sets++
+	sb.WriteString(fmt.Sprintf("Set %d: %d files, %s each (hash: %s...)\n",
+		t.sets, len(set.Files), formatSize(set.Size), set.Hash[:16]))
 
-			rootMap[root].DuplicateFiles++
-			rootMap[root].TotalSize += file.Size
-		}
+	for _, file := range set.Files {
+		sb.WriteString(fmt.Sprintf("  - %s%s\n", file.Path, metadataLabel(file)))
 	}
+	sb.WriteString("\n")
+
+	_, err := io.WriteString(t.w, sb.String())
+	return err
+}
+
+func (t *tableWriter) Close() error {
+	if t.sets == 0 {
+		_, err := io.WriteString(t.w, "No duplicates found.\n")
+		return err
+	}
+	return nil
+}
+
+// rootSummary accumulates duplicate totals for one root folder
+type rootSummary struct {
+	Path           string
+	DuplicateSets  int
+	DuplicateFiles int
+	TotalSize      int64
+}
+
+// summaryWriter aggregates sets per root folder and prints the table on Close.
+// Only per-root totals are retained, so memory does not grow with set count.
+type summaryWriter struct {
+	w          io.Writer
+	rootMap    map[string]*rootSummary
+	totalSets  int
+	totalFiles int
+	totalSize  int64
+}
+
+// NewSummaryWriter creates a writer for the summary view grouped by root folder
+func (f *Formatter) NewSummaryWriter(w io.Writer) SetWriter {
+	return &summaryWriter{w: w, rootMap: make(map[string]*rootSummary)}
+}
 
+func (s *summaryWriter) WriteSet(set *DuplicateSet) error {
 	// Count sets per root (a set may span multiple roots)
-	for _, set := range sets {
-		rootsInSet := make(map[string]bool)
-		for _, file := range set.Files {
-			root := file.RootFolderPath
-			if root == "" {
-				root = "(unknown)"
-			}
-			rootsInSet[root] = true
+	rootsInSet := make(map[string]bool)
+	for _, file := range set.Files {
+		root := file.RootFolderPath
+		if root == "" {
+			root = "(unknown)"
 		}
-		for root := range rootsInSet {
-			rootMap[root].DuplicateSets++
+
+		if _, exists := s.rootMap[root]; !exists {
+			s.rootMap[root] = &rootSummary{
+				Path: root,
+			}
 		}
+
+		s.rootMap[root].DuplicateFiles++
+		s.rootMap[root].TotalSize += file.Size
+		rootsInSet[root] = true
+	}
+	for root := range rootsInSet {
+		s.rootMap[root].DuplicateSets++
+	}
+
+	s.totalSets++
+	s.totalFiles += len(set.Files)
+	s.totalSize += set.Size * int64(len(set.Files))
+	return nil
+}
+
+func (s *summaryWriter) Close() error {
+	if s.totalSets == 0 {
+		_, err := io.WriteString(s.w, "No duplicates found.\n")
+		return err
 	}
 
 	var sb strings.Builder
@@ -94,10 +220,11 @@ func (f *Formatter) FormatSummary(sets []*DuplicateSet) string {
 	sb.WriteString("\n")
 
 	// Sort by root path for consistent display
-	var roots []*RootSummary
-	for _, summary := range rootMap {
+	var roots []*rootSummary
+	for _, summary := range s.rootMap {
 		roots = append(roots, summary)
 	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].Path < roots[j].Path })
 
 	for _, summary := range roots {
 		path := summary.Path
@@ -113,60 +240,254 @@ func (f *Formatter) FormatSummary(sets []*DuplicateSet) string {
 	}
 
 	sb.WriteString("\n")
-
-	totalSets := len(sets)
-	totalFiles := 0
-	totalSize := int64(0)
-	for _, set := range sets {
-		totalFiles += len(set.Files)
-		totalSize += set.Size * int64(len(set.Files))
-	}
-
 	sb.WriteString(fmt.Sprintf("Total: %d duplicate sets, %d files, %s\n",
-		totalSets, totalFiles, formatSize(totalSize)))
+		s.totalSets, s.totalFiles, formatSize(s.totalSize)))
 	sb.WriteString("\nUse 'dupectl get duplicates --details' to see individual file paths.\n")
 
-	return sb.String()
+	_, err := io.WriteString(s.w, sb.String())
+	return err
 }
 
-// FormatJSON formats duplicates as JSON
-func (f *Formatter) FormatJSON(sets []*DuplicateSet) (string, error) {
-	type JSONFile struct {
-		Path string `json:"path"`
-		Size int64  `json:"size"`
+// JSONFile is the JSON representation of a file in a duplicate set
+type JSONFile struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Root    string `json:"root,omitempty"` // Path of the root folder holding the file
+	Owner   string `json:"owner,omitempty"`
+	Purpose string `json:"purpose,omitempty"`
+	Policy  string `json:"policy,omitempty"`
+}
+
+// NewJSONFile converts a file, with its effective metadata when resolved
+func NewJSONFile(file *datastore.File) JSONFile {
+	jf := JSONFile{Path: file.Path, Size: file.Size, Root: file.RootFolderPath}
+	if m := file.Metadata; m != nil {
+		if m.Owner != nil {
+			jf.Owner = m.Owner.Name
+		}
+		if m.Purpose != nil {
+			jf.Purpose = m.Purpose.Name
+		}
+		if m.Policy != nil {
+			jf.Policy = m.Policy.Name
+		}
+	}
+	return jf
+}
+
+// JSONSet is the JSON representation of a duplicate set
+type JSONSet struct {
+	Hash        string     `json:"hash"`
+	Size        int64      `json:"size"`
+	Count       int        `json:"count"`
+	Reclaimable int64      `json:"reclaimable"` // Bytes freed by keeping a single copy
+	Files       []JSONFile `json:"files"`
+}
+
+// NewJSONSet converts a duplicate set to its JSON representation
+func NewJSONSet(set *DuplicateSet) JSONSet {
+	files := make([]JSONFile, len(set.Files))
+	for j, file := range set.Files {
+		files[j] = NewJSONFile(file)
 	}
 
-	type JSONSet struct {
-		Hash  string     `json:"hash"`
-		Size  int64      `json:"size"`
-		Count int        `json:"count"`
-		Files []JSONFile `json:"files"`
+	return JSONSet{
+		Hash:        set.Hash,
+		Size:        set.Size,
+		Count:       len(set.Files),
+		Reclaimable: set.Size * int64(len(set.Files)-1),
+		Files:       files,
 	}
+}
 
-	result := make([]JSONSet, len(sets))
-	for i, set := range sets {
-		files := make([]JSONFile, len(set.Files))
-		for j, file := range set.Files {
-			files[j] = JSONFile{
-				Path: file.Path,
-				Size: file.Size,
-			}
-		}
+// JSONPage is one page of duplicate sets served by the API; Next is the
+// cursor of the following page, empty on the last one
+type JSONPage struct {
+	Sets  []JSONSet `json:"sets"`
+	Total int       `json:"total"` // Sets from this page on, across all pages
+	Next  string    `json:"next,omitempty"`
+}
 
-		result[i] = JSONSet{
-			Hash:  set.Hash,
-			Size:  set.Size,
-			Count: len(set.Files),
-			Files: files,
+// File converts a file received from the API back for the set writers,
+// with the effective metadata the server resolved
+func (jf JSONFile) File() *datastore.File {
+	file := &datastore.File{Path: jf.Path, Size: jf.Size, RootFolderPath: jf.Root}
+	if jf.Owner != "" || jf.Purpose != "" || jf.Policy != "" {
+		file.Metadata = &datastore.EffectiveMetadata{}
+		if jf.Owner != "" {
+			file.Metadata.Owner = &entities.Owner{Name: jf.Owner}
+		}
+		if jf.Purpose != "" {
+			file.Metadata.Purpose = &entities.Purpose{Name: jf.Purpose}
+		}
+		if jf.Policy != "" {
+			file.Metadata.Policy = &entities.Policy{Name: jf.Policy}
 		}
 	}
+	return file
+}
+
+// Set converts a set received from the API back for the set writers
+func (js JSONSet) Set() *DuplicateSet {
+	set := &DuplicateSet{Hash: js.Hash, Size: js.Size, Files: make([]*datastore.File, len(js.Files))}
+	for i, file := range js.Files {
+		set.Files[i] = file.File()
+	}
+	return set
+}
+
+// jsonWriter streams a JSON array, one set element at a time
+type jsonWriter struct {
+	w       io.Writer
+	count   int
+	element func(set *DuplicateSet) (interface{}, error)
+}
+
+// NewJSONWriter creates a writer producing a JSON array of sets
+func (f *Formatter) NewJSONWriter(w io.Writer) SetWriter {
+	return &jsonWriter{w: w, element: func(set *DuplicateSet) (interface{}, error) {
+		return NewJSONSet(set), nil
+	}}
+}
 
-	data, err := json.MarshalIndent(result, "", "  ")
+func (j *jsonWriter) WriteSet(set *DuplicateSet) error {
+	element, err := j.element(set)
 	if err != nil {
-		return "", err
+		return err
+	}
+	data, err := json.MarshalIndent(element, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	prefix := ",\n  "
+	if j.count == 0 {
+		prefix = "[\n  "
+	}
+	j.count++
+
+	if _, err := io.WriteString(j.w, prefix); err != nil {
+		return err
 	}
+	_, err = j.w.Write(data)
+	return err
+}
 
-	return string(data), nil
+func (j *jsonWriter) Close() error {
+	if j.count == 0 {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
+
+// planTableWriter prints the keep/remove split chosen for each set
+type planTableWriter struct {
+	w           io.Writer
+	planner     *Planner
+	sets        int
+	removeFiles int
+	reclaimable int64
+	violations  int
+}
+
+// NewPlanTableWriter creates a writer previewing the keeper chosen for each set
+func (f *Formatter) NewPlanTableWriter(w io.Writer, planner *Planner) SetWriter {
+	return &planTableWriter{w: w, planner: planner}
+}
+
+func (t *planTableWriter) WriteSet(set *DuplicateSet) error {
+	plan, err := t.planner.Plan(set)
+	if err != nil {
+		return err
+	}
+	t.sets++
+	t.removeFiles += len(plan.Remove)
+	t.reclaimable += set.Size * int64(len(plan.Remove))
+	t.violations += len(plan.Violations)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Set %d: %d files, %s each (hash: %s...) decided by %s\n",
+		t.sets, len(set.Files), formatSize(set.Size), set.Hash[:16], plan.DecidedBy))
+	sb.WriteString(fmt.Sprintf("  KEEP    %s%s\n", plan.Keeper.Path, metadataLabel(plan.Keeper)))
+	for _, retained := range plan.Retain {
+		sb.WriteString(fmt.Sprintf("  RETAIN  %s%s  [%s]\n", retained.File.Path, metadataLabel(retained.File), retained.Reason))
+	}
+	for _, file := range plan.Remove {
+		sb.WriteString(fmt.Sprintf("  REMOVE  %s%s\n", file.Path, metadataLabel(file)))
+	}
+	for _, violation := range plan.Violations {
+		sb.WriteString(fmt.Sprintf("  VIOLATION  %s\n", violation))
+	}
+	sb.WriteString("\n")
+
+	_, err = io.WriteString(t.w, sb.String())
+	return err
+}
+
+func (t *planTableWriter) Close() error {
+	if t.sets == 0 {
+		_, err := io.WriteString(t.w, "No duplicates found.\n")
+		return err
+	}
+	_, err := fmt.Fprintf(t.w, "Plan: %d duplicate sets, %d files to remove, %s reclaimable\n",
+		t.sets, t.removeFiles, formatSize(t.reclaimable))
+	if err == nil && t.violations > 0 {
+		_, err = fmt.Fprintf(t.w, "Policy violations: %d\n", t.violations)
+	}
+	return err
+}
+
+// JSONPlan is the JSON representation of the keep/remove split of a set
+type JSONPlan struct {
+	Hash       string         `json:"hash"`
+	Size       int64          `json:"size"`
+	DecidedBy  string         `json:"decided_by"`
+	Keep       JSONFile       `json:"keep"`
+	Retain     []JSONRetained `json:"retain,omitempty"`
+	Remove     []JSONFile     `json:"remove"`
+	Violations []string       `json:"violations,omitempty"`
+}
+
+// JSONRetained is a copy retained by a policy, with the reason
+type JSONRetained struct {
+	JSONFile
+	Reason string `json:"reason"`
+}
+
+// NewJSONPlan converts a plan to its JSON representation
+func NewJSONPlan(plan *Plan) JSONPlan {
+	remove := make([]JSONFile, len(plan.Remove))
+	for i, file := range plan.Remove {
+		remove[i] = NewJSONFile(file)
+	}
+
+	var retain []JSONRetained
+	for _, retained := range plan.Retain {
+		retain = append(retain, JSONRetained{JSONFile: NewJSONFile(retained.File), Reason: retained.Reason})
+	}
+
+	return JSONPlan{
+		Hash:       plan.Set.Hash,
+		Size:       plan.Set.Size,
+		DecidedBy:  plan.DecidedBy,
+		Keep:       NewJSONFile(plan.Keeper),
+		Retain:     retain,
+		Remove:     remove,
+		Violations: plan.Violations,
+	}
+}
+
+// NewPlanJSONWriter creates a writer producing a JSON array of plans
+func (f *Formatter) NewPlanJSONWriter(w io.Writer, planner *Planner) SetWriter {
+	return &jsonWriter{w: w, element: func(set *DuplicateSet) (interface{}, error) {
+		plan, err := planner.Plan(set)
+		if err != nil {
+			return nil, err
+		}
+		return NewJSONPlan(plan), nil
+	}}
 }
 
 // formatSize formats byte size in human-readable format
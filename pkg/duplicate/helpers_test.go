@@ -0,0 +1,91 @@
+package duplicate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/hash"
+
+	_ "modernc.org/sqlite"
+)
+
+// testCatalog is a migrated catalog holding one root folder of the local
+// host backed by a temporary directory
+type testCatalog struct {
+	t        *testing.T
+	db       *sql.DB
+	root     *datastore.RootFolder
+	folderID int64
+}
+
+// newTestCatalog creates an empty catalog and root folder
+func newTestCatalog(t *testing.T) *testCatalog {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "catalog.db")+
+		"?_pragma=busy_timeout(10000)&_pragma=foreign_keys(ON)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := datastore.RunMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := datastore.RegisterLocalHost(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := &datastore.RootFolder{HostID: int64(host.Id), Path: t.TempDir()}
+	if root.ID, err = datastore.InsertRootFolder(db, root); err != nil {
+		t.Fatal(err)
+	}
+	folderID, err := datastore.InsertFolder(db, &datastore.Folder{Path: root.Path, RootFolderID: root.ID,
+		FirstScannedAt: 1, LastScannedAt: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCatalog{t: t, db: db, root: root, folderID: folderID}
+}
+
+// catalog records a file of the root folder with the given size and hash,
+// whether or not it exists on disk
+func (c *testCatalog) catalog(name string, size int64, hashValue string) *datastore.File {
+	c.t.Helper()
+	algorithm := "sha256"
+	file := &datastore.File{Path: filepath.Join(c.root.Path, name), Size: size, Mtime: 1,
+		HashValue: &hashValue, HashAlgorithm: &algorithm, FirstScannedAt: 1, LastScannedAt: 1,
+		FolderID: c.folderID, RootFolderID: c.root.ID, RootFolderPath: c.root.Path}
+	var err error
+	if file.ID, err = datastore.InsertFile(c.db, file); err != nil {
+		c.t.Fatal(err)
+	}
+	return file
+}
+
+// addFile writes a file under the root folder and catalogues it, hashed,
+// as a scan would
+func (c *testCatalog) addFile(name, content string) *datastore.File {
+	c.t.Helper()
+	path := filepath.Join(c.root.Path, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		c.t.Fatal(err)
+	}
+	// Catalogued files are dated 1 second into the epoch
+	if err := os.Chtimes(path, time.Unix(1, 0), time.Unix(1, 0)); err != nil {
+		c.t.Fatal(err)
+	}
+	hasher, err := hash.NewHasher("sha256")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	hashValue, err := hasher.Hash(context.Background(), path)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return c.catalog(name, int64(len(content)), hashValue)
+}
@@ -0,0 +1,348 @@
+package duplicate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+)
+
+// Rule ranks the files of a duplicate set when choosing the copy to keep.
+// Rules are applied in order: only the files sharing the highest rank stay
+// candidates for the next rule, so earlier rules take precedence.
+type Rule interface {
+	// Name identifies the rule in plans, in its configuration syntax
+	Name() string
+	// Rank scores a file; higher ranks are preferred as keeper
+	Rank(file *datastore.File) (int64, error)
+}
+
+// PriorityFunc returns the retention policy priority of a file.
+// Files without an assigned priority should return 0.
+type PriorityFunc func(file *datastore.File) (int64, error)
+
+// PolicyFunc returns the retention policy in effect for a file, or nil
+type PolicyFunc func(file *datastore.File) (*entities.Policy, error)
+
+// PolicyPriority derives file priorities from their retention policies.
+// Copies without a policy, or past its maximum age, have priority 0.
+func PolicyPriority(policy PolicyFunc) PriorityFunc {
+	now := time.Now()
+	return func(file *datastore.File) (int64, error) {
+		p, err := policy(file)
+		if err != nil || p == nil || p.Expired(file.Mtime, now) {
+			return 0, err
+		}
+		return int64(p.Priority), nil
+	}
+}
+
+// TieBreakRule names the final deterministic choice made when every rule
+// leaves more than one candidate: the lexically smallest path is kept
+const TieBreakRule = "path-order"
+
+// KeeperRuleHelp describes the rule syntax for command help text
+const KeeperRuleHelp = `  prefer-root=<path>   keep copies under this root folder
+  prefer-path=<glob>   keep copies whose path matches the glob (** matches directories)
+  oldest               keep the copy with the oldest modification time
+  newest               keep the copy with the newest modification time
+  shortest-path        keep the copy with the shortest path
+  priority             keep the copy with the highest retention policy priority`
+
+// ParseRules parses keeper rule specifications such as "prefer-root=/data",
+// "prefer-path=**/Photos/**" or "oldest". The priority function backs the
+// "priority" rule; when nil, all files have priority 0.
+func ParseRules(specs []string, priority PriorityFunc) ([]Rule, error) {
+	rules := make([]Rule, 0, len(specs))
+	for _, spec := range specs {
+		rule, err := ParseRule(spec, priority)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ParseRule parses a single keeper rule specification
+func ParseRule(spec string, priority PriorityFunc) (Rule, error) {
+	name, arg, hasArg := strings.Cut(strings.TrimSpace(spec), "=")
+
+	switch name {
+	case "prefer-root":
+		if !hasArg || arg == "" {
+			return nil, fmt.Errorf("rule %q requires a root folder path (prefer-root=<path>)", spec)
+		}
+		absPath, err := pathutil.ToAbsolute(arg)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", spec, err)
+		}
+		return &preferRootRule{root: absPath}, nil
+	case "prefer-path":
+		if !hasArg || arg == "" {
+			return nil, fmt.Errorf("rule %q requires a glob pattern (prefer-path=<glob>)", spec)
+		}
+		glob, err := pathutil.CompileGlob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", spec, err)
+		}
+		return &preferPathRule{glob: glob}, nil
+	}
+
+	if hasArg {
+		return nil, fmt.Errorf("rule %q does not take an argument", name)
+	}
+
+	switch name {
+	case "oldest":
+		return &mtimeRule{name: name, oldest: true}, nil
+	case "newest":
+		return &mtimeRule{name: name}, nil
+	case "shortest-path":
+		return shortestPathRule{}, nil
+	case "priority":
+		return &priorityRule{priority: priority}, nil
+	default:
+		return nil, fmt.Errorf("unknown keeper rule %q", spec)
+	}
+}
+
+// preferRootRule prefers files located under a given root folder
+type preferRootRule struct {
+	root string
+}
+
+func (r *preferRootRule) Name() string {
+	return "prefer-root=" + r.root
+}
+
+func (r *preferRootRule) Rank(file *datastore.File) (int64, error) {
+	root := pathutil.NormalizePathForComparison(r.root, file.RootCaseInsensitive)
+	path := pathutil.NormalizePathForComparison(file.Path, file.RootCaseInsensitive)
+	if pathutil.IsSubpath(root, path) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// preferPathRule prefers files whose path matches a glob pattern
+type preferPathRule struct {
+	glob *pathutil.Glob
+}
+
+func (r *preferPathRule) Name() string {
+	return "prefer-path=" + r.glob.String()
+}
+
+func (r *preferPathRule) Rank(file *datastore.File) (int64, error) {
+	if r.glob.Match(file.Path, file.RootCaseInsensitive) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// mtimeRule prefers the oldest or newest modification time
+type mtimeRule struct {
+	name   string
+	oldest bool
+}
+
+func (r *mtimeRule) Name() string {
+	return r.name
+}
+
+func (r *mtimeRule) Rank(file *datastore.File) (int64, error) {
+	if r.oldest {
+		return -file.Mtime, nil
+	}
+	return file.Mtime, nil
+}
+
+// shortestPathRule prefers the shortest path
+type shortestPathRule struct{}
+
+func (shortestPathRule) Name() string {
+	return "shortest-path"
+}
+
+func (shortestPathRule) Rank(file *datastore.File) (int64, error) {
+	return -int64(len(file.Path)), nil
+}
+
+// priorityRule prefers the highest retention policy priority
+type priorityRule struct {
+	priority PriorityFunc
+}
+
+func (r *priorityRule) Name() string {
+	return "priority"
+}
+
+func (r *priorityRule) Rank(file *datastore.File) (int64, error) {
+	if r.priority == nil {
+		return 0, nil
+	}
+	return r.priority(file)
+}
+
+// Plan is the keep/remove split chosen for one duplicate set
+type Plan struct {
+	Set        *DuplicateSet
+	Keeper     *datastore.File
+	Remove     []*datastore.File
+	Retain     []Retained // Copies the rules would remove but a policy retains
+	DecidedBy  string     // Name of the rule that singled out the keeper
+	Violations []string   // Policy requirements the set cannot meet
+}
+
+// Retained is a copy kept in addition to the keeper, and why
+type Retained struct {
+	File   *datastore.File
+	Reason string
+}
+
+// Planner selects the keeper of each duplicate set from ordered rules
+type Planner struct {
+	rules  []Rule
+	policy PolicyFunc
+	now    time.Time
+}
+
+// NewPlanner creates a planner applying rules in order
+func NewPlanner(rules []Rule) *Planner {
+	return &Planner{rules: rules}
+}
+
+// WithPolicies makes the planner enforce retention policies: copies under
+// a protected policy are never removed and every set keeps the minimum
+// number of copies its policies require. Expired copies are not retained.
+func (p *Planner) WithPolicies(policy PolicyFunc) *Planner {
+	p.policy = policy
+	p.now = time.Now()
+	return p
+}
+
+// Plan picks the keeper of a set and reports which rule decided
+func (p *Planner) Plan(set *DuplicateSet) (*Plan, error) {
+	if len(set.Files) == 0 {
+		return nil, fmt.Errorf("duplicate set %s has no files", set.Hash)
+	}
+
+	candidates := append([]*datastore.File(nil), set.Files...)
+	decidedBy := ""
+	for _, rule := range p.rules {
+		if len(candidates) == 1 {
+			break
+		}
+		narrowed, err := narrow(rule, candidates)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name(), err)
+		}
+		if len(narrowed) < len(candidates) {
+			decidedBy = rule.Name()
+		}
+		candidates = narrowed
+	}
+
+	if len(candidates) > 1 {
+		// No rule could separate the remaining copies
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Path < candidates[j].Path })
+		decidedBy = TieBreakRule
+	}
+	keeper := candidates[0]
+
+	plan := &Plan{Set: set, Keeper: keeper, DecidedBy: decidedBy}
+	for _, file := range set.Files {
+		if file != keeper {
+			plan.Remove = append(plan.Remove, file)
+		}
+	}
+	if p.policy != nil {
+		if err := p.enforcePolicies(plan); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// enforcePolicies moves copies the policies retain from Remove to Retain
+// and records the requirements the set cannot meet
+func (p *Planner) enforcePolicies(plan *Plan) error {
+	policies := make(map[*datastore.File]*entities.Policy)
+	var strictest *entities.Policy
+	for _, file := range plan.Set.Files {
+		policy, err := p.policy(file)
+		if err != nil {
+			return fmt.Errorf("failed to resolve policy of %s: %w", file.Path, err)
+		}
+		if policy == nil || policy.Expired(file.Mtime, p.now) {
+			continue
+		}
+		policies[file] = policy
+		if strictest == nil || policy.MinCopies > strictest.MinCopies {
+			strictest = policy
+		}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	var remove []*datastore.File
+	for _, file := range plan.Remove {
+		if policy := policies[file]; policy != nil && policy.Protected {
+			plan.Retain = append(plan.Retain, Retained{File: file, Reason: "policy " + policy.Name + " is protected"})
+			continue
+		}
+		remove = append(remove, file)
+	}
+
+	// Keep the copies the policies govern first, then any other copy
+	required := strictest.MinCopies
+	kept := 1 + len(plan.Retain)
+	for _, governed := range []bool{true, false} {
+		var rest []*datastore.File
+		for _, file := range remove {
+			if kept < required && (policies[file] != nil) == governed {
+				plan.Retain = append(plan.Retain, Retained{
+					File:   file,
+					Reason: fmt.Sprintf("policy %s requires %d copies", strictest.Name, required),
+				})
+				kept++
+				continue
+			}
+			rest = append(rest, file)
+		}
+		remove = rest
+	}
+	plan.Remove = remove
+
+	if len(plan.Set.Files) < required {
+		plan.Violations = append(plan.Violations, fmt.Sprintf("policy %s requires %d copies, only %d exist",
+			strictest.Name, required, len(plan.Set.Files)))
+	}
+	return nil
+}
+
+// narrow keeps only the candidates sharing the highest rank
+func narrow(rule Rule, candidates []*datastore.File) ([]*datastore.File, error) {
+	var best int64
+	var kept []*datastore.File
+	for i, file := range candidates {
+		rank, err := rule.Rank(file)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0 || rank > best:
+			best = rank
+			kept = []*datastore.File{file}
+		case rank == best:
+			kept = append(kept, file)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,89 @@
+package duplicate
+
+import (
+	"testing"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+)
+
+func TestPlannerRules(t *testing.T) {
+	// Two copies under /archive, the older one deeper; one newer copy
+	// under /photos with the shortest path
+	files := []*datastore.File{
+		{Path: "/photos/a.jpg", Mtime: 300},
+		{Path: "/archive/2020/a.jpg", Mtime: 100},
+		{Path: "/archive/a.jpg", Mtime: 200},
+	}
+	priorities := map[string]int64{"/archive/a.jpg": 5, "/archive/2020/a.jpg": 5}
+	priority := func(file *datastore.File) (int64, error) { return priorities[file.Path], nil }
+
+	for _, tc := range []struct {
+		name      string
+		rules     []string
+		keeper    string
+		decidedBy string
+	}{
+		{"first rule decides", []string{"oldest", "newest"}, "/archive/2020/a.jpg", "oldest"},
+		{"order matters", []string{"newest", "oldest"}, "/photos/a.jpg", "newest"},
+		{"tie passes to next rule", []string{"prefer-root=/archive", "shortest-path"}, "/archive/a.jpg", "shortest-path"},
+		{"rule that narrows last decides", []string{"priority", "prefer-path=/archive/**", "newest"}, "/archive/a.jpg", "newest"},
+		{"rules after a single candidate are skipped", []string{"prefer-path=/photos/*", "oldest"}, "/photos/a.jpg", "prefer-path=/photos/*"},
+		{"glob class", []string{"prefer-path=/archive/[0-9]*/*"}, "/archive/2020/a.jpg", "prefer-path=/archive/[0-9]*/*"},
+		{"no rule separates", []string{"prefer-path=**/*.png"}, "/archive/2020/a.jpg", TieBreakRule},
+		{"no rules", nil, "/archive/2020/a.jpg", TieBreakRule},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseRules(tc.rules, priority)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan, err := NewPlanner(rules).Plan(&DuplicateSet{Hash: "h", Files: files})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan.Keeper.Path != tc.keeper || plan.DecidedBy != tc.decidedBy {
+				t.Errorf("kept %s decided by %q, want %s decided by %q",
+					plan.Keeper.Path, plan.DecidedBy, tc.keeper, tc.decidedBy)
+			}
+			if len(plan.Remove) != len(files)-1 {
+				t.Errorf("removes %d copies, want %d", len(plan.Remove), len(files)-1)
+			}
+		})
+	}
+}
+
+func TestPreferPathFoldsCaseInsensitiveRoots(t *testing.T) {
+	rules, err := ParseRules([]string{"prefer-path=**/PHOTOS/*"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		caseInsensitive bool
+		keeper          string
+		decidedBy       string
+	}{
+		{false, "/a/other.jpg", TieBreakRule},
+		{true, "/b/photos/x.jpg", "prefer-path=**/PHOTOS/*"},
+	} {
+		files := []*datastore.File{
+			{Path: "/b/photos/x.jpg", RootCaseInsensitive: tc.caseInsensitive},
+			{Path: "/a/other.jpg", RootCaseInsensitive: tc.caseInsensitive},
+		}
+		plan, err := NewPlanner(rules).Plan(&DuplicateSet{Hash: "h", Files: files})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.Keeper.Path != tc.keeper || plan.DecidedBy != tc.decidedBy {
+			t.Errorf("case-insensitive %v: kept %s decided by %q, want %s decided by %q",
+				tc.caseInsensitive, plan.Keeper.Path, plan.DecidedBy, tc.keeper, tc.decidedBy)
+		}
+	}
+}
+
+func TestParseRulesRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"prefer-root", "prefer-path=", "prefer-path=/data/[a", "oldest=1", "largest"} {
+		if _, err := ParseRules([]string{spec}, nil); err == nil {
+			t.Errorf("ParseRules(%q) succeeded, want an error", spec)
+		}
+	}
+}
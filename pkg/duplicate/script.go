@@ -0,0 +1,343 @@
+package duplicate
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Script shells
+const (
+	ScriptBash       = "bash"
+	ScriptPowerShell = "powershell"
+)
+
+// Script link kinds; an empty link kind removes copies
+const (
+	ScriptLinkHard    = "hard"
+	ScriptLinkReflink = "reflink"
+	ScriptLinkSymlink = "symlink"
+)
+
+// ScriptOptions selects the shell and action of a remediation script
+type ScriptOptions struct {
+	Shell string // ScriptBash or ScriptPowerShell
+	Link  string // ScriptLink* kind, or empty to remove copies
+}
+
+// Validate checks that the shell supports the requested action
+func (o ScriptOptions) Validate() error {
+	switch o.Shell {
+	case ScriptBash, ScriptPowerShell:
+	default:
+		return fmt.Errorf("unknown script shell %q (use %s or %s)", o.Shell, ScriptBash, ScriptPowerShell)
+	}
+	switch o.Link {
+	case "", ScriptLinkHard, ScriptLinkSymlink:
+	case ScriptLinkReflink:
+		if o.Shell == ScriptPowerShell {
+			return fmt.Errorf("reflinks are not available in %s scripts", ScriptPowerShell)
+		}
+	default:
+		return fmt.Errorf("unknown link kind %q (use %s, %s or %s)", o.Link, ScriptLinkHard, ScriptLinkReflink, ScriptLinkSymlink)
+	}
+	return nil
+}
+
+// scriptDialect renders the shell-specific parts of a remediation script
+type scriptDialect interface {
+	header(opts ScriptOptions) string
+	checkKeeper(path string, size int64, hash, algorithm string) string
+	remove(path string, size int64, hash, algorithm string) string
+	link(kind, keeper, path, tmp string, size int64, hash, algorithm string) string
+	footer(sets, files int, reclaimable string) string
+}
+
+// scriptWriter emits a self-checking script that removes or links the
+// non-keeper copies of each set. Every copy's size and hash are checked
+// immediately before it is touched and the script aborts on a mismatch.
+type scriptWriter struct {
+	w           io.Writer
+	planner     *Planner
+	opts        ScriptOptions
+	dialect     scriptDialect
+	started     bool
+	sets        int
+	removeFiles int
+	reclaimable int64
+}
+
+// NewPlanScriptWriter creates a writer producing a reviewable remediation
+// script from the keeper plan of each set
+func (f *Formatter) NewPlanScriptWriter(w io.Writer, planner *Planner, opts ScriptOptions) (SetWriter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	var dialect scriptDialect = bashDialect{}
+	if opts.Shell == ScriptPowerShell {
+		dialect = powerShellDialect{}
+	}
+	return &scriptWriter{w: w, planner: planner, opts: opts, dialect: dialect}, nil
+}
+
+func (s *scriptWriter) start() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	_, err := io.WriteString(s.w, s.dialect.header(s.opts))
+	return err
+}
+
+func (s *scriptWriter) WriteSet(set *DuplicateSet) error {
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	plan, err := s.planner.Plan(set)
+	if err != nil {
+		return err
+	}
+	algorithm := ""
+	if plan.Keeper.HashAlgorithm != nil {
+		algorithm = *plan.Keeper.HashAlgorithm
+	}
+	if algorithm == "" {
+		return fmt.Errorf("set %s has no hash algorithm", set.Hash)
+	}
+
+	s.sets++
+	s.removeFiles += len(plan.Remove)
+	s.reclaimable += set.Size * int64(len(plan.Remove))
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("\n# Set %d: %s each (hash: %s...) decided by %s\n",
+		s.sets, formatSize(set.Size), set.Hash[:16], scriptComment(plan.DecidedBy)))
+	sb.WriteString(s.dialect.checkKeeper(plan.Keeper.Path, set.Size, set.Hash, algorithm))
+	for _, retained := range plan.Retain {
+		sb.WriteString(fmt.Sprintf("# Retained: %s (%s)\n", scriptComment(retained.File.Path), scriptComment(retained.Reason)))
+	}
+	for _, violation := range plan.Violations {
+		sb.WriteString(fmt.Sprintf("# Policy violation: %s\n", scriptComment(violation)))
+	}
+	for _, file := range plan.Remove {
+		if s.opts.Link == "" {
+			sb.WriteString(s.dialect.remove(file.Path, set.Size, set.Hash, algorithm))
+			continue
+		}
+		tmp := filepath.Join(filepath.Dir(file.Path), "."+filepath.Base(file.Path)+".dupectl.tmp")
+		sb.WriteString(s.dialect.link(s.opts.Link, plan.Keeper.Path, file.Path, tmp, set.Size, set.Hash, algorithm))
+	}
+
+	_, err = io.WriteString(s.w, sb.String())
+	return err
+}
+
+func (s *scriptWriter) Close() error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(s.w, s.dialect.footer(s.sets, s.removeFiles, formatSize(s.reclaimable)))
+	return err
+}
+
+// scriptComment keeps text from breaking out of a one-line comment
+func scriptComment(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// scriptAction describes what a script does to each copy
+func scriptAction(opts ScriptOptions) string {
+	if opts.Link == "" {
+		return "remove duplicate copies"
+	}
+	return fmt.Sprintf("replace duplicate copies with %s links", opts.Link)
+}
+
+// bashDialect renders POSIX shell commands for bash
+type bashDialect struct{}
+
+// bashQuote quotes s as a single-quoted shell word
+func bashQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (bashDialect) header(opts ScriptOptions) string {
+	return fmt.Sprintf(`#!/usr/bin/env bash
+# Generated by dupectl on %s to %s.
+# Review before running. Each file's size and hash are checked before it
+# is touched; the script stops at the first mismatch.
+set -euo pipefail
+
+die() {
+    printf 'dupectl: %%s\n' "$1" >&2
+    exit 1
+}
+
+file_hash() {
+    case "$2" in
+        sha256) { sha256sum 2>/dev/null || shasum -a 256; } <"$1" | cut -d' ' -f1 ;;
+        sha512) { sha512sum 2>/dev/null || shasum -a 512; } <"$1" | cut -d' ' -f1 ;;
+        sha3-256) openssl dgst -sha3-256 -r <"$1" | cut -d' ' -f1 ;;
+        *) die "unsupported hash algorithm $2" ;;
+    esac
+}
+
+# check <path> <size> <hash> <algorithm>
+check() {
+    [ -f "$1" ] && [ ! -L "$1" ] || die "$1 is missing or not a regular file"
+    [ "$(wc -c <"$1" | tr -d ' ')" = "$2" ] || die "$1 size changed, expected $2 bytes"
+    [ "$(file_hash "$1" "$4")" = "$3" ] || die "$1 content changed, expected $4 $3"
+}
+
+# remove <path> <size> <hash> <algorithm>
+remove() {
+    check "$1" "$2" "$3" "$4"
+    rm -f -- "$1"
+    printf 'removed %%s\n' "$1"
+}
+
+# link <kind> <keeper> <path> <tmp> <size> <hash> <algorithm>
+link() {
+    check "$3" "$5" "$6" "$7"
+    rm -f -- "$4"
+    case "$1" in
+        hard) ln -- "$2" "$4" ;;
+        symlink) ln -s -- "$2" "$4" ;;
+        reflink)
+            cp --reflink=always -- "$2" "$4"
+            chmod --reference="$3" -- "$4"
+            touch -r "$3" -- "$4"
+            ;;
+    esac
+    mv -f -- "$4" "$3" || { rm -f -- "$4"; die "failed to replace $3"; }
+    printf 'linked %%s -> %%s\n' "$3" "$2"
+}
+`, time.Now().Format(time.RFC3339), scriptAction(opts))
+}
+
+func (bashDialect) checkKeeper(path string, size int64, hash, algorithm string) string {
+	return fmt.Sprintf("check %s %d %s %s\n", bashQuote(path), size, hash, bashQuote(algorithm))
+}
+
+func (bashDialect) remove(path string, size int64, hash, algorithm string) string {
+	return fmt.Sprintf("remove %s %d %s %s\n", bashQuote(path), size, hash, bashQuote(algorithm))
+}
+
+func (bashDialect) link(kind, keeper, path, tmp string, size int64, hash, algorithm string) string {
+	return fmt.Sprintf("link %s %s %s %s %d %s %s\n",
+		kind, bashQuote(keeper), bashQuote(path), bashQuote(tmp), size, hash, bashQuote(algorithm))
+}
+
+func (bashDialect) footer(sets, files int, reclaimable string) string {
+	if sets == 0 {
+		return "\necho 'No duplicates found.'\n"
+	}
+	return fmt.Sprintf("\necho %s\n", bashQuote(fmt.Sprintf("Done: %d duplicate sets, %d files, %s reclaimed", sets, files, reclaimable)))
+}
+
+// powerShellDialect renders Windows PowerShell (5.1 and later) commands
+type powerShellDialect struct{}
+
+// powerShellQuote quotes s as a single-quoted PowerShell string. PowerShell
+// also ends single-quoted strings at typographic single quotes, so those
+// are doubled as well.
+func powerShellQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			sb.WriteRune(r)
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
+
+func (powerShellDialect) header(opts ScriptOptions) string {
+	return fmt.Sprintf(`# Generated by dupectl on %s to %s.
+# Review before running. Each file's size and hash are checked before it
+# is touched; the script stops at the first mismatch.
+$ErrorActionPreference = 'Stop'
+
+function Get-DupectlHash([string]$Path, [string]$Algorithm) {
+    switch ($Algorithm) {
+        'sha256' { return (Get-FileHash -LiteralPath $Path -Algorithm SHA256).Hash.ToLowerInvariant() }
+        'sha512' { return (Get-FileHash -LiteralPath $Path -Algorithm SHA512).Hash.ToLowerInvariant() }
+        'sha3-256' {
+            $stream = [System.IO.File]::OpenRead($Path)
+            try {
+                $bytes = [System.Security.Cryptography.SHA3_256]::HashData($stream)
+            } finally {
+                $stream.Dispose()
+            }
+            return ([System.BitConverter]::ToString($bytes) -replace '-', '').ToLowerInvariant()
+        }
+        default { throw "dupectl: unsupported hash algorithm $Algorithm" }
+    }
+}
+
+function Assert-DupectlFile([string]$Path, [long]$Size, [string]$Hash, [string]$Algorithm) {
+    $item = Get-Item -LiteralPath $Path -Force -ErrorAction SilentlyContinue
+    if (-not $item -or $item.PSIsContainer -or $item.LinkType -in 'SymbolicLink', 'Junction') {
+        throw "dupectl: $Path is missing or not a regular file"
+    }
+    if ($item.Length -ne $Size) {
+        throw "dupectl: $Path size changed, expected $Size bytes"
+    }
+    if ((Get-DupectlHash $Path $Algorithm) -ne $Hash) {
+        throw "dupectl: $Path content changed, expected $Algorithm $Hash"
+    }
+}
+
+function Remove-DupectlCopy([string]$Path, [long]$Size, [string]$Hash, [string]$Algorithm) {
+    Assert-DupectlFile $Path $Size $Hash $Algorithm
+    Remove-Item -LiteralPath $Path -Force
+    Write-Output "removed $Path"
+}
+
+function Set-DupectlLink([string]$Kind, [string]$Keeper, [string]$Path, [string]$Temp, [long]$Size, [string]$Hash, [string]$Algorithm) {
+    Assert-DupectlFile $Path $Size $Hash $Algorithm
+    Remove-Item -LiteralPath $Temp -Force -ErrorAction SilentlyContinue
+    $itemType = if ($Kind -eq 'hard') { 'HardLink' } else { 'SymbolicLink' }
+    New-Item -ItemType $itemType -Path $Temp -Value $Keeper | Out-Null
+    try {
+        Move-Item -LiteralPath $Temp -Destination $Path -Force
+    } catch {
+        Remove-Item -LiteralPath $Temp -Force -ErrorAction SilentlyContinue
+        throw
+    }
+    Write-Output "linked $Path -> $Keeper"
+}
+`, time.Now().Format(time.RFC3339), scriptAction(opts))
+}
+
+func (powerShellDialect) checkKeeper(path string, size int64, hash, algorithm string) string {
+	return fmt.Sprintf("Assert-DupectlFile %s %d '%s' %s\n", powerShellQuote(path), size, hash, powerShellQuote(algorithm))
+}
+
+func (powerShellDialect) remove(path string, size int64, hash, algorithm string) string {
+	return fmt.Sprintf("Remove-DupectlCopy %s %d '%s' %s\n", powerShellQuote(path), size, hash, powerShellQuote(algorithm))
+}
+
+func (powerShellDialect) link(kind, keeper, path, tmp string, size int64, hash, algorithm string) string {
+	return fmt.Sprintf("Set-DupectlLink '%s' %s %s %s %d '%s' %s\n",
+		kind, powerShellQuote(keeper), powerShellQuote(path), powerShellQuote(tmp), size, hash, powerShellQuote(algorithm))
+}
+
+func (powerShellDialect) footer(sets, files int, reclaimable string) string {
+	if sets == 0 {
+		return "\nWrite-Output 'No duplicates found.'\n"
+	}
+	return fmt.Sprintf("\nWrite-Output %s\n", powerShellQuote(fmt.Sprintf("Done: %d duplicate sets, %d files, %s reclaimed", sets, files, reclaimable)))
+}
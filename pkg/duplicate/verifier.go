@@ -0,0 +1,313 @@
+package duplicate
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+)
+
+// compareChunkSize is the number of bytes read from each file per comparison step
+const compareChunkSize = 64 * 1024
+
+// maxOpenFiles bounds the files of a set compared at once
+const maxOpenFiles = 32
+
+// Verifier re-reads the files of duplicate sets and compares them
+// byte-for-byte before any remediation is allowed to act on them
+type Verifier struct {
+	db *sql.DB
+}
+
+// NewVerifier creates a duplicate set verifier
+func NewVerifier(db *sql.DB) *Verifier {
+	return &Verifier{db: db}
+}
+
+// VerifySet checks every file of set against the catalog and against each
+// other, then stores the result. Files whose size or mtime changed since
+// hashing make the set stale; differing contents make it mismatched.
+func (v *Verifier) VerifySet(ctx context.Context, set *DuplicateSet) (*datastore.DuplicateVerification, error) {
+	result := &datastore.DuplicateVerification{
+		HashValue:  set.Hash,
+		Size:       set.Size,
+		VerifiedAt: time.Now().Unix(),
+	}
+
+	// Re-check size and mtime against the catalog
+	var current []*datastore.VerificationFile
+	var currentPaths []string
+	for _, file := range set.Files {
+		vf := &datastore.VerificationFile{FileID: file.ID, Path: file.Path, Status: datastore.VerificationFileMatch}
+		result.Files = append(result.Files, vf)
+
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			vf.Status = fileErrorStatus(err)
+			vf.Detail = stringPtr(err.Error())
+			continue
+		}
+
+		vf.Size = info.Size()
+		vf.Mtime = info.ModTime().Unix()
+		if vf.Size != file.Size || vf.Mtime != file.Mtime {
+			vf.Status = datastore.VerificationFileStale
+			vf.Detail = stringPtr(fmt.Sprintf("changed since hashing: size %d -> %d, mtime %d -> %d",
+				file.Size, vf.Size, file.Mtime, vf.Mtime))
+			continue
+		}
+
+		current = append(current, vf)
+		currentPaths = append(currentPaths, file.Path)
+	}
+
+	// Compare contents of the files that are still current
+	if len(current) > 1 {
+		groups, failed, err := compareFiles(ctx, currentPaths)
+		if err != nil {
+			return nil, err
+		}
+		for idx, err := range failed {
+			current[idx].Status = fileErrorStatus(err)
+			current[idx].Detail = stringPtr(err.Error())
+		}
+
+		// The largest group of identical files is the reference; any file
+		// outside it does not match despite sharing the hash
+		largest := 0
+		for i, group := range groups {
+			if len(group) > len(groups[largest]) {
+				largest = i
+			}
+		}
+		for i, group := range groups {
+			if i == largest {
+				continue
+			}
+			for _, idx := range group {
+				current[idx].Status = datastore.VerificationFileMismatch
+				current[idx].Detail = stringPtr("contents differ from other files in the set")
+			}
+		}
+	}
+
+	result.Status = setStatus(result.Files)
+
+	if _, err := datastore.SaveVerification(v.db, result); err != nil {
+		return nil, fmt.Errorf("failed to save verification: %w", err)
+	}
+	return result, nil
+}
+
+// fileErrorStatus is the outcome of a file that could not be read
+func fileErrorStatus(err error) string {
+	if errors.Is(err, fs.ErrNotExist) {
+		return datastore.VerificationFileMissing
+	}
+	return datastore.VerificationFileStale
+}
+
+// setStatus derives the set status from its per-file statuses
+func setStatus(files []*datastore.VerificationFile) string {
+	matches := 0
+	status := datastore.VerificationVerified
+	for _, file := range files {
+		switch file.Status {
+		case datastore.VerificationFileMatch:
+			matches++
+		case datastore.VerificationFileMismatch:
+			return datastore.VerificationMismatched
+		default:
+			status = datastore.VerificationStale
+		}
+	}
+	if matches < 2 {
+		return datastore.VerificationStale
+	}
+	return status
+}
+
+// CompareFiles reports whether the files at a and b have identical contents
+func CompareFiles(ctx context.Context, a, b string) (bool, error) {
+	groups, failed, err := compareFiles(ctx, []string{a, b})
+	if err != nil {
+		return false, err
+	}
+	for _, err := range failed {
+		return false, err
+	}
+	return len(groups) == 1, nil
+}
+
+// compareFiles partitions files into groups of identical content, holding
+// at most maxOpenFiles open at once. Returned groups hold indexes into
+// paths; files that cannot be opened or read are left out of the groups
+// and returned in failed, by index.
+func compareFiles(ctx context.Context, paths []string) ([][]int, map[int]error, error) {
+	failed := make(map[int]error)
+	var groups [][]int
+	for next := 0; next < len(paths); {
+		// Each batch after the first is read along with a member of the
+		// first group, which the batch's files are expected to match
+		var batch []int
+		if len(groups) > 0 {
+			batch = append(batch, groups[0][0])
+		}
+		for ; next < len(paths) && len(batch) < maxOpenFiles; next++ {
+			batch = append(batch, next)
+		}
+		split, err := compareBatch(ctx, paths, batch, failed)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(groups) > 0 {
+			reference := batch[0]
+			if _, ok := failed[reference]; ok {
+				// The reference vanished meanwhile: the first group
+				// carries on without it
+				groups[0] = groups[0][1:]
+				if len(groups[0]) == 0 {
+					groups = groups[1:]
+				}
+			}
+			for i, group := range split {
+				if group[0] == reference {
+					groups[0] = append(groups[0], group[1:]...)
+					split[i] = nil
+				}
+			}
+		}
+
+		// Groups differing from the reference may still match earlier ones
+		for _, group := range split {
+			if group == nil {
+				continue
+			}
+			merged := false
+			for g := 1; g < len(groups) && !merged; g++ {
+				pair, err := compareBatch(ctx, paths, []int{groups[g][0], group[0]}, failed)
+				if err != nil {
+					return nil, nil, err
+				}
+				if len(pair) == 1 && len(pair[0]) == 2 {
+					groups[g] = append(groups[g], group...)
+					merged = true
+				}
+			}
+			if !merged {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	// A representative may have failed while compared with another group
+	var readable [][]int
+	for _, group := range groups {
+		group = slices.DeleteFunc(group, func(idx int) bool { return failed[idx] != nil })
+		if len(group) > 0 {
+			readable = append(readable, group)
+		}
+	}
+	return readable, failed, nil
+}
+
+// compareBatch reads the files of a batch in lockstep and partitions them
+// into groups of identical content. Files that fail to open or read are
+// recorded in failed and left out.
+func compareBatch(ctx context.Context, paths []string, batch []int, failed map[int]error) ([][]int, error) {
+	files := make(map[int]*os.File, len(batch))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	var opened []int
+	for _, idx := range batch {
+		f, err := os.Open(paths[idx])
+		if err != nil {
+			failed[idx] = err
+			continue
+		}
+		files[idx] = f
+		opened = append(opened, idx)
+	}
+	if len(opened) == 0 {
+		return nil, nil
+	}
+
+	groups := [][]int{opened}
+	buffers := make(map[int][]byte, len(opened))
+	done := false
+
+	for !done {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		done = true
+		var next [][]int
+		for _, group := range groups {
+			// A single file cannot split any further
+			if len(group) == 1 {
+				next = append(next, group)
+				continue
+			}
+
+			// Read the next chunk of every file in the group
+			var read []int
+			for _, idx := range group {
+				if buffers[idx] == nil {
+					buffers[idx] = make([]byte, compareChunkSize)
+				}
+				n, err := io.ReadFull(files[idx], buffers[idx])
+				if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+					failed[idx] = fmt.Errorf("failed to read %s: %w", paths[idx], err)
+					continue
+				}
+				buffers[idx] = buffers[idx][:n]
+				if n == compareChunkSize {
+					done = false
+				}
+				read = append(read, idx)
+			}
+
+			// Split the group by chunk content
+			var split [][]int
+			for _, idx := range read {
+				placed := false
+				for s, members := range split {
+					if bytes.Equal(buffers[members[0]], buffers[idx]) {
+						split[s] = append(members, idx)
+						placed = true
+						break
+					}
+				}
+				if !placed {
+					split = append(split, []int{idx})
+				}
+			}
+			next = append(next, split...)
+
+			for _, idx := range read {
+				buffers[idx] = buffers[idx][:cap(buffers[idx])]
+			}
+		}
+		groups = next
+	}
+
+	return groups, nil
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
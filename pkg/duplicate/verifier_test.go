@@ -0,0 +1,154 @@
+package duplicate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+)
+
+// verifySet verifies the duplicate set of a file
+func verifySet(t *testing.T, c *testCatalog, file *datastore.File) *datastore.DuplicateVerification {
+	t.Helper()
+	set, err := NewDetector(c.db).GetSet(*file.HashValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewVerifier(c.db).VerifySet(context.Background(), set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// fileStatuses returns the outcome of each file of a verification by name
+func fileStatuses(result *datastore.DuplicateVerification) map[string]string {
+	statuses := map[string]string{}
+	for _, file := range result.Files {
+		statuses[filepath.Base(file.Path)] = file.Status
+	}
+	return statuses
+}
+
+func TestVerifySet(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(c *testCatalog, files []*datastore.File)
+		status string
+		files  map[string]string
+	}{
+		{
+			name:   "identical",
+			change: func(c *testCatalog, files []*datastore.File) {},
+			status: datastore.VerificationVerified,
+			files: map[string]string{"a": datastore.VerificationFileMatch, "b": datastore.VerificationFileMatch,
+				"c": datastore.VerificationFileMatch},
+		},
+		{
+			name: "changed since hashing",
+			change: func(c *testCatalog, files []*datastore.File) {
+				later := time.Now().Add(time.Hour)
+				if err := os.Chtimes(files[2].Path, later, later); err != nil {
+					t.Fatal(err)
+				}
+			},
+			status: datastore.VerificationStale,
+			files: map[string]string{"a": datastore.VerificationFileMatch, "b": datastore.VerificationFileMatch,
+				"c": datastore.VerificationFileStale},
+		},
+		{
+			name: "missing",
+			change: func(c *testCatalog, files []*datastore.File) {
+				if err := os.Remove(files[1].Path); err != nil {
+					t.Fatal(err)
+				}
+			},
+			status: datastore.VerificationStale,
+			files: map[string]string{"a": datastore.VerificationFileMatch, "b": datastore.VerificationFileMissing,
+				"c": datastore.VerificationFileMatch},
+		},
+		{
+			name: "same size and mtime, other contents",
+			change: func(c *testCatalog, files []*datastore.File) {
+				info, err := os.Stat(files[0].Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(files[0].Path, []byte("SAME CONTENTS"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(files[0].Path, info.ModTime(), info.ModTime()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			status: datastore.VerificationMismatched,
+			files: map[string]string{"a": datastore.VerificationFileMismatch, "b": datastore.VerificationFileMatch,
+				"c": datastore.VerificationFileMatch},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCatalog(t)
+			files := []*datastore.File{c.addFile("a", "same contents"), c.addFile("b", "same contents"),
+				c.addFile("c", "same contents")}
+			tc.change(c, files)
+
+			result := verifySet(t, c, files[0])
+			if result.Status != tc.status {
+				t.Errorf("set is %s, want %s", result.Status, tc.status)
+			}
+			got := fileStatuses(result)
+			for name, want := range tc.files {
+				if got[name] != want {
+					t.Errorf("file %s is %s, want %s", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareFilesInBatches(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 2*maxOpenFiles+5; i++ {
+		content := "same"
+		switch i {
+		case 3, 2*maxOpenFiles + 1: // In different batches, alike
+			content = "odd"
+		case maxOpenFiles + 2:
+			content = "unique"
+		}
+		path := filepath.Join(dir, fmt.Sprintf("f%d", i))
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	paths = append(paths, filepath.Join(dir, "missing"))
+
+	groups, failed, err := compareFiles(context.Background(), paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[len(paths)-1] == nil {
+		t.Errorf("got failures %v, want the missing file only", failed)
+	}
+	sizes := map[string]int{}
+	for _, group := range groups {
+		data, err := os.ReadFile(paths[group[0]])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := sizes[string(data)]; ok {
+			t.Errorf("contents %q split over several groups", data)
+		}
+		sizes[string(data)] = len(group)
+	}
+	want := map[string]int{"same": 2*maxOpenFiles + 2, "odd": 2, "unique": 1}
+	if fmt.Sprint(sizes) != fmt.Sprint(want) {
+		t.Errorf("got groups %v, want %v", sizes, want)
+	}
+}
@@ -5,32 +5,114 @@ import (
 )
 
 type Host struct {
-	Id   int    `json:"id"`
-	Name string `json:"name"`
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// MachineID is the client ID of the machine, set when it registers
+	// as an agent or registers its first root folder
+	MachineID string `json:"machine_id,omitempty"`
 }
 
 type Owner struct {
-	Id   int    `json:"id"`
-	Name string `json:"name"`
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
 }
 
+// Policy is a retention policy: the rules governing how copies of the
+// content under it may be deduplicated
 type Policy struct {
-	Id   int    `json:"id"`
-	Name string `json:"name"`
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Priority    int    `json:"priority"`     // Higher priorities are preferred as keeper
+	MinCopies   int    `json:"min_copies"`   // Copies to retain; 0 for no minimum
+	MaxAgeDays  int    `json:"max_age_days"` // Days a copy is retained after its last change; 0 for ever
+	Protected   bool   `json:"protected"`    // Copies may never be marked for deletion
+}
+
+// Expired reports whether a copy last modified at mtime (Unix seconds) is
+// past the policy's maximum age, so the policy no longer retains it
+func (p *Policy) Expired(mtime int64, now time.Time) bool {
+	if p.MaxAgeDays <= 0 {
+		return false
+	}
+	return now.Sub(time.Unix(mtime, 0)) > time.Duration(p.MaxAgeDays)*24*time.Hour
 }
 
 type Purpose struct {
-	Id   int    `json:"id"`
-	Name string `json:"name"`
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
 }
 
 type Agent struct {
-	Id      int        `json:"id"`
-	Name    string     `json:"name"`
-	Guid    string     `json:"uid"`
-	Enabled bool       `json:"enabled"`
-	Updated time.Time  `json:"updated"`
-	Status  StatusName `json:"status"`
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Guid    string `json:"uid"`
+	Enabled bool   `json:"enabled"` // Disabled agents are given no scan jobs
+	// Approval is AgentPending until an admin approves the registration;
+	// only approved agents obtain tokens
+	Approval string `json:"approval"`
+	// Admin agents may manage the server through the API; other agents
+	// only push scans and work on the jobs they lease
+	Admin   bool       `json:"admin"`
+	Updated time.Time  `json:"updated"` // Last registration or heartbeat
+	Status  StatusName `json:"status"`  // 1 Registered, 2 Ready, 3 Not Ready (offline or revoked), 4 Pending, 5 Scanning
+	HostID  int        `json:"host_id,omitempty"`
+	// Reported by the agent's heartbeats
+	Version  string `json:"version,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	Platform string `json:"platform,omitempty"`
+	Activity string `json:"activity,omitempty"` // Empty while idle
+}
+
+// Approval states of agents
+const (
+	AgentPending  = "pending"
+	AgentApproved = "approved"
+	AgentRevoked  = "revoked"
+)
+
+// AgentUpdate is the body of PUT /api/agent. Omitted fields are left
+// unchanged.
+type AgentUpdate struct {
+	Enabled  *bool  `json:"enabled,omitempty"`
+	Approval string `json:"approval,omitempty"` // approved or revoked
+	Admin    *bool  `json:"admin,omitempty"`
+}
+
+// AgentRegistrationRequest is the optional body of a registration request
+type AgentRegistrationRequest struct {
+	// CSR asks for a client certificate (PEM certificate request) for
+	// servers authenticating agents by certificate
+	CSR string `json:"csr,omitempty"`
+}
+
+// AgentRegistration answers a registration request. The credential is
+// only ever returned here; the agent exchanges it for tokens once approved.
+type AgentRegistration struct {
+	AgentID    int    `json:"agent_id"`
+	Approval   string `json:"approval"`
+	Credential string `json:"credential"`
+	// Certificate is the client certificate (PEM) issued for the request's
+	// CSR, when the server holds a CA
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// AgentToken is a short-lived API token issued to an approved agent
+type AgentToken struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"` // Unix seconds
+}
+
+// AgentHeartbeat is sent periodically by running agents; agents that miss
+// heartbeats are marked offline
+type AgentHeartbeat struct {
+	Version  string `json:"version"`
+	Hostname string `json:"hostname"`
+	Platform string `json:"platform"`
+	Activity string `json:"activity,omitempty"`
 }
 
 type RootFolder struct {
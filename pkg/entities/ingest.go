@@ -0,0 +1,67 @@
+package entities
+
+// Requests and responses of the ingestion API, through which agents push
+// what they scan to the server. The server assigns all catalog IDs; agents
+// refer to folders and files by path.
+
+// IngestStart opens a scan of a root folder of the agent's host
+type IngestStart struct {
+	Path            string `json:"path"`
+	CaseInsensitive bool   `json:"case_insensitive"`
+	Device          string `json:"device,omitempty"`
+	Register        bool   `json:"register,omitempty"` // Register the root if it is not yet known
+}
+
+// IngestRoot is the root folder a scan pushes to
+type IngestRoot struct {
+	ID              int64  `json:"id"`
+	Path            string `json:"path"` // Registered spelling of the path
+	CaseInsensitive bool   `json:"case_insensitive"`
+}
+
+// IngestFolder is a folder found by a scan
+type IngestFolder struct {
+	Path        string  `json:"path"`
+	ParentPath  *string `json:"parent_path,omitempty"`
+	ErrorStatus *string `json:"error_status,omitempty"`
+}
+
+// IngestFile is a file found by a scan, with its hash once computed
+type IngestFile struct {
+	Path          string  `json:"path"`
+	FolderPath    string  `json:"folder_path"`
+	Size          int64   `json:"size"`
+	Mtime         int64   `json:"mtime"`
+	HashValue     *string `json:"hash_value,omitempty"`
+	HashAlgorithm *string `json:"hash_algorithm,omitempty"`
+	ErrorStatus   *string `json:"error_status,omitempty"`
+}
+
+// IngestBatch is one push of folders or files
+type IngestBatch struct {
+	Folders []IngestFolder `json:"folders,omitempty"`
+	Files   []IngestFile   `json:"files,omitempty"`
+}
+
+// IngestRecord is the ID the server assigned to a pushed folder or file
+type IngestRecord struct {
+	Path string `json:"path"`
+	ID   int64  `json:"id"`
+}
+
+// IngestComplete closes a scan. Sweep is set when the scan traversed the
+// whole tree at that path: entries beneath it not pushed within the last
+// ElapsedSeconds are marked removed.
+type IngestComplete struct {
+	Sweep          string `json:"sweep,omitempty"`
+	ElapsedSeconds int64  `json:"elapsed_seconds,omitempty"`
+}
+
+// IngestStats are the totals of a root folder after a completed scan
+type IngestStats struct {
+	Folders        int64 `json:"folders"`
+	Files          int64 `json:"files"`
+	TotalSize      int64 `json:"total_size"`
+	RemovedFolders int64 `json:"removed_folders"` // Marked removed by the scan's sweep
+	RemovedFiles   int64 `json:"removed_files"`
+}
@@ -0,0 +1,63 @@
+package entities
+
+// Scan job kinds
+const (
+	ScanJobRoot    = "root"    // Scan a whole root folder
+	ScanJobSubtree = "subtree" // Scan one folder of a root and everything under it
+	ScanJobRehash  = "rehash"  // Hash a list of files again
+)
+
+// Scan job statuses
+const (
+	ScanJobQueued = "queued" // Waiting for an agent of the root's host
+	ScanJobLeased = "leased" // Held by an agent until its lease expires
+	ScanJobDone   = "done"
+	ScanJobFailed = "failed" // Gave up after the maximum attempts
+)
+
+// ScanJob is work handed out to the agents of the host holding its root
+type ScanJob struct {
+	ID              int64    `json:"id"`
+	RootFolderID    int64    `json:"root_folder_id"`
+	RootPath        string   `json:"root_path"`
+	CaseInsensitive bool     `json:"case_insensitive"`
+	Kind            string   `json:"kind"`
+	Path            string   `json:"path,omitempty"`  // Folder scanned by a subtree job
+	Paths           []string `json:"paths,omitempty"` // Files hashed by a rehash job
+	Status          string   `json:"status"`
+	Attempts        int      `json:"attempts"`
+	AgentID         int64    `json:"agent_id,omitempty"` // Agent of the latest lease
+	// LeaseID is only given to the agent leasing the job, which quotes it
+	// in its reports
+	LeaseID      string `json:"lease_id,omitempty"`
+	LeaseExpires int64  `json:"lease_expires,omitempty"`
+	FoldersDone  int64  `json:"folders_done"`
+	FilesDone    int64  `json:"files_done"`
+	Error        string `json:"error,omitempty"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+}
+
+// ScanJobRequest queues a job; Path is set for subtree jobs and Paths for
+// rehash jobs
+type ScanJobRequest struct {
+	RootFolderID int64    `json:"root_folder_id"`
+	Kind         string   `json:"kind"`
+	Path         string   `json:"path,omitempty"`
+	Paths        []string `json:"paths,omitempty"`
+}
+
+// ScanJobLease asks for the next job; Timeout is the visibility timeout in
+// seconds, after which an unreported job is handed to another agent
+type ScanJobLease struct {
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// ScanJobReport is sent by the agent holding a job's lease to report
+// progress, which extends the lease, or to complete or fail the job
+type ScanJobReport struct {
+	LeaseID     string `json:"lease_id"`
+	FoldersDone int64  `json:"folders_done"`
+	FilesDone   int64  `json:"files_done"`
+	Error       string `json:"error,omitempty"`
+}
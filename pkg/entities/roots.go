@@ -0,0 +1,86 @@
+package entities
+
+// Requests and responses of the root folder API
+
+// RootFolderInfo is the JSON form of a registered root folder
+type RootFolderInfo struct {
+	ID              int64   `json:"id"`
+	Host            string  `json:"host"`
+	Path            string  `json:"path"`
+	TraverseLinks   bool    `json:"traverse_links"`
+	CaseInsensitive bool    `json:"case_insensitive"`
+	Device          string  `json:"device,omitempty"`
+	FolderCount     int64   `json:"folder_count"`
+	FileCount       int64   `json:"file_count"`
+	TotalSizeBytes  int64   `json:"total_size_bytes"`
+	LastScanDate    *string `json:"last_scan_date"`
+	Owner           string  `json:"owner,omitempty"`
+	Purpose         string  `json:"purpose,omitempty"`
+	Policy          string  `json:"policy,omitempty"`
+}
+
+// RootFolderRequest is the body of POST and PUT. Fields left out keep their
+// current value on PUT. On POST the host defaults to the host of the calling
+// agent, and case sensitivity is only detected when the root is on the
+// server's own host. An empty owner, purpose or policy clears the assignment.
+// Include and exclude filters are not supported: scans always catalog the
+// whole root, and unknown fields such as "filters" are rejected.
+type RootFolderRequest struct {
+	Host            string  `json:"host,omitempty"`
+	Path            string  `json:"path,omitempty"`
+	TraverseLinks   *bool   `json:"traverse_links,omitempty"`
+	CaseInsensitive *bool   `json:"case_insensitive,omitempty"`
+	Owner           *string `json:"owner,omitempty"`
+	Purpose         *string `json:"purpose,omitempty"`
+	Policy          *string `json:"policy,omitempty"`
+}
+
+// Entities a purge removes
+const (
+	PurgeFiles   = "files"
+	PurgeFolders = "folders"
+	PurgeAll     = "all"
+)
+
+// PurgeRequest is the body of POST /api/root/<id>/purge, which permanently
+// deletes the records of files or folders no longer found by scans
+type PurgeRequest struct {
+	Entities string `json:"entities"`          // Records to purge: files, folders or all
+	Before   int64  `json:"before,omitempty"`  // Only those last seen before (Unix seconds)
+	DryRun   bool   `json:"dry_run,omitempty"` // Only count them
+}
+
+// PurgeResult counts the records purged, or that would be on a dry run
+type PurgeResult struct {
+	Files   int64 `json:"files"`
+	Folders int64 `json:"folders"`
+}
+
+// VerifyRequest is the body of POST /api/root/<id>/verify
+type VerifyRequest struct {
+	Repair bool `json:"repair,omitempty"` // Fix the issues that can be fixed safely
+}
+
+// VerifyResult reports the consistency checks of a root folder's catalog
+type VerifyResult struct {
+	RootPath      string        `json:"root_path"`
+	ChecksRun     int           `json:"checks_run"`
+	IssuesFound   int           `json:"issues_found"`
+	IssuesFixed   int           `json:"issues_fixed"`
+	Checks        []VerifyCheck `json:"checks"`
+	ScanTimestamp string        `json:"scan_timestamp"`
+}
+
+// VerifyCheck is the outcome of one check
+type VerifyCheck struct {
+	Name   string        `json:"name"`
+	Status string        `json:"status"` // pass, warning, error
+	Issues []VerifyIssue `json:"issues"`
+	Fixed  int           `json:"fixed,omitempty"`
+}
+
+// VerifyIssue is an inconsistency found by a check
+type VerifyIssue struct {
+	Description string `json:"description"`
+	Severity    string `json:"severity"` // warning, error
+}
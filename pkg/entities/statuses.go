@@ -49,3 +49,41 @@ func (s StatusName) String() string {
 	}
 	return "unknown"
 }
+
+// fileTransitions lists the status changes allowed for files in the
+// deletion workflow (see docs/design/files.md)
+var fileTransitions = map[StatusName][]StatusName{
+	StatusSynced:           {StatusMarkForDeletion},
+	StatusMarkForDeletion:  {StatusSynced, StatusReadyForDeletion},
+	StatusReadyForDeletion: {StatusSynced, StatusDeleting},
+	StatusDeleting:         {StatusDeleted, StatusReadyForDeletion},
+	StatusDeleted:          {StatusSynced}, // Restored from quarantine
+}
+
+// folderTransitions lists the status changes allowed for folders in the
+// deletion workflow (see docs/design/folder.md)
+var folderTransitions = map[StatusName][]StatusName{
+	StatusSynced:           {StatusMarkForDeletion},
+	StatusMarkForDeletion:  {StatusSynced, StatusReadyForDeletion},
+	StatusReadyForDeletion: {StatusSynced, StatusDeleting},
+	StatusDeleting:         {StatusDeleted, StatusReadyForDeletion},
+}
+
+// CanTransitionFile reports whether a file may move from one status to another
+func CanTransitionFile(from, to StatusName) bool {
+	return canTransition(fileTransitions, from, to)
+}
+
+// CanTransitionFolder reports whether a folder may move from one status to another
+func CanTransitionFolder(from, to StatusName) bool {
+	return canTransition(folderTransitions, from, to)
+}
+
+func canTransition(transitions map[StatusName][]StatusName, from, to StatusName) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package pathutil
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// DeviceID identifies the filesystem device holding path, so copies on
+// separate disks can be told apart from copies on the same one
+func DeviceID(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", fmt.Errorf("no device information for %s", path)
+	}
+	return fmt.Sprintf("%d", stat.Dev), nil
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package pathutil
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// DeviceID identifies the volume holding path by its serial number, so
+// copies on separate disks can be told apart from copies on the same one
+func DeviceID(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	root, err := windows.UTF16PtrFromString(filepath.VolumeName(absPath) + `\`)
+	if err != nil {
+		return "", err
+	}
+
+	var serial uint32
+	if err := windows.GetVolumeInformation(root, nil, 0, &serial, nil, nil, nil, 0); err != nil {
+		return "", fmt.Errorf("failed to read volume of %s: %w", path, err)
+	}
+	return fmt.Sprintf("%08x", serial), nil
+}
@@ -1,11 +1,19 @@
 package pathutil
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
+	"unicode"
 )
 
+// QuarantineDirName is the directory inside each root folder that holds
+// quarantined files. Scans never descend into it.
+const QuarantineDirName = ".dupectl-quarantine"
+
 // ToAbsolute converts a relative path to absolute path
 func ToAbsolute(path string) (string, error) {
 	absPath, err := filepath.Abs(path)
@@ -34,6 +42,65 @@ func NormalizePathForStorage(path string) string {
 	return path
 }
 
+// NormalizePathForComparison normalizes a path into a key used to decide
+// whether two stored paths refer to the same entry. Paths are only
+// case-folded when the root they belong to is case-insensitive.
+func NormalizePathForComparison(path string, caseInsensitive bool) string {
+	path = filepath.Clean(path)
+	if caseInsensitive {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// DefaultCaseInsensitive returns the usual case sensitivity of the
+// platform's native filesystems, used when probing is not possible
+func DefaultCaseInsensitive() bool {
+	return runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+}
+
+// ProbeCaseInsensitive reports whether the filesystem holding dir treats
+// names differing only in case as the same entry. A temporary file is
+// created inside dir so the probe reflects the mounted filesystem itself.
+func ProbeCaseInsensitive(dir string) (bool, error) {
+	probe, err := os.CreateTemp(dir, ".dupectl-case-probe-")
+	if err != nil {
+		return false, err
+	}
+	probePath := probe.Name()
+	probe.Close()
+	defer os.Remove(probePath)
+
+	swapped := filepath.Join(dir, swapCase(filepath.Base(probePath)))
+	if swapped == probePath {
+		return false, nil
+	}
+
+	swappedInfo, err := os.Stat(swapped)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	probeInfo, err := os.Stat(probePath)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(probeInfo, swappedInfo), nil
+}
+
+// swapCase inverts the case of every letter in name
+func swapCase(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, name)
+}
+
 // IsSubpath checks if child is a subpath of parent
 func IsSubpath(parent, child string) bool {
 	parent = filepath.Clean(parent)
@@ -48,6 +115,143 @@ func IsSubpath(parent, child string) bool {
 	return !strings.HasPrefix(rel, "..") && rel != "."
 }
 
+// windowsAbsolute matches drive-letter and UNC paths
+var windowsAbsolute = regexp.MustCompile(`^([A-Za-z]:[\\/]|\\\\)`)
+
+// IsAbsoluteOnAnyHost accepts absolute paths in the style of any operating
+// system, since they may belong to a machine other than this one
+func IsAbsoluteOnAnyHost(path string) bool {
+	return strings.HasPrefix(path, "/") || windowsAbsolute.MatchString(path)
+}
+
+// WithinRoot reports whether a path reported by the machine holding a root
+// is the root itself or lies under it. Either separator is accepted since
+// that machine may run another operating system; ".." elements never are.
+func WithinRoot(root, path string, caseInsensitive bool) bool {
+	for _, element := range strings.FieldsFunc(path, isSeparator) {
+		if element == ".." {
+			return false
+		}
+	}
+	if caseInsensitive {
+		root, path = strings.ToLower(root), strings.ToLower(path)
+	}
+	if path == root {
+		return true
+	}
+	root = strings.TrimRightFunc(root, isSeparator)
+	return len(path) > len(root) && path[:len(root)] == root && isSeparator(rune(path[len(root)]))
+}
+
+func isSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+// Glob is a compiled path pattern. In addition to the filepath.Match
+// syntax ('*', '?', '[...]' classes with '!' or '^' negation), '**' matches
+// any number of directories. Backslash escapes are not supported: patterns
+// and paths are compared in slash form so they work on every platform.
+type Glob struct {
+	pattern   string
+	sensitive *regexp.Regexp
+	folded    *regexp.Regexp
+}
+
+// CompileGlob parses a glob pattern once so it can be matched repeatedly
+func CompileGlob(pattern string) (*Glob, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	rest := filepath.ToSlash(pattern)
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "**/"):
+			sb.WriteString("(.*/)?")
+			rest = rest[3:]
+		case strings.HasPrefix(rest, "**"):
+			sb.WriteString(".*")
+			rest = rest[2:]
+		case rest[0] == '*':
+			sb.WriteString("[^/]*")
+			rest = rest[1:]
+		case rest[0] == '?':
+			sb.WriteString("[^/]")
+			rest = rest[1:]
+		case rest[0] == '[':
+			n, err := writeGlobClass(&sb, rest)
+			if err != nil {
+				return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+			}
+			rest = rest[n:]
+		default:
+			// Quote the literal run up to the next wildcard
+			n := strings.IndexAny(rest, "*?[")
+			if n < 0 {
+				n = len(rest)
+			}
+			sb.WriteString(regexp.QuoteMeta(rest[:n]))
+			rest = rest[n:]
+		}
+	}
+	sb.WriteString("$")
+
+	sensitive, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return &Glob{
+		pattern:   pattern,
+		sensitive: sensitive,
+		folded:    regexp.MustCompile("(?i)" + sb.String()),
+	}, nil
+}
+
+// writeGlobClass translates the '[...]' class at the start of pattern and
+// returns its length. Negated classes never match a separator.
+func writeGlobClass(sb *strings.Builder, pattern string) (int, error) {
+	end := strings.IndexByte(pattern[1:], ']') + 1
+	if end <= 0 {
+		return 0, fmt.Errorf("unterminated character class")
+	}
+	body := pattern[1:end]
+	negated := strings.HasPrefix(body, "!") || strings.HasPrefix(body, "^")
+	if negated {
+		body = body[1:]
+	}
+	if body == "" {
+		return 0, fmt.Errorf("empty character class")
+	}
+
+	sb.WriteString("[")
+	if negated {
+		sb.WriteString("^/")
+	}
+	for _, r := range body {
+		if r == '-' {
+			sb.WriteRune(r)
+			continue
+		}
+		sb.WriteString(regexp.QuoteMeta(string(r)))
+	}
+	sb.WriteString("]")
+	return end + 1, nil
+}
+
+// String returns the pattern the glob was compiled from
+func (g *Glob) String() string {
+	return g.pattern
+}
+
+// Match reports whether path matches the glob, ignoring case when the
+// path lives in a case-insensitive root
+func (g *Glob) Match(path string, caseInsensitive bool) bool {
+	re := g.sensitive
+	if caseInsensitive {
+		re = g.folded
+	}
+	return re.MatchString(filepath.ToSlash(path))
+}
+
 // Join joins path elements using platform-specific separator
 func Join(elements ...string) string {
 	return filepath.Join(elements...)
@@ -0,0 +1,51 @@
+package pathutil
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern         string
+		path            string
+		caseInsensitive bool
+		want            bool
+	}{
+		{"*.jpg", "a.jpg", false, true},
+		{"*.jpg", "dir/a.jpg", false, false},
+		{"**/*.jpg", "a.jpg", false, true},
+		{"**/*.jpg", "dir/sub/a.jpg", false, true},
+		{"/data/**", "/data/a/b/c", false, true},
+		{"/data/**/Photos/*", "/data/Photos/a.jpg", false, true},
+		{"/data/**/Photos/*", "/data/2024/trip/Photos/a.jpg", false, true},
+		{"/data/**/Photos/*", "/data/Photos/sub/a.jpg", false, false},
+		{"/data/?.txt", "/data/a.txt", false, true},
+		{"/data/?.txt", "/data/ab.txt", false, false},
+		{"/data?x", "/data/x", false, false},
+		{"/data/[abc].txt", "/data/b.txt", false, true},
+		{"/data/[abc].txt", "/data/d.txt", false, false},
+		{"/data/[a-c].txt", "/data/c.txt", false, true},
+		{"/data/[!a-c].txt", "/data/d.txt", false, true},
+		{"/data/[^a-c].txt", "/data/a.txt", false, false},
+		{"/data[!a]x", "/data/x", false, false},
+		{"/data/[.]txt", "/data/.txt", false, true},
+		{"/data/a.txt", "/data/aXtxt", false, false},
+		{"/Data/*.JPG", "/data/a.jpg", false, false},
+		{"/Data/*.JPG", "/data/a.jpg", true, true},
+		{"/data/[A-C].txt", "/data/b.txt", true, true},
+	} {
+		glob, err := CompileGlob(tc.pattern)
+		if err != nil {
+			t.Fatalf("CompileGlob(%q): %v", tc.pattern, err)
+		}
+		if got := glob.Match(tc.path, tc.caseInsensitive); got != tc.want {
+			t.Errorf("%q.Match(%q, %v) = %v, want %v", tc.pattern, tc.path, tc.caseInsensitive, got, tc.want)
+		}
+	}
+}
+
+func TestCompileGlobRejectsBadClasses(t *testing.T) {
+	for _, pattern := range []string{"/data/[abc", "/data/[]", "/data/[!]", "/data/[z-a]"} {
+		if _, err := CompileGlob(pattern); err == nil {
+			t.Errorf("CompileGlob(%q) succeeded, want an error", pattern)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+package remediate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/hash"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+)
+
+// Options controls a remediation run
+type Options struct {
+	Mode     string // ModeDelete or ModeQuarantine; empty means ModeDelete
+	DryRun   bool   // Check and report only; nothing is changed on disk or in the catalog
+	MaxBytes int64  // Stop once this many bytes have been removed, 0 = no limit
+	MaxFiles int    // Stop once this many files have been removed, 0 = no limit
+	// HostID is the host running the executor. Only files of its roots are
+	// remediated or kept, since other hosts' paths are not on this disk.
+	HostID int64
+}
+
+// Result is the outcome of one file or folder in a run
+type Result struct {
+	Path       string
+	Action     string // datastore.JournalAction*
+	Result     string // datastore.JournalResult*
+	Size       int64
+	KeeperPath string
+	Detail     string
+}
+
+// Summary totals a remediation run
+type Summary struct {
+	RunID   string
+	Done    int
+	Skipped int
+	Failed  int
+	Bytes   int64
+	Capped  bool // The run stopped at --max-bytes or --max-files
+}
+
+// Executor carries out remediation of files marked for deletion.
+// Every file is re-checked against the catalog immediately before it is
+// touched, and every action is written to the remediation journal.
+type Executor struct {
+	db    *sql.DB
+	opts  Options
+	runID string
+	roots map[int64]bool // Root folders of the host
+}
+
+// NewExecutor creates an executor for one remediation run
+func NewExecutor(db *sql.DB, opts Options) *Executor {
+	return &Executor{
+		db:    db,
+		opts:  opts,
+		runID: newRunID(),
+	}
+}
+
+// RunID identifies this run in the remediation journal
+func (e *Executor) RunID() string {
+	return e.runID
+}
+
+// ExecuteDeletions deletes (or quarantines) marked files that pass the
+// safety checks, then removes marked folders left empty. fn is called with
+// each result.
+func (e *Executor) ExecuteDeletions(ctx context.Context, fn func(*Result)) (*Summary, error) {
+	summary := &Summary{RunID: e.runID}
+
+	roots, err := datastore.GetHostRootFolderIDs(e.db, e.opts.HostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query root folders: %w", err)
+	}
+	e.roots = roots
+
+	files, err := datastore.GetMarkedFiles(e.db, e.opts.HostID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query marked files: %w", err)
+	}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		if e.capReached(summary, file.Size) {
+			summary.Capped = true
+			break
+		}
+
+		result, err := e.deleteFile(ctx, file)
+		if err != nil {
+			return summary, err
+		}
+		summary.add(result)
+		fn(result)
+	}
+
+	if summary.Capped || e.opts.DryRun {
+		// Folders are only removed once every marked file has been handled
+		return summary, nil
+	}
+
+	folders, err := datastore.GetMarkedFolders(e.db, e.opts.HostID)
+	if err != nil {
+		return summary, fmt.Errorf("failed to query marked folders: %w", err)
+	}
+
+	// Deepest folders first so parents are empty when their turn comes
+	sort.Slice(folders, func(i, j int) bool { return len(folders[i].Path) > len(folders[j].Path) })
+	for _, folder := range folders {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		result, err := e.deleteFolder(folder)
+		if err != nil {
+			return summary, err
+		}
+		if result != nil {
+			summary.add(result)
+			fn(result)
+		}
+	}
+
+	return summary, nil
+}
+
+func (s *Summary) add(r *Result) {
+	switch r.Result {
+	case datastore.JournalResultDone:
+		s.Done++
+		s.Bytes += r.Size
+	case datastore.JournalResultSkipped:
+		s.Skipped++
+	case datastore.JournalResultFailed:
+		s.Failed++
+	}
+}
+
+func (e *Executor) capReached(s *Summary, size int64) bool {
+	if e.opts.MaxFiles > 0 && s.Done >= e.opts.MaxFiles {
+		return true
+	}
+	return e.opts.MaxBytes > 0 && s.Bytes+size > e.opts.MaxBytes
+}
+
+// deleteFile checks and deletes one marked file
+func (e *Executor) deleteFile(ctx context.Context, file *datastore.File) (*Result, error) {
+	result := &Result{Path: file.Path, Action: datastore.JournalActionDelete, Size: file.Size}
+	quarantine := e.opts.Mode == ModeQuarantine
+	if quarantine {
+		result.Action = datastore.JournalActionQuarantine
+	}
+
+	// A previous run was interrupted after removing the file
+	if file.Status == entities.StatusDeleting && !e.opts.DryRun {
+		if _, err := os.Lstat(file.Path); os.IsNotExist(err) {
+			result.Detail = "completed interrupted deletion"
+			return e.completeDeletion(file, result)
+		}
+	}
+
+	keeper, reason, err := e.checkFile(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	if keeper != nil {
+		result.KeeperPath = keeper.Path
+	}
+	if reason != "" {
+		result.Result = datastore.JournalResultSkipped
+		result.Detail = reason
+		return result, e.journal(file, result)
+	}
+
+	var target string
+	if quarantine {
+		target, err = quarantinePath(file.RootFolderPath, e.runID, file.Path)
+		if err != nil {
+			result.Result = datastore.JournalResultSkipped
+			result.Detail = err.Error()
+			return result, e.journal(file, result)
+		}
+		result.Detail = "moved to " + target
+	}
+
+	if e.opts.DryRun {
+		result.Result = datastore.JournalResultDone
+		result.Detail = "dry run"
+		if quarantine {
+			result.Detail = "dry run, would move to " + target
+		}
+		return result, nil
+	}
+
+	// Mark -> Ready -> Deleting before touching the disk, so an interrupted
+	// run leaves the file in Deleting rather than silently marked
+	if file.Status == entities.StatusMarkForDeletion {
+		if err := datastore.SetFileStatus(e.db, file.ID, entities.StatusReadyForDeletion); err != nil {
+			return nil, err
+		}
+		file.Status = entities.StatusReadyForDeletion
+	}
+	if file.Status == entities.StatusReadyForDeletion {
+		if err := datastore.SetFileStatus(e.db, file.ID, entities.StatusDeleting); err != nil {
+			return nil, err
+		}
+		file.Status = entities.StatusDeleting
+	}
+
+	// The quarantine entry is recorded before the move so that a run
+	// interrupted mid-move can still be restored
+	var entryID int64
+	if quarantine {
+		entryID, err = datastore.InsertQuarantineEntry(e.db, &datastore.QuarantineEntry{
+			RunID:          e.runID,
+			FileID:         &file.ID,
+			RootFolderID:   &file.RootFolderID,
+			OriginalPath:   file.Path,
+			QuarantinePath: target,
+			Size:           file.Size,
+			Mtime:          file.Mtime,
+			HashValue:      file.HashValue,
+			HashAlgorithm:  file.HashAlgorithm,
+			Status:         datastore.QuarantineHeld,
+			QuarantinedAt:  time.Now().Unix(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to record quarantine of %s: %w", file.Path, err)
+		}
+	}
+
+	var removeErr error
+	if quarantine {
+		removeErr = moveFile(file.Path, target)
+	} else if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+		removeErr = err
+	}
+	if removeErr != nil {
+		logger.Warn("Failed to %s %s: %v", result.Action, file.Path, removeErr)
+		// A copy stranded in quarantine keeps its entry so that it can
+		// still be found and expired; otherwise nothing was moved
+		var partial *partialMoveError
+		if quarantine && !errors.As(removeErr, &partial) {
+			if err := datastore.DeleteQuarantineEntry(e.db, entryID); err != nil {
+				return nil, err
+			}
+		}
+		if err := datastore.SetFileStatus(e.db, file.ID, entities.StatusReadyForDeletion); err != nil {
+			return nil, err
+		}
+		result.Result = datastore.JournalResultFailed
+		result.Detail = removeErr.Error()
+		return result, e.journal(file, result)
+	}
+
+	return e.completeDeletion(file, result)
+}
+
+// completeDeletion records a file removed from disk as Deleted
+func (e *Executor) completeDeletion(file *datastore.File, result *Result) (*Result, error) {
+	if err := datastore.SetFileStatus(e.db, file.ID, entities.StatusDeleted); err != nil {
+		return nil, err
+	}
+	if err := datastore.SetFileRemoved(e.db, file.RootFolderID, file.Path, true); err != nil {
+		return nil, err
+	}
+
+	result.Result = datastore.JournalResultDone
+	return result, e.journal(file, result)
+}
+
+// checkFile re-verifies a marked file against the catalog and finds a
+// verified keeper. A non-empty reason means the file must not be deleted.
+func (e *Executor) checkFile(ctx context.Context, file *datastore.File) (*datastore.File, string, error) {
+	if file.HashValue == nil || file.HashAlgorithm == nil {
+		return nil, "file has not been hashed", nil
+	}
+
+	verified, err := datastore.IsFileVerified(e.db, file.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !verified {
+		return nil, "duplicate set not verified (run 'dupectl verify duplicates')", nil
+	}
+
+	info, reason := checkOnDisk(file)
+	if reason != "" {
+		return nil, reason, nil
+	}
+
+	keeper, err := e.findKeeper(file, info)
+	if err != nil {
+		return nil, "", err
+	}
+	if keeper == nil {
+		return nil, "no verified copy remains to keep", nil
+	}
+
+	hasher, err := hash.NewHasher(*file.HashAlgorithm)
+	if err != nil {
+		return keeper, err.Error(), nil
+	}
+	hashValue, err := hasher.Hash(ctx, file.Path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		return keeper, "failed to re-hash: " + err.Error(), nil
+	}
+	if hashValue != *file.HashValue {
+		return keeper, "content changed since it was hashed", nil
+	}
+
+	return keeper, "", nil
+}
+
+// findKeeper returns a copy of the file's content on the same host that
+// is not in the deletion workflow, belongs to the verified set and is
+// unchanged on disk.
+// info is the file's own entry: links to it are not copies, since a
+// symbolic link dangles and a hard link shares the inode being removed.
+func (e *Executor) findKeeper(file *datastore.File, info os.FileInfo) (*datastore.File, error) {
+	copies, err := datastore.GetFilesByHash(e.db, *file.HashValue, file.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	self := pathutil.NormalizePathForComparison(file.Path, file.RootCaseInsensitive)
+	for _, c := range copies {
+		if c.ID == file.ID || c.Status != entities.StatusSynced || !e.roots[c.RootFolderID] {
+			continue
+		}
+		// Another name for the same entry on a case-insensitive root is not a copy
+		if pathutil.NormalizePathForComparison(c.Path, file.RootCaseInsensitive) == self {
+			continue
+		}
+		if c.LinkKind != nil && *c.LinkKind == datastore.FileLinkSymlink {
+			continue
+		}
+		verified, err := datastore.IsFileVerified(e.db, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !verified {
+			continue
+		}
+		if keeperInfo, reason := checkOnDisk(c); reason == "" && !os.SameFile(info, keeperInfo) {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkOnDisk compares a file's size and mtime with the catalog. Links are
+// not followed: a symbolic link is not the file it names.
+func checkOnDisk(file *datastore.File) (os.FileInfo, string) {
+	info, err := os.Lstat(file.Path)
+	if err != nil {
+		return nil, "cannot stat file: " + err.Error()
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, "is a symbolic link"
+	}
+	if !info.Mode().IsRegular() {
+		return nil, "not a regular file"
+	}
+	if info.Size() != file.Size || info.ModTime().Unix() != file.Mtime {
+		return nil, "file changed since it was catalogued"
+	}
+	return info, ""
+}
+
+// deleteFolder removes a marked folder once it holds no catalogued entries
+// and is empty on disk. Returns nil when the folder is not ready yet.
+func (e *Executor) deleteFolder(folder *datastore.Folder) (*Result, error) {
+	hasChildren, err := datastore.FolderHasChildren(e.db, folder.ID)
+	if err != nil {
+		return nil, err
+	}
+	if hasChildren {
+		return nil, nil
+	}
+
+	result := &Result{Path: folder.Path, Action: datastore.JournalActionDeleteFolder}
+	entries, err := os.ReadDir(folder.Path)
+	if err != nil && !os.IsNotExist(err) {
+		result.Result = datastore.JournalResultSkipped
+		result.Detail = err.Error()
+		return result, e.journal(nil, result)
+	}
+	if len(entries) > 0 {
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		result.Result = datastore.JournalResultSkipped
+		result.Detail = "folder contains uncatalogued entries: " + strings.Join(names, ", ")
+		return result, e.journal(nil, result)
+	}
+
+	if folder.Status == entities.StatusMarkForDeletion {
+		if err := datastore.SetFolderStatus(e.db, folder.ID, entities.StatusReadyForDeletion); err != nil {
+			return nil, err
+		}
+		folder.Status = entities.StatusReadyForDeletion
+	}
+	if folder.Status == entities.StatusReadyForDeletion {
+		if err := datastore.SetFolderStatus(e.db, folder.ID, entities.StatusDeleting); err != nil {
+			return nil, err
+		}
+		folder.Status = entities.StatusDeleting
+	}
+
+	if err := os.Remove(folder.Path); err != nil && !os.IsNotExist(err) {
+		if err := datastore.SetFolderStatus(e.db, folder.ID, entities.StatusReadyForDeletion); err != nil {
+			return nil, err
+		}
+		result.Result = datastore.JournalResultFailed
+		result.Detail = err.Error()
+		return result, e.journal(nil, result)
+	}
+
+	if err := datastore.SetFolderStatus(e.db, folder.ID, entities.StatusDeleted); err != nil {
+		return nil, err
+	}
+	if err := datastore.SetFolderRemoved(e.db, folder.RootFolderID, folder.Path, true); err != nil {
+		return nil, err
+	}
+
+	result.Result = datastore.JournalResultDone
+	return result, e.journal(nil, result)
+}
+
+// journal records a result in the remediation journal; dry runs leave
+// no trace in the catalog
+func (e *Executor) journal(file *datastore.File, r *Result) error {
+	if e.opts.DryRun {
+		return nil
+	}
+
+	entry := newJournalEntry(e.runID, r)
+	if file != nil {
+		entry.FileID = &file.ID
+		entry.HashValue = file.HashValue
+	}
+
+	if _, err := datastore.InsertJournalEntry(e.db, entry); err != nil {
+		return fmt.Errorf("failed to write journal entry for %s: %w", r.Path, err)
+	}
+	return nil
+}
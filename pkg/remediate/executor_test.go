@@ -0,0 +1,190 @@
+package remediate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+)
+
+func TestExecuteDeletionsDeletesVerifiedDuplicate(t *testing.T) {
+	c := newTestCatalog(t)
+	keeper := c.addFile("a.txt", "same content")
+	victim := c.addFile("b.txt", "same content")
+	c.verify(victim)
+	c.mark(victim)
+
+	summary, results := c.execute(Options{})
+	if summary.Done != 1 || summary.Skipped != 0 || summary.Failed != 0 {
+		t.Fatalf("summary = %+v, results = %+v", summary, results)
+	}
+	if results[0].KeeperPath != keeper.Path {
+		t.Errorf("keeper = %q, want %q", results[0].KeeperPath, keeper.Path)
+	}
+	if exists(victim.Path) || !exists(keeper.Path) {
+		t.Errorf("victim exists = %v, keeper exists = %v", exists(victim.Path), exists(keeper.Path))
+	}
+	if status := c.status(victim); status != entities.StatusDeleted {
+		t.Errorf("victim status = %s", status)
+	}
+	if entries := c.journal(summary.RunID); len(entries) != 1 || entries[0].Result != datastore.JournalResultDone {
+		t.Errorf("journal = %+v", entries)
+	}
+}
+
+func TestExecuteDeletionsRequiresVerifiedSet(t *testing.T) {
+	c := newTestCatalog(t)
+	c.addFile("a.txt", "same content")
+	victim := c.addFile("b.txt", "same content")
+	c.mark(victim)
+
+	summary, results := c.execute(Options{})
+	if summary.Skipped != 1 || summary.Done != 0 {
+		t.Fatalf("summary = %+v, results = %+v", summary, results)
+	}
+	if !exists(victim.Path) {
+		t.Error("unverified file was deleted")
+	}
+}
+
+func TestExecuteDeletionsRefusesWithoutKeeper(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(path string) error
+	}{
+		{"keeper removed", os.Remove},
+		{"keeper changed", func(path string) error { return os.WriteFile(path, []byte("other content"), 0o644) }},
+		{"keeper touched", func(path string) error {
+			later := time.Now().Add(time.Hour)
+			return os.Chtimes(path, later, later)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCatalog(t)
+			keeper := c.addFile("a.txt", "same content")
+			victim := c.addFile("b.txt", "same content")
+			c.verify(victim)
+			c.mark(victim)
+			if err := tt.damage(keeper.Path); err != nil {
+				t.Fatal(err)
+			}
+
+			summary, results := c.execute(Options{})
+			if summary.Skipped != 1 || summary.Done != 0 {
+				t.Fatalf("summary = %+v, results = %+v", summary, results)
+			}
+			if results[0].Detail != "no verified copy remains to keep" {
+				t.Errorf("detail = %q", results[0].Detail)
+			}
+			if !exists(victim.Path) {
+				t.Error("last copy was deleted")
+			}
+			if status := c.status(victim); status != entities.StatusMarkForDeletion {
+				t.Errorf("victim status = %s", status)
+			}
+		})
+	}
+}
+
+func TestExecuteDeletionsRefusesChangedFile(t *testing.T) {
+	c := newTestCatalog(t)
+	c.addFile("a.txt", "same content")
+	victim := c.addFile("b.txt", "same content")
+	c.verify(victim)
+	c.mark(victim)
+	if err := os.WriteFile(victim.Path, []byte("edited since the scan"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, results := c.execute(Options{})
+	if summary.Skipped != 1 || summary.Done != 0 {
+		t.Fatalf("summary = %+v, results = %+v", summary, results)
+	}
+	if results[0].Detail != "file changed since it was catalogued" {
+		t.Errorf("detail = %q", results[0].Detail)
+	}
+	if !exists(victim.Path) {
+		t.Error("changed file was deleted")
+	}
+	if entries := c.journal(summary.RunID); len(entries) != 1 || entries[0].Result != datastore.JournalResultSkipped {
+		t.Errorf("journal = %+v", entries)
+	}
+}
+
+func TestExecuteDeletionsDryRun(t *testing.T) {
+	for _, mode := range []string{ModeDelete, ModeQuarantine} {
+		t.Run(mode, func(t *testing.T) {
+			c := newTestCatalog(t)
+			c.addFile("a.txt", "same content")
+			victim := c.addFile("b.txt", "same content")
+			c.verify(victim)
+			c.mark(victim)
+
+			summary, results := c.execute(Options{Mode: mode, DryRun: true})
+			if summary.Done != 1 {
+				t.Fatalf("summary = %+v, results = %+v", summary, results)
+			}
+			if !exists(victim.Path) {
+				t.Error("dry run removed the file")
+			}
+			if exists(filepath.Join(c.root.Path, pathutil.QuarantineDirName)) {
+				t.Error("dry run created the quarantine directory")
+			}
+			if status := c.status(victim); status != entities.StatusMarkForDeletion {
+				t.Errorf("victim status = %s", status)
+			}
+			if entries := c.journal(summary.RunID); len(entries) != 0 {
+				t.Errorf("dry run wrote %d journal entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestRunIDsAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := NewExecutor(nil, Options{}).RunID()
+		if seen[id] {
+			t.Fatalf("run ID %s reused", id)
+		}
+		seen[id] = true
+	}
+}
+
+// A copy catalogued on another host is not on this disk, even when a file
+// happens to exist here at the same path
+func TestExecuteDeletionsIgnoresOtherHosts(t *testing.T) {
+	c := newTestCatalog(t)
+	host, err := datastore.InsertHost(c.db, entities.Host{Name: "server"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, localFolderID := c.root, c.folderID
+	c.root = &datastore.RootFolder{HostID: int64(host.Id), Path: local.Path}
+	if c.root.ID, err = datastore.InsertRootFolder(c.db, c.root); err != nil {
+		t.Fatal(err)
+	}
+	c.folderID = c.addFolder(c.root, c.root.Path)
+	remote := c.addFile("a.txt", "same content")
+	remoteVictim := c.addFile("c.txt", "same content")
+	c.root, c.folderID = local, localFolderID
+	victim := c.addFile("b.txt", "same content")
+	c.verify(victim)
+	c.mark(victim, remoteVictim)
+
+	summary, results := c.execute(Options{})
+	if summary.Skipped != 1 || summary.Done != 0 || results[0].Path != victim.Path {
+		t.Fatalf("summary = %+v, results = %+v", summary, results)
+	}
+	if results[0].Detail != "no verified copy remains to keep" {
+		t.Errorf("detail = %q", results[0].Detail)
+	}
+	if !exists(victim.Path) || !exists(remote.Path) || !exists(remoteVictim.Path) {
+		t.Error("a file was deleted")
+	}
+}
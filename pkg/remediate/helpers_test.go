@@ -0,0 +1,178 @@
+package remediate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/hash"
+
+	_ "modernc.org/sqlite"
+)
+
+// testCatalog is a migrated catalog holding one root folder of the local
+// host backed by a temporary directory
+type testCatalog struct {
+	t        *testing.T
+	db       *sql.DB
+	hostID   int64
+	root     *datastore.RootFolder
+	folderID int64
+}
+
+// newTestCatalog creates an empty catalog and root folder
+func newTestCatalog(t *testing.T) *testCatalog {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "catalog.db")+
+		"?_pragma=busy_timeout(10000)&_pragma=foreign_keys(ON)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := datastore.RunMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := datastore.RegisterLocalHost(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testCatalog{t: t, db: db, hostID: int64(host.Id)}
+	c.root = c.addRoot(t.TempDir())
+	c.folderID = c.addFolder(c.root, c.root.Path)
+	return c
+}
+
+// addRoot registers a root folder of the catalog's host
+func (c *testCatalog) addRoot(path string) *datastore.RootFolder {
+	c.t.Helper()
+	root := &datastore.RootFolder{HostID: c.hostID, Path: path}
+	id, err := datastore.InsertRootFolder(c.db, root)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	root.ID = id
+	return root
+}
+
+// addFolder catalogues a folder of a root
+func (c *testCatalog) addFolder(root *datastore.RootFolder, path string) int64 {
+	c.t.Helper()
+	id, err := datastore.InsertFolder(c.db, &datastore.Folder{Path: path, RootFolderID: root.ID,
+		FirstScannedAt: 1, LastScannedAt: 1})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return id
+}
+
+// addFile writes a file under the root folder and catalogues it, hashed,
+// as a scan would
+func (c *testCatalog) addFile(name, content string) *datastore.File {
+	c.t.Helper()
+	path := filepath.Join(c.root.Path, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.catalogFile(path)
+}
+
+// catalogFile catalogues an existing file of the root folder
+func (c *testCatalog) catalogFile(path string) *datastore.File {
+	c.t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	hasher, err := hash.NewHasher("sha256")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	hashValue, err := hasher.Hash(context.Background(), path)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	algorithm := hasher.Algorithm()
+	file := &datastore.File{Path: path, Size: info.Size(), Mtime: info.ModTime().Unix(),
+		HashValue: &hashValue, HashAlgorithm: &algorithm, FirstScannedAt: 1, LastScannedAt: 1,
+		FolderID: c.folderID, RootFolderID: c.root.ID, Status: entities.StatusSynced, RootFolderPath: c.root.Path}
+	file.ID, err = datastore.InsertFile(c.db, file)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return file
+}
+
+// verify compares the duplicate set of a file byte-for-byte, as
+// 'verify duplicates' does
+func (c *testCatalog) verify(file *datastore.File) {
+	c.t.Helper()
+	set, err := duplicate.NewDetector(c.db).GetSet(*file.HashValue)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	result, err := duplicate.NewVerifier(c.db).VerifySet(context.Background(), set)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if result.Status != datastore.VerificationVerified {
+		c.t.Fatalf("set %s is %s", set.Hash, result.Status)
+	}
+}
+
+// mark marks files for deletion
+func (c *testCatalog) mark(files ...*datastore.File) {
+	c.t.Helper()
+	targets := &datastore.MarkTargets{}
+	for _, file := range files {
+		targets.FileIDs = append(targets.FileIDs, file.ID)
+	}
+	if _, err := datastore.MarkForDeletion(c.db, targets); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// status returns a file's deletion workflow status
+func (c *testCatalog) status(file *datastore.File) entities.StatusName {
+	c.t.Helper()
+	var status entities.StatusName
+	if err := c.db.QueryRow(`SELECT status FROM files WHERE id = ?`, file.ID).Scan(&status); err != nil {
+		c.t.Fatal(err)
+	}
+	return status
+}
+
+// execute runs the executor and returns its results
+func (c *testCatalog) execute(opts Options) (*Summary, []*Result) {
+	c.t.Helper()
+	var results []*Result
+	opts.HostID = c.hostID
+	summary, err := NewExecutor(c.db, opts).ExecuteDeletions(context.Background(), func(r *Result) {
+		results = append(results, r)
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return summary, results
+}
+
+// journal returns the journal entries of a run
+func (c *testCatalog) journal(runID string) []*datastore.JournalEntry {
+	c.t.Helper()
+	entries, err := datastore.GetJournalEntries(c.db, runID)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return entries
+}
+
+// exists reports whether a path exists on disk, without following links
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
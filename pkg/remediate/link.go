@@ -0,0 +1,412 @@
+package remediate
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+)
+
+// Link kinds
+const (
+	LinkHard    = datastore.FileLinkHard    // Hard link to the keeper's inode
+	LinkReflink = datastore.FileLinkReflink // Copy-on-write clone sharing the keeper's extents
+	LinkSymlink = datastore.FileLinkSymlink // Symbolic link to the keeper's absolute path
+)
+
+// ErrReflinkUnsupported is returned when the filesystem or platform cannot
+// clone file extents
+var ErrReflinkUnsupported = errors.New("reflinks are not supported here")
+
+// ParseLinkKind validates a link kind name
+func ParseLinkKind(kind string) (string, error) {
+	switch kind {
+	case LinkHard, LinkReflink, LinkSymlink:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("unknown link kind %q (use %s, %s or %s)", kind, LinkHard, LinkReflink, LinkSymlink)
+	}
+}
+
+// linkAction maps a link kind to its journal action
+func linkAction(kind string) string {
+	switch kind {
+	case LinkHard:
+		return datastore.JournalActionLinkHard
+	case LinkReflink:
+		return datastore.JournalActionLinkReflink
+	default:
+		return datastore.JournalActionLinkSymlink
+	}
+}
+
+// LinkOptions controls a dedupe run
+type LinkOptions struct {
+	Kind     string // LinkHard, LinkReflink or LinkSymlink
+	Fallback string // Kind used when a reflink is not supported; empty refuses instead
+	DryRun   bool   // Check and report only; nothing is changed on disk or in the catalog
+}
+
+// Linker replaces the non-keeper copies of duplicate sets with links to
+// the keeper. Each copy is compared byte-for-byte with the keeper and then
+// swapped atomically by renaming a link over it; every replacement is
+// journaled with the copy's mode and mtime so it can be undone.
+type Linker struct {
+	db    *sql.DB
+	opts  LinkOptions
+	runID string
+}
+
+// NewLinker creates a linker for one dedupe run
+func NewLinker(db *sql.DB, opts LinkOptions) *Linker {
+	return &Linker{
+		db:    db,
+		opts:  opts,
+		runID: newRunID(),
+	}
+}
+
+// RunID identifies this run in the remediation journal
+func (l *Linker) RunID() string {
+	return l.runID
+}
+
+// LinkSet replaces every copy the plan removes with a link to its keeper.
+// fn is called with each result.
+func (l *Linker) LinkSet(ctx context.Context, plan *duplicate.Plan, summary *Summary, fn func(*Result)) error {
+	keeper := plan.Keeper
+	for _, file := range plan.Remove {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		result, err := l.linkFile(ctx, keeper, file)
+		if err != nil {
+			return err
+		}
+		summary.add(result)
+		fn(result)
+	}
+	return nil
+}
+
+// linkFile checks one copy against the keeper and replaces it with a link
+func (l *Linker) linkFile(ctx context.Context, keeper, file *datastore.File) (*Result, error) {
+	result := &Result{
+		Path:       file.Path,
+		Action:     linkAction(l.opts.Kind),
+		Size:       file.Size,
+		KeeperPath: keeper.Path,
+	}
+
+	if reason := l.checkLink(keeper, file); reason != "" {
+		result.Result = datastore.JournalResultSkipped
+		result.Detail = reason
+		return result, l.journal(file, result, nil)
+	}
+
+	same, err := duplicate.CompareFiles(ctx, keeper.Path, file.Path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		result.Result = datastore.JournalResultSkipped
+		result.Detail = "failed to compare with keeper: " + err.Error()
+		return result, l.journal(file, result, nil)
+	}
+	if !same {
+		result.Result = datastore.JournalResultSkipped
+		result.Detail = "content differs from the keeper"
+		return result, l.journal(file, result, nil)
+	}
+
+	info, err := os.Lstat(file.Path)
+	if err != nil {
+		result.Result = datastore.JournalResultFailed
+		result.Detail = err.Error()
+		return result, l.journal(file, result, nil)
+	}
+
+	if l.opts.DryRun {
+		result.Result = datastore.JournalResultDone
+		return result, nil
+	}
+
+	kind, err := replaceWithLink(keeper.Path, file.Path, l.tempPath(file.Path), l.opts.Kind, l.opts.Fallback, info)
+	if err != nil {
+		result.Result = datastore.JournalResultFailed
+		result.Detail = err.Error()
+		return result, l.journal(file, result, info)
+	}
+	result.Action = linkAction(kind)
+
+	// The catalog must no longer count the path as an independent copy,
+	// and the path now shows the keeper's modification time
+	mtime := file.Mtime
+	if linked, err := os.Stat(file.Path); err == nil {
+		mtime = linked.ModTime().Unix()
+	}
+	if err := datastore.SetFileLink(l.db, file.ID, kind, keeper.Path, mtime); err != nil {
+		return nil, err
+	}
+
+	result.Result = datastore.JournalResultDone
+	return result, l.journal(file, result, info)
+}
+
+// checkLink returns why a copy must not be linked, or "" when it may be
+func (l *Linker) checkLink(keeper, file *datastore.File) string {
+	if keeper.Status != entities.StatusSynced {
+		return "keeper is " + keeper.Status.String()
+	}
+	if file.Status != entities.StatusSynced {
+		return "file is " + file.Status.String()
+	}
+	keeperInfo, reason := checkOnDisk(keeper)
+	if reason != "" {
+		return "keeper: " + reason
+	}
+
+	info, err := os.Lstat(file.Path)
+	if err != nil {
+		return "cannot stat file: " + err.Error()
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return "already a symbolic link"
+	}
+	if _, reason := checkOnDisk(file); reason != "" {
+		return reason
+	}
+	if os.SameFile(keeperInfo, info) {
+		return "already linked to the keeper"
+	}
+	return ""
+}
+
+// tempPath names the temporary link created next to path before it is
+// renamed over it
+func (l *Linker) tempPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".dupectl-"+l.runID+".tmp")
+}
+
+// replaceWithLink creates a link to keeper at tmp and renames it over path.
+// Returns the kind of link actually created.
+func replaceWithLink(keeper, path, tmp, kind, fallback string, info os.FileInfo) (string, error) {
+	err := createLink(keeper, tmp, kind, info)
+	if errors.Is(err, ErrReflinkUnsupported) && fallback != "" {
+		logger.Debug("Reflink %s failed (%v), falling back to %s link", path, err, fallback)
+		kind = fallback
+		err = createLink(keeper, tmp, kind, info)
+	}
+	if err != nil {
+		return kind, err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return kind, err
+	}
+	return kind, nil
+}
+
+// createLink creates a new link of the given kind to keeper at tmp
+func createLink(keeper, tmp, kind string, info os.FileInfo) error {
+	switch kind {
+	case LinkHard:
+		return os.Link(keeper, tmp)
+	case LinkSymlink:
+		return os.Symlink(keeper, tmp)
+	case LinkReflink:
+		if err := reflinkFile(keeper, tmp, info.Mode().Perm()); err != nil {
+			return err
+		}
+		// A clone is a file of its own and keeps the copy's attributes
+		if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown link kind %q", kind)
+	}
+}
+
+// Undo replaces the links created during a dedupe run with independent
+// copies of the keeper carrying the original mode and modification time.
+// fn is called with each result.
+func (l *Linker) Undo(ctx context.Context, runID string, fn func(*Result)) (*Summary, error) {
+	summary := &Summary{RunID: l.runID}
+
+	entries, err := datastore.GetJournalEntries(l.db, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		switch entry.Action {
+		case datastore.JournalActionLinkHard, datastore.JournalActionLinkReflink, datastore.JournalActionLinkSymlink:
+		default:
+			continue
+		}
+		if entry.Result != datastore.JournalResultDone {
+			continue
+		}
+		undone, err := datastore.IsJournalEntryUndone(l.db, entry.ID)
+		if err != nil {
+			return summary, err
+		}
+		if undone {
+			continue
+		}
+
+		result, err := l.unlinkEntry(ctx, entry)
+		if err != nil {
+			return summary, err
+		}
+		summary.add(result)
+		fn(result)
+	}
+
+	return summary, nil
+}
+
+// unlinkEntry reverses one link-* journal entry
+func (l *Linker) unlinkEntry(ctx context.Context, entry *datastore.JournalEntry) (*Result, error) {
+	result := &Result{Path: entry.Path, Action: datastore.JournalActionUnlink, Size: entry.Size}
+	fail := func(status, detail string) (*Result, error) {
+		result.Result = status
+		result.Detail = detail
+		return result, l.journalUndo(entry, result)
+	}
+
+	if entry.KeeperPath == nil || entry.FileMode == nil || entry.FileMtime == nil {
+		return fail(datastore.JournalResultSkipped, "journal entry lacks the replaced file's attributes")
+	}
+	keeper := *entry.KeeperPath
+	result.KeeperPath = keeper
+
+	same, err := duplicate.CompareFiles(ctx, keeper, entry.Path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return fail(datastore.JournalResultSkipped, "failed to compare with keeper: "+err.Error())
+	}
+	if !same {
+		return fail(datastore.JournalResultSkipped, "content changed since it was linked")
+	}
+
+	if l.opts.DryRun {
+		result.Result = datastore.JournalResultDone
+		return result, nil
+	}
+
+	tmp := l.tempPath(entry.Path)
+	mode := os.FileMode(*entry.FileMode).Perm()
+	mtime := time.Unix(*entry.FileMtime, 0)
+	if err := copyFile(keeper, tmp); err != nil {
+		return fail(datastore.JournalResultFailed, err.Error())
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
+		return fail(datastore.JournalResultFailed, err.Error())
+	}
+	if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+		os.Remove(tmp)
+		return fail(datastore.JournalResultFailed, err.Error())
+	}
+	if err := os.Rename(tmp, entry.Path); err != nil {
+		os.Remove(tmp)
+		return fail(datastore.JournalResultFailed, err.Error())
+	}
+
+	if entry.FileID != nil {
+		if err := datastore.SetFileLink(l.db, *entry.FileID, "", "", *entry.FileMtime); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Result = datastore.JournalResultDone
+	return result, l.journalUndo(entry, result)
+}
+
+// journal records a link result; info holds the replaced copy's attributes
+func (l *Linker) journal(file *datastore.File, r *Result, info os.FileInfo) error {
+	if l.opts.DryRun {
+		return nil
+	}
+
+	entry := newJournalEntry(l.runID, r)
+	entry.FileID = &file.ID
+	entry.HashValue = file.HashValue
+	if info != nil {
+		mode := int64(info.Mode().Perm())
+		mtime := info.ModTime().Unix()
+		entry.FileMode = &mode
+		entry.FileMtime = &mtime
+	}
+	_, err := datastore.InsertJournalEntry(l.db, entry)
+	return err
+}
+
+// journalUndo records the reversal of a link entry
+func (l *Linker) journalUndo(undone *datastore.JournalEntry, r *Result) error {
+	if l.opts.DryRun {
+		return nil
+	}
+
+	entry := newJournalEntry(l.runID, r)
+	entry.FileID = undone.FileID
+	entry.HashValue = undone.HashValue
+	entry.UndoOf = &undone.ID
+	_, err := datastore.InsertJournalEntry(l.db, entry)
+	return err
+}
+
+// newJournalEntry builds the journal entry common to every result
+func newJournalEntry(runID string, r *Result) *datastore.JournalEntry {
+	entry := &datastore.JournalEntry{
+		RunID:     runID,
+		Path:      r.Path,
+		Action:    r.Action,
+		Result:    r.Result,
+		Size:      r.Size,
+		CreatedAt: time.Now().Unix(),
+	}
+	if r.KeeperPath != "" {
+		entry.KeeperPath = &r.KeeperPath
+	}
+	if r.Detail != "" {
+		entry.Detail = &r.Detail
+	}
+	return entry
+}
+
+// newRunID returns an identifier for one run: a nanosecond timestamp,
+// which keeps journal runs in order, and a random suffix so that runs
+// started at the same instant never share quarantine or temp paths
+func newRunID() string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return time.Now().UTC().Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,89 @@
+package remediate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/duplicate"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+)
+
+// link replaces file with a link of the given kind to keeper
+func (c *testCatalog) link(kind string, keeper, file *datastore.File) string {
+	c.t.Helper()
+	linker := NewLinker(c.db, LinkOptions{Kind: kind})
+	summary := &Summary{RunID: linker.RunID()}
+	plan := &duplicate.Plan{Keeper: keeper, Remove: []*datastore.File{file}}
+	if err := linker.LinkSet(context.Background(), plan, summary, func(*Result) {}); err != nil {
+		c.t.Fatal(err)
+	}
+	if summary.Done != 1 {
+		c.t.Fatalf("link summary = %+v", summary)
+	}
+	return linker.RunID()
+}
+
+// Once a copy is replaced by a link to the real file, the link must not
+// count as a surviving copy: deleting the real file would lose the content.
+func TestLinkedCopyIsNotAKeeper(t *testing.T) {
+	for _, kind := range []string{LinkSymlink, LinkHard} {
+		t.Run(kind, func(t *testing.T) {
+			c := newTestCatalog(t)
+			real := c.addFile("a.txt", "same content")
+			copy := c.addFile("b.txt", "same content")
+			c.verify(real)
+			c.link(kind, real, copy)
+			c.verify(real)
+
+			_, err := datastore.MarkForDeletion(c.db, &datastore.MarkTargets{FileIDs: []int64{real.ID}})
+			var refused *datastore.MarkRefusedError
+			if !errors.As(err, &refused) {
+				t.Fatalf("marking the real file: err = %v, want refusal", err)
+			}
+
+			// A mark recorded before the link was known must still be refused
+			if err := datastore.SetFileStatus(c.db, real.ID, entities.StatusMarkForDeletion); err != nil {
+				t.Fatal(err)
+			}
+			summary, results := c.execute(Options{})
+			if summary.Skipped != 1 || summary.Done != 0 {
+				t.Fatalf("summary = %+v, results = %+v", summary, results)
+			}
+			if results[0].Detail != "no verified copy remains to keep" {
+				t.Errorf("detail = %q", results[0].Detail)
+			}
+			if !exists(real.Path) {
+				t.Fatal("real file was deleted and the link left dangling")
+			}
+		})
+	}
+}
+
+func TestUndoLinkRestoresCopy(t *testing.T) {
+	c := newTestCatalog(t)
+	real := c.addFile("a.txt", "same content")
+	copy := c.addFile("b.txt", "same content")
+	c.verify(real)
+	runID := c.link(LinkSymlink, real, copy)
+
+	summary, err := NewLinker(c.db, LinkOptions{}).Undo(context.Background(), runID, func(*Result) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Done != 1 {
+		t.Fatalf("undo summary = %+v", summary)
+	}
+	c.verify(real)
+
+	// The copy is independent again, so the real file may go
+	c.mark(real)
+	summary, results := c.execute(Options{})
+	if summary.Done != 1 || results[0].KeeperPath != copy.Path {
+		t.Fatalf("summary = %+v, results = %+v", summary, results)
+	}
+	if exists(real.Path) || !exists(copy.Path) {
+		t.Errorf("real exists = %v, copy exists = %v", exists(real.Path), exists(copy.Path))
+	}
+}
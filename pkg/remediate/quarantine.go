@@ -0,0 +1,248 @@
+package remediate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/hash"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
+)
+
+// Remediation modes
+const (
+	ModeDelete     = "delete"     // Remove files permanently
+	ModeQuarantine = "quarantine" // Move files into the root's quarantine directory
+)
+
+// ParseMode validates a remediation mode name
+func ParseMode(mode string) (string, error) {
+	switch mode {
+	case ModeDelete, ModeQuarantine:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown remediation mode %q (use %s or %s)", mode, ModeDelete, ModeQuarantine)
+	}
+}
+
+// quarantinePath returns where a file is moved when quarantined:
+// <root>/.dupectl-quarantine/<run>/<path relative to root>
+func quarantinePath(rootPath, runID, filePath string) (string, error) {
+	rel, err := filepath.Rel(rootPath, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not under root folder %s", filePath, rootPath)
+	}
+	return filepath.Join(rootPath, pathutil.QuarantineDirName, runID, rel), nil
+}
+
+// Quarantine restores or permanently removes quarantined files
+type Quarantine struct {
+	db    *sql.DB
+	runID string
+}
+
+// NewQuarantine creates a quarantine manager; its actions are journaled
+// under a run ID of their own
+func NewQuarantine(db *sql.DB) *Quarantine {
+	return &Quarantine{db: db, runID: newRunID()}
+}
+
+// Restore moves a quarantined file back to its original path and returns
+// it to the catalog. The file must be unchanged since it was quarantined
+// and nothing may exist at the original path.
+func (q *Quarantine) Restore(ctx context.Context, entry *datastore.QuarantineEntry) error {
+	if entry.Status != datastore.QuarantineHeld {
+		return fmt.Errorf("entry %d is %s", entry.ID, entry.Status)
+	}
+	if _, err := os.Lstat(entry.OriginalPath); err == nil {
+		return fmt.Errorf("%s already exists", entry.OriginalPath)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	info, err := os.Stat(entry.QuarantinePath)
+	if err != nil {
+		return err
+	}
+	if info.Size() != entry.Size || info.ModTime().Unix() != entry.Mtime {
+		return fmt.Errorf("%s changed while in quarantine", entry.QuarantinePath)
+	}
+	if entry.HashValue != nil && entry.HashAlgorithm != nil {
+		hasher, err := hash.NewHasher(*entry.HashAlgorithm)
+		if err != nil {
+			return err
+		}
+		hashValue, err := hasher.Hash(ctx, entry.QuarantinePath)
+		if err != nil {
+			return err
+		}
+		if hashValue != *entry.HashValue {
+			return fmt.Errorf("%s changed while in quarantine", entry.QuarantinePath)
+		}
+	}
+
+	if err := moveFile(entry.QuarantinePath, entry.OriginalPath); err != nil {
+		return err
+	}
+	if entry.FileID != nil {
+		if err := datastore.RestoreFileRecord(q.db, *entry.FileID); err != nil {
+			return fmt.Errorf("restored %s but failed to update catalog: %w", entry.OriginalPath, err)
+		}
+	}
+	if err := datastore.SetQuarantineStatus(q.db, entry.ID, datastore.QuarantineRestored); err != nil {
+		return err
+	}
+
+	pruneEmptyDirs(filepath.Dir(entry.QuarantinePath), entry.QuarantinePath)
+	return q.journal(entry, datastore.JournalActionRestore)
+}
+
+// Expire permanently removes files quarantined before the cutoff.
+// fn is called with each entry before it is removed; with dryRun nothing
+// is removed. Returns the number of files and bytes expired.
+func (q *Quarantine) Expire(cutoff time.Time, dryRun bool, fn func(*datastore.QuarantineEntry)) (int, int64, error) {
+	entries, err := datastore.GetHeldQuarantineEntriesBefore(q.db, cutoff.Unix())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var count int
+	var bytes int64
+	for _, entry := range entries {
+		fn(entry)
+		count++
+		bytes += entry.Size
+		if dryRun {
+			continue
+		}
+
+		if err := os.Remove(entry.QuarantinePath); err != nil && !os.IsNotExist(err) {
+			return count - 1, bytes - entry.Size, err
+		}
+		if err := datastore.SetQuarantineStatus(q.db, entry.ID, datastore.QuarantineExpired); err != nil {
+			return count, bytes, err
+		}
+		pruneEmptyDirs(filepath.Dir(entry.QuarantinePath), entry.QuarantinePath)
+		if err := q.journal(entry, datastore.JournalActionExpire); err != nil {
+			return count, bytes, err
+		}
+	}
+	return count, bytes, nil
+}
+
+func (q *Quarantine) journal(entry *datastore.QuarantineEntry, action string) error {
+	detail := entry.QuarantinePath
+	_, err := datastore.InsertJournalEntry(q.db, &datastore.JournalEntry{
+		RunID:     q.runID,
+		FileID:    entry.FileID,
+		Path:      entry.OriginalPath,
+		Action:    action,
+		Result:    datastore.JournalResultDone,
+		Size:      entry.Size,
+		HashValue: entry.HashValue,
+		Detail:    &detail,
+		CreatedAt: time.Now().Unix(),
+	})
+	return err
+}
+
+// pruneEmptyDirs removes dir and its parents while they are empty, stopping
+// at the quarantine directory's parent (the root folder)
+func pruneEmptyDirs(dir, quarantined string) {
+	idx := strings.LastIndex(quarantined, string(filepath.Separator)+pathutil.QuarantineDirName+string(filepath.Separator))
+	if idx < 0 {
+		return
+	}
+	stop := quarantined[:idx]
+
+	for dir != stop && len(dir) > len(stop) {
+		if err := os.Remove(dir); err != nil {
+			return // Not empty, or not removable
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// moveFile moves src to dst, creating dst's parent directories. When a
+// rename is not possible (e.g. across filesystems) the file is copied with
+// its mode and modification time, then src is removed.
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	renameErr := os.Rename(src, dst)
+	if renameErr == nil {
+		return nil
+	}
+
+	logger.Debug("Rename %s failed (%v), copying instead", src, renameErr)
+	if err := copyFile(src, dst); err != nil {
+		return fmt.Errorf("failed to move %s: %w", src, renameErr)
+	}
+	if err := os.Remove(src); err != nil {
+		// Undo the copy so the move either happens or leaves no trace
+		if cleanupErr := os.Remove(dst); cleanupErr != nil {
+			return &partialMoveError{src: src, dst: dst, err: err}
+		}
+		return fmt.Errorf("failed to remove %s after copying it: %w", src, err)
+	}
+	return nil
+}
+
+// partialMoveError reports a move that copied src to dst but could remove
+// neither src nor the copy, so the file now exists at both paths
+type partialMoveError struct {
+	src, dst string
+	err      error
+}
+
+func (e *partialMoveError) Error() string {
+	return fmt.Sprintf("copied %s to %s but failed to remove the original: %v", e.src, e.dst, e.err)
+}
+
+func (e *partialMoveError) Unwrap() error {
+	return e.err
+}
+
+// copyFile copies src to a new file dst preserving mode and mtime
+func copyFile(src, dst string) (err error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(dst)
+		}
+	}()
+
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package remediate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflinkFile creates dst as a copy-on-write clone of src using the
+// FICLONE ioctl (btrfs, xfs and other filesystems with shared extents)
+func reflinkFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+
+	cloneErr := unix.IoctlFileClone(int(out.Fd()), int(in.Fd()))
+	closeErr := out.Close()
+	if cloneErr != nil {
+		os.Remove(dst)
+		switch {
+		case errors.Is(cloneErr, unix.EOPNOTSUPP), errors.Is(cloneErr, unix.ENOTTY),
+			errors.Is(cloneErr, unix.EINVAL), errors.Is(cloneErr, unix.EXDEV):
+			return fmt.Errorf("%w: %v", ErrReflinkUnsupported, cloneErr)
+		}
+		return cloneErr
+	}
+	if closeErr != nil {
+		os.Remove(dst)
+		return closeErr
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package remediate
+
+import (
+	"os"
+)
+
+// reflinkFile is only implemented on Linux
+func reflinkFile(src, dst string, mode os.FileMode) error {
+	return ErrReflinkUnsupported
+}
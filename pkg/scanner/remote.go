@@ -0,0 +1,143 @@
+package scanner
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/jpconstantineau/dupectl/pkg/apiclient"
+	"github.com/jpconstantineau/dupectl/pkg/entities"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+)
+
+// RemoteBatchSize is the number of folders or files pushed per request
+const RemoteBatchSize = 500
+
+// remoteSink pushes scan results to a dupectl server in batches. Files are
+// pushed once hashed, after the folders holding them.
+type remoteSink struct {
+	client       *apiclient.Client
+	rootFolderID int64 // ID of the root on the server
+
+	mu      sync.Mutex
+	folders []entities.IngestFolder
+	files   []entities.IngestFile
+}
+
+// NewRemoteSink creates a sink pushing to the server root rootFolderID
+func NewRemoteSink(client *apiclient.Client, rootFolderID int64) Sink {
+	return &remoteSink{client: client, rootFolderID: rootFolderID}
+}
+
+func (s *remoteSink) Folder(ctx context.Context, folder *FolderInfo) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.folders = append(s.folders, entities.IngestFolder{
+		Path:        folder.Path,
+		ParentPath:  folder.ParentPath,
+		ErrorStatus: folder.ErrorStatus,
+	})
+	if len(s.folders) >= RemoteBatchSize {
+		return 0, s.flushFolders(ctx)
+	}
+	return 0, nil
+}
+
+func (s *remoteSink) Files(ctx context.Context, folderID int64, folderPath string, files []FileInfo) []FileRef {
+	refs := make([]FileRef, 0, len(files))
+	for _, file := range files {
+		refs = append(refs, FileRef{FolderPath: folderPath, Info: file})
+	}
+	return refs
+}
+
+func (s *remoteSink) Hashed(ctx context.Context, file FileRef, hashValue, algorithm string) error {
+	record := ingestFile(file)
+	record.HashValue = &hashValue
+	record.HashAlgorithm = &algorithm
+	return s.addFile(ctx, record)
+}
+
+func (s *remoteSink) HashFailed(ctx context.Context, file FileRef, hashErr error) error {
+	record := ingestFile(file)
+	errMsg := hashErr.Error()
+	record.ErrorStatus = &errMsg
+	return s.addFile(ctx, record)
+}
+
+func (s *remoteSink) Finish(ctx context.Context, sweep *Sweep) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.flushFiles(ctx); err != nil {
+		return err
+	}
+
+	// The server applies the elapsed time to its own clock, so the
+	// machines' clocks need not agree
+	var complete entities.IngestComplete
+	if sweep != nil {
+		complete.Sweep = sweep.Path
+		complete.ElapsedSeconds = int64(math.Ceil(sweep.Elapsed.Seconds()))
+	}
+	stats, err := s.client.CompleteIngest(ctx, s.rootFolderID, complete)
+	if err != nil {
+		return err
+	}
+	if sweep != nil {
+		logger.Info("Server marked %d folders and %d files no longer found as removed", stats.RemovedFolders, stats.RemovedFiles)
+	}
+	logger.Info("Server statistics updated: %d folders, %d files, %d bytes", stats.Folders, stats.Files, stats.TotalSize)
+	return nil
+}
+
+func ingestFile(file FileRef) entities.IngestFile {
+	return entities.IngestFile{
+		Path:       file.Info.Path,
+		FolderPath: file.FolderPath,
+		Size:       file.Info.Size,
+		Mtime:      file.Info.Mtime,
+	}
+}
+
+func (s *remoteSink) addFile(ctx context.Context, file entities.IngestFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files = append(s.files, file)
+	if len(s.files) >= RemoteBatchSize {
+		return s.flushFiles(ctx)
+	}
+	return nil
+}
+
+// flushFolders pushes the pending folders; the caller holds mu
+func (s *remoteSink) flushFolders(ctx context.Context) error {
+	if len(s.folders) == 0 {
+		return nil
+	}
+	if _, err := s.client.IngestFolders(ctx, s.rootFolderID, entities.IngestBatch{Folders: s.folders}); err != nil {
+		return err
+	}
+	logger.Debug("Pushed %d folders", len(s.folders))
+	s.folders = s.folders[:0]
+	return nil
+}
+
+// flushFiles pushes the pending files after any pending folders, which the
+// files may belong to; the caller holds mu
+func (s *remoteSink) flushFiles(ctx context.Context) error {
+	if err := s.flushFolders(ctx); err != nil {
+		return err
+	}
+	if len(s.files) == 0 {
+		return nil
+	}
+	if _, err := s.client.IngestFiles(ctx, s.rootFolderID, entities.IngestBatch{Files: s.files}); err != nil {
+		return err
+	}
+	logger.Debug("Pushed %d files", len(s.files))
+	s.files = s.files[:0]
+	return nil
+}
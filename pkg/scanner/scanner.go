@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
 	"time"
 
@@ -12,31 +14,40 @@ import (
 	"github.com/jpconstantineau/dupectl/pkg/datastore"
 	"github.com/jpconstantineau/dupectl/pkg/hash"
 	"github.com/jpconstantineau/dupectl/pkg/logger"
+	"github.com/jpconstantineau/dupectl/pkg/pathutil"
 )
 
 // Scanner orchestrates the scanning process
 type Scanner struct {
-	db            *sql.DB
-	rootFolderID  int64
-	rootPath      string
-	scanMode      string // "all", "folders", "files"
-	hasher        hash.Hasher
-	workerCount   int
-	progress      *ProgressIndicator
-	checkpointMgr *checkpoint.Manager
-	traverseLinks bool
+	db              *sql.DB
+	rootFolderID    int64
+	rootPath        string
+	startPath       string // Top of the scanned tree, the root unless scanning a subtree
+	scanMode        string // "all", "folders", "files"
+	hasher          hash.Hasher
+	workerCount     int
+	progress        *ProgressIndicator
+	checkpointMgr   *checkpoint.Manager
+	sink            Sink
+	traverseLinks   bool
+	caseInsensitive bool // Matches the root folder's filesystem
 }
 
 // Config holds scanner configuration
 type Config struct {
 	RootFolderID     int64
 	RootPath         string
+	StartPath        string // Folder under RootPath to scan instead of the whole root
 	ScanMode         string
 	HashAlgorithm    string
 	WorkerCount      int
 	ShowProgress     bool
 	ProgressInterval time.Duration
 	TraverseLinks    bool
+	CaseInsensitive  bool
+	// Sink receives the results; nil writes them to db. A scan pushing to
+	// a server passes a nil db and keeps no local checkpoint.
+	Sink Sink
 }
 
 // NewScanner creates a new scanner
@@ -57,22 +68,43 @@ func NewScanner(db *sql.DB, config *Config) (*Scanner, error) {
 	logger.Info("Scanner config: hash=%s, workers=%d, progress_interval=%v",
 		config.HashAlgorithm, workerCount, config.ProgressInterval)
 
+	sink := config.Sink
+	var checkpointMgr *checkpoint.Manager
+	if db != nil {
+		checkpointMgr = checkpoint.NewManager(db, config.RootFolderID, config.ScanMode)
+		if sink == nil {
+			sink = NewDBSink(db, config.RootFolderID)
+		}
+	}
+	if sink == nil {
+		return nil, fmt.Errorf("scanner needs a database or a sink")
+	}
+
+	startPath := config.StartPath
+	if startPath == "" {
+		startPath = config.RootPath
+	}
+
 	return &Scanner{
-		db:            db,
-		rootFolderID:  config.RootFolderID,
-		rootPath:      config.RootPath,
-		scanMode:      config.ScanMode,
-		hasher:        hasher,
-		workerCount:   workerCount,
-		progress:      NewProgressIndicator(config.ShowProgress, config.ProgressInterval),
-		checkpointMgr: checkpoint.NewManager(db, config.RootFolderID, config.ScanMode),
-		traverseLinks: config.TraverseLinks,
+		db:              db,
+		rootFolderID:    config.RootFolderID,
+		rootPath:        config.RootPath,
+		startPath:       startPath,
+		scanMode:        config.ScanMode,
+		hasher:          hasher,
+		workerCount:     workerCount,
+		progress:        NewProgressIndicator(config.ShowProgress, config.ProgressInterval),
+		checkpointMgr:   checkpointMgr,
+		sink:            sink,
+		traverseLinks:   config.TraverseLinks,
+		caseInsensitive: config.CaseInsensitive,
 	}, nil
 }
 
 // Scan performs the scan operation
 func (s *Scanner) Scan(ctx context.Context, restart bool) error {
-	logger.Info("Starting scan: mode=%s, root=%s", s.scanMode, s.rootPath)
+	logger.Info("Starting scan: mode=%s, root=%s", s.scanMode, s.startPath)
+	started := time.Now()
 
 	// Handle restart
 	var resuming bool
@@ -121,9 +153,20 @@ func (s *Scanner) Scan(ctx context.Context, restart bool) error {
 		return err
 	}
 
-	// Phase 3: Update root folder statistics
+	// A full scan that ran to the end saw every entry of its tree, so
+	// entries it did not see are gone
+	var sweep *Sweep
+	if s.scanMode == "all" && ctx.Err() == nil {
+		sweep = &Sweep{Path: pathutil.NormalizePathForStorage(s.startPath), Elapsed: time.Since(started)}
+	}
+
+	// Phase 3: Flush results and update root folder statistics
 	logger.Info("Phase 3: Updating statistics...")
-	if err := s.updateRootStatistics(); err != nil {
+	if err := s.sink.Finish(ctx, sweep); err != nil {
+		if s.db == nil {
+			// Results still pending for the server would be lost
+			return fmt.Errorf("failed to push results: %w", err)
+		}
 		logger.Error("Failed to update statistics: %v", err)
 		// Don't fail the scan if statistics update fails
 	}
@@ -141,38 +184,23 @@ func (s *Scanner) Scan(ctx context.Context, restart bool) error {
 func (s *Scanner) scanAll(ctx context.Context) error {
 	// Phase 1: Traverse folders and register files
 	logger.Info("Phase 1: Traversing folders...")
-	traverser := NewTraverser(s.db, s.rootFolderID, s.rootPath, s.traverseLinks)
 
 	// Collect files to hash
-	var filesToHash []struct {
-		ID   int64
-		Path string
-	}
+	var filesToHash []FileRef
 
-	err := traverser.Traverse(ctx, func(folderInfo *FolderInfo) error {
+	err := s.traverse(ctx, func(folderInfo *FolderInfo) error {
 		s.progress.IncrementFolders()
 
 		// Register folder and files
-		folderID, err := RegisterFolder(s.db, s.rootFolderID, folderInfo.Path,
-			folderInfo.ParentPath, folderInfo.ErrorStatus)
+		folderID, err := s.sink.Folder(ctx, folderInfo)
 		if err != nil {
 			logger.Error("Failed to register folder %s: %v", folderInfo.Path, err)
 			return err
 		}
 
 		// Register files
-		for _, fileInfo := range folderInfo.Files {
-			fileID, err := RegisterFile(s.db, folderID, s.rootFolderID, &fileInfo, nil)
-			if err != nil {
-				logger.Warn("Failed to register file %s: %v", fileInfo.Path, err)
-				continue
-			}
-
-			filesToHash = append(filesToHash, struct {
-				ID   int64
-				Path string
-			}{fileID, fileInfo.Path})
-
+		for _, file := range s.sink.Files(ctx, folderID, folderInfo.Path, folderInfo.Files) {
+			filesToHash = append(filesToHash, file)
 			s.progress.IncrementFiles()
 		}
 
@@ -193,9 +221,9 @@ func (s *Scanner) scanAll(ctx context.Context) error {
 	}
 
 	for _, file := range filesToHash {
-		workItem := NewFileHashingWorkItem(s.db, file.ID, file.Path, s.hasher, s.progress)
+		workItem := NewFileHashingWorkItem(s.sink, file, s.hasher, s.progress)
 		if err := hashPool.Submit(workItem); err != nil {
-			logger.Error("Failed to submit file %s for hashing: %v", file.Path, err)
+			logger.Error("Failed to submit file %s for hashing: %v", file.Info.Path, err)
 		}
 	}
 
@@ -214,14 +242,12 @@ func (s *Scanner) scanAll(ctx context.Context) error {
 // scanFolders performs folder traversal only (no hashing)
 func (s *Scanner) scanFolders(ctx context.Context) error {
 	logger.Info("Scanning folders only...")
-	traverser := NewTraverser(s.db, s.rootFolderID, s.rootPath, s.traverseLinks)
 
-	return traverser.Traverse(ctx, func(folderInfo *FolderInfo) error {
+	return s.traverse(ctx, func(folderInfo *FolderInfo) error {
 		s.progress.IncrementFolders()
 
 		// Register folder only
-		_, err := RegisterFolder(s.db, s.rootFolderID, folderInfo.Path,
-			folderInfo.ParentPath, folderInfo.ErrorStatus)
+		_, err := s.sink.Folder(ctx, folderInfo)
 		if err != nil {
 			logger.Error("Failed to register folder %s: %v", folderInfo.Path, err)
 			return err
@@ -236,6 +262,9 @@ func (s *Scanner) scanFolders(ctx context.Context) error {
 // scanFiles performs file hashing only (assumes folders exist)
 func (s *Scanner) scanFiles(ctx context.Context) error {
 	logger.Info("Scanning files only...")
+	if s.db == nil {
+		return fmt.Errorf("scanning files only needs the folders of the local catalog")
+	}
 
 	// Get all folders for this root
 	folders, err := datastore.GetFoldersByRootID(s.db, s.rootFolderID)
@@ -258,20 +287,14 @@ func (s *Scanner) scanFiles(ctx context.Context) error {
 	// For each folder, register files and hash them
 	for _, folder := range folders {
 		// Read directory
-		traverser := NewTraverser(s.db, s.rootFolderID, folder.Path, s.traverseLinks)
+		traverser := NewTraverser(s.db, s.rootFolderID, folder.Path, s.traverseLinks, s.caseInsensitive)
 
 		err := traverser.Traverse(ctx, func(folderInfo *FolderInfo) error {
 			// Register and hash files
-			for _, fileInfo := range folderInfo.Files {
-				fileID, err := RegisterFile(s.db, folder.ID, s.rootFolderID, &fileInfo, nil)
-				if err != nil {
-					logger.Warn("Failed to register file %s: %v", fileInfo.Path, err)
-					continue
-				}
-
-				workItem := NewFileHashingWorkItem(s.db, fileID, fileInfo.Path, s.hasher, s.progress)
+			for _, file := range s.sink.Files(ctx, folder.ID, folder.Path, folderInfo.Files) {
+				workItem := NewFileHashingWorkItem(s.sink, file, s.hasher, s.progress)
 				if err := hashPool.Submit(workItem); err != nil {
-					logger.Error("Failed to submit file %s for hashing: %v", fileInfo.Path, err)
+					logger.Error("Failed to submit file %s for hashing: %v", file.Info.Path, err)
 				}
 
 				s.progress.IncrementFiles()
@@ -293,46 +316,78 @@ func (s *Scanner) scanFiles(ctx context.Context) error {
 	return nil
 }
 
-// GetSummary returns scan summary statistics
-func (s *Scanner) GetSummary() (folders, files int64, duration string) {
-	f, fi, d := s.progress.Summary()
-	return f, fi, formatDuration(d)
+// traverse walks the scanned tree. The top folder of a subtree scan is
+// linked to its parent, registered by earlier scans of the root.
+func (s *Scanner) traverse(ctx context.Context, callback func(*FolderInfo) error) error {
+	var topParent *string
+	top := pathutil.NormalizePathForStorage(s.startPath)
+	if top != pathutil.NormalizePathForStorage(s.rootPath) {
+		parent := filepath.Dir(top)
+		topParent = &parent
+	}
+
+	traverser := NewTraverser(s.db, s.rootFolderID, s.startPath, s.traverseLinks, s.caseInsensitive)
+	return traverser.Traverse(ctx, func(folderInfo *FolderInfo) error {
+		if folderInfo.ParentPath == nil {
+			folderInfo.ParentPath = topParent
+		}
+		return callback(folderInfo)
+	})
 }
 
-// updateRootStatistics calculates and updates root folder statistics
-func (s *Scanner) updateRootStatistics() error {
-	// Calculate statistics from database
-	var folderCount, fileCount, totalSize int64
+// Rehash hashes the given files of the root again, e.g. after the server
+// found their hashes suspect. Files that no longer exist are skipped.
+func (s *Scanner) Rehash(ctx context.Context, paths []string) error {
+	logger.Info("Rehashing %d files of %s", len(paths), s.rootPath)
 
-	err := s.db.QueryRow("SELECT COUNT(*) FROM folders WHERE root_folder_id = ? AND removed = 0", s.rootFolderID).Scan(&folderCount)
-	if err != nil {
-		return fmt.Errorf("failed to count folders: %w", err)
-	}
+	s.progress.Start()
+	defer s.progress.Stop()
 
-	err = s.db.QueryRow("SELECT COUNT(*) FROM files WHERE root_folder_id = ? AND removed = 0", s.rootFolderID).Scan(&fileCount)
+	hashPool, err := worker.NewWorkerPool(ctx, s.workerCount)
 	if err != nil {
-		return fmt.Errorf("failed to count files: %w", err)
+		return fmt.Errorf("failed to create worker pool: %w", err)
 	}
 
-	err = s.db.QueryRow("SELECT COALESCE(SUM(size), 0) FROM files WHERE root_folder_id = ? AND removed = 0", s.rootFolderID).Scan(&totalSize)
-	if err != nil {
-		return fmt.Errorf("failed to calculate total size: %w", err)
-	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			logger.Warn("Skipping %s: not a readable file", path)
+			continue
+		}
+		file := FileInfo{Path: pathutil.NormalizePathForStorage(path), Size: info.Size(), Mtime: info.ModTime().Unix()}
+		folderPath := filepath.Dir(file.Path)
 
-	// Update root folder statistics
-	_, err = s.db.Exec(`
-		UPDATE root_folders 
-		SET folder_count = ?, 
-			file_count = ?, 
-			total_size = ?, 
-			last_scan_date = CURRENT_TIMESTAMP
-		WHERE id = ?
-	`, folderCount, fileCount, totalSize, s.rootFolderID)
+		// The local catalog needs the ID of the file's folder
+		var folderID int64
+		if s.db != nil {
+			folder, err := datastore.GetFolderByPath(s.db, s.rootFolderID, folderPath)
+			if err != nil {
+				logger.Warn("Skipping %s: folder not scanned yet", path)
+				continue
+			}
+			folderID = folder.ID
+		}
 
-	if err != nil {
-		return fmt.Errorf("failed to update statistics: %w", err)
+		for _, ref := range s.sink.Files(ctx, folderID, folderPath, []FileInfo{file}) {
+			if err := hashPool.Submit(NewFileHashingWorkItem(s.sink, ref, s.hasher, s.progress)); err != nil {
+				logger.Error("Failed to submit file %s for hashing: %v", path, err)
+			}
+			s.progress.IncrementFiles()
+		}
 	}
 
-	logger.Info("Statistics updated: %d folders, %d files, %d bytes", folderCount, fileCount, totalSize)
-	return nil
+	hashErrors := hashPool.Wait()
+	if len(hashErrors) > 0 {
+		logger.Warn("Rehashing completed with %d errors", len(hashErrors))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.sink.Finish(ctx, nil)
+}
+
+// GetSummary returns scan summary statistics
+func (s *Scanner) GetSummary() (folders, files int64, duration string) {
+	f, fi, d := s.progress.Summary()
+	return f, fi, formatDuration(d)
 }
@@ -0,0 +1,115 @@
+package scanner
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jpconstantineau/dupectl/pkg/datastore"
+	"github.com/jpconstantineau/dupectl/pkg/errors"
+	"github.com/jpconstantineau/dupectl/pkg/logger"
+)
+
+// Sink receives what a scan discovers. The local sink writes to the catalog
+// database; the remote sink pushes batches to a dupectl server.
+// Hashed and HashFailed are called concurrently by the hashing workers.
+type Sink interface {
+	// Folder records a folder and returns its catalog ID, or 0 when the ID
+	// is assigned later by the server
+	Folder(ctx context.Context, folder *FolderInfo) (int64, error)
+	// Files registers the files of a folder before they are hashed. Files
+	// that cannot be registered are logged and left out of the result.
+	Files(ctx context.Context, folderID int64, folderPath string, files []FileInfo) []FileRef
+	// Hashed records the hash of a registered file
+	Hashed(ctx context.Context, file FileRef, hashValue, algorithm string) error
+	// HashFailed records why a registered file could not be hashed
+	HashFailed(ctx context.Context, file FileRef, hashErr error) error
+	// Finish flushes pending records and refreshes the root's statistics.
+	// With a sweep, catalogued entries the scan did not see are marked removed.
+	Finish(ctx context.Context, sweep *Sweep) error
+}
+
+// Sweep describes a completed traversal of the tree at Path, started
+// Elapsed ago: any catalogued entry beneath Path that it did not see since
+// then no longer exists
+type Sweep struct {
+	Path    string
+	Elapsed time.Duration
+}
+
+// Since returns the Unix time before which entries were not seen by the
+// scan, given the catalog's current time. A second of margin absorbs the
+// truncation of catalog timestamps to whole seconds.
+func (s *Sweep) Since(now time.Time) int64 {
+	return now.Add(-s.Elapsed).Unix() - 1
+}
+
+// FileRef is a registered file waiting for its hash
+type FileRef struct {
+	ID         int64 // Catalog ID, or 0 when assigned by the server
+	FolderPath string
+	Info       FileInfo
+}
+
+// dbSink writes scan results to the local catalog
+type dbSink struct {
+	db           *sql.DB
+	rootFolderID int64
+}
+
+// NewDBSink creates a sink writing to the local catalog
+func NewDBSink(db *sql.DB, rootFolderID int64) Sink {
+	return &dbSink{db: db, rootFolderID: rootFolderID}
+}
+
+func (s *dbSink) Folder(ctx context.Context, folder *FolderInfo) (int64, error) {
+	return RegisterFolder(s.db, s.rootFolderID, folder.Path, folder.ParentPath, folder.ErrorStatus)
+}
+
+func (s *dbSink) Files(ctx context.Context, folderID int64, folderPath string, files []FileInfo) []FileRef {
+	refs := make([]FileRef, 0, len(files))
+	for i := range files {
+		fileID, err := RegisterFile(s.db, folderID, s.rootFolderID, &files[i], nil)
+		if err != nil {
+			logger.Warn("Failed to register file %s: %v", files[i].Path, err)
+			continue
+		}
+		refs = append(refs, FileRef{ID: fileID, FolderPath: folderPath, Info: files[i]})
+	}
+	return refs
+}
+
+func (s *dbSink) Hashed(ctx context.Context, file FileRef, hashValue, algorithm string) error {
+	if err := datastore.UpdateFileHash(s.db, file.ID, hashValue, algorithm); err != nil {
+		return errors.NewDatabaseError("update file hash", err)
+	}
+	return nil
+}
+
+func (s *dbSink) HashFailed(ctx context.Context, file FileRef, hashErr error) error {
+	if err := datastore.SetFileError(s.db, file.ID, hashErr.Error()); err != nil {
+		return errors.NewDatabaseError("update file error status", err)
+	}
+	return nil
+}
+
+func (s *dbSink) Finish(ctx context.Context, sweep *Sweep) error {
+	if sweep != nil {
+		root, err := datastore.GetRootFolder(s.db, s.rootFolderID)
+		if err != nil {
+			return err
+		}
+		folders, files, err := datastore.MarkUnseenRemoved(s.db, root, sweep.Path, sweep.Since(time.Now()))
+		if err != nil {
+			return err
+		}
+		logger.Info("Marked %d folders and %d files no longer found as removed", folders, files)
+	}
+
+	folders, files, size, err := datastore.RefreshRootFolderStats(s.db, s.rootFolderID)
+	if err != nil {
+		return err
+	}
+	logger.Info("Statistics updated: %d folders, %d files, %d bytes", folders, files, size)
+	return nil
+}
@@ -15,19 +15,25 @@ import (
 
 // Traverser handles folder tree traversal
 type Traverser struct {
-	db            *sql.DB
-	rootFolderID  int64
-	rootPath      string
-	traverseLinks bool
+	db              *sql.DB
+	rootFolderID    int64
+	rootPath        string
+	traverseLinks   bool
+	caseInsensitive bool
+	visited         map[string]bool
 }
 
 // NewTraverser creates a folder traverser
-func NewTraverser(db *sql.DB, rootFolderID int64, rootPath string, traverseLinks bool) *Traverser {
+// caseInsensitive must match the root's filesystem so that directories
+// reached under differently-cased names are only visited once
+func NewTraverser(db *sql.DB, rootFolderID int64, rootPath string, traverseLinks, caseInsensitive bool) *Traverser {
 	return &Traverser{
-		db:            db,
-		rootFolderID:  rootFolderID,
-		rootPath:      filepath.Clean(rootPath),
-		traverseLinks: traverseLinks,
+		db:              db,
+		rootFolderID:    rootFolderID,
+		rootPath:        filepath.Clean(rootPath),
+		traverseLinks:   traverseLinks,
+		caseInsensitive: caseInsensitive,
+		visited:         make(map[string]bool),
 	}
 }
 
@@ -67,6 +73,14 @@ func (t *Traverser) traverseDir(ctx context.Context, dirPath string, parentPath
 		}
 	}
 
+	// Skip directories already visited under an equivalent path
+	visitKey := pathutil.NormalizePathForComparison(dirPath, t.caseInsensitive)
+	if t.visited[visitKey] {
+		logger.Debug("Skipping already visited folder: %s", dirPath)
+		return nil
+	}
+	t.visited[visitKey] = true
+
 	folderInfo := &FolderInfo{
 		Path:       pathutil.NormalizePathForStorage(dirPath),
 		ParentPath: parentPath,
@@ -94,6 +108,10 @@ func (t *Traverser) traverseDir(ctx context.Context, dirPath string, parentPath
 		entryPath := pathutil.NormalizePathForStorage(pathutil.Join(dirPath, entry.Name()))
 
 		if entry.IsDir() {
+			if dirPath == t.rootPath && entry.Name() == pathutil.QuarantineDirName {
+				logger.Debug("Skipping quarantine folder: %s", entryPath)
+				continue
+			}
 			subdirs = append(subdirs, entryPath)
 		} else {
 			// Get file info
@@ -127,13 +145,13 @@ func (t *Traverser) traverseDir(ctx context.Context, dirPath string, parentPath
 }
 
 // RegisterFolder registers a folder in the database
-func RegisterFolder(db *sql.DB, rootFolderID int64, folderPath string, parentPath *string, errorStatus *string) (int64, error) {
+func RegisterFolder(db datastore.Querier, rootFolderID int64, folderPath string, parentPath *string, errorStatus *string) (int64, error) {
 	now := time.Now().Unix()
 
 	// Get parent folder ID if parent exists
 	var parentFolderID *int64
 	if parentPath != nil {
-		parent, err := datastore.GetFolderByPath(db, *parentPath)
+		parent, err := datastore.GetFolderByPath(db, rootFolderID, *parentPath)
 		if err != nil && err != sql.ErrNoRows {
 			return 0, errors.NewDatabaseError("get parent folder", err)
 		}
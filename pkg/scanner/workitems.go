@@ -2,35 +2,30 @@ package scanner
 
 import (
 	"context"
-	"database/sql"
 
-	"github.com/jpconstantineau/dupectl/pkg/datastore"
-	"github.com/jpconstantineau/dupectl/pkg/errors"
 	"github.com/jpconstantineau/dupectl/pkg/hash"
 	"github.com/jpconstantineau/dupectl/pkg/logger"
 )
 
 // FileHashingWorkItem processes file hashing
 type FileHashingWorkItem struct {
-	db       *sql.DB
-	fileID   int64
-	filePath string
+	sink     Sink
+	file     FileRef
 	hasher   hash.Hasher
 	progress *ProgressIndicator
 }
 
 // NewFileHashingWorkItem creates a file hashing work item
-func NewFileHashingWorkItem(db *sql.DB, fileID int64, filePath string, hasher hash.Hasher, progress *ProgressIndicator) *FileHashingWorkItem {
+func NewFileHashingWorkItem(sink Sink, file FileRef, hasher hash.Hasher, progress *ProgressIndicator) *FileHashingWorkItem {
 	return &FileHashingWorkItem{
-		db:       db,
-		fileID:   fileID,
-		filePath: filePath,
+		sink:     sink,
+		file:     file,
 		hasher:   hasher,
 		progress: progress,
 	}
 }
 
-// Process calculates file hash and updates database
+// Process calculates file hash and records it in the sink
 func (w *FileHashingWorkItem) Process(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
@@ -39,28 +34,22 @@ func (w *FileHashingWorkItem) Process(ctx context.Context) error {
 	}
 
 	// Calculate hash
-	hashValue, err := w.hasher.Hash(ctx, w.filePath)
+	filePath := w.file.Info.Path
+	hashValue, err := w.hasher.Hash(ctx, filePath)
 	if err != nil {
-		logger.Warn("Failed to hash file %s: %v", w.filePath, err)
+		logger.Warn("Failed to hash file %s: %v", filePath, err)
 
-		// Update file with error status
-		errMsg := err.Error()
-		_, updateErr := datastore.InsertFile(w.db, &datastore.File{
-			ID:          w.fileID,
-			Path:        w.filePath,
-			ErrorStatus: &errMsg,
-		})
-		if updateErr != nil {
-			return errors.NewDatabaseError("update file error status", updateErr)
+		// Record the error status
+		if recordErr := w.sink.HashFailed(ctx, w.file, err); recordErr != nil {
+			return recordErr
 		}
 		return nil // Don't fail worker pool
 	}
 
-	// Update database with hash
-	err = datastore.UpdateFileHash(w.db, w.fileID, hashValue, w.hasher.Algorithm())
-	if err != nil {
-		logger.Error("Failed to update hash for %s: %v", w.filePath, err)
-		return errors.NewDatabaseError("update file hash", err)
+	// Record the hash
+	if err := w.sink.Hashed(ctx, w.file, hashValue, w.hasher.Algorithm()); err != nil {
+		logger.Error("Failed to record hash for %s: %v", filePath, err)
+		return err
 	}
 
 	// Update progress
@@ -68,11 +57,11 @@ func (w *FileHashingWorkItem) Process(ctx context.Context) error {
 		w.progress.IncrementFilesHashed()
 	}
 
-	logger.Debug("Hashed file %s: %s", w.filePath, hashValue[:16]+"...")
+	logger.Debug("Hashed file %s: %s", filePath, hashValue[:16]+"...")
 	return nil
 }
 
 // ID returns work item identifier
 func (w *FileHashingWorkItem) ID() string {
-	return w.filePath
+	return w.file.Info.Path
 }
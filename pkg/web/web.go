@@ -10,12 +10,13 @@ import (
 //go:embed static
 var embeddedFiles embed.FS
 
-func SetupStaticWeb() {
+// Handler serves the embedded web page
+func Handler() http.Handler {
 
 	fstatic, err := fs.Sub(embeddedFiles, "static")
 	if err != nil {
 		panic(err)
 	}
-	http.Handle("/", http.FileServer(http.FS(fstatic)))
+	return http.FileServer(http.FS(fstatic))
 
 }